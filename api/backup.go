@@ -6,21 +6,55 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"go.uber.org/zap"
 
 	"github.com/spinup-host/spinup/config"
 	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
 	"github.com/spinup-host/spinup/utils"
 )
 
 // createBackupRequest holds the parameters needed to create a backup
 type createBackupRequest struct {
-	ClusterID    string `json:"cluster_id"`
-	Name         string `json:"name"`
-	ApiKeyID     string `json:"api_key_id"`
-	ApiKeySecret string `json:"api_key_secret"`
-	BucketName   string `json:"bucket_name"`
+	ClusterID string `json:"cluster_id"`
+	// Name is the destination of older versions of the API, which only supported "AWS", an s3 destination.
+	Name string `json:"name"`
+	backupDestination
+}
+
+// backupDestination holds the settings of a backup destination.
+type backupDestination struct {
+	// Type is the type of the destination: s3, gcs, azure or file.
+	Type           string `json:"type"`
+	ApiKeyID       string `json:"api_key_id"`
+	ApiKeySecret   string `json:"api_key_secret"`
+	BucketName     string `json:"bucket_name"`
+	Path           string `json:"path"`
+	Endpoint       string `json:"endpoint"`
+	Region         string `json:"region"`
+	ForcePathStyle bool   `json:"force_path_style"`
+}
+
+func (d backupDestination) destination() metastore.Destination {
+	return metastore.Destination{
+		Type:           d.Type,
+		BucketName:     d.BucketName,
+		Path:           d.Path,
+		ApiKeyID:       d.ApiKeyID,
+		ApiKeySecret:   d.ApiKeySecret,
+		Endpoint:       d.Endpoint,
+		Region:         d.Region,
+		ForcePathStyle: d.ForcePathStyle,
+	}
+}
+
+// triggerBackupRequest holds the parameters needed to take a backup now. Without a destination, the backup goes to
+// the cluster's backup destination.
+type triggerBackupRequest struct {
+	ClusterID   string             `json:"cluster_id"`
+	Destination *backupDestination `json:"destination"`
 }
 
 type BackupHandler struct {
@@ -42,10 +76,7 @@ func (b BackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
 		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "invalid method"})
 		return
 	}
-	authHeader := r.Header.Get("Authorization")
-	apiKeyHeader := r.Header.Get("x-api-key")
-	var err error
-	_, err = ValidateUser(b.appConfig, authHeader, apiKeyHeader)
+	user, err := authenticate(b.appConfig, r)
 	if err != nil {
 		b.logger.Error("Failed to validate user", zap.Error(err))
 		respond(http.StatusUnauthorized, w, map[string]string{
@@ -77,23 +108,128 @@ func (b BackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	backupCfg := metastore.BackupConfig{
-		Dest: metastore.Destination{
-			Name:         s.Name,
-			BucketName:   s.BucketName,
-			ApiKeyID:     s.ApiKeyID,
-			ApiKeySecret: s.ApiKeySecret,
-		},
+	backupCfg := metastore.BackupConfig{Dest: s.destination()}
+	if backupCfg.Dest.Type == "" && s.Name == "AWS" {
+		backupCfg.Dest.Type = metastore.DestinationS3
 	}
 
-	if err := b.backupService.CreateBackup(r.Context(), s.ClusterID, backupCfg); err != nil {
+	if err := b.backupService.CreateBackup(r.Context(), user, s.ClusterID, backupCfg); err != nil {
 		b.logger.Error("failed to create backup", zap.Error(err))
+		if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+			return
+		}
+		if errors.As(err, &service.ErrUnsupportedEngine{}) || errors.As(err, &service.ErrInvalidSchedule{}) ||
+			errors.As(err, &service.ErrInvalidDestination{}) {
+			respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+			return
+		}
 		respond(http.StatusInternalServerError, w, map[string]string{"message": err.Error()})
 		return
 	}
 	respond(http.StatusOK, w, map[string]string{"message": "successfully scheduled backup"})
 }
 
+// TriggerBackup takes a backup of a cluster now. The backup runs in the background: the response is the backup
+// operation, whose progress is polled with GetOperation.
+func (b BackupHandler) TriggerBackup(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "invalid method"})
+		return
+	}
+	user, err := authenticate(b.appConfig, r)
+	if err != nil {
+		b.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+	var s triggerBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		b.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+	var dest *metastore.Destination
+	if s.Destination != nil {
+		d := s.Destination.destination()
+		dest = &d
+	}
+
+	op, err := b.backupService.TriggerBackup(r.Context(), user, s.ClusterID, dest)
+	if err != nil {
+		b.logger.Error("failed to trigger backup", zap.Error(err))
+		switch {
+		case errors.As(err, &service.ErrNoMatch{}):
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		case errors.Is(err, service.ErrBackupRunning):
+			respond(http.StatusConflict, w, map[string]string{"message": err.Error()})
+		case errors.As(err, &service.ErrUnsupportedEngine{}), errors.As(err, &service.ErrInvalidDestination{}),
+			errors.As(err, &service.ErrNoBackupDestination{}):
+			respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+		default:
+			respond(http.StatusInternalServerError, w, map[string]string{"message": err.Error()})
+		}
+		return
+	}
+	respond(http.StatusAccepted, w, op)
+}
+
+// defaultBackupRunLimit is the number of backup runs listed when no limit is given.
+const defaultBackupRunLimit = 20
+
+// BackupRuns returns the latest backup runs of the cluster given by the cluster_id query parameter, newest first, with
+// the health of its backups. limit sets the number of runs (20 by default).
+func (b BackupHandler) BackupRuns(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "invalid method"})
+		return
+	}
+	user, err := authenticate(b.appConfig, r)
+	if err != nil {
+		b.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+	query := r.URL.Query()
+	clusterID := query.Get("cluster_id")
+	if clusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+	limit := defaultBackupRunLimit
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			respond(http.StatusBadRequest, w, map[string]string{"message": fmt.Sprintf("invalid limit '%s'", l)})
+			return
+		}
+	}
+	var logs bool
+	if l := query.Get("logs"); l != "" {
+		logs, err = strconv.ParseBool(l)
+		if err != nil {
+			respond(http.StatusBadRequest, w, map[string]string{"message": fmt.Sprintf("invalid logs '%s'", l)})
+			return
+		}
+	}
+
+	history, err := b.backupService.BackupHistory(r.Context(), user, clusterID, limit, logs)
+	if errors.As(err, &service.ErrNoMatch{}) {
+		respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		return
+	}
+	if err != nil {
+		b.logger.Error("failed to list backup runs", zap.Error(err))
+		respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to list backup runs"})
+		return
+	}
+	respond(http.StatusOK, w, history)
+}
+
 type logicError struct {
 	err error
 }
@@ -102,19 +238,13 @@ func (l logicError) Error() string {
 	return fmt.Sprintf("logic error %v", l.err)
 }
 
+// backupDataValidation checks the request; the destination is validated by the backup service.
 func backupDataValidation(s createBackupRequest) error {
 	if s.ClusterID == "" {
-		return errors.New("no cluster specified as a backup target")
-	}
-
-	if s.Name != "AWS" {
-		return logicError{err: errors.New("destination other than AWS is not supported")}
-	}
-	if s.ApiKeyID == "" || s.ApiKeySecret == "" {
-		return errors.New("api key id and api key secret is mandatory")
+		return logicError{err: errors.New("no cluster specified as a backup target")}
 	}
-	if s.BucketName == "" {
-		return errors.New("bucket name is mandatory")
+	if s.Type == "" && s.Name != "" && s.Name != "AWS" {
+		return logicError{err: errors.New("destination other than AWS is not supported, set type instead of name")}
 	}
 	return nil
 }
@@ -4,15 +4,23 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	_ "modernc.org/sqlite"
 
 	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/internal/export"
 	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
 	"github.com/spinup-host/spinup/misc"
 )
 
@@ -39,7 +47,19 @@ type dbCluster struct {
 
 	Memory     int64  `json:"memory,omitempty"`
 	CPU        int64  `json:"cpu,omitempty"`
+	Disk       int64  `json:"disk,omitempty"`
 	Monitoring string `json:"monitoring"`
+	// Image overrides the default postgres image, subject to the registry allow and deny lists.
+	Image string `json:"image,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// TTL (e.g. "2h30m") or ExpiresAt make the cluster ephemeral: it's deleted automatically once it expires.
+	TTL       string     `json:"ttl,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// IdleTimeout (e.g. "30m") stops the cluster after it has had no client connections for that long.
+	IdleTimeout string `json:"idle_timeout,omitempty"`
 }
 
 // CreateCluster creates a new database with the provided parameters.
@@ -48,10 +68,7 @@ func (c ClusterHandler) CreateCluster(w http.ResponseWriter, req *http.Request)
 		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
 		return
 	}
-	authHeader := req.Header.Get("Authorization")
-	apiKeyHeader := req.Header.Get("x-api-key")
-	var err error
-	_, err = ValidateUser(c.appConfig, authHeader, apiKeyHeader)
+	user, err := authenticate(c.appConfig, req)
 	if err != nil {
 		c.logger.Error("Failed to validate user", zap.Error(err))
 		respond(http.StatusUnauthorized, w, map[string]string{
@@ -75,11 +92,17 @@ func (c ClusterHandler) CreateCluster(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	if s.Db.Type != "postgres" {
-		c.logger.Error("unsupported database type")
-		respond(http.StatusBadRequest, w, map[string]string{"message": "Provided database type is not supported"})
+	expiresAt, err := parseExpiry(s.Db.TTL, s.Db.ExpiresAt, time.Now())
+	if err != nil {
+		respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
 		return
 	}
+	idleTimeout, err := parseIdleTimeout(s.Db.IdleTimeout)
+	if err != nil {
+		respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+		return
+	}
+
 	port, err := misc.PortCheck(c.appConfig.Common.Ports[0], c.appConfig.Common.Ports[len(c.appConfig.Common.Ports)-1])
 	if err != nil {
 		c.logger.Error("port issue", zap.Error(err))
@@ -87,11 +110,13 @@ func (c ClusterHandler) CreateCluster(w http.ResponseWriter, req *http.Request)
 		return
 	}
 	s.Architecture = c.appConfig.Common.Architecture
+	s.UserID = user.ID
 
 	cluster := metastore.ClusterInfo{
 		Architecture: s.Architecture,
 		Type:         s.Db.Type,
 		Host:         "localhost",
+		Owner:        s.UserID,
 		Name:         s.Db.Name,
 		Username:     s.Db.Username,
 		Password:     s.Db.Password,
@@ -99,35 +124,102 @@ func (c ClusterHandler) CreateCluster(w http.ResponseWriter, req *http.Request)
 		MajVersion:   int(s.Version.Maj),
 		MinVersion:   int(s.Version.Min),
 		Monitoring:   s.Db.Monitoring,
+		CPU:          s.Db.CPU,
+		Memory:       s.Db.Memory,
+		Disk:         s.Db.Disk,
+		Labels:       s.Db.Labels,
+		ExpiresAt:    expiresAt,
+		IdleTimeout:  int64(idleTimeout / time.Second),
+		Image:        s.Db.Image,
 	}
 
-	if cluster.MajVersion <= 9 {
+	if (cluster.Type == "" || cluster.Type == "postgres") && cluster.MajVersion <= 9 {
 		respond(http.StatusBadRequest, w, map[string]string{"message": "Unsupported Postgres version. Minimum supported major version is v9"})
 		return
 	}
-	if err := c.svc.CreateService(req.Context(), &cluster); err != nil {
+	if cluster.MajVersion <= 0 {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "version is required"})
+		return
+	}
+	if req.URL.Query().Get("stream") == "true" {
+		c.createClusterStream(w, req, user, cluster)
+		return
+	}
+	if err := c.svc.CreateService(req.Context(), user, &cluster); err != nil {
 		c.logger.Error("failed to add create service", zap.Error(err))
-		if errors.Is(err, dockerservice.ErrDuplicateContainerName) {
-			respond(http.StatusBadRequest, w, map[string]string{"message": "container with provided name already exists"})
-		} else {
-			respond(http.StatusBadRequest, w, map[string]string{"message": "failed to add service"})
-		}
+		status, message := createErrorResponse(err)
+		respond(status, w, map[string]string{"message": message})
 		return
 	}
 	respond(http.StatusOK, w, cluster)
 	return
 }
 
+// createClusterStream creates a cluster and streams the progress of the image pull as newline-delimited JSON objects
+// of the form {"progress": {...}}, followed by either {"data": cluster} or {"message": "...", "status": code}.
+// Since the response status is sent before the cluster is created, errors are only reported in the last object.
+func (c ClusterHandler) createClusterStream(w http.ResponseWriter, req *http.Request, user service.User, cluster metastore.ClusterInfo) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respond(http.StatusInternalServerError, w, map[string]string{"message": "streaming is not supported"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	send := func(v interface{}) {
+		if err := enc.Encode(v); err != nil {
+			c.logger.Warn("failed to stream create progress", zap.Error(err))
+			return
+		}
+		flusher.Flush()
+	}
+
+	ctx := dockerservice.WithPullProgress(req.Context(), func(progress dockerservice.PullProgress) {
+		send(map[string]interface{}{"progress": progress})
+	})
+	if err := c.svc.CreateService(ctx, user, &cluster); err != nil {
+		c.logger.Error("failed to add create service", zap.Error(err))
+		status, message := createErrorResponse(err)
+		send(map[string]interface{}{"message": message, "status": status})
+		return
+	}
+	send(map[string]interface{}{"data": cluster})
+}
+
+// createErrorResponse returns the status code and message to respond with when creating a cluster fails.
+func createErrorResponse(err error) (int, string) {
+	quotaErr := service.ErrQuotaExceeded{}
+	labelErr := service.ErrInvalidLabel{}
+	imageErr := service.ErrImageNotAllowed{}
+	engineErr := service.ErrUnsupportedEngine{}
+	switch {
+	case errors.As(err, &quotaErr):
+		return http.StatusForbidden, quotaErr.Error()
+	case errors.As(err, &imageErr):
+		return http.StatusForbidden, imageErr.Error()
+	case errors.As(err, &labelErr):
+		return http.StatusBadRequest, labelErr.Error()
+	case errors.As(err, &engineErr):
+		return http.StatusBadRequest, engineErr.Error()
+	case errors.Is(err, service.ErrInvalidExpiry) || errors.Is(err, service.ErrInvalidIdleTimeout):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, dockerservice.ErrDuplicateContainerName):
+		return http.StatusBadRequest, "container with provided name already exists"
+	case errors.As(err, &engine.ErrInvalidCredentials{}), errors.As(err, &engine.ErrVolumeInUse{}):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return http.StatusBadRequest, "failed to add service"
+	}
+}
+
 func (c ClusterHandler) ListCluster(w http.ResponseWriter, req *http.Request) {
 	if (*req).Method != "GET" {
 		respond(http.StatusMethodNotAllowed, w, map[string]string{
 			"message": "Invalid Method"})
 		return
 	}
-	authHeader := req.Header.Get("Authorization")
-	apiKeyHeader := req.Header.Get("x-api-key")
-	var err error
-	_, err = ValidateUser(c.appConfig, authHeader, apiKeyHeader)
+	user, err := authenticate(c.appConfig, req)
 	if err != nil {
 		c.logger.Error("validating user", zap.Error(err))
 		respond(http.StatusUnauthorized, w, map[string]string{
@@ -135,18 +227,86 @@ func (c ClusterHandler) ListCluster(w http.ResponseWriter, req *http.Request) {
 		})
 		return
 	}
-	clustersInfo, err := c.svc.ListClusters(req.Context())
+	filter, err := parseClusterFilter(req.URL.Query())
 	if err != nil {
+		respond(http.StatusBadRequest, w, map[string]string{
+			"message": err.Error(),
+		})
+		return
+	}
+	page, err := c.svc.ListClusters(req.Context(), user, filter)
+	if errors.Is(err, metastore.ErrInvalidCursor) {
+		respond(http.StatusBadRequest, w, map[string]string{
+			"message": "invalid cursor",
+		})
+		return
+	} else if err != nil {
 		c.logger.Error("failed to list clusters", zap.Error(err))
 		respond(http.StatusInternalServerError, w, map[string]string{
 			"message": "Failed to list clusters",
 		})
 		return
 	}
-	respond(http.StatusOK, w, clustersInfo)
+	if page.NextCursor != "" {
+		w.Header().Set(nextCursorHeader, page.NextCursor)
+	}
+	clusters := page.Clusters
+	// passwords are only listed when asked for, so that listing clusters doesn't spread them.
+	if req.URL.Query().Get("include_secrets") != "true" {
+		clusters = make([]metastore.ClusterInfo, len(page.Clusters))
+		for i, cluster := range page.Clusters {
+			cluster.Password = ""
+			clusters[i] = cluster
+		}
+	}
+	respond(http.StatusOK, w, clusters)
 	return
 }
 
+// nextCursorHeader holds the cursor for the next page when listing clusters. It isn't set on the last page.
+const nextCursorHeader = "X-Next-Cursor"
+
+// parseClusterFilter builds a cluster filter from the ListCluster query parameters:
+// label (comma-separated key=value or key selectors, may be repeated), name_prefix, status, version (major or
+// major.minor), owner, limit and cursor.
+func parseClusterFilter(query url.Values) (metastore.ClusterFilter, error) {
+	filter := metastore.ClusterFilter{
+		Owner:      query.Get("owner"),
+		NamePrefix: query.Get("name_prefix"),
+		Status:     query.Get("status"),
+		Cursor:     query.Get("cursor"),
+	}
+	for _, l := range query["label"] {
+		selectors, err := metastore.ParseLabelSelectors(l)
+		if err != nil {
+			return filter, err
+		}
+		filter.Labels = append(filter.Labels, selectors...)
+	}
+	if v := query.Get("version"); v != "" {
+		maj, min, hasMin := strings.Cut(v, ".")
+		var err error
+		if filter.MajVersion, err = strconv.Atoi(maj); err != nil {
+			return filter, fmt.Errorf("invalid version '%s'", v)
+		}
+		if hasMin {
+			minVersion, err := strconv.Atoi(min)
+			if err != nil {
+				return filter, fmt.Errorf("invalid version '%s'", v)
+			}
+			filter.MinVersion = &minVersion
+		}
+	}
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 0 {
+			return filter, fmt.Errorf("invalid limit '%s'", l)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
 func (c ClusterHandler) GetCluster(w http.ResponseWriter, r *http.Request) {
 	if (*r).Method != "GET" {
 		respond(http.StatusMethodNotAllowed, w, map[string]interface{}{
@@ -155,10 +315,7 @@ func (c ClusterHandler) GetCluster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// todo (idoqo): move auth stuff to a "middleware"
-	authHeader := r.Header.Get("Authorization")
-	apiKeyHeader := r.Header.Get("x-api-key")
-	var err error
-	_, err = ValidateUser(c.appConfig, authHeader, apiKeyHeader)
+	user, err := authenticate(c.appConfig, r)
 	if err != nil {
 		c.logger.Error("validating user", zap.Error(err))
 		respond(http.StatusInternalServerError, w, map[string]interface{}{
@@ -175,15 +332,16 @@ func (c ClusterHandler) GetCluster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ci, err := c.svc.GetClusterByID(r.Context(), clusterId)
+	ci, err := c.svc.GetClusterByID(r.Context(), user, clusterId)
 	if errors.Is(err, fs.ErrNotExist) {
 		c.logger.Error("no database file", zap.Error(err))
 		respond(http.StatusInternalServerError, w, map[string]interface{}{
 			"message": "sqlite database was not found",
 		})
+		return
 	}
 
-	if err == sql.ErrNoRows {
+	if err == sql.ErrNoRows || errors.As(err, &service.ErrNoMatch{}) {
 		respond(http.StatusNotFound, w, map[string]interface{}{
 			"message": "no cluster found with matching id",
 		})
@@ -200,3 +358,422 @@ func (c ClusterHandler) GetCluster(w http.ResponseWriter, r *http.Request) {
 		"data": ci,
 	})
 }
+
+// resizeClusterRequest holds the new resources for a cluster. CPU is in CPU shares, memory and disk in megabytes.
+type resizeClusterRequest struct {
+	ClusterID string `json:"cluster_id"`
+	Memory    int64  `json:"memory"`
+	CPU       int64  `json:"cpu"`
+	Disk      int64  `json:"disk"`
+}
+
+// ResizeCluster changes the resources allocated to an existing cluster.
+func (c ClusterHandler) ResizeCluster(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+
+	var s resizeClusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		c.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+	if s.Memory < 0 || s.CPU < 0 || s.Disk < 0 {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "resources cannot be negative"})
+		return
+	}
+
+	resources := service.Resources{CPU: s.CPU, Memory: s.Memory, Disk: s.Disk}
+	ci, err := c.svc.ResizeCluster(r.Context(), user, s.ClusterID, resources)
+	if err != nil {
+		c.logger.Error("failed to resize cluster", zap.Error(err))
+		quotaErr := service.ErrQuotaExceeded{}
+		if errors.As(err, &quotaErr) {
+			respond(http.StatusForbidden, w, map[string]string{"message": quotaErr.Error()})
+		} else if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		} else {
+			respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to resize cluster"})
+		}
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": ci,
+	})
+}
+
+// GetQuota shows the resources used by the current user against their quota. Admins can look up any user by
+// passing a user_id query parameter.
+func (c ClusterHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "method not allowed"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("validating user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	userID := user.ID
+	if requested := r.URL.Query().Get("user_id"); requested != "" && requested != user.ID {
+		if !user.Admin {
+			respond(http.StatusForbidden, w, map[string]string{"message": "only admins can view quotas of other users"})
+			return
+		}
+		userID = requested
+	}
+
+	report, err := c.svc.QuotaUsage(r.Context(), userID)
+	if err != nil {
+		c.logger.Error("failed to get quota usage", zap.Error(err))
+		respond(http.StatusInternalServerError, w, map[string]string{"message": "could not get quota usage"})
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": report,
+	})
+}
+
+// updateLabelsRequest holds the labels to set on and remove from a cluster.
+type updateLabelsRequest struct {
+	ClusterID string            `json:"cluster_id"`
+	Set       map[string]string `json:"set"`
+	Remove    []string          `json:"remove"`
+}
+
+// UpdateLabels sets and removes labels on an existing cluster.
+func (c ClusterHandler) UpdateLabels(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+
+	var s updateLabelsRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		c.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+
+	ci, err := c.svc.UpdateLabels(r.Context(), user, s.ClusterID, s.Set, s.Remove)
+	if err != nil {
+		c.logger.Error("failed to update labels", zap.Error(err))
+		labelErr := service.ErrInvalidLabel{}
+		if errors.As(err, &labelErr) {
+			respond(http.StatusBadRequest, w, map[string]string{"message": labelErr.Error()})
+		} else if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		} else {
+			respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to update labels"})
+		}
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": ci,
+	})
+}
+
+// parseExpiry returns the expiry time given either as a TTL relative to now or as an absolute time.
+// It returns nil if neither is set.
+func parseExpiry(ttl string, expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	if ttl != "" && expiresAt != nil {
+		return nil, errors.New("only one of ttl and expires_at can be set")
+	}
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid ttl '%s'", ttl)
+		}
+		t := now.Add(d).UTC()
+		return &t, nil
+	}
+	return expiresAt, nil
+}
+
+// DeleteCluster deletes a cluster and its data.
+func (c ClusterHandler) DeleteCluster(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "DELETE" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "method not allowed"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("validating user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "unauthorized"})
+		return
+	}
+
+	clusterId := r.URL.Query().Get("cluster_id")
+	if clusterId == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+
+	if err := c.svc.DeleteCluster(r.Context(), user, clusterId); err != nil {
+		c.logger.Error("failed to delete cluster", zap.Error(err))
+		if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		} else {
+			respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to delete cluster"})
+		}
+		return
+	}
+	respond(http.StatusNoContent, w, nil)
+}
+
+// extendClusterRequest holds the new expiry of a cluster, either relative to now (TTL) or absolute (ExpiresAt).
+type extendClusterRequest struct {
+	ClusterID string     `json:"cluster_id"`
+	TTL       string     `json:"ttl"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// ExtendCluster changes when an ephemeral cluster expires.
+func (c ClusterHandler) ExtendCluster(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+
+	var s extendClusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		c.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+	expiresAt, err := parseExpiry(s.TTL, s.ExpiresAt, time.Now())
+	if err != nil {
+		respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+		return
+	}
+	if expiresAt == nil {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "one of ttl and expires_at is required"})
+		return
+	}
+
+	ci, err := c.svc.ExtendCluster(r.Context(), user, s.ClusterID, expiresAt)
+	if err != nil {
+		c.logger.Error("failed to extend cluster", zap.Error(err))
+		if errors.Is(err, service.ErrInvalidExpiry) {
+			respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+		} else if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		} else {
+			respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to extend cluster"})
+		}
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": ci,
+	})
+}
+
+// parseIdleTimeout parses an idle timeout given as a duration string. An empty string disables the idle policy.
+func parseIdleTimeout(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid idle_timeout '%s'", s)
+	}
+	return d, nil
+}
+
+// idlePolicyRequest holds the new idle timeout of a cluster. An empty or zero timeout disables the idle policy.
+type idlePolicyRequest struct {
+	ClusterID   string `json:"cluster_id"`
+	IdleTimeout string `json:"idle_timeout"`
+}
+
+// SetIdlePolicy changes how long a cluster can go without client connections before it is stopped.
+func (c ClusterHandler) SetIdlePolicy(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+
+	var s idlePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		c.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+	idleTimeout, err := parseIdleTimeout(s.IdleTimeout)
+	if err != nil {
+		respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+		return
+	}
+
+	ci, err := c.svc.SetIdlePolicy(r.Context(), user, s.ClusterID, idleTimeout)
+	if err != nil {
+		c.logger.Error("failed to set idle policy", zap.Error(err))
+		if errors.Is(err, service.ErrInvalidIdleTimeout) || errors.As(err, &service.ErrUnsupportedEngine{}) {
+			respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+		} else if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		} else {
+			respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to set idle policy"})
+		}
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": ci,
+	})
+}
+
+type adoptClusterRequest struct {
+	Container  string            `json:"container"`
+	Name       string            `json:"name"`
+	Owner      string            `json:"owner"`
+	Username   string            `json:"username"`
+	Password   string            `json:"password"`
+	Monitoring string            `json:"monitoring"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// AdoptCluster registers an existing postgres container as a cluster. Since any container on the host can be
+// adopted, only admins can adopt containers, optionally on behalf of another user.
+func (c ClusterHandler) AdoptCluster(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+	if !user.Admin {
+		respond(http.StatusForbidden, w, map[string]string{"message": "only admins can adopt containers"})
+		return
+	}
+
+	var s adoptClusterRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		c.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.Container == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "container not present"})
+		return
+	}
+	owner := user
+	if s.Owner != "" {
+		owner = service.User{ID: s.Owner}
+	}
+
+	cluster := metastore.ClusterInfo{
+		Name:       s.Name,
+		Username:   s.Username,
+		Password:   s.Password,
+		Monitoring: s.Monitoring,
+		Labels:     s.Labels,
+	}
+	if err := c.svc.AdoptCluster(r.Context(), owner, s.Container, &cluster); err != nil {
+		c.logger.Error("failed to adopt container", zap.Error(err))
+		adoptErr := service.ErrNotAdoptable{}
+		if errors.As(err, &adoptErr) {
+			respond(http.StatusBadRequest, w, map[string]string{"message": adoptErr.Error()})
+		} else if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no container found with matching name or id"})
+		} else {
+			status, message := createErrorResponse(err)
+			respond(status, w, map[string]string{"message": message})
+		}
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": cluster,
+	})
+}
+
+// ExportCluster returns the cluster with the given cluster_id as a docker compose file, or as Kubernetes manifests
+// when format is kubernetes.
+func (c ClusterHandler) ExportCluster(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+
+	clusterID := r.URL.Query().Get("cluster_id")
+	if clusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCompose
+	}
+
+	data, err := c.svc.ExportCluster(r.Context(), user, clusterID, format)
+	if err != nil {
+		c.logger.Error("failed to export cluster", zap.Error(err))
+		if errors.Is(err, export.ErrUnknownFormat) || errors.As(err, &service.ErrUnsupportedEngine{}) {
+			respond(http.StatusBadRequest, w, map[string]string{"message": err.Error()})
+		} else if errors.As(err, &service.ErrNoMatch{}) {
+			respond(http.StatusNotFound, w, map[string]string{"message": "no cluster found with matching id"})
+		} else {
+			respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to export cluster"})
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", clusterID+"-"+format+".yaml"))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		c.logger.Error("failed to write export", zap.Error(err))
+	}
+}
@@ -1,15 +1,25 @@
 package api
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 
 	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/internal/export"
 	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
 	"github.com/spinup-host/spinup/testutils"
 )
 
@@ -22,10 +32,30 @@ func TestListCluster(t *testing.T) {
 			ID:        1,
 			Name:      "test_cluster_1",
 			ClusterID: "test_cluster_1",
+			Owner:     "testuser",
+			Password:  "secret",
 		},
 	}
+	allClusters := append(testClusters, metastore.ClusterInfo{
+		ID:        2,
+		Name:      "test_cluster_2",
+		ClusterID: "test_cluster_2",
+		Owner:     "otheruser",
+	})
 
-	svc.On("ListClusters", mock.Anything).Return(testClusters, nil)
+	svc.On("ListClusters", mock.Anything, service.User{ID: "testuser"}, metastore.ClusterFilter{}).
+		Return(metastore.ClusterPage{Clusters: testClusters}, nil)
+	svc.On("ListClusters", mock.Anything, service.User{ID: "testuser", Admin: true}, metastore.ClusterFilter{}).
+		Return(metastore.ClusterPage{Clusters: allClusters}, nil)
+	filter := metastore.ClusterFilter{
+		NamePrefix: "test_",
+		Status:     "running",
+		MajVersion: 13,
+		Labels:     []metastore.LabelSelector{{Key: "env", Value: "dev", HasValue: true}, {Key: "team"}},
+		Limit:      1,
+	}
+	svc.On("ListClusters", mock.Anything, service.User{ID: "testuser"}, filter).
+		Return(metastore.ClusterPage{Clusters: testClusters, NextCursor: "next"}, nil)
 
 	loggerConfig := zap.NewProductionConfig()
 	loggerConfig.OutputPaths = []string{"stdout"}
@@ -33,7 +63,9 @@ func TestListCluster(t *testing.T) {
 	assert.NoError(t, err)
 
 	appConfig := testutils.GetConfig()
+	appConfig.Common.ApiKey = "test_api_key"
 	ch, err := NewClusterHandler(svc, appConfig, logger)
+	assert.NoError(t, err)
 	server := createServer(ch)
 
 	t.Run("fails for unauthenticated users", func(t *testing.T) {
@@ -43,4 +75,385 @@ func TestListCluster(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, response.Code)
 	})
 
+	t.Run("lists only clusters owned by the user", func(t *testing.T) {
+		listRequest, err := http.NewRequest(http.MethodGet, "/listcluster", nil)
+		assert.NoError(t, err)
+		listRequest.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(server, listRequest)
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var clusters []metastore.ClusterInfo
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &clusters))
+		assert.Equal(t, withoutPasswords(testClusters), clusters)
+	})
+
+	t.Run("lists passwords when asked for", func(t *testing.T) {
+		listRequest, err := http.NewRequest(http.MethodGet, "/listcluster?include_secrets=true", nil)
+		assert.NoError(t, err)
+		listRequest.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(server, listRequest)
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var clusters []metastore.ClusterInfo
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &clusters))
+		assert.Equal(t, testClusters, clusters)
+	})
+
+	t.Run("lists all clusters for admins", func(t *testing.T) {
+		adminConfig := appConfig
+		adminConfig.Common.Admins = []string{"testuser"}
+		adminHandler, err := NewClusterHandler(svc, adminConfig, logger)
+		assert.NoError(t, err)
+
+		listRequest, err := http.NewRequest(http.MethodGet, "/listcluster", nil)
+		assert.NoError(t, err)
+		listRequest.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(createServer(adminHandler), listRequest)
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var clusters []metastore.ClusterInfo
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &clusters))
+		assert.Equal(t, withoutPasswords(allClusters), clusters)
+	})
+
+	t.Run("filters and paginates", func(t *testing.T) {
+		listRequest, err := http.NewRequest(http.MethodGet, "/listcluster?name_prefix=test_&status=running&version=13&label=env=dev,team&limit=1", nil)
+		assert.NoError(t, err)
+		listRequest.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(server, listRequest)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "next", response.Header().Get(nextCursorHeader))
+	})
+
+	t.Run("rejects malformed filters", func(t *testing.T) {
+		for _, query := range []string{"version=x", "version=13.x", "limit=-1", "label==dev"} {
+			listRequest, err := http.NewRequest(http.MethodGet, "/listcluster?"+query, nil)
+			assert.NoError(t, err)
+			listRequest.Header.Set("x-api-key", appConfig.Common.ApiKey)
+			response := executeRequest(server, listRequest)
+			assert.Equal(t, http.StatusBadRequest, response.Code, query)
+		}
+	})
+}
+
+func withoutPasswords(clusters []metastore.ClusterInfo) []metastore.ClusterInfo {
+	stripped := make([]metastore.ClusterInfo, len(clusters))
+	for i, cluster := range clusters {
+		cluster.Password = ""
+		stripped[i] = cluster
+	}
+	return stripped
+}
+
+func TestCreateClusterStream(t *testing.T) {
+	// the handler picks the first free port of the configured range.
+	ln, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.NoError(t, ln.Close())
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	appConfig.Common.Ports = []int{port}
+
+	createRequest := func(name string) *http.Request {
+		body := `{"db": {"type": "postgres", "name": "` + name + `", "username": "spinup", "password": "spinup"}, "version": {"maj": 14, "min": 5}}`
+		req, err := http.NewRequest(http.MethodPost, "/createservice?stream=true", strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		return req
+	}
+	readLines := func(body string) []map[string]interface{} {
+		var lines []map[string]interface{}
+		scanner := bufio.NewScanner(strings.NewReader(body))
+		for scanner.Scan() {
+			var line map[string]interface{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	svc := &mockClusterService{}
+	svc.On("CreateService", mock.Anything, service.User{ID: "testuser"}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Name == "created"
+	})).Return(nil)
+	svc.On("CreateService", mock.Anything, service.User{ID: "testuser"}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Name == "over_quota"
+	})).Return(service.ErrQuotaExceeded{Resource: "clusters", Limit: 1, Wanted: 2})
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	assert.NoError(t, err)
+	server := createServer(ch)
+
+	t.Run("ends with the created cluster", func(t *testing.T) {
+		response := executeRequest(server, createRequest("created"))
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Equal(t, "application/x-ndjson", response.Header().Get("Content-Type"))
+		lines := readLines(response.Body.String())
+		if assert.NotEmpty(t, lines) {
+			cluster := lines[len(lines)-1]["data"].(map[string]interface{})
+			assert.Equal(t, "created", cluster["name"])
+		}
+	})
+
+	t.Run("ends with the error", func(t *testing.T) {
+		response := executeRequest(server, createRequest("over_quota"))
+		assert.Equal(t, http.StatusOK, response.Code)
+		lines := readLines(response.Body.String())
+		if assert.NotEmpty(t, lines) {
+			assert.Equal(t, float64(http.StatusForbidden), lines[len(lines)-1]["status"])
+			assert.Contains(t, lines[len(lines)-1]["message"], "quota exceeded")
+		}
+	})
+}
+
+func TestCreateClusterEngines(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	assert.NoError(t, ln.Close())
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	appConfig.Common.Ports = []int{port}
+
+	svc := &mockClusterService{}
+	svc.On("CreateService", mock.Anything, service.User{ID: "testuser"}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Type == "redis" && info.Password != ""
+	})).Return(nil)
+	svc.On("CreateService", mock.Anything, service.User{ID: "testuser"}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Type == "oracle"
+	})).Return(service.ErrUnsupportedEngine{Type: "oracle"})
+	svc.On("CreateService", mock.Anything, service.User{ID: "testuser"}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Type == "redis" && info.Password == ""
+	})).Return(engine.ErrInvalidCredentials{Type: "redis", Reason: "a password is required"})
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	assert.NoError(t, err)
+	server := createServer(ch)
+
+	newCreateRequest := func(clusterType string, maj int, password string) *http.Request {
+		body := fmt.Sprintf(`{"db": {"type": "%s", "name": "cache", "username": "spinup", "password": "%s"}, "version": {"maj": %d}}`,
+			clusterType, password, maj)
+		req, err := http.NewRequest(http.MethodPost, "/createservice", strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		return req
+	}
+	createRequest := func(clusterType string, maj int) *http.Request {
+		return newCreateRequest(clusterType, maj, "spinup")
+	}
+
+	t.Run("creates clusters of other engines", func(t *testing.T) {
+		response := executeRequest(server, createRequest("redis", 7))
+		assert.Equal(t, http.StatusOK, response.Code)
+	})
+
+	t.Run("rejects unsupported types", func(t *testing.T) {
+		response := executeRequest(server, createRequest("oracle", 21))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), "unsupported database type 'oracle'")
+	})
+
+	t.Run("rejects redis clusters without a password", func(t *testing.T) {
+		response := executeRequest(server, newCreateRequest("redis", 7, ""))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), "a password is required")
+	})
+
+	t.Run("requires a version", func(t *testing.T) {
+		response := executeRequest(server, createRequest("redis", 0))
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+	})
+}
+
+func TestGetCluster(t *testing.T) {
+	svc := &mockClusterService{}
+	svc.On("GetClusterByID", mock.Anything, service.User{ID: "testuser"}, "not_owned").
+		Return(metastore.ClusterInfo{}, service.ErrNoMatch{})
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	assert.NoError(t, err)
+	server := createServer(ch)
+
+	t.Run("clusters owned by other users are not found", func(t *testing.T) {
+		getRequest, err := http.NewRequest(http.MethodGet, "/cluster?cluster_id=not_owned", nil)
+		assert.NoError(t, err)
+		getRequest.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(server, getRequest)
+		assert.Equal(t, http.StatusNotFound, response.Code)
+	})
+}
+
+func TestGetQuota(t *testing.T) {
+	svc := &mockClusterService{}
+	report := service.QuotaReport{UserID: "testuser", Usage: service.Usage{Clusters: 1}}
+	svc.On("QuotaUsage", mock.Anything, "testuser").Return(report, nil)
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	assert.NoError(t, err)
+	router := http.NewServeMux()
+	router.HandleFunc("/quota", ch.GetQuota)
+	server := &http.Server{Handler: router}
+
+	t.Run("shows the quota of the current user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/quota", nil)
+		assert.NoError(t, err)
+		req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(server, req)
+		assert.Equal(t, http.StatusOK, response.Code)
+
+		var body struct {
+			Data service.QuotaReport `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+		assert.Equal(t, report, body.Data)
+	})
+
+	t.Run("non-admins cannot see other users", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/quota?user_id=otheruser", nil)
+		assert.NoError(t, err)
+		req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(server, req)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+	})
+}
+
+func TestAdoptCluster(t *testing.T) {
+	svc := &mockClusterService{}
+	admin := service.User{ID: "testuser", Admin: true}
+	svc.On("AdoptCluster", mock.Anything, admin, "legacy", mock.Anything).Return(func(_ context.Context, _ service.User, _ string, info *metastore.ClusterInfo) error {
+		info.ClusterID = "abc"
+		return nil
+	})
+	svc.On("AdoptCluster", mock.Anything, service.User{ID: "otheruser"}, "legacy", mock.Anything).Return(nil)
+	svc.On("AdoptCluster", mock.Anything, admin, "redis", mock.Anything).Return(service.ErrNotAdoptable{Container: "redis", Reason: "not postgres"})
+	svc.On("AdoptCluster", mock.Anything, admin, "missing", mock.Anything).Return(service.ErrNoMatch{})
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	appConfig.Common.Admins = []string{"testuser"}
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	assert.NoError(t, err)
+	router := http.NewServeMux()
+	router.HandleFunc("/adoptcluster", ch.AdoptCluster)
+	server := &http.Server{Handler: router}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "adopts containers", body: `{"container": "legacy"}`, status: http.StatusOK},
+		{name: "adopts containers for other users", body: `{"container": "legacy", "owner": "otheruser"}`, status: http.StatusOK},
+		{name: "rejects containers that cannot be adopted", body: `{"container": "redis"}`, status: http.StatusBadRequest},
+		{name: "missing containers are not found", body: `{"container": "missing"}`, status: http.StatusNotFound},
+		{name: "requires a container", body: `{}`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/adoptcluster", strings.NewReader(tt.body))
+			assert.NoError(t, err)
+			req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+			response := executeRequest(server, req)
+			assert.Equal(t, tt.status, response.Code)
+		})
+	}
+
+	t.Run("only admins can adopt containers", func(t *testing.T) {
+		userConfig := appConfig
+		userConfig.Common.Admins = nil
+		ch, err := NewClusterHandler(svc, userConfig, zap.NewNop())
+		assert.NoError(t, err)
+		router := http.NewServeMux()
+		router.HandleFunc("/adoptcluster", ch.AdoptCluster)
+		req, err := http.NewRequest(http.MethodPost, "/adoptcluster", strings.NewReader(`{"container": "legacy"}`))
+		assert.NoError(t, err)
+		req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		response := executeRequest(&http.Server{Handler: router}, req)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+	})
+}
+
+func TestExportCluster(t *testing.T) {
+	svc := &mockClusterService{}
+	user := service.User{ID: "testuser"}
+	svc.On("ExportCluster", mock.Anything, user, "cluster", export.FormatCompose).Return([]byte("services: {}\n"), nil)
+	svc.On("ExportCluster", mock.Anything, user, "cluster", "helm").Return(nil, export.ErrUnknownFormat)
+	svc.On("ExportCluster", mock.Anything, user, "not_owned", export.FormatCompose).Return(nil, service.ErrNoMatch{})
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	assert.NoError(t, err)
+	router := http.NewServeMux()
+	router.HandleFunc("/exportcluster", ch.ExportCluster)
+	server := &http.Server{Handler: router}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{name: "exports as docker compose by default", query: "cluster_id=cluster", status: http.StatusOK},
+		{name: "rejects unknown formats", query: "cluster_id=cluster&format=helm", status: http.StatusBadRequest},
+		{name: "clusters owned by other users are not found", query: "cluster_id=not_owned", status: http.StatusNotFound},
+		{name: "requires a cluster id", query: "format=compose", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "/exportcluster?"+tt.query, nil)
+			assert.NoError(t, err)
+			req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+			response := executeRequest(server, req)
+			assert.Equal(t, tt.status, response.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, "application/yaml", response.Header().Get("Content-Type"))
+				assert.Equal(t, `attachment; filename="cluster-compose.yaml"`, response.Header().Get("Content-Disposition"))
+				assert.Equal(t, "services: {}\n", response.Body.String())
+			}
+		})
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+
+	got, err := parseExpiry("", nil, now)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	got, err = parseExpiry("90m", nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(90*time.Minute), *got)
+
+	got, err = parseExpiry("", &expiresAt, now)
+	assert.NoError(t, err)
+	assert.Equal(t, expiresAt, *got)
+
+	for _, ttl := range []string{"tomorrow", "-1h", "0s"} {
+		_, err = parseExpiry(ttl, nil, now)
+		assert.Error(t, err, ttl)
+	}
+	_, err = parseExpiry("1h", &expiresAt, now)
+	assert.Error(t, err)
+}
+
+func TestParseIdleTimeout(t *testing.T) {
+	got, err := parseIdleTimeout("")
+	assert.NoError(t, err)
+	assert.Zero(t, got)
+
+	got, err = parseIdleTimeout("30m")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, got)
+
+	for _, timeout := range []string{"soon", "-1h"} {
+		_, err = parseIdleTimeout(timeout)
+		assert.Error(t, err, timeout)
+	}
 }
@@ -2,19 +2,43 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
 )
 
 // clusterService provides an interface for API handlers to manage clusters
 //
 //go:generate mockery --name=clusterService --case=snake --inpackage --testonly
 type clusterService interface {
-	CreateService(ctx context.Context, info *metastore.ClusterInfo) error
-	ListClusters(ctx context.Context) ([]metastore.ClusterInfo, error)
-	GetClusterByID(ctx context.Context, clusterID string) (metastore.ClusterInfo, error)
+	CreateService(ctx context.Context, user service.User, info *metastore.ClusterInfo) error
+	ListClusters(ctx context.Context, user service.User, filter metastore.ClusterFilter) (metastore.ClusterPage, error)
+	GetClusterByID(ctx context.Context, user service.User, clusterID string) (metastore.ClusterInfo, error)
+	ResizeCluster(ctx context.Context, user service.User, clusterID string, resources service.Resources) (metastore.ClusterInfo, error)
+	QuotaUsage(ctx context.Context, userID string) (service.QuotaReport, error)
+	UpdateLabels(ctx context.Context, user service.User, clusterID string, set map[string]string, remove []string) (metastore.ClusterInfo, error)
+	DeleteCluster(ctx context.Context, user service.User, clusterID string) error
+	ExtendCluster(ctx context.Context, user service.User, clusterID string, expiresAt *time.Time) (metastore.ClusterInfo, error)
+	SetIdlePolicy(ctx context.Context, user service.User, clusterID string, idleTimeout time.Duration) (metastore.ClusterInfo, error)
+	ExportCluster(ctx context.Context, user service.User, clusterID, format string) ([]byte, error)
+	AdoptCluster(ctx context.Context, user service.User, containerRef string, info *metastore.ClusterInfo) error
+	ListEvents(ctx context.Context, user service.User, clusterID string, filter metastore.EventFilter) (metastore.EventPage, error)
+	ListBackups(ctx context.Context, user service.User, clusterID string, refresh bool) (metastore.BackupCatalog, error)
+	RestoreBackup(ctx context.Context, user service.User, clusterID, backup string, target service.RecoveryTarget, info *metastore.ClusterInfo) (metastore.Operation, error)
+	GetOperation(ctx context.Context, user service.User, id string) (metastore.Operation, error)
 }
 
 type backupService interface {
-	CreateBackup(ctx context.Context, clusterID string, backupConfig metastore.BackupConfig) error
+	CreateBackup(ctx context.Context, user service.User, clusterID string, backupConfig metastore.BackupConfig) error
+	SetRetentionPolicy(ctx context.Context, user service.User, clusterID string, policy metastore.RetentionPolicy) (metastore.RetentionPolicy, error)
+	GetRetentionPolicy(ctx context.Context, user service.User, clusterID string) (metastore.RetentionPolicy, error)
+	ApplyRetention(ctx context.Context, user service.User, clusterID string, dryRun bool) (service.RetentionResult, error)
+	TriggerBackup(ctx context.Context, user service.User, clusterID string, dest *metastore.Destination) (metastore.Operation, error)
+	BackupHistory(ctx context.Context, user service.User, clusterID string, limit int, logs bool) (service.BackupHistory, error)
+}
+
+type imageService interface {
+	ListImages(ctx context.Context) ([]service.ImageInfo, error)
+	PruneImages(ctx context.Context) ([]service.ImageInfo, error)
 }
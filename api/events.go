@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+)
+
+// defaultEventLimit is the number of events listed per page when no limit is given, as a cluster's history grows
+// for as long as the cluster exists.
+const defaultEventLimit = 100
+
+// ListEvents lists the history of the cluster given by the cluster_id query parameter, oldest first. Pages hold
+// limit events (100 by default); the cursor of the next page is set in the X-Next-Cursor header.
+func (c ClusterHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{
+			"message": "method not allowed",
+		})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("validating user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{
+			"message": "unauthorized",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+	clusterID := query.Get("cluster_id")
+	if clusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{
+			"message": "cluster_id not present",
+		})
+		return
+	}
+	filter := metastore.EventFilter{Cursor: query.Get("cursor"), Limit: defaultEventLimit}
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			respond(http.StatusBadRequest, w, map[string]string{
+				"message": fmt.Sprintf("invalid limit '%s'", l),
+			})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	page, err := c.svc.ListEvents(r.Context(), user, clusterID, filter)
+	if errors.As(err, &service.ErrNoMatch{}) {
+		respond(http.StatusNotFound, w, map[string]string{
+			"message": "no cluster found with matching id",
+		})
+		return
+	}
+	if errors.Is(err, metastore.ErrInvalidCursor) {
+		respond(http.StatusBadRequest, w, map[string]string{
+			"message": "invalid cursor",
+		})
+		return
+	}
+	if err != nil {
+		c.logger.Error("failed to list cluster events", zap.Error(err))
+		respond(http.StatusInternalServerError, w, map[string]string{
+			"message": "failed to list cluster events",
+		})
+		return
+	}
+	if page.NextCursor != "" {
+		w.Header().Set(nextCursorHeader, page.NextCursor)
+	}
+	respond(http.StatusOK, w, page.Events)
+}
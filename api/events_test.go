@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+)
+
+func TestListEvents(t *testing.T) {
+	svc := &mockClusterService{}
+	user := service.User{ID: "testuser"}
+	events := []metastore.Event{
+		{ID: 1, ClusterID: "cluster", Type: metastore.EventCreated, Actor: "testuser", CreatedAt: time.Unix(1700000000, 0).UTC()},
+		{ID: 2, ClusterID: "cluster", Type: metastore.EventResized, Actor: "testuser", CreatedAt: time.Unix(1700000060, 0).UTC(),
+			Details: map[string]string{"memory": "1024"}},
+	}
+	svc.On("ListEvents", mock.Anything, user, "cluster", metastore.EventFilter{Limit: defaultEventLimit}).
+		Return(metastore.EventPage{Events: events}, nil)
+	svc.On("ListEvents", mock.Anything, user, "cluster", metastore.EventFilter{Limit: 1}).
+		Return(metastore.EventPage{Events: events[:1], NextCursor: "next"}, nil)
+	svc.On("ListEvents", mock.Anything, user, "cluster", metastore.EventFilter{Limit: defaultEventLimit, Cursor: "bogus"}).
+		Return(metastore.EventPage{}, metastore.ErrInvalidCursor)
+	svc.On("ListEvents", mock.Anything, user, "not_owned", metastore.EventFilter{Limit: defaultEventLimit}).
+		Return(metastore.EventPage{}, service.ErrNoMatch{})
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	require.NoError(t, err)
+	router := http.NewServeMux()
+	router.HandleFunc("/events", ch.ListEvents)
+	server := &http.Server{Handler: router}
+
+	get := func(query string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "/events?"+query, nil)
+		require.NoError(t, err)
+		req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		return executeRequest(server, req).Result()
+	}
+
+	t.Run("lists the events of a cluster", func(t *testing.T) {
+		response := get("cluster_id=cluster")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Empty(t, response.Header.Get(nextCursorHeader))
+		var got []metastore.Event
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&got))
+		assert.Equal(t, events, got)
+	})
+
+	t.Run("pages are limited", func(t *testing.T) {
+		response := get("cluster_id=cluster&limit=1")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "next", response.Header.Get(nextCursorHeader))
+	})
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{name: "requires a cluster id", query: "limit=1", status: http.StatusBadRequest},
+		{name: "rejects invalid limits", query: "cluster_id=cluster&limit=0", status: http.StatusBadRequest},
+		{name: "rejects invalid cursors", query: "cluster_id=cluster&cursor=bogus", status: http.StatusBadRequest},
+		{name: "clusters owned by other users are not found", query: "cluster_id=not_owned", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, get(tt.query).StatusCode)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/config"
+)
+
+type ImageHandler struct {
+	logger       *zap.Logger
+	appConfig    config.Configuration
+	imageService imageService
+}
+
+func NewImageHandler(cfg config.Configuration, imageService imageService, logger *zap.Logger) ImageHandler {
+	return ImageHandler{
+		logger:       logger,
+		appConfig:    cfg,
+		imageService: imageService,
+	}
+}
+
+// ListImages lists the images spinup uses, with their size and the clusters created from them. Images are shared by
+// all users, so this is restricted to admins.
+func (h ImageHandler) ListImages(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "method not allowed"})
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	images, err := h.imageService.ListImages(r.Context())
+	if err != nil {
+		h.logger.Error("failed to list images", zap.Error(err))
+		respond(http.StatusInternalServerError, w, map[string]string{"message": "could not list images"})
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": images,
+	})
+}
+
+// PruneImages removes the postgres images that no cluster uses.
+func (h ImageHandler) PruneImages(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "method not allowed"})
+		return
+	}
+	if !h.authorizeAdmin(w, r) {
+		return
+	}
+
+	removed, err := h.imageService.PruneImages(r.Context())
+	if err != nil {
+		// some images may have been removed before the failure, so they are still reported.
+		h.logger.Error("failed to prune images", zap.Error(err))
+		respond(http.StatusInternalServerError, w, map[string]interface{}{
+			"message": "could not prune all images",
+			"data":    removed,
+		})
+		return
+	}
+	respond(http.StatusOK, w, map[string]interface{}{
+		"data": removed,
+	})
+}
+
+// authorizeAdmin responds with an error and returns false unless the caller is an admin.
+func (h ImageHandler) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, err := authenticate(h.appConfig, r)
+	if err != nil {
+		h.logger.Error("validating user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "unauthorized"})
+		return false
+	}
+	if !user.Admin {
+		respond(http.StatusForbidden, w, map[string]string{"message": "only admins can manage images"})
+		return false
+	}
+	return true
+}
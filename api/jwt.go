@@ -4,6 +4,7 @@ import (
 	"crypto/rsa"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/service"
 )
 
 func stringToJWT(key *rsa.PrivateKey, text string) (string, error) {
@@ -86,6 +88,18 @@ func ValidateUser(appConfig config.Configuration, authHeader string, apiKeyHeade
 	return "testuser", errors.New("could not validate authentication headers")
 }
 
+// authenticate validates the credentials sent with a request and returns the user making the request.
+func authenticate(appConfig config.Configuration, r *http.Request) (service.User, error) {
+	userID, err := ValidateUser(appConfig, r.Header.Get("Authorization"), r.Header.Get("x-api-key"))
+	if err != nil {
+		return service.User{}, err
+	}
+	return service.User{
+		ID:    userID,
+		Admin: appConfig.IsAdmin(userID),
+	}, nil
+}
+
 func ValidateApiKey(appConfig config.Configuration, apiKeyHeader string) error {
 	if apiKeyHeader != appConfig.Common.ApiKey {
 		return errors.New("invalid api key")
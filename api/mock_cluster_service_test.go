@@ -5,9 +5,13 @@ package api
 import (
 	context "context"
 
+	time "time"
+
 	mock "github.com/stretchr/testify/mock"
 
 	metastore "github.com/spinup-host/spinup/internal/metastore"
+
+	service "github.com/spinup-host/spinup/internal/service"
 )
 
 // mockClusterService is an autogenerated mock type for the clusterService type
@@ -15,13 +19,41 @@ type mockClusterService struct {
 	mock.Mock
 }
 
-// CreateService provides a mock function with given fields: ctx, info
-func (_m *mockClusterService) CreateService(ctx context.Context, info *metastore.ClusterInfo) error {
-	ret := _m.Called(ctx, info)
+// AdoptCluster provides a mock function with given fields: ctx, user, containerRef, info
+func (_m *mockClusterService) AdoptCluster(ctx context.Context, user service.User, containerRef string, info *metastore.ClusterInfo) error {
+	ret := _m.Called(ctx, user, containerRef, info)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, *metastore.ClusterInfo) error); ok {
+		r0 = rf(ctx, user, containerRef, info)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateService provides a mock function with given fields: ctx, user, info
+func (_m *mockClusterService) CreateService(ctx context.Context, user service.User, info *metastore.ClusterInfo) error {
+	ret := _m.Called(ctx, user, info)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, *metastore.ClusterInfo) error); ok {
+		r0 = rf(ctx, user, info)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteCluster provides a mock function with given fields: ctx, user, clusterID
+func (_m *mockClusterService) DeleteCluster(ctx context.Context, user service.User, clusterID string) error {
+	ret := _m.Called(ctx, user, clusterID)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *metastore.ClusterInfo) error); ok {
-		r0 = rf(ctx, info)
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string) error); ok {
+		r0 = rf(ctx, user, clusterID)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -29,20 +61,169 @@ func (_m *mockClusterService) CreateService(ctx context.Context, info *metastore
 	return r0
 }
 
-// GetClusterByID provides a mock function with given fields: ctx, clusterID
-func (_m *mockClusterService) GetClusterByID(ctx context.Context, clusterID string) (metastore.ClusterInfo, error) {
-	ret := _m.Called(ctx, clusterID)
+// ExportCluster provides a mock function with given fields: ctx, user, clusterID, format
+func (_m *mockClusterService) ExportCluster(ctx context.Context, user service.User, clusterID string, format string) ([]byte, error) {
+	ret := _m.Called(ctx, user, clusterID, format)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, string) []byte); ok {
+		r0 = rf(ctx, user, clusterID, format)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, string) error); ok {
+		r1 = rf(ctx, user, clusterID, format)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ExtendCluster provides a mock function with given fields: ctx, user, clusterID, expiresAt
+func (_m *mockClusterService) ExtendCluster(ctx context.Context, user service.User, clusterID string, expiresAt *time.Time) (metastore.ClusterInfo, error) {
+	ret := _m.Called(ctx, user, clusterID, expiresAt)
+
+	var r0 metastore.ClusterInfo
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, *time.Time) metastore.ClusterInfo); ok {
+		r0 = rf(ctx, user, clusterID, expiresAt)
+	} else {
+		r0 = ret.Get(0).(metastore.ClusterInfo)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, *time.Time) error); ok {
+		r1 = rf(ctx, user, clusterID, expiresAt)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetClusterByID provides a mock function with given fields: ctx, user, clusterID
+func (_m *mockClusterService) GetClusterByID(ctx context.Context, user service.User, clusterID string) (metastore.ClusterInfo, error) {
+	ret := _m.Called(ctx, user, clusterID)
 
 	var r0 metastore.ClusterInfo
-	if rf, ok := ret.Get(0).(func(context.Context, string) metastore.ClusterInfo); ok {
-		r0 = rf(ctx, clusterID)
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string) metastore.ClusterInfo); ok {
+		r0 = rf(ctx, user, clusterID)
 	} else {
 		r0 = ret.Get(0).(metastore.ClusterInfo)
 	}
 
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string) error); ok {
+		r1 = rf(ctx, user, clusterID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOperation provides a mock function with given fields: ctx, user, id
+func (_m *mockClusterService) GetOperation(ctx context.Context, user service.User, id string) (metastore.Operation, error) {
+	ret := _m.Called(ctx, user, id)
+
+	var r0 metastore.Operation
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string) metastore.Operation); ok {
+		r0 = rf(ctx, user, id)
+	} else {
+		r0 = ret.Get(0).(metastore.Operation)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string) error); ok {
+		r1 = rf(ctx, user, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListBackups provides a mock function with given fields: ctx, user, clusterID, refresh
+func (_m *mockClusterService) ListBackups(ctx context.Context, user service.User, clusterID string, refresh bool) (metastore.BackupCatalog, error) {
+	ret := _m.Called(ctx, user, clusterID, refresh)
+
+	var r0 metastore.BackupCatalog
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, bool) metastore.BackupCatalog); ok {
+		r0 = rf(ctx, user, clusterID, refresh)
+	} else {
+		r0 = ret.Get(0).(metastore.BackupCatalog)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, bool) error); ok {
+		r1 = rf(ctx, user, clusterID, refresh)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListClusters provides a mock function with given fields: ctx, user, filter
+func (_m *mockClusterService) ListClusters(ctx context.Context, user service.User, filter metastore.ClusterFilter) (metastore.ClusterPage, error) {
+	ret := _m.Called(ctx, user, filter)
+
+	var r0 metastore.ClusterPage
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, metastore.ClusterFilter) metastore.ClusterPage); ok {
+		r0 = rf(ctx, user, filter)
+	} else {
+		r0 = ret.Get(0).(metastore.ClusterPage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, metastore.ClusterFilter) error); ok {
+		r1 = rf(ctx, user, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListEvents provides a mock function with given fields: ctx, user, clusterID, filter
+func (_m *mockClusterService) ListEvents(ctx context.Context, user service.User, clusterID string, filter metastore.EventFilter) (metastore.EventPage, error) {
+	ret := _m.Called(ctx, user, clusterID, filter)
+
+	var r0 metastore.EventPage
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, metastore.EventFilter) metastore.EventPage); ok {
+		r0 = rf(ctx, user, clusterID, filter)
+	} else {
+		r0 = ret.Get(0).(metastore.EventPage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, metastore.EventFilter) error); ok {
+		r1 = rf(ctx, user, clusterID, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QuotaUsage provides a mock function with given fields: ctx, userID
+func (_m *mockClusterService) QuotaUsage(ctx context.Context, userID string) (service.QuotaReport, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 service.QuotaReport
+	if rf, ok := ret.Get(0).(func(context.Context, string) service.QuotaReport); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(service.QuotaReport)
+	}
+
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, clusterID)
+		r1 = rf(ctx, userID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -50,22 +231,83 @@ func (_m *mockClusterService) GetClusterByID(ctx context.Context, clusterID stri
 	return r0, r1
 }
 
-// ListClusters provides a mock function with given fields: ctx
-func (_m *mockClusterService) ListClusters(ctx context.Context) ([]metastore.ClusterInfo, error) {
-	ret := _m.Called(ctx)
+// ResizeCluster provides a mock function with given fields: ctx, user, clusterID, resources
+func (_m *mockClusterService) ResizeCluster(ctx context.Context, user service.User, clusterID string, resources service.Resources) (metastore.ClusterInfo, error) {
+	ret := _m.Called(ctx, user, clusterID, resources)
 
-	var r0 []metastore.ClusterInfo
-	if rf, ok := ret.Get(0).(func(context.Context) []metastore.ClusterInfo); ok {
-		r0 = rf(ctx)
+	var r0 metastore.ClusterInfo
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, service.Resources) metastore.ClusterInfo); ok {
+		r0 = rf(ctx, user, clusterID, resources)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]metastore.ClusterInfo)
-		}
+		r0 = ret.Get(0).(metastore.ClusterInfo)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, service.Resources) error); ok {
+		r1 = rf(ctx, user, clusterID, resources)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreBackup provides a mock function with given fields: ctx, user, clusterID, backup, target, info
+func (_m *mockClusterService) RestoreBackup(ctx context.Context, user service.User, clusterID string, backup string, target service.RecoveryTarget, info *metastore.ClusterInfo) (metastore.Operation, error) {
+	ret := _m.Called(ctx, user, clusterID, backup, target, info)
+
+	var r0 metastore.Operation
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, string, service.RecoveryTarget, *metastore.ClusterInfo) metastore.Operation); ok {
+		r0 = rf(ctx, user, clusterID, backup, target, info)
+	} else {
+		r0 = ret.Get(0).(metastore.Operation)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, string, service.RecoveryTarget, *metastore.ClusterInfo) error); ok {
+		r1 = rf(ctx, user, clusterID, backup, target, info)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetIdlePolicy provides a mock function with given fields: ctx, user, clusterID, idleTimeout
+func (_m *mockClusterService) SetIdlePolicy(ctx context.Context, user service.User, clusterID string, idleTimeout time.Duration) (metastore.ClusterInfo, error) {
+	ret := _m.Called(ctx, user, clusterID, idleTimeout)
+
+	var r0 metastore.ClusterInfo
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, time.Duration) metastore.ClusterInfo); ok {
+		r0 = rf(ctx, user, clusterID, idleTimeout)
+	} else {
+		r0 = ret.Get(0).(metastore.ClusterInfo)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, time.Duration) error); ok {
+		r1 = rf(ctx, user, clusterID, idleTimeout)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateLabels provides a mock function with given fields: ctx, user, clusterID, set, remove
+func (_m *mockClusterService) UpdateLabels(ctx context.Context, user service.User, clusterID string, set map[string]string, remove []string) (metastore.ClusterInfo, error) {
+	ret := _m.Called(ctx, user, clusterID, set, remove)
+
+	var r0 metastore.ClusterInfo
+	if rf, ok := ret.Get(0).(func(context.Context, service.User, string, map[string]string, []string) metastore.ClusterInfo); ok {
+		r0 = rf(ctx, user, clusterID, set, remove)
+	} else {
+		r0 = ret.Get(0).(metastore.ClusterInfo)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, service.User, string, map[string]string, []string) error); ok {
+		r1 = rf(ctx, user, clusterID, set, remove)
 	} else {
 		r1 = ret.Error(1)
 	}
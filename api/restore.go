@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+	"github.com/spinup-host/spinup/misc"
+)
+
+type restoreBackupRequest struct {
+	// ClusterID is the cluster whose backup is restored.
+	ClusterID string `json:"cluster_id"`
+	// Backup is the name of the base backup to restore, the latest one when empty.
+	Backup string `json:"backup"`
+	// TargetTime, TargetLSN and TargetName are the point in time, the LSN or the restore point to recover to, past
+	// the base backup. At most one of them is set; the cluster recovers all the archived WAL when none is.
+	TargetTime *time.Time `json:"target_time,omitempty"`
+	TargetLSN  string     `json:"target_lsn,omitempty"`
+	TargetName string     `json:"target_name,omitempty"`
+
+	Name       string            `json:"name"`
+	CPU        int64             `json:"cpu,omitempty"`
+	Memory     int64             `json:"memory,omitempty"`
+	Monitoring string            `json:"monitoring"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// ListBackups returns the backup catalog of the cluster given by the cluster_id query parameter, which lists its base
+// backups oldest first. The catalog is cached; it's refreshed from the backup destination with refresh=true.
+func (c ClusterHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+	clusterID := r.URL.Query().Get("cluster_id")
+	if clusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+
+	refresh := r.URL.Query().Get("refresh") == "true"
+
+	catalog, err := c.svc.ListBackups(r.Context(), user, clusterID, refresh)
+	if err != nil {
+		c.logger.Error("failed to list backups", zap.Error(err))
+		status, message := restoreErrorResponse(err)
+		respond(status, w, map[string]string{"message": message})
+		return
+	}
+	respond(http.StatusOK, w, catalog)
+}
+
+// RestoreBackup restores a backup of a cluster into a new cluster. The restore runs in the background: the response
+// is the restore operation, whose progress is polled with GetOperation.
+func (c ClusterHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+
+	var s restoreBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		c.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+	if s.Name == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "name not present"})
+		return
+	}
+	port, err := misc.PortCheck(c.appConfig.Common.Ports[0], c.appConfig.Common.Ports[len(c.appConfig.Common.Ports)-1])
+	if err != nil {
+		c.logger.Error("port issue", zap.Error(err))
+		respond(http.StatusInternalServerError, w, map[string]string{"message": "Could not find an open port"})
+		return
+	}
+
+	cluster := metastore.ClusterInfo{
+		Architecture: c.appConfig.Common.Architecture,
+		Host:         "localhost",
+		Name:         s.Name,
+		Port:         port,
+		CPU:          s.CPU,
+		Memory:       s.Memory,
+		Monitoring:   s.Monitoring,
+		Labels:       s.Labels,
+	}
+	target := service.RecoveryTarget{Time: s.TargetTime, LSN: s.TargetLSN, Name: s.TargetName}
+	op, err := c.svc.RestoreBackup(r.Context(), user, s.ClusterID, s.Backup, target, &cluster)
+	if err != nil {
+		c.logger.Error("failed to restore backup", zap.Error(err))
+		status, message := restoreErrorResponse(err)
+		respond(status, w, map[string]string{"message": message})
+		return
+	}
+	respond(http.StatusAccepted, w, op)
+}
+
+// GetOperation returns the operation given by the id query parameter, e.g. a restore.
+func (c ClusterHandler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "Invalid Method"})
+		return
+	}
+	user, err := authenticate(c.appConfig, r)
+	if err != nil {
+		c.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "id not present"})
+		return
+	}
+
+	op, err := c.svc.GetOperation(r.Context(), user, id)
+	if errors.As(err, &service.ErrNoMatch{}) {
+		respond(http.StatusNotFound, w, map[string]string{"message": "no operation found with matching id"})
+		return
+	}
+	if err != nil {
+		c.logger.Error("failed to get operation", zap.Error(err))
+		respond(http.StatusInternalServerError, w, map[string]string{"message": "failed to get operation"})
+		return
+	}
+	respond(http.StatusOK, w, op)
+}
+
+func restoreErrorResponse(err error) (int, string) {
+	destErr := service.ErrNoBackupDestination{}
+	targetErr := service.ErrInvalidRecoveryTarget{}
+	switch {
+	case errors.As(err, &service.ErrNoMatch{}):
+		return http.StatusNotFound, "no cluster found with matching id"
+	case errors.As(err, &destErr):
+		return http.StatusBadRequest, destErr.Error()
+	case errors.As(err, &targetErr):
+		return http.StatusBadRequest, targetErr.Error()
+	case errors.As(err, &service.ErrQuotaExceeded{}), errors.As(err, &service.ErrImageNotAllowed{}),
+		errors.As(err, &service.ErrInvalidLabel{}), errors.As(err, &service.ErrUnsupportedEngine{}),
+		errors.Is(err, dockerservice.ErrDuplicateContainerName):
+		return createErrorResponse(err)
+	default:
+		return http.StatusInternalServerError, err.Error()
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+)
+
+func TestRestoreBackup(t *testing.T) {
+	// the handler picks the first free port of the configured range.
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+	require.NoError(t, ln.Close())
+
+	svc := &mockClusterService{}
+	user := service.User{ID: "testuser"}
+	op := metastore.Operation{ID: "op", Type: service.OperationRestore, Owner: "testuser", Status: metastore.OperationRunning}
+	catalog := metastore.BackupCatalog{ClusterID: "cluster", Backups: []metastore.CatalogBackup{{Name: "base_000000010000000000000002"}}}
+	svc.On("ListBackups", mock.Anything, user, "cluster", false).Return(catalog, nil)
+	svc.On("ListBackups", mock.Anything, user, "cluster", true).Return(catalog, nil)
+	svc.On("ListBackups", mock.Anything, user, "unscheduled", false).
+		Return(metastore.BackupCatalog{}, service.ErrNoBackupDestination{ClusterID: "unscheduled"})
+	svc.On("RestoreBackup", mock.Anything, user, "cluster", "", service.RecoveryTarget{}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Name == "restored" && info.Port == port
+	})).Return(op, nil)
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	svc.On("RestoreBackup", mock.Anything, user, "cluster", "", service.RecoveryTarget{Time: &at}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Name == "restored"
+	})).Return(op, nil)
+	svc.On("RestoreBackup", mock.Anything, user, "cluster", "", service.RecoveryTarget{LSN: "9/0"}, mock.Anything).
+		Return(metastore.Operation{}, service.ErrInvalidRecoveryTarget{Reason: "the archived WAL ends before the recovery target"})
+	svc.On("RestoreBackup", mock.Anything, user, "cluster", "", service.RecoveryTarget{}, mock.MatchedBy(func(info *metastore.ClusterInfo) bool {
+		return info.Name == "taken"
+	})).Return(metastore.Operation{}, dockerservice.ErrDuplicateContainerName)
+	svc.On("GetOperation", mock.Anything, user, "op").Return(op, nil)
+	svc.On("GetOperation", mock.Anything, user, "not_owned").Return(metastore.Operation{}, service.ErrNoMatch{})
+
+	appConfig := config.Configuration{}
+	appConfig.Common.ApiKey = "test_api_key"
+	appConfig.Common.Ports = []int{port}
+	ch, err := NewClusterHandler(svc, appConfig, zap.NewNop())
+	require.NoError(t, err)
+	router := http.NewServeMux()
+	router.HandleFunc("/backups", ch.ListBackups)
+	router.HandleFunc("/restorebackup", ch.RestoreBackup)
+	router.HandleFunc("/operation", ch.GetOperation)
+	server := &http.Server{Handler: router}
+
+	do := func(method, target, body string) *http.Response {
+		req, err := http.NewRequest(method, target, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("x-api-key", appConfig.Common.ApiKey)
+		return executeRequest(server, req).Result()
+	}
+
+	t.Run("lists backups", func(t *testing.T) {
+		response := do(http.MethodGet, "/backups?cluster_id=cluster", "")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		var got metastore.BackupCatalog
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&got))
+		assert.Len(t, got.Backups, 1)
+
+		response = do(http.MethodGet, "/backups?cluster_id=cluster&refresh=true", "")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		svc.AssertCalled(t, "ListBackups", mock.Anything, user, "cluster", true)
+	})
+
+	t.Run("starts a restore", func(t *testing.T) {
+		response := do(http.MethodPost, "/restorebackup", `{"cluster_id": "cluster", "name": "restored"}`)
+		assert.Equal(t, http.StatusAccepted, response.StatusCode)
+		var got metastore.Operation
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&got))
+		assert.Equal(t, "op", got.ID)
+
+		response = do(http.MethodGet, "/operation?id=op", "")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+
+	t.Run("starts a point-in-time restore", func(t *testing.T) {
+		response := do(http.MethodPost, "/restorebackup", `{"cluster_id": "cluster", "name": "restored", "target_time": "2024-01-01T12:00:00Z"}`)
+		assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{name: "clusters without a destination", method: http.MethodGet, target: "/backups?cluster_id=unscheduled", status: http.StatusBadRequest},
+		{name: "restores require a name", method: http.MethodPost, target: "/restorebackup", body: `{"cluster_id": "cluster"}`, status: http.StatusBadRequest},
+		{name: "targets outside the archived WAL", method: http.MethodPost, target: "/restorebackup", body: `{"cluster_id": "cluster", "name": "restored", "target_lsn": "9/0"}`, status: http.StatusBadRequest},
+		{name: "restores into a taken name", method: http.MethodPost, target: "/restorebackup", body: `{"cluster_id": "cluster", "name": "taken"}`, status: http.StatusBadRequest},
+		{name: "operations of other users are not found", method: http.MethodGet, target: "/operation?id=not_owned", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, do(tt.method, tt.target, tt.body).StatusCode)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+)
+
+// applyRetentionRequest holds the parameters needed to apply the retention policy of a cluster.
+type applyRetentionRequest struct {
+	ClusterID string `json:"cluster_id"`
+	DryRun    bool   `json:"dry_run"`
+}
+
+// RetentionPolicy returns the backup retention policy of the cluster in the cluster_id query parameter on GET, and
+// sets the policy in the request body on POST. A policy whose rules are all zero removes the cluster's policy.
+func (b BackupHandler) RetentionPolicy(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "GET" && (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "invalid method"})
+		return
+	}
+	user, err := authenticate(b.appConfig, r)
+	if err != nil {
+		b.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+
+	var policy metastore.RetentionPolicy
+	if (*r).Method == "GET" {
+		policy.ClusterID = r.URL.Query().Get("cluster_id")
+	} else if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		b.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if policy.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+
+	if (*r).Method == "GET" {
+		policy, err = b.backupService.GetRetentionPolicy(r.Context(), user, policy.ClusterID)
+	} else {
+		policy, err = b.backupService.SetRetentionPolicy(r.Context(), user, policy.ClusterID, policy)
+	}
+	if err != nil {
+		b.logger.Error("failed to handle retention policy", zap.Error(err))
+		status, message := retentionErrorResponse(err)
+		respond(status, w, map[string]string{"message": message})
+		return
+	}
+	respond(http.StatusOK, w, policy)
+}
+
+// ApplyRetention applies the retention policy of a cluster to its backups now, or reports the backups it would delete
+// in a dry run.
+func (b BackupHandler) ApplyRetention(w http.ResponseWriter, r *http.Request) {
+	if (*r).Method != "POST" {
+		respond(http.StatusMethodNotAllowed, w, map[string]string{"message": "invalid method"})
+		return
+	}
+	user, err := authenticate(b.appConfig, r)
+	if err != nil {
+		b.logger.Error("Failed to validate user", zap.Error(err))
+		respond(http.StatusUnauthorized, w, map[string]string{"message": "Unauthorized"})
+		return
+	}
+	var s applyRetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		b.logger.Error("parsing request", zap.Error(err))
+		respond(http.StatusBadRequest, w, map[string]string{"message": "Error reading request body"})
+		return
+	}
+	if s.ClusterID == "" {
+		respond(http.StatusBadRequest, w, map[string]string{"message": "cluster_id not present"})
+		return
+	}
+
+	result, err := b.backupService.ApplyRetention(r.Context(), user, s.ClusterID, s.DryRun)
+	if err != nil {
+		b.logger.Error("failed to apply retention policy", zap.Error(err))
+		status, message := retentionErrorResponse(err)
+		respond(status, w, map[string]string{"message": message})
+		return
+	}
+	respond(http.StatusOK, w, result)
+}
+
+// retentionErrorResponse returns the status code and message of an error returned while handling retention policies.
+func retentionErrorResponse(err error) (int, string) {
+	switch {
+	case errors.As(err, &service.ErrNoMatch{}):
+		return http.StatusNotFound, "no cluster found with matching id"
+	case errors.As(err, &service.ErrUnsupportedEngine{}), errors.As(err, &service.ErrInvalidRetentionPolicy{}),
+		errors.As(err, &service.ErrNoBackupDestination{}):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return http.StatusInternalServerError, err.Error()
+	}
+}
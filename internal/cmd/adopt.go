@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+)
+
+func adoptCmd() *cobra.Command {
+	var owner string
+	info := metastore.ClusterInfo{}
+	ac := &cobra.Command{
+		Use:   "adopt <container>",
+		Short: "register an existing postgres container, given by name or ID, as a spinup cluster",
+		Long: `Registers an existing postgres container as a spinup cluster. The container is renamed to spinup-postgres-<name>
+and attached to spinup's network without being restarted. Its image, credentials, port and resources are read from
+the container. Monitoring is only available when adopting through the API, since the monitoring services run with
+the API server.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, err := newClusterService()
+			if err != nil {
+				return err
+			}
+			if err := svc.AdoptCluster(cmd.Context(), service.User{ID: owner}, args[0], &info); err != nil {
+				return err
+			}
+			info.Password = ""
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(info)
+		},
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	ac.Flags().StringVar(&cfgFile, "config",
+		fmt.Sprintf("%s/.local/spinup/config.yaml", home), "Path to spinup configuration")
+	ac.Flags().StringVar(&info.Name, "name", "", "cluster name, defaults to the container name")
+	ac.Flags().StringVar(&owner, "owner", "spinup", "user owning the cluster")
+	ac.Flags().StringVar(&info.Username, "username", "", "postgres superuser, defaults to the container's POSTGRES_USER")
+	ac.Flags().StringVar(&info.Password, "password", "", "postgres password, defaults to the container's POSTGRES_PASSWORD")
+	ac.Flags().StringToStringVar(&info.Labels, "label", nil, "cluster label as key=value, can be repeated")
+	return ac
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+	"github.com/spinup-host/spinup/utils"
+)
+
+func backupsCmd() *cobra.Command {
+	bc := &cobra.Command{
+		Use:   "backups",
+		Short: "inspect the backups of clusters",
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	bc.PersistentFlags().StringVar(&cfgFile, "config",
+		fmt.Sprintf("%s/.local/spinup/config.yaml", home), "Path to spinup configuration")
+
+	var refresh bool
+	lc := &cobra.Command{
+		Use:   "list <cluster-id>",
+		Short: "list the base backups of a cluster, from the backup catalog",
+		Long: `Lists the base backups of a cluster, oldest first. The backup catalog is kept in the metastore; it's read from
+the cluster's backup destination with wal-g the first time, and again with --refresh.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, err := newClusterService()
+			if err != nil {
+				return err
+			}
+			// the CLI runs on the spinup host, so it can list the backups of every user.
+			catalog, err := svc.ListBackups(cmd.Context(), service.User{ID: "spinup", Admin: true}, args[0], refresh)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "refreshed at %s\n", catalog.RefreshedAt.Local().Format(time.RFC3339))
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSTARTED\tFINISHED\tSIZE\tWAL\tDELTA")
+			for _, b := range catalog.Backups {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s-%s\t%t\n", b.Name, b.StartTime.Local().Format(time.RFC3339),
+					b.FinishTime.Local().Format(time.RFC3339), units.HumanSize(float64(b.CompressedSize)), b.WalStart, b.WalEnd, b.Delta)
+			}
+			return w.Flush()
+		},
+	}
+	lc.Flags().BoolVar(&refresh, "refresh", false, "read the backups from the backup destination instead of the catalog")
+	bc.AddCommand(lc)
+
+	var timeout time.Duration
+	rc := &cobra.Command{
+		Use:   "run <cluster-id>",
+		Short: "take a backup of a cluster now",
+		Long: `Takes a base backup of a cluster to its backup destination, outside of its backup schedule, and waits for it
+to finish. The cluster's retention policy is applied after the backup.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bs, db, err := newBackupService()
+			if err != nil {
+				return err
+			}
+			op, err := bs.TriggerBackup(cmd.Context(), service.User{ID: "spinup", Admin: true}, args[0], nil)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "backup %s started\n", op.ID)
+			// the backup runs in this process, so it must be waited for.
+			deadline := time.Now().Add(timeout)
+			for op.Status == metastore.OperationRunning {
+				if time.Now().After(deadline) {
+					return fmt.Errorf("backup %s didn't finish within %s", op.ID, timeout)
+				}
+				time.Sleep(time.Second)
+				if op, err = metastore.GetOperation(db, op.ID); err != nil {
+					return err
+				}
+			}
+			if op.Status == metastore.OperationFailed {
+				return fmt.Errorf("backup %s failed: %s", op.ID, op.Error)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "backup %s %s\n", op.ID, op.Status)
+			return nil
+		},
+	}
+	rc.Flags().DurationVar(&timeout, "timeout", 6*time.Hour, "how long to wait for the backup to finish")
+	bc.AddCommand(rc)
+
+	var limit int
+	var showLogs bool
+	hc := &cobra.Command{
+		Use:   "history <cluster-id>",
+		Short: "list the backup runs of a cluster",
+		Long: `Lists the latest backup runs of a cluster, newest first, and the health of its backups, which are failing after
+consecutive failed runs. Use --logs to print the logs of the backup container of each run.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bs, _, err := newBackupService()
+			if err != nil {
+				return err
+			}
+			history, err := bs.BackupHistory(cmd.Context(), service.User{ID: "spinup", Admin: true}, args[0], limit, showLogs)
+			if err != nil {
+				return err
+			}
+			health := history.Health
+			fmt.Fprintf(cmd.OutOrStdout(), "health: %s", health.Status)
+			if health.ConsecutiveFailures > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), ", %d consecutive failures", health.ConsecutiveFailures)
+			}
+			if health.LastSuccess != nil {
+				fmt.Fprintf(cmd.OutOrStdout(), ", last success at %s", health.LastSuccess.Local().Format(time.RFC3339))
+			}
+			fmt.Fprintln(cmd.OutOrStdout())
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTRIGGER\tSTATUS\tSTARTED\tDURATION\tEXIT CODE\tBACKUP\tSIZE\tERROR")
+			for _, run := range history.Runs {
+				duration := "-"
+				if run.FinishedAt != nil {
+					duration = run.FinishedAt.Sub(run.StartedAt).String()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", run.ID, run.Trigger, run.Status,
+					run.StartedAt.Local().Format(time.RFC3339), duration, run.ExitCode, run.BackupName,
+					units.HumanSize(float64(run.BytesUploaded)), run.Error)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if showLogs {
+				for _, run := range history.Runs {
+					fmt.Fprintf(cmd.OutOrStdout(), "\n==> %s <==\n%s", run.ID, run.Logs)
+				}
+			}
+			return nil
+		},
+	}
+	hc.Flags().IntVar(&limit, "limit", 20, "number of runs to list, 0 for all")
+	hc.Flags().BoolVar(&showLogs, "logs", false, "print the logs of each run")
+	bc.AddCommand(hc)
+	return bc
+}
+
+// newBackupService returns a backup service using the configured docker host and metastore.
+func newBackupService() (service.BackupService, metastore.Db, error) {
+	utils.InitializeLogger("", "")
+	if err := validateConfig(cfgFile); err != nil {
+		return service.BackupService{}, metastore.Db{}, fmt.Errorf("failed to validate config: %w", err)
+	}
+	dockerClient, err := newDockerClient(context.Background())
+	if err != nil {
+		return service.BackupService{}, metastore.Db{}, err
+	}
+	db, err := openMetastore()
+	if err != nil {
+		return service.BackupService{}, metastore.Db{}, err
+	}
+	return service.NewBackupService(db, dockerClient, utils.Logger), db, nil
+}
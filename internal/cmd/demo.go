@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/service"
+	"github.com/spinup-host/spinup/utils"
+)
+
+// demoAPIKey is the API key of demo mode, unless SPINUP_API_KEY is set.
+const demoAPIKey = "spinup"
+
+// demoConfig returns the configuration used by demo mode: clusters are simulated by the in-memory runtime, the
+// metastore lives in a temporary directory, and requests made with the API key are made by an admin.
+func demoConfig() (config.Configuration, error) {
+	cfg := config.Configuration{}
+	projectDir, err := os.MkdirTemp("", "spinup-demo")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Common.ProjectDir = projectDir
+	cfg.Common.Architecture = "amd64"
+	cfg.Common.Ports = []int{5432, 5433, 5434, 5435, 5436, 5437, 5438, 5439}
+	cfg.Common.ApiKey = demoAPIKey
+	if key := os.Getenv("SPINUP_API_KEY"); key != "" {
+		cfg.Common.ApiKey = key
+	}
+	cfg.Common.Admins = []string{"testuser"}
+	cfg.PromConfig.Port = 9090
+	cfg.Runtime.Type = dockerservice.RuntimeMemory
+
+	// tokens are signed with a key that only lives as long as the demo.
+	if cfg.SignKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		return cfg, err
+	}
+	cfg.VerifyKey = &cfg.SignKey.PublicKey
+	return cfg, nil
+}
+
+// seedDemoClusters creates a few clusters so that the demo doesn't start empty.
+func seedDemoClusters(ctx context.Context, svc service.Service) {
+	clusters := []metastore.ClusterInfo{
+		{Name: "demo-app", MajVersion: 14, MinVersion: 5, Labels: map[string]string{"env": "production", "team": "web"}},
+		{Name: "demo-analytics", MajVersion: 13, MinVersion: 6, Memory: 512, CPU: 512, Labels: map[string]string{"env": "staging"}},
+	}
+	for i, info := range clusters {
+		info.Architecture = appConfig.Common.Architecture
+		info.Type = "postgres"
+		info.Host = "localhost"
+		info.Port = appConfig.Common.Ports[i]
+		info.Username = "postgres"
+		info.Password = "postgres"
+		if err := svc.CreateService(ctx, service.User{ID: "testuser", Admin: true}, &info); err != nil {
+			utils.Logger.Error("could not create demo cluster", zap.String("name", info.Name), zap.Error(err))
+			continue
+		}
+		utils.Logger.Info(fmt.Sprintf("created demo cluster %s on port %d", info.Name, info.Port))
+	}
+}
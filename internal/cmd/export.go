@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/spinup-host/spinup/internal/export"
+	"github.com/spinup-host/spinup/internal/service"
+	"github.com/spinup-host/spinup/utils"
+)
+
+func exportCmd() *cobra.Command {
+	var format, output string
+	ec := &cobra.Command{
+		Use:   "export <cluster-id>",
+		Short: "export a cluster as a docker compose file or Kubernetes manifests",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, err := newClusterService()
+			if err != nil {
+				return err
+			}
+			// the CLI runs on the spinup host, so it can export the clusters of every user.
+			data, err := svc.ExportCluster(cmd.Context(), service.User{ID: "spinup", Admin: true}, args[0], format)
+			if err != nil {
+				return err
+			}
+			if output == "" || output == "-" {
+				_, err = cmd.OutOrStdout().Write(data)
+				return err
+			}
+			return os.WriteFile(output, data, 0o644)
+		},
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	ec.Flags().StringVar(&cfgFile, "config",
+		fmt.Sprintf("%s/.local/spinup/config.yaml", home), "Path to spinup configuration")
+	ec.Flags().StringVarP(&format, "format", "f", export.FormatCompose,
+		fmt.Sprintf("export format, %s or %s", export.FormatCompose, export.FormatKubernetes))
+	ec.Flags().StringVarP(&output, "output", "o", "", "file to write the export to, defaults to stdout")
+	return ec
+}
+
+// newClusterService creates a cluster service from the configuration file, for commands that run without the API
+// server.
+func newClusterService() (service.Service, error) {
+	utils.InitializeLogger("", "")
+	if err := validateConfig(cfgFile); err != nil {
+		return service.Service{}, fmt.Errorf("failed to validate config: %w", err)
+	}
+	dockerClient, err := newDockerClient(context.Background())
+	if err != nil {
+		return service.Service{}, err
+	}
+	db, err := openMetastore()
+	if err != nil {
+		return service.Service{}, err
+	}
+	return service.NewService(dockerClient, db, nil, utils.Logger, appConfig), nil
+}
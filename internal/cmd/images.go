@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/spinup-host/spinup/internal/service"
+	"github.com/spinup-host/spinup/utils"
+)
+
+func imagesCmd() *cobra.Command {
+	ic := &cobra.Command{
+		Use:   "images",
+		Short: "manage the docker images used by spinup",
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	ic.PersistentFlags().StringVar(&cfgFile, "config",
+		fmt.Sprintf("%s/.local/spinup/config.yaml", home), "Path to spinup configuration")
+
+	ic.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "list the postgres and tooling images with their size and the clusters using them",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, err := newImageService()
+			if err != nil {
+				return err
+			}
+			images, err := svc.ListImages(cmd.Context())
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KIND\tIMAGE\tSIZE\tCLUSTERS")
+			for _, image := range images {
+				size := "not pulled"
+				if image.Pulled {
+					size = units.HumanSize(float64(image.Size))
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", image.Kind, image.Image, size, strings.Join(image.Clusters, ","))
+			}
+			return w.Flush()
+		},
+	})
+	ic.AddCommand(&cobra.Command{
+		Use:   "prune",
+		Short: "remove the postgres images that no cluster uses",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, err := newImageService()
+			if err != nil {
+				return err
+			}
+			removed, err := svc.PruneImages(cmd.Context())
+			for _, image := range removed {
+				fmt.Fprintf(cmd.OutOrStdout(), "removed %s (%s)\n", image.Image, units.HumanSize(float64(image.Size)))
+			}
+			return err
+		},
+	})
+	ic.AddCommand(&cobra.Command{
+		Use:   "pull",
+		Short: "pull the images of the pre-pull list",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, err := newImageService()
+			if err != nil {
+				return err
+			}
+			svc.PrePull(cmd.Context())
+			return nil
+		},
+	})
+	return ic
+}
+
+// newImageService creates an image service from the configuration file, for commands that run without the API server.
+func newImageService() (service.ImageService, error) {
+	utils.InitializeLogger("", "")
+	if err := validateConfig(cfgFile); err != nil {
+		return service.ImageService{}, fmt.Errorf("failed to validate config: %w", err)
+	}
+	dockerClient, err := newDockerClient(context.Background())
+	if err != nil {
+		return service.ImageService{}, err
+	}
+	db, err := openMetastore()
+	if err != nil {
+		return service.ImageService{}, err
+	}
+	return service.NewImageService(dockerClient, db, utils.Logger, appConfig), nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/secrets"
+	"github.com/spinup-host/spinup/utils"
+)
+
+func keysCmd() *cobra.Command {
+	kc := &cobra.Command{
+		Use:   "keys",
+		Short: "manage the master key encrypting the secrets in the metastore",
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	kc.PersistentFlags().StringVar(&cfgFile, "config",
+		fmt.Sprintf("%s/.local/spinup/config.yaml", home), "Path to spinup configuration")
+
+	var prune bool
+	rc := &cobra.Command{
+		Use:   "rotate",
+		Short: "replace the master key and re-encrypt all secrets with the new key",
+		Long: "Replaces the master key and re-encrypts all secrets with the new key. The previous keys stay in the key " +
+			"file, where they only decrypt, so that metastore backups and state exports taken before the rotation can " +
+			"still be read. Use --prune to remove them once no such copy is needed. Stop spinup first: a running server " +
+			"only knows the previous key.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			utils.InitializeLogger("", "")
+			if err := validateConfig(cfgFile); err != nil {
+				return fmt.Errorf("failed to validate config: %w", err)
+			}
+			keyring, err := loadKeyring()
+			if err != nil {
+				return err
+			}
+			if err := keyring.Rotate(); err != nil {
+				return err
+			}
+			db, err := metastore.Open(appConfig.MetastoreDSN(), metastore.WithKeyring(keyring))
+			if err != nil {
+				return err
+			}
+			n, err := metastore.EncryptSecrets(db)
+			if err != nil {
+				return err
+			}
+			if prune {
+				if err := keyring.Prune(); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "rotated the master key and re-encrypted %d secrets\n", n)
+			return nil
+		},
+	}
+	rc.Flags().BoolVar(&prune, "prune", false, "remove the previous keys from the key file")
+	kc.AddCommand(rc)
+	return kc
+}
+
+// openMetastore opens the configured metastore, with its secrets encrypted by the master key.
+func openMetastore() (metastore.Db, error) {
+	keyring, err := loadKeyring()
+	if err != nil {
+		return metastore.Db{}, err
+	}
+	return metastore.Open(appConfig.MetastoreDSN(), metastore.WithKeyring(keyring))
+}
+
+func loadKeyring() (*secrets.Keyring, error) {
+	keyring, err := secrets.Load(appConfig.Common.ProjectDir, appConfig.Secrets.MasterKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load master key: %w", err)
+	}
+	return keyring, nil
+}
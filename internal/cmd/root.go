@@ -17,6 +17,12 @@ var rootCmd = &cobra.Command{
 func Execute(ctx context.Context, buildInfo build.Info) error {
 	rootCmd.AddCommand(versionCmd(buildInfo))
 	rootCmd.AddCommand(startCmd())
+	rootCmd.AddCommand(imagesCmd())
+	rootCmd.AddCommand(exportCmd())
+	rootCmd.AddCommand(adoptCmd())
+	rootCmd.AddCommand(keysCmd())
+	rootCmd.AddCommand(stateCmd())
+	rootCmd.AddCommand(backupsCmd())
 
 	return rootCmd.ExecuteContext(ctx)
 }
@@ -9,7 +9,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path"
 	"path/filepath"
@@ -39,6 +38,7 @@ var (
 	cfgFile string
 	uiPath  string
 	apiOnly bool
+	demo    bool
 
 	apiPort = ":4434"
 	uiPort  = ":3000"
@@ -47,19 +47,7 @@ var (
 	appConfig      config.Configuration
 )
 
-func apiHandler() http.Handler {
-	dockerClient, err := dockerservice.NewDocker(config.DefaultNetworkName)
-	if err != nil {
-		utils.Logger.Error("could not create docker client", zap.Error(err))
-	}
-	projectDir := filepath.Join(appConfig.Common.ProjectDir, "metastore.db")
-	db, err := metastore.NewDb(projectDir)
-	if err != nil {
-		utils.Logger.Fatal("unable to setup sqlite database", zap.Error(err))
-	}
-
-	clusterService := service.NewService(dockerClient, db, monitorRuntime, utils.Logger, appConfig)
-
+func apiHandler(clusterService service.Service, backupService service.BackupService, imageService service.ImageService) http.Handler {
 	ch, err := api.NewClusterHandler(clusterService, appConfig, utils.Logger)
 	if err != nil {
 		utils.Logger.Fatal("unable to create NewClusterHandler")
@@ -69,8 +57,8 @@ func apiHandler() http.Handler {
 		utils.Logger.Fatal("unable to create NewClusterHandler")
 	}
 
-	backupService := service.NewBackupService(db, dockerClient, utils.Logger)
 	bh := api.NewBackupHandler(appConfig, backupService, utils.Logger)
+	ih := api.NewImageHandler(appConfig, imageService, utils.Logger)
 	githubHandler := api.NewGithubAuthHandler(appConfig.SignKey, appConfig.Common.ClientID, appConfig.Common.ClientSecret)
 
 	rand.Seed(time.Now().UnixNano())
@@ -82,8 +70,26 @@ func apiHandler() http.Handler {
 	mux.HandleFunc("/streamlogs", api.StreamLogs)
 	mux.HandleFunc("/listcluster", ch.ListCluster)
 	mux.HandleFunc("/cluster", ch.GetCluster)
+	mux.HandleFunc("/events", ch.ListEvents)
+	mux.HandleFunc("/resizecluster", ch.ResizeCluster)
+	mux.HandleFunc("/quota", ch.GetQuota)
+	mux.HandleFunc("/clusterlabels", ch.UpdateLabels)
+	mux.HandleFunc("/deletecluster", ch.DeleteCluster)
+	mux.HandleFunc("/extendcluster", ch.ExtendCluster)
+	mux.HandleFunc("/idlepolicy", ch.SetIdlePolicy)
+	mux.HandleFunc("/exportcluster", ch.ExportCluster)
+	mux.HandleFunc("/adoptcluster", ch.AdoptCluster)
 	mux.HandleFunc("/metrics", mh.ServeHTTP)
 	mux.HandleFunc("/createbackup", bh.CreateBackup)
+	mux.HandleFunc("/triggerbackup", bh.TriggerBackup)
+	mux.HandleFunc("/backupruns", bh.BackupRuns)
+	mux.HandleFunc("/backupretention", bh.RetentionPolicy)
+	mux.HandleFunc("/applyretention", bh.ApplyRetention)
+	mux.HandleFunc("/backups", ch.ListBackups)
+	mux.HandleFunc("/restorebackup", ch.RestoreBackup)
+	mux.HandleFunc("/operation", ch.GetOperation)
+	mux.HandleFunc("/images", ih.ListImages)
+	mux.HandleFunc("/pruneimages", ih.PruneImages)
 	mux.HandleFunc("/altauth", ch.AltAuth)
 	c := cors.New(cors.Options{
 		AllowedHeaders: []string{"authorization", "content-type", "x-api-key"},
@@ -98,21 +104,27 @@ func startCmd() *cobra.Command {
 		Short: "start the spinup API and frontend servers",
 		Run: func(cmd *cobra.Command, args []string) {
 			utils.InitializeLogger("", "")
-			if !isDockerdRunning(context.Background()) {
-				log.Fatalf("FATAL: docker daemon is not running. Start docker daemon")
-			}
-			log.Println(fmt.Sprintf("INFO: Using config file: %s", cfgFile))
-			if err := validateConfig(cfgFile); err != nil {
-				log.Fatalf("FATAL: failed to validate config: %v", err)
+			if demo {
+				var err error
+				if appConfig, err = demoConfig(); err != nil {
+					log.Fatalf("FATAL: failed to set up demo mode: %v", err)
+				}
+				defer os.RemoveAll(appConfig.Common.ProjectDir)
+				log.Println(fmt.Sprintf("INFO: Running in demo mode with simulated clusters, use the API key '%s'", appConfig.Common.ApiKey))
+			} else {
+				log.Println(fmt.Sprintf("INFO: Using config file: %s", cfgFile))
+				if err := validateConfig(cfgFile); err != nil {
+					log.Fatalf("FATAL: failed to validate config: %v", err)
+				}
+				log.Println("INFO: Initial Validations successful")
 			}
-			log.Println("INFO: Initial Validations successful")
 			utils.InitializeLogger(appConfig.Common.LogDir, appConfig.Common.LogFile)
 
-			dockerClient, err := dockerservice.NewDocker(config.DefaultNetworkName)
+			ctx := context.TODO()
+			dockerClient, err := newDockerClient(ctx)
 			if err != nil {
-				utils.Logger.Error("could not create docker client", zap.Error(err))
+				log.Fatalf("FATAL: %v", err)
 			}
-			ctx := context.TODO()
 			_, err = dockerClient.CreateNetwork(ctx)
 			if err != nil {
 				if errors.Is(err, dockerservice.ErrDuplicateNetwork) {
@@ -122,8 +134,20 @@ func startCmd() *cobra.Command {
 				}
 			}
 
+			db, err := openMetastore()
+			if err != nil {
+				utils.Logger.Fatal("unable to setup sqlite database", zap.Error(err))
+			}
+			// secrets stored before encryption was enabled, or before an interrupted key rotation, are re-encrypted.
+			if n, err := metastore.EncryptSecrets(db); err != nil {
+				utils.Logger.Fatal("unable to encrypt metastore secrets", zap.Error(err))
+			} else if n > 0 {
+				utils.Logger.Info("encrypted metastore secrets", zap.Int("count", n))
+			}
+
 			if appConfig.Common.Monitoring {
-				monitorRuntime = monitor.NewRuntime(dockerClient, monitor.WithLogger(utils.Logger), monitor.WithAppConfig(appConfig))
+				monitorRuntime = monitor.NewRuntime(dockerClient, monitor.WithLogger(utils.Logger), monitor.WithAppConfig(appConfig),
+					monitor.WithStore(db))
 				if err := monitorRuntime.BootstrapServices(ctx); err != nil {
 					utils.Logger.Error("could not start monitoring services", zap.Error(err))
 				} else {
@@ -131,23 +155,52 @@ func startCmd() *cobra.Command {
 				}
 			}
 
+			clusterService := service.NewService(dockerClient, db, monitorRuntime, utils.Logger, appConfig)
+			backupService := service.NewBackupService(db, dockerClient, utils.Logger)
+			// backup schedules are restored from the metastore, and the scheduler is stopped after the API server.
+			if err := backupService.StartScheduler(); err != nil {
+				utils.Logger.Error("could not restore backup schedules", zap.Error(err))
+			}
+			imageService := service.NewImageService(dockerClient, db, utils.Logger, appConfig)
+			if demo {
+				seedDemoClusters(ctx, clusterService)
+			}
+
+			backgroundCtx, stopBackground := context.WithCancel(ctx)
+			defer stopBackground()
+			go service.NewReaper(clusterService).Run(backgroundCtx)
+			go service.NewIdleManager(clusterService).Run(backgroundCtx)
+			go service.NewContainerWatcher(clusterService).Run(backgroundCtx)
+			go imageService.PrePull(backgroundCtx)
+			if backup := appConfig.Metastore.Backup; backup.Interval > 0 {
+				if db.Backend != nil && db.Backend.Name() != (metastore.SQLite{}).Name() {
+					utils.Logger.Warn("scheduled metastore backups are only supported for sqlite metastores",
+						zap.String("backend", db.Backend.Name()))
+				} else {
+					go service.NewStateBackup(db, appConfig.MetastoreBackupDir(), backup.Interval, utils.Logger,
+						service.WithStateBackupKeep(backup.Keep)).Run(backgroundCtx)
+				}
+			}
+
 			apiListener, err := net.Listen("tcp", apiPort)
 			if err != nil {
 				utils.Logger.Fatal("failed to start listener", zap.Error(err))
 			}
 			apiServer := &http.Server{
-				Handler: apiHandler(),
+				Handler: apiHandler(clusterService, backupService, imageService),
 			}
-			defer stop(apiServer)
 
 			stopCh := make(chan os.Signal, 1)
+			signal.Notify(stopCh, syscall.SIGINT, syscall.SIGTERM)
 			go func() {
 				utils.Logger.Info("starting Spinup API ", zap.String("port", apiPort))
-				if err = apiServer.Serve(apiListener); err != nil {
+				if err := apiServer.Serve(apiListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 					utils.Logger.Fatal("failed to start API server", zap.Error(err))
 				}
 			}()
 
+			var uiServer *http.Server
+
 			if apiOnly == false {
 				uiListener, err := net.Listen("tcp", uiPort)
 				if err != nil {
@@ -174,23 +227,28 @@ func startCmd() *cobra.Command {
 					fs.ServeHTTP(w, r)
 				})
 
-				uiServer := &http.Server{
+				uiServer = &http.Server{
 					Handler: http.DefaultServeMux,
 				}
 				go func() {
 					utils.Logger.Info("starting Spinup UI", zap.String("port", uiPort))
-					if err = uiServer.Serve(uiListener); err != nil {
+					if err := uiServer.Serve(uiListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
 						utils.Logger.Fatal("failed to start UI server", zap.Error(err))
 					}
 				}()
-				defer stop(uiServer)
 			}
 
-			signal.Notify(stopCh, syscall.SIGINT, syscall.SIGTERM)
-			log.Println(fmt.Sprint(<-stopCh))
-			utils.Logger.Info(fmt.Sprint(<-stopCh))
+			utils.Logger.Info("received signal", zap.String("signal", fmt.Sprint(<-stopCh)))
 			utils.Logger.Info("stopping spinup apiServer")
-
+			// the servers are shut down first, so that no request starts a backup while the scheduler stops.
+			stop(apiServer)
+			if uiServer != nil {
+				stop(uiServer)
+			}
+			stopBackground()
+			stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			backupService.StopScheduler(stopCtx)
 		},
 	}
 
@@ -203,6 +261,7 @@ func startCmd() *cobra.Command {
 	sc.Flags().StringVar(&uiPath, "ui-path",
 		fmt.Sprintf("%s/.local/spinup/spinup-dash", home), "Path to spinup frontend")
 	sc.Flags().BoolVar(&apiOnly, "api-only", false, "Only run the API server (without the UI server). Useful for development")
+	sc.Flags().BoolVar(&demo, "demo", false, "Simulate clusters in memory instead of running them with docker. Useful for frontend development")
 
 	return sc
 }
@@ -252,17 +311,17 @@ func stop(server *http.Server) {
 	}
 }
 
-// isDockerdRunning returns true if docker daemon process is running on the host
-// ref: https://docs.docker.com/config/daemon/#check-whether-docker-is-running
-func isDockerdRunning(ctx context.Context) bool {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-	stdout, err := exec.CommandContext(ctx, "docker", "info").CombinedOutput()
+// newDockerClient connects to the configured (or detected) container runtime.
+func newDockerClient(ctx context.Context) (dockerservice.Docker, error) {
+	rt, runtimeType, err := dockerservice.NewRuntime(ctx, appConfig.Runtime)
 	if err != nil {
-		return false
+		return dockerservice.Docker{}, fmt.Errorf("container runtime is not available: %w", err)
 	}
-	if strings.Contains(string(stdout), "ERROR") {
-		return false
+	utils.Logger.Info("using container runtime", zap.String("runtime", runtimeType))
+
+	dockerClient := dockerservice.NewDockerWithRuntime(config.DefaultNetworkName, rt)
+	if dockerClient.RegistryAuths, err = dockerservice.RegistryAuths(appConfig.Registry); err != nil {
+		return dockerservice.Docker{}, fmt.Errorf("unable to load registry credentials: %w", err)
 	}
-	return true
+	return dockerClient, nil
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/secrets"
+	"github.com/spinup-host/spinup/utils"
+)
+
+func stateCmd() *cobra.Command {
+	sc := &cobra.Command{
+		Use:   "state",
+		Short: "export and import the metastore, to back it up or move it to another project directory",
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "~"
+	}
+	sc.PersistentFlags().StringVar(&cfgFile, "config",
+		fmt.Sprintf("%s/.local/spinup/config.yaml", home), "Path to spinup configuration")
+
+	var output string
+	ec := &cobra.Command{
+		Use:   "export",
+		Short: "dump every table of the metastore to a JSON document",
+		Long: "Dumps every table of the metastore to a versioned JSON document. Passwords are exported encrypted, so " +
+			"importing the document requires the master key of this project directory.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := openStateMetastore()
+			if err != nil {
+				return err
+			}
+			state, err := metastore.ExportState(db)
+			if err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(state, "", "  ")
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+			if output == "" || output == "-" {
+				_, err = cmd.OutOrStdout().Write(data)
+				return err
+			}
+			return os.WriteFile(output, data, 0o600)
+		},
+	}
+	ec.Flags().StringVarP(&output, "output", "o", "", "file to write the state to, defaults to stdout")
+	sc.AddCommand(ec)
+
+	sc.AddCommand(&cobra.Command{
+		Use:   "import <file>",
+		Short: "restore an exported state into an empty metastore",
+		Long: "Restores a state written by 'spinup state export' into the configured metastore, which must be empty. " +
+			"The master key of the exporting project directory must be copied along with the state, or set with " +
+			secrets.EnvMasterKey + ".",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			state, err := metastore.ReadState(f)
+			if err != nil {
+				return err
+			}
+			db, err := openStateMetastore()
+			if err != nil {
+				return err
+			}
+			if err := metastore.ImportState(db, state); err != nil {
+				if errors.Is(err, secrets.ErrUnknownKey) {
+					return fmt.Errorf("%w; copy %s from the exporting project directory or set %s",
+						err, secrets.KeyFileName, secrets.EnvMasterKey)
+				}
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "imported %d clusters\n", len(state.Tables["clusterinfo"]))
+			return nil
+		},
+	})
+	return sc
+}
+
+func openStateMetastore() (metastore.Db, error) {
+	utils.InitializeLogger("", "")
+	if err := validateConfig(cfgFile); err != nil {
+		return metastore.Db{}, fmt.Errorf("failed to validate config: %w", err)
+	}
+	return openMetastore()
+}
@@ -1,11 +1,13 @@
 package dockerservice
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/docker/docker/api/types"
@@ -34,6 +36,9 @@ type Container struct {
 	HostConfig    container.HostConfig // non-portable docker config
 	NetworkConfig network.NetworkingConfig
 	Warning       []string
+	// Files is a tar archive that Start extracts at the root of the container, after creating it and before starting
+	// it, for files the container needs as soon as it starts.
+	Files io.Reader
 }
 
 // NewContainer returns a container with provided name.
@@ -52,13 +57,13 @@ func NewContainer(name string, config container.Config, hostConfig container.Hos
 func (c *Container) Start(ctx context.Context, d Docker) (container.ContainerCreateCreatedBody, error) {
 	body := container.ContainerCreateCreatedBody{}
 
-	exists, err := imageExistsLocally(context.Background(), d, c.Config.Image)
+	exists, err := imageExistsLocally(ctx, d, c.Config.Image)
 	if err != nil {
 		return body, errors.Wrap(err, "error checking whether the image exists locally")
 	}
 	if !exists {
 		log.Printf("INFO: docker image %s doesn't exist on the host. Will attempt to pull in the background \n", c.Config.Image)
-		if err := pullImageFromDockerRegistry(d, c.Config.Image); err != nil {
+		if err := pullImageFromDockerRegistry(ctx, d, c.Config.Image); err != nil {
 			return body, errors.Wrap(err, "pulling image from docker registry")
 		}
 	}
@@ -74,6 +79,12 @@ func (c *Container) Start(ctx context.Context, d Docker) (container.ContainerCre
 		return body, errors.Wrapf(err, "unable to create container with image %s", c.Config.Image)
 	}
 
+	if c.Files != nil {
+		if err := d.Cli.CopyToContainer(ctx, body.ID, "/", c.Files, types.CopyToContainerOptions{}); err != nil {
+			return body, errors.Wrapf(err, "unable to copy files to container %s", body.ID)
+		}
+	}
+
 	err = d.Cli.ContainerStart(ctx, body.ID, c.Options)
 	if err != nil {
 		return body, errors.Wrapf(err, "unable to start container for image %s", c.Config.Image)
@@ -132,6 +143,16 @@ func (c *Container) Restart(ctx context.Context, d Docker) error {
 	return nil
 }
 
+// Update changes the resources (memory, CPU shares, etc.) of an existing container without restarting it.
+func (c *Container) Update(ctx context.Context, d Docker, resources container.Resources) error {
+	_, err := d.Cli.ContainerUpdate(ctx, c.ID, container.UpdateConfig{Resources: resources})
+	if err != nil {
+		return errors.Wrapf(err, "unable to update container: %s", c.ID)
+	}
+	c.HostConfig.Resources = resources
+	return nil
+}
+
 // imageExistsLocally returns a boolean indicating if an image with the
 // requested name exists in the local docker image store
 func imageExistsLocally(ctx context.Context, d Docker, imageName string) (bool, error) {
@@ -164,16 +185,22 @@ func imageExistsLocally(ctx context.Context, d Docker, imageName string) (bool,
 	return false, nil
 }
 
-func pullImageFromDockerRegistry(d Docker, image string) error {
-	rc, err := d.Cli.ImagePull(context.Background(), image, types.ImagePullOptions{
+// pullImageFromDockerRegistry pulls the image and waits for the pull to complete. Progress is reported to the func set
+// on the context with WithPullProgress.
+func pullImageFromDockerRegistry(ctx context.Context, d Docker, image string) error {
+	registryAuth, err := d.registryAuthFor(image)
+	if err != nil {
+		return err
+	}
+	rc, err := d.Cli.ImagePull(ctx, image, types.ImagePullOptions{
 		//		Platform: "linux/amd64",
+		RegistryAuth: registryAuth,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to pull docker image %s %w", image, err)
 	}
 	defer rc.Close()
-	_, err = io.ReadAll(rc)
-	if err != nil {
+	if err := readPullStream(rc, image, pullProgressFrom(ctx)); err != nil {
 		return fmt.Errorf("unable to download docker image %s %w", image, err)
 	}
 	return nil
@@ -207,6 +234,65 @@ func (c Container) ExecCommand(ctx context.Context, d Docker, execConfig types.E
 	return execResponse, nil
 }
 
+// ExecResult holds the output and exit code of a command executed in a container.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Exec executes a command in the container and waits for it to complete. Unlike ExecCommand, the output of the
+// command is captured and returned alongside its exit code instead of being written to stdout and stderr.
+func (c Container) Exec(ctx context.Context, d Docker, execConfig types.ExecConfig) (ExecResult, error) {
+	if c.ID == "" {
+		return ExecResult{}, errors.New("container id is empty")
+	}
+	execConfig.AttachStdout = true
+	execConfig.AttachStderr = true
+	execResponse, err := d.Cli.ContainerExecCreate(ctx, c.ID, execConfig)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("creating container exec %w", err)
+	}
+	resp, err := d.Cli.ContainerExecAttach(ctx, execResponse.ID, types.ExecStartCheck{Tty: false})
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("creating container exec attach %w", err)
+	}
+	defer resp.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader); err != nil {
+		return ExecResult{}, fmt.Errorf("unable to read the output of the command, %w", err)
+	}
+	inspect, err := d.Cli.ContainerExecInspect(ctx, execResponse.ID)
+	if err != nil {
+		return ExecResult{}, fmt.Errorf("inspecting container exec %w", err)
+	}
+	return ExecResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: inspect.ExitCode,
+	}, nil
+}
+
+// Logs returns the output of the container's main process, stdout and stderr interleaved. A positive tail returns only
+// its last lines.
+func (c Container) Logs(ctx context.Context, d Docker, tail int) (string, error) {
+	opts := types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Tail: "all"}
+	if tail > 0 {
+		opts.Tail = strconv.Itoa(tail)
+	}
+	rc, err := d.Cli.ContainerLogs(ctx, c.ID, opts)
+	if err != nil {
+		return "", fmt.Errorf("reading container logs %w", err)
+	}
+	defer rc.Close()
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, rc); err != nil {
+		return "", fmt.Errorf("unable to read the container logs, %w", err)
+	}
+	return out.String(), nil
+}
+
 // Stop stops a running docker container.
 func (c *Container) Stop(ctx context.Context, d Docker, opts types.ContainerStartOptions) error {
 	timeout := 20 // in seconds
@@ -17,8 +17,10 @@ import (
 )
 
 type Docker struct {
-	Cli         *client.Client
+	Cli         Runtime
 	NetworkName string
+	// RegistryAuths holds the credentials used to pull images, keyed by registry host.
+	RegistryAuths map[string]types.AuthConfig
 }
 
 // NewDocker returns a Docker struct
@@ -30,6 +32,11 @@ func NewDocker(networkName string, opts ...client.Opt) (Docker, error) {
 	return Docker{NetworkName: networkName, Cli: cli}, nil
 }
 
+// NewDockerWithRuntime returns a Docker struct using the given container runtime.
+func NewDockerWithRuntime(networkName string, rt Runtime) Docker {
+	return Docker{NetworkName: networkName, Cli: rt}
+}
+
 var ErrDuplicateNetwork = errors.New("duplicate networks found with given name")
 var ErrDuplicateContainerName = errors.New("a container already exists with the given name")
 
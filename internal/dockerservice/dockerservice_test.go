@@ -115,7 +115,7 @@ func Test_imageExistsLocally(t *testing.T) {
 				// INFO: not sure what's the best way to make sure an image exists locally, hence pulling it before testing imageExistsLocally.
 				// Perhaps we could move this to TestMain() which means we need to define a type for struct - not sure if it's that the right way to do
 				// postgres:9.6-alpine image will be pulled since its fairly small. It could be any image.
-				if err := pullImageFromDockerRegistry(dc.Docker, d.image); err != nil {
+				if err := pullImageFromDockerRegistry(ctx, dc.Docker, d.image); err != nil {
 					t.Errorf("error setting up imageExistsLocally() for test data %+v", d)
 				}
 			}
@@ -151,7 +151,7 @@ func Test_pullImageFromDockerRegistry(t *testing.T) {
 	}
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
-			actual := pullImageFromDockerRegistry(dc.Docker, d.image)
+			actual := pullImageFromDockerRegistry(ctx, dc.Docker, d.image)
 			if actual != d.expected {
 				if !strings.Contains(actual.Error(), d.expected.Error()) {
 					t.Errorf("incorrect result: actual %t , expected %t", actual, d.expected)
@@ -0,0 +1,56 @@
+package dockerservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+)
+
+// Image is an image stored on the docker host.
+type Image struct {
+	ID      string
+	Tags    []string
+	Size    int64 // in bytes
+	Created time.Time
+}
+
+// ListImages returns the images stored on the docker host.
+func (d Docker) ListImages(ctx context.Context) ([]Image, error) {
+	summaries, err := d.Cli.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing images")
+	}
+	images := make([]Image, 0, len(summaries))
+	for _, summary := range summaries {
+		images = append(images, Image{
+			ID:      summary.ID,
+			Tags:    summary.RepoTags,
+			Size:    summary.Size,
+			Created: time.Unix(summary.Created, 0),
+		})
+	}
+	return images, nil
+}
+
+// PullImage pulls the image from its registry, unless it already exists on the docker host.
+func (d Docker) PullImage(ctx context.Context, image string) error {
+	exists, err := imageExistsLocally(ctx, d, image)
+	if err != nil {
+		return errors.Wrap(err, "error checking whether the image exists locally")
+	}
+	if exists {
+		return nil
+	}
+	return pullImageFromDockerRegistry(ctx, d, image)
+}
+
+// RemoveImage removes an image, given by ID or reference, from the docker host. Removing a reference only untags the
+// image if it has other tags. It fails if a container still uses the image.
+func (d Docker) RemoveImage(ctx context.Context, image string) error {
+	if _, err := d.Cli.ImageRemove(ctx, image, types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+		return errors.Wrapf(err, "removing image %s", image)
+	}
+	return nil
+}
@@ -0,0 +1,1213 @@
+package dockerservice
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/docker/go-units"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ExecHandler simulates a command executed in a container of a MemoryRuntime. It receives the name of the container
+// and the command, and returns the command's output and exit code.
+type ExecHandler func(container string, cmd []string) ExecResult
+
+// MemoryRuntime is a Runtime that simulates containers, images, networks and volumes in memory, without running
+// anything. Containers go through the same states as with docker (created, running, exited), and the runtime
+// returns the errors docker does for e.g. duplicate names, ports that are already allocated or removing a running
+// container. Commands executed in containers are answered by an ExecHandler.
+// It's used in tests and in demo mode.
+type MemoryRuntime struct {
+	mu          sync.Mutex
+	containers  map[string]*memoryContainer // keyed by ID
+	images      map[string]*types.ImageInspect
+	networks    map[string]*types.NetworkResource
+	volumes     map[string]*volume.Volume
+	execs       map[string]*memoryExec
+	execHandler ExecHandler
+	now         func() time.Time
+	subnets     int // number of subnets handed out to networks
+	bindPorts   bool
+}
+
+type memoryContainer struct {
+	json      types.ContainerJSON
+	files     map[string][]byte // files copied into the container, keyed by path
+	listeners []net.Listener    // host ports the container listens on while running, see WithHostPorts
+	logs      []memoryLog       // output of the main process, see Log
+}
+
+type memoryLog struct {
+	stream stdcopy.StdType
+	text   string
+}
+
+type memoryExec struct {
+	containerID string
+	cmd         []string
+	result      *ExecResult
+}
+
+var _ Runtime = (*MemoryRuntime)(nil)
+
+type MemoryRuntimeOptions func(m *MemoryRuntime)
+
+// WithExecHandler sets the handler simulating the commands executed in containers. The default handler is
+// SimulatePostgres.
+func WithExecHandler(handler ExecHandler) MemoryRuntimeOptions {
+	return func(m *MemoryRuntime) {
+		m.execHandler = handler
+	}
+}
+
+// WithImages makes the given images available without pulling them.
+func WithImages(images ...string) MemoryRuntimeOptions {
+	return func(m *MemoryRuntime) {
+		for _, image := range images {
+			_ = m.addImage(image)
+		}
+	}
+}
+
+// WithHostPorts makes running containers listen on their published host ports, like docker does, so that the ports
+// are seen as used by other programs. Connections to the ports are accepted and closed right away.
+func WithHostPorts() MemoryRuntimeOptions {
+	return func(m *MemoryRuntime) {
+		m.bindPorts = true
+	}
+}
+
+// NewMemoryRuntime returns an empty MemoryRuntime, with only docker's default bridge network.
+func NewMemoryRuntime(opts ...MemoryRuntimeOptions) *MemoryRuntime {
+	m := &MemoryRuntime{
+		containers:  map[string]*memoryContainer{},
+		images:      map[string]*types.ImageInspect{},
+		networks:    map[string]*types.NetworkResource{},
+		volumes:     map[string]*volume.Volume{},
+		execs:       map[string]*memoryExec{},
+		execHandler: SimulatePostgres,
+		now:         time.Now,
+	}
+	bridge := m.newNetwork("bridge", "bridge")
+	m.networks[bridge.ID] = bridge
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// SimulatePostgres answers the commands spinup runs in postgres containers: pg_isready reports the server as
+// accepting connections and psql counts return zero. Other commands succeed without output.
+func SimulatePostgres(container string, cmd []string) ExecResult {
+	if len(cmd) == 0 {
+		return ExecResult{}
+	}
+	switch path.Base(cmd[0]) {
+	case "pg_isready":
+		return ExecResult{Stdout: "localhost:5432 - accepting connections\n"}
+	case "psql":
+		if strings.Contains(strings.ToLower(strings.Join(cmd, " ")), "count(") {
+			return ExecResult{Stdout: "0\n"}
+		}
+	}
+	return ExecResult{}
+}
+
+// ReadFile returns the content of a file copied into a container with CopyToContainer.
+func (m *MemoryRuntime) ReadFile(containerID, filePath string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return nil, false
+	}
+	content, ok := c.files[path.Clean(filePath)]
+	return content, ok
+}
+
+// Exit simulates the main process of a running container exiting with the given code, e.g. a crash.
+func (m *MemoryRuntime) Exit(containerID string, exitCode int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	if !c.json.State.Running {
+		return errdefs.Conflict(fmt.Errorf("Container %s is not running", c.json.ID))
+	}
+	m.stop(c, exitCode)
+	return nil
+}
+
+// Log simulates the main process of a container writing to its stdout and stderr, which is then returned by
+// ContainerLogs.
+func (m *MemoryRuntime) Log(containerID, stdout, stderr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	if stdout != "" {
+		c.logs = append(c.logs, memoryLog{stream: stdcopy.Stdout, text: stdout})
+	}
+	if stderr != "" {
+		c.logs = append(c.logs, memoryLog{stream: stdcopy.Stderr, text: stderr})
+	}
+	return nil
+}
+
+func (m *MemoryRuntime) Ping(ctx context.Context) (types.Ping, error) {
+	return types.Ping{APIVersion: "1.41", OSType: "linux"}, nil
+}
+
+func (m *MemoryRuntime) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []types.Container
+	for _, c := range m.containers {
+		if !options.All && !c.json.State.Running {
+			continue
+		}
+		if !m.matchContainer(c, options.Filters) {
+			continue
+		}
+		list = append(list, m.summary(c))
+	}
+	// docker lists the most recently created containers first.
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Created != list[j].Created {
+			return list[i].Created > list[j].Created
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (m *MemoryRuntime) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	return m.inspect(c), nil
+}
+
+func (m *MemoryRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.CreateResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if config == nil {
+		config = &container.Config{}
+	}
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+	image, err := m.image(config.Image)
+	if err != nil {
+		return container.CreateResponse{}, err
+	}
+	if containerName != "" {
+		if existing := m.containerByName(containerName); existing != nil {
+			return container.CreateResponse{}, errdefs.Conflict(fmt.Errorf("Conflict. The container name \"/%s\" is already in use by container \"%s\". You have to remove (or rename) that container to be able to reuse that name.", containerName, existing.json.ID))
+		}
+	}
+
+	id := stringid.GenerateRandomID()
+	if containerName == "" {
+		containerName = stringid.TruncateID(id)
+	}
+	endpoints := map[string]*network.EndpointSettings{}
+	if networkingConfig != nil {
+		for name := range networkingConfig.EndpointsConfig {
+			nw, err := m.network(name)
+			if err != nil {
+				return container.CreateResponse{}, err
+			}
+			endpoints[nw.Name] = &network.EndpointSettings{NetworkID: nw.ID}
+		}
+	}
+	if len(endpoints) == 0 {
+		bridge, err := m.network("bridge")
+		if err != nil {
+			return container.CreateResponse{}, err
+		}
+		endpoints[bridge.Name] = &network.EndpointSettings{NetworkID: bridge.ID}
+	}
+
+	var mounts []types.MountPoint
+	for _, mnt := range hostConfig.Mounts {
+		point := types.MountPoint{
+			Type:        mnt.Type,
+			Source:      mnt.Source,
+			Destination: mnt.Target,
+			RW:          !mnt.ReadOnly,
+		}
+		if mnt.Type == mount.TypeVolume {
+			// like docker, named volumes are created when they are first used.
+			vol := m.createVolume(volume.CreateOptions{Name: mnt.Source, Driver: "local"})
+			point.Name = vol.Name
+			point.Source = vol.Mountpoint
+			point.Driver = vol.Driver
+		}
+		mounts = append(mounts, point)
+	}
+
+	cfg := *config
+	hc := *hostConfig
+	c := &memoryContainer{
+		json: types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:         id,
+				Created:    m.now().UTC().Format(time.RFC3339Nano),
+				Name:       "/" + containerName,
+				Image:      image.ID,
+				State:      &types.ContainerState{Status: "created"},
+				HostConfig: &hc,
+				Driver:     "memory",
+				Platform:   "linux",
+			},
+			Mounts: mounts,
+			Config: &cfg,
+			NetworkSettings: &types.NetworkSettings{
+				Networks: endpoints,
+			},
+		},
+		files: map[string][]byte{},
+	}
+	m.containers[id] = c
+	return container.CreateResponse{ID: id}, nil
+}
+
+func (m *MemoryRuntime) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	return m.start(c)
+}
+
+func (m *MemoryRuntime) ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	if c.json.State.Running {
+		m.stop(c, 0)
+	}
+	if err := m.start(c); err != nil {
+		return err
+	}
+	c.json.RestartCount++
+	return nil
+}
+
+func (m *MemoryRuntime) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	if c.json.State.Running {
+		m.stop(c, 0)
+	}
+	return nil
+}
+
+func (m *MemoryRuntime) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	if c.json.State.Running && !options.Force {
+		return errdefs.Conflict(fmt.Errorf("You cannot remove a running container %s. Stop the container before attempting removal or force remove", c.json.ID))
+	}
+	c.closeListeners()
+	delete(m.containers, c.json.ID)
+	for id, exec := range m.execs {
+		if exec.containerID == c.json.ID {
+			delete(m.execs, id)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRuntime) ContainerUpdate(ctx context.Context, containerID string, updateConfig container.UpdateConfig) (container.ContainerUpdateOKBody, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return container.ContainerUpdateOKBody{}, err
+	}
+	c.json.HostConfig.Resources = updateConfig.Resources
+	if updateConfig.RestartPolicy.Name != "" {
+		c.json.HostConfig.RestartPolicy = updateConfig.RestartPolicy
+	}
+	return container.ContainerUpdateOKBody{}, nil
+}
+
+func (m *MemoryRuntime) ContainerRename(ctx context.Context, containerID, newContainerName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	newContainerName = strings.TrimPrefix(newContainerName, "/")
+	if existing := m.containerByName(newContainerName); existing != nil && existing != c {
+		return errdefs.Conflict(fmt.Errorf("Error when allocating new name: Conflict. The container name \"/%s\" is already in use by container \"%s\". You have to remove (or rename) that container to be able to reuse that name.", newContainerName, existing.json.ID))
+	}
+	c.json.Name = "/" + newContainerName
+	for _, endpoint := range c.json.NetworkSettings.Networks {
+		if nw := m.networks[endpoint.NetworkID]; nw != nil {
+			if resource, ok := nw.Containers[c.json.ID]; ok {
+				resource.Name = newContainerName
+				nw.Containers[c.json.ID] = resource
+			}
+		}
+	}
+	return nil
+}
+
+// ContainerLogs returns the output the container's main process wrote with Log, as a multiplexed stream. Like docker,
+// options.Tail limits the output to its last lines.
+func (m *MemoryRuntime) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return nil, err
+	}
+	var lines []memoryLog
+	for _, l := range c.logs {
+		if (l.stream == stdcopy.Stdout && !options.ShowStdout) || (l.stream == stdcopy.Stderr && !options.ShowStderr) {
+			continue
+		}
+		for _, line := range strings.SplitAfter(l.text, "\n") {
+			if line != "" {
+				lines = append(lines, memoryLog{stream: l.stream, text: line})
+			}
+		}
+	}
+	if tail, err := strconv.Atoi(options.Tail); err == nil && tail >= 0 && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		_, _ = stdcopy.NewStdWriter(&buf, line.stream).Write([]byte(line.text))
+	}
+	return io.NopCloser(&buf), nil
+}
+
+func (m *MemoryRuntime) ContainerExecCreate(ctx context.Context, containerID string, config types.ExecConfig) (types.IDResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return types.IDResponse{}, err
+	}
+	if !c.json.State.Running {
+		return types.IDResponse{}, errdefs.Conflict(fmt.Errorf("Container %s is not running", c.json.ID))
+	}
+	id := stringid.GenerateRandomID()
+	m.execs[id] = &memoryExec{containerID: c.json.ID, cmd: config.Cmd}
+	return types.IDResponse{ID: id}, nil
+}
+
+// ContainerExecAttach runs the command, like docker does, and returns its output as a multiplexed stream.
+func (m *MemoryRuntime) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	result, err := m.runExec(execID)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+	server, conn := net.Pipe()
+	go func() {
+		defer server.Close()
+		if result.Stdout != "" {
+			_, _ = stdcopy.NewStdWriter(server, stdcopy.Stdout).Write([]byte(result.Stdout))
+		}
+		if result.Stderr != "" {
+			_, _ = stdcopy.NewStdWriter(server, stdcopy.Stderr).Write([]byte(result.Stderr))
+		}
+	}()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, nil
+}
+
+func (m *MemoryRuntime) ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error {
+	_, err := m.runExec(execID)
+	return err
+}
+
+func (m *MemoryRuntime) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	exec, ok := m.execs[execID]
+	if !ok {
+		return types.ContainerExecInspect{}, errdefs.NotFound(fmt.Errorf("No such exec instance: %s", execID))
+	}
+	inspect := types.ContainerExecInspect{
+		ExecID:      execID,
+		ContainerID: exec.containerID,
+		Running:     false,
+	}
+	if exec.result != nil {
+		inspect.ExitCode = exec.result.ExitCode
+	}
+	return inspect, nil
+}
+
+func (m *MemoryRuntime) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(content)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errdefs.InvalidParameter(fmt.Errorf("unable to read the archive: %w", err))
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return errdefs.InvalidParameter(fmt.Errorf("unable to read the archive: %w", err))
+		}
+		c.files[path.Join(dstPath, hdr.Name)] = data
+	}
+}
+
+func (m *MemoryRuntime) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var refs []string
+	if options.Filters.Contains("reference") {
+		refs = options.Filters.Get("reference")
+	}
+	var list []types.ImageSummary
+	for _, image := range m.images {
+		if len(refs) > 0 && !imageHasReference(image, refs) {
+			continue
+		}
+		created, _ := time.Parse(time.RFC3339Nano, image.Created)
+		list = append(list, types.ImageSummary{
+			ID:          image.ID,
+			RepoTags:    append([]string(nil), image.RepoTags...),
+			RepoDigests: append([]string(nil), image.RepoDigests...),
+			Created:     created.Unix(),
+			Size:        image.Size,
+			VirtualSize: image.Size,
+			Containers:  -1,
+			SharedSize:  -1,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *MemoryRuntime) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	image, err := m.image(imageID)
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+	raw, err := json.Marshal(image)
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+	return *image, raw, nil
+}
+
+// ImagePull adds the image right away, and returns the progress messages of a pull of a single layer image.
+func (m *MemoryRuntime) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	named, err := parseImage(ref)
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+	image := m.addImage(ref)
+	layer := stringid.TruncateID(strings.TrimPrefix(image.ID, "sha256:"))
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	messages := []map[string]interface{}{
+		{"status": "Pulling from " + familiarRepository(named), "id": tagOf(named)},
+		{"status": "Pulling fs layer", "id": layer},
+		{"status": "Downloading", "id": layer, "progressDetail": map[string]int64{"current": image.Size / 2, "total": image.Size}},
+		{"status": "Downloading", "id": layer, "progressDetail": map[string]int64{"current": image.Size, "total": image.Size}},
+		{"status": "Download complete", "id": layer},
+		{"status": "Pull complete", "id": layer},
+		{"status": "Digest: " + strings.TrimPrefix(image.RepoDigests[0], familiarRepository(named)+"@")},
+		{"status": "Status: Downloaded newer image for " + familiarTag(ref)},
+	}
+	for _, msg := range messages {
+		if err := enc.Encode(msg); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(&buf), nil
+}
+
+func (m *MemoryRuntime) ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	image, err := m.image(imageID)
+	if err != nil {
+		return nil, err
+	}
+	if !options.Force {
+		for _, c := range m.containers {
+			if c.json.Image == image.ID {
+				return nil, errdefs.Conflict(fmt.Errorf("conflict: unable to remove repository reference \"%s\" (must force) - container %s is using its referenced image %s",
+					imageID, stringid.TruncateID(c.json.ID), stringid.TruncateID(strings.TrimPrefix(image.ID, "sha256:"))))
+			}
+		}
+	}
+
+	var deleted []types.ImageDeleteResponseItem
+	tag := familiarTag(imageID)
+	tags := image.RepoTags[:0]
+	for _, t := range image.RepoTags {
+		if t == tag {
+			deleted = append(deleted, types.ImageDeleteResponseItem{Untagged: t})
+		} else {
+			tags = append(tags, t)
+		}
+	}
+	image.RepoTags = tags
+	// an image removed by ID, or whose last tag was removed, is deleted.
+	if len(deleted) == 0 || len(image.RepoTags) == 0 {
+		delete(m.images, image.ID)
+		deleted = append(deleted, types.ImageDeleteResponseItem{Deleted: image.ID})
+	}
+	return deleted, nil
+}
+
+func (m *MemoryRuntime) NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if options.CheckDuplicate {
+		if _, err := m.network(name); err == nil {
+			return types.NetworkCreateResponse{}, errdefs.Conflict(fmt.Errorf("network with name %s already exists", name))
+		}
+	}
+	driver := options.Driver
+	if driver == "" {
+		driver = "bridge"
+	}
+	nw := m.newNetwork(name, driver)
+	nw.Labels = options.Labels
+	m.networks[nw.ID] = nw
+	return types.NetworkCreateResponse{ID: nw.ID}, nil
+}
+
+func (m *MemoryRuntime) NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []types.NetworkResource
+	for _, nw := range m.networks {
+		if options.Filters.Contains("name") && !matchAny(options.Filters.Get("name"), nw.Name) {
+			continue
+		}
+		if options.Filters.Contains("id") && !matchIDPrefix(options.Filters.Get("id"), nw.ID) {
+			continue
+		}
+		list = append(list, *nw)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (m *MemoryRuntime) NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nw, err := m.network(networkID)
+	if err != nil {
+		return err
+	}
+	c, err := m.container(containerID)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.json.NetworkSettings.Networks[nw.Name]; ok {
+		return errdefs.Forbidden(fmt.Errorf("endpoint with name %s already exists in network %s", strings.TrimPrefix(c.json.Name, "/"), nw.Name))
+	}
+	endpoint := &network.EndpointSettings{}
+	if config != nil {
+		*endpoint = *config
+	}
+	endpoint.NetworkID = nw.ID
+	c.json.NetworkSettings.Networks[nw.Name] = endpoint
+	if c.json.State.Running {
+		m.attach(c, nw, endpoint)
+	}
+	return nil
+}
+
+func (m *MemoryRuntime) NetworkRemove(ctx context.Context, networkID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nw, err := m.network(networkID)
+	if err != nil {
+		return err
+	}
+	if nw.Name == "bridge" {
+		return errdefs.Forbidden(fmt.Errorf("bridge is a pre-defined network and cannot be removed"))
+	}
+	for _, c := range m.containers {
+		if _, ok := c.json.NetworkSettings.Networks[nw.Name]; ok && c.json.State.Running {
+			return errdefs.Forbidden(fmt.Errorf("error while removing network: network %s id %s has active endpoints", nw.Name, nw.ID))
+		}
+	}
+	delete(m.networks, nw.ID)
+	return nil
+}
+
+func (m *MemoryRuntime) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.createVolume(options), nil
+}
+
+func (m *MemoryRuntime) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.volumes[volumeID]; !ok {
+		if force {
+			return nil
+		}
+		return errdefs.NotFound(fmt.Errorf("get %s: no such volume", volumeID))
+	}
+	var users []string
+	for _, c := range m.containers {
+		for _, point := range c.json.Mounts {
+			if point.Type == mount.TypeVolume && point.Name == volumeID {
+				users = append(users, c.json.ID)
+			}
+		}
+	}
+	if len(users) > 0 {
+		return errdefs.Conflict(fmt.Errorf("remove %s: volume is in use - [%s]", volumeID, strings.Join(users, ", ")))
+	}
+	delete(m.volumes, volumeID)
+	return nil
+}
+
+// container returns the container with the given ID, ID prefix or name. The caller must hold m.mu.
+func (m *MemoryRuntime) container(idOrName string) (*memoryContainer, error) {
+	if c, ok := m.containers[idOrName]; ok {
+		return c, nil
+	}
+	if c := m.containerByName(idOrName); c != nil {
+		return c, nil
+	}
+	var match *memoryContainer
+	for id, c := range m.containers {
+		if idOrName != "" && strings.HasPrefix(id, idOrName) {
+			if match != nil {
+				return nil, errdefs.InvalidParameter(fmt.Errorf("multiple IDs found with provided prefix: %s", idOrName))
+			}
+			match = c
+		}
+	}
+	if match == nil {
+		return nil, errdefs.NotFound(fmt.Errorf("No such container: %s", idOrName))
+	}
+	return match, nil
+}
+
+func (m *MemoryRuntime) containerByName(name string) *memoryContainer {
+	name = "/" + strings.TrimPrefix(name, "/")
+	for _, c := range m.containers {
+		if c.json.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// start starts a container, failing like docker does when one of its host ports is used by another running
+// container. The caller must hold m.mu.
+func (m *MemoryRuntime) start(c *memoryContainer) error {
+	if c.json.State.Running {
+		return nil
+	}
+	for _, bindings := range c.json.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			if other := m.hostPortUser(binding.HostPort); other != nil && other != c {
+				return errdefs.System(fmt.Errorf("driver failed programming external connectivity on endpoint %s (%s): Bind for 0.0.0.0:%s failed: port is already allocated",
+					strings.TrimPrefix(c.json.Name, "/"), c.json.ID, binding.HostPort))
+			}
+		}
+	}
+	if m.bindPorts {
+		if err := c.listen(); err != nil {
+			return err
+		}
+	}
+
+	for name, endpoint := range c.json.NetworkSettings.Networks {
+		nw := m.networks[endpoint.NetworkID]
+		if nw == nil {
+			return errdefs.NotFound(fmt.Errorf("network %s not found", name))
+		}
+		m.attach(c, nw, endpoint)
+	}
+	c.json.State = &types.ContainerState{
+		Status:    "running",
+		Running:   true,
+		Pid:       1000 + len(m.containers),
+		StartedAt: m.now().UTC().Format(time.RFC3339Nano),
+	}
+	return nil
+}
+
+// attach gives a running container an address on a network. The caller must hold m.mu.
+func (m *MemoryRuntime) attach(c *memoryContainer, nw *types.NetworkResource, endpoint *network.EndpointSettings) {
+	endpoint.Gateway = nw.IPAM.Config[0].Gateway
+	endpoint.IPAddress = m.nextAddress(nw)
+	endpoint.IPPrefixLen = 16
+	endpoint.EndpointID = stringid.GenerateRandomID()
+	nw.Containers[c.json.ID] = types.EndpointResource{
+		Name:        strings.TrimPrefix(c.json.Name, "/"),
+		EndpointID:  endpoint.EndpointID,
+		IPv4Address: endpoint.IPAddress + "/16",
+	}
+}
+
+// stop marks a running container as exited with the given code. The caller must hold m.mu.
+func (m *MemoryRuntime) stop(c *memoryContainer, exitCode int) {
+	c.json.State.Status = "exited"
+	c.json.State.Running = false
+	c.json.State.Pid = 0
+	c.json.State.ExitCode = exitCode
+	c.json.State.FinishedAt = m.now().UTC().Format(time.RFC3339Nano)
+	c.closeListeners()
+	for _, endpoint := range c.json.NetworkSettings.Networks {
+		if nw := m.networks[endpoint.NetworkID]; nw != nil {
+			delete(nw.Containers, c.json.ID)
+		}
+		endpoint.Gateway = ""
+		endpoint.IPAddress = ""
+		endpoint.IPPrefixLen = 0
+		endpoint.EndpointID = ""
+	}
+}
+
+// listen listens on the published host ports of the container.
+func (c *memoryContainer) listen() error {
+	for _, bindings := range c.json.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			if binding.HostPort == "" {
+				continue
+			}
+			ln, err := net.Listen("tcp", net.JoinHostPort(binding.HostIP, binding.HostPort))
+			if err != nil {
+				c.closeListeners()
+				return errdefs.System(fmt.Errorf("driver failed programming external connectivity on endpoint %s (%s): Error starting userland proxy: %w",
+					strings.TrimPrefix(c.json.Name, "/"), c.json.ID, err))
+			}
+			c.listeners = append(c.listeners, ln)
+			go func() {
+				for {
+					conn, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					conn.Close()
+				}
+			}()
+		}
+	}
+	return nil
+}
+
+func (c *memoryContainer) closeListeners() {
+	for _, ln := range c.listeners {
+		ln.Close()
+	}
+	c.listeners = nil
+}
+
+func (m *MemoryRuntime) hostPortUser(hostPort string) *memoryContainer {
+	for _, c := range m.containers {
+		if !c.json.State.Running {
+			continue
+		}
+		for _, bindings := range c.json.HostConfig.PortBindings {
+			for _, binding := range bindings {
+				if binding.HostPort == hostPort {
+					return c
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRuntime) runExec(execID string) (ExecResult, error) {
+	m.mu.Lock()
+	exec, ok := m.execs[execID]
+	if !ok {
+		m.mu.Unlock()
+		return ExecResult{}, errdefs.NotFound(fmt.Errorf("No such exec instance: %s", execID))
+	}
+	if exec.result != nil {
+		result := *exec.result
+		m.mu.Unlock()
+		return result, nil
+	}
+	c, err := m.container(exec.containerID)
+	if err != nil {
+		m.mu.Unlock()
+		return ExecResult{}, err
+	}
+	name := strings.TrimPrefix(c.json.Name, "/")
+	handler := m.execHandler
+	m.mu.Unlock()
+
+	// the handler runs without the lock, so that it can use the runtime.
+	result := handler(name, exec.cmd)
+
+	m.mu.Lock()
+	exec.result = &result
+	m.mu.Unlock()
+	return result, nil
+}
+
+func (m *MemoryRuntime) inspect(c *memoryContainer) types.ContainerJSON {
+	base := *c.json.ContainerJSONBase
+	state := *c.json.State
+	base.State = &state
+	hostConfig := *c.json.HostConfig
+	base.HostConfig = &hostConfig
+	config := *c.json.Config
+	networks := map[string]*network.EndpointSettings{}
+	for name, endpoint := range c.json.NetworkSettings.Networks {
+		e := *endpoint
+		networks[name] = &e
+	}
+	return types.ContainerJSON{
+		ContainerJSONBase: &base,
+		Mounts:            append([]types.MountPoint(nil), c.json.Mounts...),
+		Config:            &config,
+		NetworkSettings:   &types.NetworkSettings{Networks: networks},
+	}
+}
+
+func (m *MemoryRuntime) summary(c *memoryContainer) types.Container {
+	inspect := m.inspect(c)
+	created, _ := time.Parse(time.RFC3339Nano, inspect.Created)
+	summary := types.Container{
+		ID:      inspect.ID,
+		Names:   []string{inspect.Name},
+		Image:   inspect.Config.Image,
+		ImageID: inspect.Image,
+		Command: strings.Join(inspect.Config.Cmd, " "),
+		Created: created.Unix(),
+		Labels:  inspect.Config.Labels,
+		State:   inspect.State.Status,
+		Status:  m.status(inspect.State),
+		NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: inspect.NetworkSettings.Networks,
+		},
+		Mounts: inspect.Mounts,
+	}
+	summary.HostConfig.NetworkMode = string(inspect.HostConfig.NetworkMode)
+	for port, bindings := range inspect.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			p := types.Port{PrivatePort: uint16(port.Int()), Type: port.Proto()}
+			if inspect.State.Running {
+				p.IP = binding.HostIP
+				fmt.Sscanf(binding.HostPort, "%d", &p.PublicPort)
+			}
+			summary.Ports = append(summary.Ports, p)
+		}
+	}
+	return summary
+}
+
+// status returns the human readable status of a container, e.g. "Up 5 minutes" or "Exited (0) 2 hours ago".
+func (m *MemoryRuntime) status(state *types.ContainerState) string {
+	since := func(ts string) string {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return ""
+		}
+		return units.HumanDuration(m.now().Sub(t))
+	}
+	switch state.Status {
+	case "running":
+		return "Up " + since(state.StartedAt)
+	case "exited":
+		return fmt.Sprintf("Exited (%d) %s ago", state.ExitCode, since(state.FinishedAt))
+	default:
+		return strings.ToUpper(state.Status[:1]) + state.Status[1:]
+	}
+}
+
+// matchContainer reports whether a container matches the name, id, network, label and status filters.
+func (m *MemoryRuntime) matchContainer(c *memoryContainer, args filters.Args) bool {
+	name := strings.TrimPrefix(c.json.Name, "/")
+	if args.Contains("name") && !matchAny(args.Get("name"), name) {
+		return false
+	}
+	if args.Contains("id") && !matchIDPrefix(args.Get("id"), c.json.ID) {
+		return false
+	}
+	if args.Contains("status") && !args.ExactMatch("status", c.json.State.Status) {
+		return false
+	}
+	if args.Contains("label") && !args.MatchKVList("label", c.json.Config.Labels) {
+		return false
+	}
+	if args.Contains("network") {
+		matched := false
+		for netName, endpoint := range c.json.NetworkSettings.Networks {
+			if args.ExactMatch("network", netName) || matchIDPrefix(args.Get("network"), endpoint.NetworkID) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether the value matches one of the patterns. Like docker, patterns are regular expressions.
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			if strings.Contains(value, pattern) {
+				return true
+			}
+			continue
+		}
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIDPrefix(prefixes []string, id string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryRuntime) network(idOrName string) (*types.NetworkResource, error) {
+	if nw, ok := m.networks[idOrName]; ok {
+		return nw, nil
+	}
+	for _, nw := range m.networks {
+		if nw.Name == idOrName {
+			return nw, nil
+		}
+	}
+	return nil, errdefs.NotFound(fmt.Errorf("network %s not found", idOrName))
+}
+
+// newNetwork returns a network with its own /16 subnet, like docker's default address pools.
+func (m *MemoryRuntime) newNetwork(name, driver string) *types.NetworkResource {
+	subnet := 17 + m.subnets
+	m.subnets++
+	nw := &types.NetworkResource{
+		Name:    name,
+		ID:      stringid.GenerateRandomID(),
+		Created: m.now(),
+		Scope:   "local",
+		Driver:  driver,
+		IPAM: network.IPAM{
+			Driver: "default",
+			Config: []network.IPAMConfig{{
+				Subnet:  fmt.Sprintf("172.%d.0.0/16", subnet),
+				Gateway: fmt.Sprintf("172.%d.0.1", subnet),
+			}},
+		},
+		Containers: map[string]types.EndpointResource{},
+		Options:    map[string]string{},
+		Labels:     map[string]string{},
+	}
+	return nw
+}
+
+// nextAddress returns the lowest free address of a network.
+func (m *MemoryRuntime) nextAddress(nw *types.NetworkResource) string {
+	prefix := strings.TrimSuffix(nw.IPAM.Config[0].Gateway, ".0.1")
+	used := map[string]bool{}
+	for _, endpoint := range nw.Containers {
+		used[strings.TrimSuffix(endpoint.IPv4Address, "/16")] = true
+	}
+	for i := 2; ; i++ {
+		address := fmt.Sprintf("%s.%d.%d", prefix, i/256, i%256)
+		if !used[address] {
+			return address
+		}
+	}
+}
+
+func (m *MemoryRuntime) createVolume(options volume.CreateOptions) *volume.Volume {
+	name := options.Name
+	if name == "" {
+		name = stringid.GenerateRandomID()
+	}
+	if vol, ok := m.volumes[name]; ok {
+		return vol
+	}
+	driver := options.Driver
+	if driver == "" {
+		driver = "local"
+	}
+	vol := &volume.Volume{
+		Name:       name,
+		Driver:     driver,
+		Labels:     options.Labels,
+		Options:    options.DriverOpts,
+		Mountpoint: "/var/lib/docker/volumes/" + name + "/_data",
+		Scope:      "local",
+		CreatedAt:  m.now().UTC().Format(time.RFC3339),
+	}
+	m.volumes[name] = vol
+	return vol
+}
+
+// image returns the image with the given ID or reference. The caller must hold m.mu.
+func (m *MemoryRuntime) image(idOrRef string) (*types.ImageInspect, error) {
+	if image, ok := m.images[idOrRef]; ok {
+		return image, nil
+	}
+	tag := familiarTag(idOrRef)
+	for id, image := range m.images {
+		if strings.HasPrefix(strings.TrimPrefix(id, "sha256:"), strings.TrimPrefix(idOrRef, "sha256:")) && len(idOrRef) >= 12 {
+			return image, nil
+		}
+		for _, t := range image.RepoTags {
+			if t == tag {
+				return image, nil
+			}
+		}
+	}
+	return nil, errdefs.NotFound(fmt.Errorf("No such image: %s", idOrRef))
+}
+
+// addImage adds an image with the given reference, unless it already exists. The caller must hold m.mu.
+func (m *MemoryRuntime) addImage(ref string) *types.ImageInspect {
+	if image, err := m.image(ref); err == nil {
+		return image
+	}
+	named, err := parseImage(ref)
+	if err != nil {
+		return nil
+	}
+	id := "sha256:" + stringid.GenerateRandomID()
+	digest := "sha256:" + stringid.GenerateRandomID()
+	image := &types.ImageInspect{
+		ID:           id,
+		RepoTags:     []string{familiarTag(ref)},
+		RepoDigests:  []string{familiarRepository(named) + "@" + digest},
+		Created:      m.now().UTC().Format(time.RFC3339Nano),
+		Architecture: "amd64",
+		Os:           "linux",
+		// a typical size for a postgres image.
+		Size:        int64(350 * units.MB),
+		VirtualSize: int64(350 * units.MB),
+	}
+	m.images[id] = image
+	return image
+}
+
+// imageHasReference reports whether one of the image's tags matches one of the references, which can be patterns
+// like "postgres:*".
+func imageHasReference(image *types.ImageInspect, refs []string) bool {
+	for _, ref := range refs {
+		pattern := familiarImage(ref)
+		for _, tag := range image.RepoTags {
+			repo := tag
+			if i := strings.LastIndex(tag, ":"); i > strings.LastIndex(tag, "/") {
+				repo = tag[:i]
+			}
+			if ok, _ := path.Match(pattern, tag); ok || pattern == tag {
+				return true
+			}
+			if ok, _ := path.Match(pattern, repo); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseImage parses an image reference, defaulting to the "latest" tag like docker does.
+func parseImage(ref string) (reference.Named, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, err
+	}
+	return reference.TagNameOnly(named), nil
+}
+
+// familiarTag returns the image reference the way docker reports it in tags, e.g. "postgres:latest" for
+// "docker.io/library/postgres". References that can't be parsed, such as image IDs, are returned unchanged.
+func familiarTag(ref string) string {
+	named, err := parseImage(ref)
+	if err != nil {
+		return ref
+	}
+	return reference.FamiliarString(named)
+}
+
+func familiarRepository(named reference.Named) string {
+	return reference.FamiliarName(named)
+}
+
+func tagOf(named reference.Named) string {
+	if tagged, ok := named.(reference.Tagged); ok {
+		return tagged.Tag()
+	}
+	return "latest"
+}
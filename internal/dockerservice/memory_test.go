@@ -0,0 +1,167 @@
+package dockerservice
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRuntime(t *testing.T) {
+	ctx := context.Background()
+	rt := NewMemoryRuntime(WithExecHandler(func(container string, cmd []string) ExecResult {
+		if cmd[0] == "false" {
+			return ExecResult{Stderr: "failed\n", ExitCode: 1}
+		}
+		return ExecResult{Stdout: container + ": " + cmd[0] + "\n"}
+	}))
+	d := NewDockerWithRuntime("memory-test", rt)
+	_, err := d.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	newContainer := func(name, port string) Container {
+		return NewContainer(name,
+			container.Config{Image: "postgres:14"},
+			container.HostConfig{
+				PortBindings: nat.PortMap{"5432/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: port}}},
+				Mounts:       []mount.Mount{{Type: mount.TypeVolume, Source: name, Target: "/var/lib/postgresql/data"}},
+			},
+			network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{d.NetworkName: {}}},
+		)
+	}
+
+	var progress []PullProgress
+	pg := newContainer("pg", "5432")
+	_, err = pg.Start(WithPullProgress(ctx, func(p PullProgress) { progress = append(progress, p) }), d)
+	require.NoError(t, err)
+
+	t.Run("pulls missing images", func(t *testing.T) {
+		require.NotEmpty(t, progress)
+		assert.Equal(t, "Pull complete", progress[len(progress)-3].Status)
+		images, err := d.ListImages(ctx)
+		require.NoError(t, err)
+		require.Len(t, images, 1)
+		assert.Equal(t, []string{"postgres:14"}, images[0].Tags)
+	})
+
+	t.Run("starts containers", func(t *testing.T) {
+		c, err := d.GetContainer(ctx, "pg")
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		assert.Equal(t, "running", c.State)
+		assert.Equal(t, "172.18.0.1", c.NetworkConfig.EndpointsConfig[d.NetworkName].Gateway)
+		assert.Equal(t, "172.18.0.2", c.NetworkConfig.EndpointsConfig[d.NetworkName].IPAddress)
+	})
+
+	t.Run("rejects duplicate names and ports", func(t *testing.T) {
+		duplicate := newContainer("pg", "5433")
+		_, err := duplicate.Start(ctx, d)
+		assert.ErrorIs(t, err, ErrDuplicateContainerName)
+
+		// like with docker, the container is created but not started.
+		other := newContainer("other", "5432")
+		_, err = other.Start(ctx, d)
+		assert.ErrorContains(t, err, "port is already allocated")
+		c, err := d.GetContainer(ctx, "other")
+		require.NoError(t, err)
+		assert.Equal(t, "created", c.State)
+		require.NoError(t, c.Remove(ctx, d))
+	})
+
+	t.Run("executes commands", func(t *testing.T) {
+		res, err := pg.Exec(ctx, d, types.ExecConfig{Cmd: []string{"pg_isready"}})
+		require.NoError(t, err)
+		assert.Equal(t, ExecResult{Stdout: "pg: pg_isready\n"}, res)
+
+		res, err = pg.Exec(ctx, d, types.ExecConfig{Cmd: []string{"false"}})
+		require.NoError(t, err)
+		assert.Equal(t, ExecResult{Stderr: "failed\n", ExitCode: 1}, res)
+	})
+
+	t.Run("copies files", func(t *testing.T) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "modify-pghba", Mode: 0755, Size: 4}))
+		_, err := tw.Write([]byte("echo"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+
+		require.NoError(t, rt.CopyToContainer(ctx, pg.ID, "/etc/postgresql", &buf, types.CopyToContainerOptions{}))
+		content, ok := rt.ReadFile(pg.ID, "/etc/postgresql/modify-pghba")
+		assert.True(t, ok)
+		assert.Equal(t, "echo", string(content))
+	})
+
+	t.Run("returns logs", func(t *testing.T) {
+		require.NoError(t, rt.Log(pg.ID, "ready\n", "LOG: checkpoint starting\nLOG: checkpoint complete\n"))
+		logs, err := pg.Logs(ctx, d, 0)
+		require.NoError(t, err)
+		assert.Equal(t, "ready\nLOG: checkpoint starting\nLOG: checkpoint complete\n", logs)
+		logs, err = pg.Logs(ctx, d, 1)
+		require.NoError(t, err)
+		assert.Equal(t, "LOG: checkpoint complete\n", logs)
+	})
+
+	t.Run("renames and connects containers", func(t *testing.T) {
+		created, err := rt.ContainerCreate(ctx, &container.Config{Image: "postgres:14"}, nil, nil, nil, "legacy")
+		require.NoError(t, err)
+		require.NoError(t, rt.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}))
+
+		assert.Error(t, rt.ContainerRename(ctx, "legacy", "pg"))
+		require.NoError(t, rt.ContainerRename(ctx, "legacy", "renamed"))
+		require.NoError(t, rt.NetworkConnect(ctx, d.NetworkName, "renamed", nil))
+		assert.Error(t, rt.NetworkConnect(ctx, d.NetworkName, "renamed", nil))
+
+		c, err := d.GetContainer(ctx, "renamed")
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		assert.Contains(t, c.NetworkConfig.EndpointsConfig, "bridge")
+		assert.Equal(t, "172.18.0.3", c.NetworkConfig.EndpointsConfig[d.NetworkName].IPAddress)
+		require.NoError(t, rt.ContainerRemove(ctx, created.ID, types.ContainerRemoveOptions{Force: true}))
+	})
+
+	t.Run("protects resources in use", func(t *testing.T) {
+		assert.Error(t, pg.Remove(ctx, d))
+		assert.Error(t, RemoveVolume(ctx, d, "pg"))
+		assert.Error(t, d.RemoveImage(ctx, "postgres:14"))
+	})
+
+	t.Run("stops and removes containers", func(t *testing.T) {
+		require.NoError(t, pg.Stop(ctx, d, types.ContainerStartOptions{}))
+		c, err := d.GetContainer(ctx, "pg")
+		require.NoError(t, err)
+		assert.Equal(t, "exited", c.State)
+		_, err = pg.Exec(ctx, d, types.ExecConfig{Cmd: []string{"pg_isready"}})
+		assert.Error(t, err)
+
+		require.NoError(t, pg.StartExisting(ctx, d))
+		require.NoError(t, rt.Exit(pg.ID, 137))
+		inspect, err := rt.ContainerInspect(ctx, pg.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 137, inspect.State.ExitCode)
+
+		require.NoError(t, pg.Remove(ctx, d))
+		_, err = rt.ContainerInspect(ctx, pg.ID)
+		assert.True(t, client.IsErrNotFound(err))
+		assert.NoError(t, RemoveVolume(ctx, d, "pg"))
+		assert.NoError(t, d.RemoveImage(ctx, "postgres:14"))
+	})
+
+	t.Run("creates volumes once", func(t *testing.T) {
+		first, err := CreateVolume(ctx, d, volume.CreateOptions{Name: "data"})
+		require.NoError(t, err)
+		second, err := CreateVolume(ctx, d, volume.CreateOptions{Name: "data"})
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+	})
+}
@@ -0,0 +1,98 @@
+package dockerservice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// podmanRuntime talks to podman through its docker-compatible socket, and smooths over the differences with docker
+// that matter to spinup:
+//   - podman may refuse short image names like "postgres:14" (short-name resolution), so the image references sent
+//     as is are fully qualified, and image tags are reported in the short form docker uses. Pulls don't need it: the
+//     client sends the short name, which podman resolves to docker hub on its docker-compatible API.
+//   - podman reports an existing network with a different error than docker.
+type podmanRuntime struct {
+	*client.Client
+}
+
+func newPodmanRuntime(cli *client.Client) podmanRuntime {
+	return podmanRuntime{Client: cli}
+}
+
+// qualifyImage returns the fully qualified form of an image reference, e.g. "docker.io/library/postgres:14" for
+// "postgres:14". Image IDs and references that can't be parsed are returned unchanged.
+func qualifyImage(image string) string {
+	if strings.HasPrefix(image, "sha256:") {
+		return image
+	}
+	ref, err := reference.ParseAnyReference(image)
+	if err != nil {
+		return image
+	}
+	named, ok := ref.(reference.Named)
+	if !ok {
+		return image
+	}
+	return named.String()
+}
+
+// familiarImage returns the short form of an image reference, as reported by docker.
+func familiarImage(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.FamiliarString(named)
+}
+
+func (p podmanRuntime) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.CreateResponse, error) {
+	qualified := *config
+	qualified.Image = qualifyImage(config.Image)
+	return p.Client.ContainerCreate(ctx, &qualified, hostConfig, networkingConfig, platform, containerName)
+}
+
+func (p podmanRuntime) ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error) {
+	return p.Client.ImageInspectWithRaw(ctx, qualifyImage(image))
+}
+
+func (p podmanRuntime) ImageRemove(ctx context.Context, image string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	return p.Client.ImageRemove(ctx, qualifyImage(image), options)
+}
+
+func (p podmanRuntime) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	if options.Filters.Contains("reference") {
+		filters := options.Filters.Clone()
+		for _, ref := range filters.Get("reference") {
+			filters.Del("reference", ref)
+			filters.Add("reference", qualifyImage(ref))
+		}
+		options.Filters = filters
+	}
+	images, err := p.Client.ImageList(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	for i := range images {
+		for j, tag := range images[i].RepoTags {
+			images[i].RepoTags[j] = familiarImage(tag)
+		}
+	}
+	return images, nil
+}
+
+func (p podmanRuntime) NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
+	resp, err := p.Client.NetworkCreate(ctx, name, options)
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		// report the error the way docker does, which is what CreateNetwork checks for.
+		return resp, fmt.Errorf("network with name %s already exists: %w", name, err)
+	}
+	return resp, err
+}
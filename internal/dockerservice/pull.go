@@ -0,0 +1,70 @@
+package dockerservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// PullProgress is a progress update of an image pull. Updates about a single layer have the layer ID set, others
+// (e.g. "Pulling from library/postgres" or the final digest) don't.
+type PullProgress struct {
+	Image   string `json:"image"`
+	Layer   string `json:"layer,omitempty"`
+	Status  string `json:"status"`            // e.g. "Downloading", "Extracting" or "Pull complete"
+	Current int64  `json:"current,omitempty"` // bytes downloaded or extracted so far
+	Total   int64  `json:"total,omitempty"`   // size of the layer in bytes, if known
+}
+
+// PullProgressFunc receives the progress updates of image pulls.
+type PullProgressFunc func(PullProgress)
+
+type pullProgressKey struct{}
+
+// WithPullProgress returns a context that makes image pulls done with it report their progress to fn.
+func WithPullProgress(ctx context.Context, fn PullProgressFunc) context.Context {
+	return context.WithValue(ctx, pullProgressKey{}, fn)
+}
+
+// pullProgressFrom returns the progress func set on the context, or a func that discards progress updates.
+func pullProgressFrom(ctx context.Context) PullProgressFunc {
+	if fn, ok := ctx.Value(pullProgressKey{}).(PullProgressFunc); ok && fn != nil {
+		return fn
+	}
+	return func(PullProgress) {}
+}
+
+// readPullStream reads the JSON message stream returned by an image pull until it ends, reporting each progress
+// update to fn. Pulls can fail after the stream has started, in which case the error is only found in the stream.
+func readPullStream(r io.Reader, image string, fn PullProgressFunc) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("unable to read pull progress %w", err)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if msg.ErrorMessage != "" {
+			return fmt.Errorf("%s", msg.ErrorMessage)
+		}
+
+		progress := PullProgress{
+			Image:  image,
+			Layer:  msg.ID,
+			Status: msg.Status,
+		}
+		if msg.Progress != nil {
+			progress.Current = msg.Progress.Current
+			progress.Total = msg.Progress.Total
+		}
+		fn(progress)
+	}
+}
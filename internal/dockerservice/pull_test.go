@@ -0,0 +1,55 @@
+package dockerservice
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPullStream(t *testing.T) {
+	t.Run("reports progress", func(t *testing.T) {
+		stream := `{"status":"Pulling from library/postgres","id":"14"}
+{"status":"Downloading","progressDetail":{"current":1024,"total":4096},"progress":"[==>  ]","id":"a2abf6c4d29d"}
+{"status":"Pull complete","progressDetail":{},"id":"a2abf6c4d29d"}
+{"status":"Status: Downloaded newer image for postgres:14"}
+`
+		var progress []PullProgress
+		err := readPullStream(strings.NewReader(stream), "postgres:14", func(p PullProgress) {
+			progress = append(progress, p)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []PullProgress{
+			{Image: "postgres:14", Layer: "14", Status: "Pulling from library/postgres"},
+			{Image: "postgres:14", Layer: "a2abf6c4d29d", Status: "Downloading", Current: 1024, Total: 4096},
+			{Image: "postgres:14", Layer: "a2abf6c4d29d", Status: "Pull complete"},
+			{Image: "postgres:14", Status: "Status: Downloaded newer image for postgres:14"},
+		}, progress)
+	})
+
+	t.Run("returns errors from the stream", func(t *testing.T) {
+		stream := `{"status":"Downloading","progressDetail":{"current":1024,"total":4096},"id":"a2abf6c4d29d"}
+{"errorDetail":{"message":"unauthorized: authentication required"},"error":"unauthorized: authentication required"}
+`
+		err := readPullStream(strings.NewReader(stream), "registry.internal/postgres:14", func(PullProgress) {})
+		assert.EqualError(t, err, "unauthorized: authentication required")
+	})
+
+	t.Run("returns malformed streams as errors", func(t *testing.T) {
+		err := readPullStream(strings.NewReader(`{"status":`), "postgres:14", func(PullProgress) {})
+		assert.Error(t, err)
+	})
+}
+
+func TestPullProgressContext(t *testing.T) {
+	// without a progress func, updates are discarded.
+	pullProgressFrom(context.Background())(PullProgress{Status: "Downloading"})
+
+	var got []PullProgress
+	ctx := WithPullProgress(context.Background(), func(p PullProgress) {
+		got = append(got, p)
+	})
+	pullProgressFrom(ctx)(PullProgress{Status: "Downloading"})
+	assert.Equal(t, []PullProgress{{Status: "Downloading"}}, got)
+}
@@ -0,0 +1,119 @@
+package dockerservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+
+	"github.com/spinup-host/spinup/config"
+)
+
+// dockerHubDomain is the domain images without an explicit registry are pulled from.
+const dockerHubDomain = "docker.io"
+
+// RegistryAuths returns the credentials for each registry host, taken from the registry configuration and the
+// credentials file it points to. Credentials set in the configuration take precedence over the file.
+func RegistryAuths(cfg config.RegistryConfig) (map[string]types.AuthConfig, error) {
+	auths := make(map[string]types.AuthConfig)
+	if cfg.CredentialsFile != "" {
+		fileAuths, err := readCredentialsFile(cfg.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		for host, auth := range fileAuths {
+			auths[host] = auth
+		}
+	}
+	for host, creds := range cfg.Credentials {
+		host = normalizeRegistryHost(host)
+		auths[host] = types.AuthConfig{
+			Username:      creds.Username,
+			Password:      creds.Password,
+			ServerAddress: host,
+		}
+	}
+	return auths, nil
+}
+
+// readCredentialsFile reads the "auths" section of a docker config.json.
+func readCredentialsFile(path string) (map[string]types.AuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read registry credentials file %s %w", path, err)
+	}
+	var file struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			Username      string `json:"username"`
+			Password      string `json:"password"`
+			IdentityToken string `json:"identitytoken"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("unable to parse registry credentials file %s %w", path, err)
+	}
+
+	auths := make(map[string]types.AuthConfig, len(file.Auths))
+	for server, entry := range file.Auths {
+		host := normalizeRegistryHost(server)
+		auth := types.AuthConfig{
+			Username:      entry.Username,
+			Password:      entry.Password,
+			IdentityToken: entry.IdentityToken,
+			ServerAddress: host,
+		}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for registry %s in %s %w", server, path, err)
+			}
+			username, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid auth for registry %s in %s", server, path)
+			}
+			auth.Username, auth.Password = username, password
+		}
+		auths[host] = auth
+	}
+	return auths, nil
+}
+
+// normalizeRegistryHost turns a registry address as found in docker config files (e.g. "https://index.docker.io/v1/")
+// into the registry host used in image references (e.g. "docker.io").
+func normalizeRegistryHost(server string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHubDomain
+	}
+	return host
+}
+
+// registryAuthFor returns the encoded registry auth to pull the given image with, or an empty string if no
+// credentials are configured for the image's registry.
+func (d Docker) registryAuthFor(image string) (string, error) {
+	if len(d.RegistryAuths) == 0 {
+		return "", nil
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s %w", image, err)
+	}
+	auth, ok := d.RegistryAuths[reference.Domain(named)]
+	if !ok {
+		return "", nil
+	}
+	encoded, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(encoded), nil
+}
@@ -0,0 +1,53 @@
+package dockerservice
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+)
+
+func TestRegistryAuths(t *testing.T) {
+	credentialsFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(credentialsFile, []byte(`{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "`+base64.StdEncoding.EncodeToString([]byte("hub-user:hub-pass"))+`"},
+			"registry.internal": {"username": "file-user", "password": "file-pass"}
+		}
+	}`), 0600))
+
+	auths, err := RegistryAuths(config.RegistryConfig{
+		CredentialsFile: credentialsFile,
+		Credentials: map[string]config.RegistryCredentials{
+			"registry.internal": {Username: "config-user", Password: "config-pass"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.AuthConfig{
+		"docker.io":         {Username: "hub-user", Password: "hub-pass", ServerAddress: "docker.io"},
+		"registry.internal": {Username: "config-user", Password: "config-pass", ServerAddress: "registry.internal"},
+	}, auths)
+
+	d := Docker{RegistryAuths: auths}
+	encoded, err := d.registryAuthFor("registry.internal/hardened/postgres:14")
+	require.NoError(t, err)
+	raw, err := base64.URLEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	var auth types.AuthConfig
+	require.NoError(t, json.Unmarshal(raw, &auth))
+	assert.Equal(t, "config-user", auth.Username)
+
+	encoded, err = d.registryAuthFor("ghcr.io/someone/postgres:14")
+	require.NoError(t, err)
+	assert.Empty(t, encoded)
+
+	_, err = RegistryAuths(config.RegistryConfig{CredentialsFile: filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package dockerservice
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/spinup-host/spinup/config"
+)
+
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+	// RuntimeMemory simulates containers in memory, see MemoryRuntime.
+	RuntimeMemory = "memory"
+)
+
+// pingTimeout is how long to wait for a runtime to respond when connecting to it.
+const pingTimeout = 5 * time.Second
+
+// Runtime is the container runtime API used by spinup. It's the subset of the docker API covering the container,
+// exec, copy, image, network and volume operations spinup performs, which podman also serves on its
+// docker-compatible socket.
+type Runtime interface {
+	Ping(ctx context.Context) (types.Ping, error)
+
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	ContainerInspect(ctx context.Context, container string) (types.ContainerJSON, error)
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.CreateResponse, error)
+	ContainerStart(ctx context.Context, container string, options types.ContainerStartOptions) error
+	ContainerRestart(ctx context.Context, container string, options container.StopOptions) error
+	ContainerStop(ctx context.Context, container string, options container.StopOptions) error
+	ContainerRemove(ctx context.Context, container string, options types.ContainerRemoveOptions) error
+	ContainerUpdate(ctx context.Context, container string, updateConfig container.UpdateConfig) (container.ContainerUpdateOKBody, error)
+	ContainerRename(ctx context.Context, container, newContainerName string) error
+	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+
+	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error)
+	ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+	CopyToContainer(ctx context.Context, container, path string, content io.Reader, options types.CopyToContainerOptions) error
+
+	ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error)
+	ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error)
+	ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error)
+	ImageRemove(ctx context.Context, image string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error)
+
+	NetworkCreate(ctx context.Context, name string, options types.NetworkCreate) (types.NetworkCreateResponse, error)
+	NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
+	NetworkConnect(ctx context.Context, network, container string, config *network.EndpointSettings) error
+	NetworkRemove(ctx context.Context, network string) error
+
+	VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	VolumeRemove(ctx context.Context, volumeID string, force bool) error
+}
+
+var _ Runtime = (*client.Client)(nil)
+
+// NewRuntime connects to the configured container runtime and returns it along with its type. When no runtime type
+// is configured, docker is tried first and podman second.
+func NewRuntime(ctx context.Context, cfg config.RuntimeConfig) (Runtime, string, error) {
+	switch cfg.Type {
+	case RuntimeDocker:
+		cli, err := connect(ctx, dockerSockets(cfg.Socket))
+		if err != nil {
+			return nil, "", err
+		}
+		return cli, RuntimeDocker, nil
+	case RuntimePodman:
+		cli, err := connect(ctx, podmanSockets(cfg.Socket))
+		if err != nil {
+			return nil, "", err
+		}
+		return newPodmanRuntime(cli), RuntimePodman, nil
+	case RuntimeMemory:
+		return NewMemoryRuntime(WithHostPorts()), RuntimeMemory, nil
+	case "":
+		cli, dockerErr := connect(ctx, dockerSockets(cfg.Socket))
+		if dockerErr == nil {
+			// the docker socket may be served by podman, e.g. with the podman-docker package installed.
+			if isPodman(ctx, cli) {
+				return newPodmanRuntime(cli), RuntimePodman, nil
+			}
+			return cli, RuntimeDocker, nil
+		}
+		cli, podmanErr := connect(ctx, podmanSockets(cfg.Socket))
+		if podmanErr != nil {
+			return nil, "", fmt.Errorf("no container runtime found: docker: %v, podman: %w", dockerErr, podmanErr)
+		}
+		return newPodmanRuntime(cli), RuntimePodman, nil
+	default:
+		return nil, "", fmt.Errorf("unknown container runtime '%s'", cfg.Type)
+	}
+}
+
+// dockerSockets returns the sockets to try for docker. An empty host makes the client use DOCKER_HOST or the default
+// docker socket.
+func dockerSockets(socket string) []string {
+	return []string{socket}
+}
+
+// podmanSockets returns the sockets to try for podman, in order.
+func podmanSockets(socket string) []string {
+	if socket != "" {
+		return []string{socket}
+	}
+	var sockets []string
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		sockets = append(sockets, host)
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, "unix://"+filepath.Join(dir, "podman", "podman.sock"))
+	}
+	return append(sockets, "unix:///run/podman/podman.sock")
+}
+
+// connect returns a client for the first of the given sockets that responds.
+func connect(ctx context.Context, sockets []string) (*client.Client, error) {
+	var lastErr error
+	for _, socket := range sockets {
+		opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+		if socket != "" {
+			opts = append(opts, client.WithHost(socket))
+		}
+		cli, err := client.NewClientWithOpts(opts...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		_, err = cli.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			cli.Close()
+			lastErr = err
+			continue
+		}
+		return cli, nil
+	}
+	return nil, lastErr
+}
+
+// isPodman reports whether the API served by the client is podman's docker-compatible API.
+func isPodman(ctx context.Context, cli *client.Client) bool {
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		return false
+	}
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), RuntimePodman) {
+			return true
+		}
+	}
+	return false
+}
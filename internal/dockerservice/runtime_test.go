@@ -0,0 +1,130 @@
+package dockerservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+)
+
+// fakeEngine serves the parts of the docker API needed to test runtime detection and the podman adjustments.
+type fakeEngine struct {
+	engineName string
+
+	mu      sync.Mutex
+	created []string // images of the created containers
+}
+
+var apiVersionRe = regexp.MustCompile(`^/v[0-9.]+`)
+
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Api-Version", "1.41")
+	switch path := apiVersionRe.ReplaceAllString(r.URL.Path, ""); path {
+	case "/_ping":
+		_, _ = w.Write([]byte("OK"))
+	case "/version":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"ApiVersion": "1.41",
+			"Components": []map[string]string{{"Name": f.engineName}},
+		})
+	case "/containers/create":
+		var body struct{ Image string }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.created = append(f.created, body.Image)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"Id": "c1"})
+	case "/images/json":
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"Id": "sha256:1", "RepoTags": []string{"docker.io/library/postgres:14", "registry.internal/postgres:14"}},
+		})
+	case "/networks/create":
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "network name spinup already used: network already exists"})
+	case "/networks":
+		_ = json.NewEncoder(w).Encode([]map[string]string{{"Id": "net1", "Name": "spinup"}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestNewRuntime(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("detects docker", func(t *testing.T) {
+		srv := httptest.NewServer(&fakeEngine{engineName: "Engine"})
+		defer srv.Close()
+		rt, runtimeType, err := NewRuntime(ctx, config.RuntimeConfig{Socket: "tcp://" + srv.Listener.Addr().String()})
+		require.NoError(t, err)
+		assert.Equal(t, RuntimeDocker, runtimeType)
+		_, isPodman := rt.(podmanRuntime)
+		assert.False(t, isPodman)
+	})
+
+	t.Run("detects podman behind the docker socket", func(t *testing.T) {
+		srv := httptest.NewServer(&fakeEngine{engineName: "Podman Engine"})
+		defer srv.Close()
+		_, runtimeType, err := NewRuntime(ctx, config.RuntimeConfig{Socket: "tcp://" + srv.Listener.Addr().String()})
+		require.NoError(t, err)
+		assert.Equal(t, RuntimePodman, runtimeType)
+	})
+
+	t.Run("fails when the runtime doesn't respond", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		addr := srv.Listener.Addr().String()
+		srv.Close()
+		_, _, err := NewRuntime(ctx, config.RuntimeConfig{Type: RuntimePodman, Socket: "tcp://" + addr})
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects unknown runtimes", func(t *testing.T) {
+		_, _, err := NewRuntime(ctx, config.RuntimeConfig{Type: "containerd"})
+		assert.Error(t, err)
+	})
+}
+
+func TestPodmanRuntime(t *testing.T) {
+	ctx := context.Background()
+	engine := &fakeEngine{engineName: "Podman Engine"}
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+
+	rt, _, err := NewRuntime(ctx, config.RuntimeConfig{Type: RuntimePodman, Socket: "tcp://" + srv.Listener.Addr().String()})
+	require.NoError(t, err)
+	d := NewDockerWithRuntime("spinup", rt)
+
+	t.Run("creates containers from fully qualified images", func(t *testing.T) {
+		_, err := d.Cli.ContainerCreate(ctx, &container.Config{Image: "postgres:14"}, nil, nil, nil, "pg")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"docker.io/library/postgres:14"}, engine.created)
+	})
+
+	t.Run("lists images with short tags", func(t *testing.T) {
+		images, err := d.ListImages(ctx)
+		require.NoError(t, err)
+		require.Len(t, images, 1)
+		assert.Equal(t, []string{"postgres:14", "registry.internal/postgres:14"}, images[0].Tags)
+	})
+
+	t.Run("reuses existing networks", func(t *testing.T) {
+		resp, err := d.CreateNetwork(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "net1", resp.ID)
+	})
+
+	t.Run("qualifies image names", func(t *testing.T) {
+		assert.Equal(t, "docker.io/amd64/postgres:14.5", qualifyImage("amd64/postgres:14.5"))
+		assert.Equal(t, "registry.internal/postgres:14", qualifyImage("registry.internal/postgres:14"))
+		assert.Equal(t, "sha256:abc", qualifyImage("sha256:abc"))
+	})
+}
@@ -0,0 +1,188 @@
+// Package engine defines how spinup runs a database engine in containers. Each engine (postgres, mysql, redis)
+// implements Engine in its own package, and the containers of every engine are built the same way by NewContainer.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+)
+
+// Engine describes a database engine run by spinup.
+type Engine interface {
+	// Type is the type of the clusters run by the engine, e.g. "postgres".
+	Type() string
+	// Port is the port the database listens on in its container.
+	Port() int
+	// Image returns the image running the given version of the database.
+	Image(majVersion, minVersion int) string
+	// DataDir is the directory of the container the cluster's volume is mounted on.
+	DataDir() string
+	// Env returns the environment variables creating the database's superuser with the given credentials.
+	Env(username, password string) []string
+	// Cmd returns the command of the container, or nil to run the image's default command.
+	Cmd(username, password string) []string
+	// ReadyCmd returns a command run in the container that exits with zero once the database accepts connections.
+	ReadyCmd(username, password string) []string
+	// Exporter returns the prometheus exporter monitoring clusters of the engine, or nil when the monitoring services
+	// scrape the engine themselves.
+	Exporter() *Exporter
+}
+
+// ConnectionCounter is implemented by engines that can count the client connections of a cluster, which idle
+// policies rely on.
+type ConnectionCounter interface {
+	// ConnectionsCmd returns a command run in the container that prints the number of client connections, ignoring
+	// the connections of the given application.
+	ConnectionsCmd(username, password, ignoredApplication string) []string
+}
+
+// CredentialsValidator is implemented by engines that put requirements on the credentials of a cluster.
+type CredentialsValidator interface {
+	// ValidateCredentials returns an ErrInvalidCredentials when a cluster can't be created with the given credentials.
+	ValidateCredentials(username, password string) error
+}
+
+// ErrInvalidCredentials is returned when a cluster's credentials don't meet the requirements of its engine.
+type ErrInvalidCredentials struct {
+	Type   string
+	Reason string
+}
+
+func (e ErrInvalidCredentials) Error() string {
+	return fmt.Sprintf("invalid credentials for a %s cluster: %s", e.Type, e.Reason)
+}
+
+// Exporter describes the prometheus exporter of an engine, which runs in its own container next to each monitored
+// cluster.
+type Exporter struct {
+	Image string
+	// Port is the port the exporter serves metrics on.
+	Port int
+	// Env returns the environment variables of an exporter monitoring the database at the given address (host:port).
+	Env func(address, username, password string) []string
+}
+
+// ContainerProps holds the settings of a cluster's container.
+type ContainerProps struct {
+	Image     string
+	Name      string
+	Username  string
+	Password  string
+	Port      int // host port the database is published on
+	Memory    int64
+	CPUShares int64
+}
+
+// ErrVolumeInUse is returned when the volume a cluster's data would be kept in already holds the data of another
+// engine.
+type ErrVolumeInUse struct {
+	Volume  string
+	Purpose string
+}
+
+func (e ErrVolumeInUse) Error() string {
+	return fmt.Sprintf("volume %s already holds %s", e.Volume, e.Purpose)
+}
+
+// ContainerName returns the name of the container running the cluster with the given name, e.g.
+// "spinup-postgres-<name>".
+func ContainerName(e Engine, name string) string {
+	return "spinup-" + e.Type() + "-" + name
+}
+
+// NewContainer returns the container running a cluster of the given engine. The cluster's volume, named after the
+// cluster, is created by NewContainer, while the container is only created when it is started. A volume of that name
+// that holds the data of another engine is refused.
+func NewContainer(client dockerservice.Docker, e Engine, props ContainerProps) (dbContainer dockerservice.Container, err error) {
+	purpose := e.Type() + " data"
+	newVolume, err := dockerservice.CreateVolume(context.Background(), client, volume.VolumeCreateBody{
+		Driver: "local",
+		Labels: map[string]string{"purpose": purpose},
+		Name:   props.Name,
+	})
+	if err != nil {
+		return dockerservice.Container{}, err
+	}
+	// existing volumes are returned as they are. Those without a purpose were created by mounting them, e.g. to
+	// restore a backup into them.
+	if existing := newVolume.Labels["purpose"]; existing != "" && existing != purpose {
+		return dockerservice.Container{}, ErrVolumeInUse{Volume: newVolume.Name, Purpose: existing}
+	}
+	// defer for cleaning volume removal
+	defer func() {
+		if err != nil {
+			if errVolRemove := dockerservice.RemoveVolume(context.Background(), client, newVolume.Name); errVolRemove != nil {
+				err = fmt.Errorf("error removing volume during failed service creation %w", err)
+			}
+		}
+	}()
+
+	newHostPort, err := nat.NewPort("tcp", strconv.Itoa(props.Port))
+	if err != nil {
+		return dockerservice.Container{}, err
+	}
+	newContainerport, err := nat.NewPort("tcp", strconv.Itoa(e.Port()))
+	if err != nil {
+		return dockerservice.Container{}, err
+	}
+	mounts := []mount.Mount{
+		{
+			Type:   mount.TypeVolume,
+			Source: newVolume.Name,
+			Target: e.DataDir(),
+		},
+	}
+	hostConfig := container.HostConfig{
+		PortBindings: nat.PortMap{
+			newContainerport: []nat.PortBinding{
+				{
+					HostIP:   "0.0.0.0",
+					HostPort: newHostPort.Port(),
+				},
+			},
+		},
+		NetworkMode: "default",
+		AutoRemove:  false,
+		Mounts:      mounts,
+		Resources:   Resources(props.CPUShares, props.Memory),
+	}
+
+	endpointConfig := map[string]*network.EndpointSettings{}
+	endpointConfig[client.NetworkName] = &network.EndpointSettings{}
+	nwConfig := network.NetworkingConfig{EndpointsConfig: endpointConfig}
+
+	dbContainer = dockerservice.NewContainer(
+		ContainerName(e, props.Name),
+		container.Config{
+			Image: props.Image,
+			Env:   e.Env(props.Username, props.Password),
+			Cmd:   e.Cmd(props.Username, props.Password),
+		},
+		hostConfig,
+		nwConfig,
+	)
+	return dbContainer, nil
+}
+
+// Resources returns the container resources for a database container with the given CPU shares and memory
+// (in megabytes). A zero value leaves the resource unlimited.
+func Resources(cpuShares, memory int64) container.Resources {
+	resources := container.Resources{
+		CPUShares: cpuShares,
+		Memory:    memory * 1000000,
+	}
+	if resources.Memory > 0 {
+		// docker defaults the swap limit to twice the memory limit on create, but won't adjust it on update.
+		resources.MemorySwap = resources.Memory * 2
+	}
+	return resources
+}
@@ -0,0 +1,100 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+)
+
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+	Volumes  map[string]composeVolume  `yaml:"volumes,omitempty"`
+}
+
+type composeService struct {
+	Image       string            `yaml:"image"`
+	Restart     string            `yaml:"restart,omitempty"`
+	Profiles    []string          `yaml:"profiles,omitempty"`
+	DependsOn   []string          `yaml:"depends_on,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+	Ports       []string          `yaml:"ports,omitempty"`
+	Volumes     []string          `yaml:"volumes,omitempty"`
+	CPUShares   int64             `yaml:"cpu_shares,omitempty"`
+	MemLimit    int64             `yaml:"mem_limit,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+}
+
+type composeVolume struct {
+	Name string `yaml:"name,omitempty"`
+}
+
+// Compose returns a docker compose file running the cluster, its postgres_exporter and its backups.
+func Compose(c Cluster) ([]byte, error) {
+	name := resourceName(c.Name)
+	volume := c.Volume
+	if volume == "" {
+		volume = name
+	}
+	pg := composeService{
+		Image:       c.Image,
+		Restart:     "unless-stopped",
+		Environment: c.Env,
+		Ports:       []string{fmt.Sprintf("%d:%d", c.Port, postgresPort)},
+		Volumes:     []string{"data:" + c.dataDir()},
+		CPUShares:   c.CPUShares,
+		MemLimit:    c.Memory,
+		Labels:      c.Labels,
+	}
+	file := composeFile{
+		Services: map[string]composeService{"postgres": pg},
+		// the volume keeps its name, so the compose project can be started with the cluster's existing data.
+		Volumes: map[string]composeVolume{"data": {Name: volume}},
+	}
+	if c.HostPath != "" {
+		pg.Volumes = []string{c.HostPath + ":" + c.dataDir()}
+		file.Services["postgres"] = pg
+		file.Volumes = nil
+	}
+	comments := []string{
+		fmt.Sprintf("docker compose file for the spinup cluster %s.", c.Name),
+	}
+
+	if c.Exporter != nil {
+		file.Services["postgres-exporter"] = composeService{
+			Image:       c.Exporter.Image,
+			Restart:     "unless-stopped",
+			DependsOn:   []string{"postgres"},
+			Environment: map[string]string{"DATA_SOURCE_NAME": c.exporterDSN("postgres")},
+			Ports:       []string{fmt.Sprintf("%d:%d", exporterPort, exporterPort)},
+		}
+	}
+	if c.Backup != nil && c.Backup.Unsupported != "" {
+		comments = append(comments, c.Backup.unsupportedComment())
+	} else if c.Backup != nil {
+		env := map[string]string{
+			"PGHOST":     "postgres",
+			"PGUSER":     c.username(),
+			"PGPASSWORD": c.password(),
+			"PGDATABASE": "postgres",
+		}
+		for name, value := range c.Backup.Env {
+			env[name] = value
+		}
+		for _, name := range c.Backup.Secrets {
+			env[name] = "${" + name + "}"
+		}
+		file.Services["backup"] = composeService{
+			Image: c.Backup.Image,
+			// the backup service takes a single backup when it runs, so it isn't started with the other services.
+			Profiles:    []string{"backup"},
+			DependsOn:   []string{"postgres"},
+			Environment: env,
+		}
+		comments = append(comments,
+			fmt.Sprintf("Backups are taken by running `docker compose run --rm backup`, which spinup did on the schedule '%s'.", c.Backup.Schedule))
+		if len(c.Backup.Secrets) > 0 {
+			comments = append(comments,
+				fmt.Sprintf("Set %s in the environment or in an .env file.", strings.Join(c.Backup.Secrets, " and ")))
+		}
+	}
+	return marshal(comments, file)
+}
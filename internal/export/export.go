@@ -0,0 +1,158 @@
+// Package export renders spinup clusters as deployment files for other platforms, so that a setup prototyped with
+// spinup can be handed over to e.g. docker compose or Kubernetes.
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatCompose    = "compose"
+	FormatKubernetes = "kubernetes"
+)
+
+// ErrUnknownFormat is returned when exporting to a format other than FormatCompose and FormatKubernetes.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+const (
+	postgresPort = 5432
+	exporterPort = 9187
+	dataDir      = "/var/lib/postgresql/data"
+)
+
+// Cluster describes a cluster to export.
+type Cluster struct {
+	Name string
+	// Image is the postgres image, as run by the cluster's container.
+	Image string
+	// Port is the host port the cluster is published on.
+	Port int
+	// Env holds the environment variables configuring postgres, e.g. POSTGRES_USER and POSTGRES_PASSWORD.
+	Env map[string]string
+	// Volume is the name of the volume holding the cluster's data.
+	Volume string
+	// HostPath is the directory of the host holding the cluster's data, for clusters whose data is bind mounted. It
+	// replaces Volume when set.
+	HostPath string
+	// DataDir is where the volume or host path is mounted in the postgres container, /var/lib/postgresql/data when
+	// empty. Env sets PGDATA when the data directory is somewhere below it.
+	DataDir string
+
+	CPUShares int64
+	Memory    int64 // memory limit in bytes
+	Disk      int64 // disk reserved for the data volume, in megabytes
+
+	Labels map[string]string
+
+	// Exporter is set for clusters monitored by a postgres_exporter.
+	Exporter *Exporter
+	// Backup is set for clusters with scheduled backups.
+	Backup *Backup
+}
+
+type Exporter struct {
+	Image string
+}
+
+// Backup describes the scheduled backups of a cluster, taken with WAL-G.
+type Backup struct {
+	Image string
+	// Schedule is a cron expression, e.g. "0 2 * * *".
+	Schedule string
+	// Env holds the WAL-G settings of the backup destination, e.g. WALG_S3_PREFIX, without its credentials.
+	Env map[string]string
+	// Secrets are the names of the WAL-G settings holding the destination's credentials, which are exported as
+	// placeholders to fill in.
+	Secrets []string
+	// Unsupported tells why the backups can't be exported, e.g. because their destination is only reachable from
+	// the spinup host. The backups are then only described in a comment.
+	Unsupported string
+}
+
+// unsupportedComment returns the comment describing backups that can't be exported.
+func (b Backup) unsupportedComment() string {
+	return fmt.Sprintf("Backups, which spinup took on the schedule '%s', aren't exported: %s.", b.Schedule, b.Unsupported)
+}
+
+// sortedEnv returns the names of the WAL-G settings, sorted.
+func (b Backup) sortedEnv() []string {
+	names := make([]string, 0, len(b.Env))
+	for name := range b.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render returns the cluster in the given format.
+func Render(format string, c Cluster) ([]byte, error) {
+	switch format {
+	case FormatCompose:
+		return Compose(c)
+	case FormatKubernetes:
+		return Kubernetes(c)
+	default:
+		return nil, fmt.Errorf("%w '%s', expected %s or %s", ErrUnknownFormat, format, FormatCompose, FormatKubernetes)
+	}
+}
+
+func (c Cluster) dataDir() string {
+	if c.DataDir == "" {
+		return dataDir
+	}
+	return c.DataDir
+}
+
+func (c Cluster) username() string {
+	return c.Env["POSTGRES_USER"]
+}
+
+func (c Cluster) password() string {
+	return c.Env["POSTGRES_PASSWORD"]
+}
+
+// exporterDSN returns the data source of the postgres_exporter for a cluster reachable at the given host.
+func (c Cluster) exporterDSN(host string) string {
+	return fmt.Sprintf("postgresql://%s:%s@%s:%d/?sslmode=disable", c.username(), c.password(), host, postgresPort)
+}
+
+// marshal encodes the documents as YAML, after the given comment lines.
+func marshal(comments []string, docs ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, comment := range comments {
+		buf.WriteString("# " + comment + "\n")
+	}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// resourceName returns the name as a valid DNS label, which both compose services and Kubernetes objects accept.
+func resourceName(name string) string {
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > 50 {
+		name = name[:50]
+	}
+	name = strings.Trim(name, "-")
+	if name == "" {
+		return "postgres"
+	}
+	return name
+}
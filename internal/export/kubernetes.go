@@ -0,0 +1,339 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type k8sObject struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+	Spec       interface{}       `yaml:"spec,omitempty"`
+}
+
+type k8sMetadata struct {
+	Name        string            `yaml:"name,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type k8sServiceSpec struct {
+	Selector map[string]string `yaml:"selector"`
+	Ports    []k8sServicePort  `yaml:"ports"`
+}
+
+type k8sServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+}
+
+type k8sPVCSpec struct {
+	AccessModes []string     `yaml:"accessModes"`
+	Resources   k8sResources `yaml:"resources"`
+}
+
+type k8sStatefulSetSpec struct {
+	ServiceName string         `yaml:"serviceName"`
+	Replicas    int            `yaml:"replicas"`
+	Selector    k8sSelector    `yaml:"selector"`
+	Template    k8sPodTemplate `yaml:"template"`
+}
+
+type k8sSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+type k8sPodTemplate struct {
+	Metadata *k8sMetadata `yaml:"metadata,omitempty"`
+	Spec     k8sPodSpec   `yaml:"spec"`
+}
+
+type k8sPodSpec struct {
+	RestartPolicy string         `yaml:"restartPolicy,omitempty"`
+	Containers    []k8sContainer `yaml:"containers"`
+	Volumes       []k8sVolume    `yaml:"volumes,omitempty"`
+}
+
+type k8sContainer struct {
+	Name         string           `yaml:"name"`
+	Image        string           `yaml:"image"`
+	Env          []k8sEnvVar      `yaml:"env,omitempty"`
+	EnvFrom      []k8sEnvFrom     `yaml:"envFrom,omitempty"`
+	Ports        []k8sPort        `yaml:"ports,omitempty"`
+	Resources    *k8sResources    `yaml:"resources,omitempty"`
+	VolumeMounts []k8sVolumeMount `yaml:"volumeMounts,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name      string          `yaml:"name"`
+	Value     string          `yaml:"value,omitempty"`
+	ValueFrom *k8sValueSource `yaml:"valueFrom,omitempty"`
+}
+
+type k8sValueSource struct {
+	SecretKeyRef k8sKeyRef `yaml:"secretKeyRef"`
+}
+
+type k8sKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type k8sEnvFrom struct {
+	SecretRef k8sNameRef `yaml:"secretRef"`
+}
+
+type k8sNameRef struct {
+	Name string `yaml:"name"`
+}
+
+type k8sPort struct {
+	Name          string `yaml:"name"`
+	ContainerPort int    `yaml:"containerPort"`
+}
+
+type k8sResources struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+type k8sVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+}
+
+type k8sVolume struct {
+	Name                  string       `yaml:"name"`
+	PersistentVolumeClaim *k8sClaimRef `yaml:"persistentVolumeClaim,omitempty"`
+	HostPath              *k8sHostPath `yaml:"hostPath,omitempty"`
+}
+
+type k8sHostPath struct {
+	Path string `yaml:"path"`
+	Type string `yaml:"type"`
+}
+
+type k8sClaimRef struct {
+	ClaimName string `yaml:"claimName"`
+}
+
+type k8sCronJobSpec struct {
+	Schedule          string         `yaml:"schedule"`
+	ConcurrencyPolicy string         `yaml:"concurrencyPolicy"`
+	JobTemplate       k8sJobTemplate `yaml:"jobTemplate"`
+}
+
+type k8sJobTemplate struct {
+	Spec k8sJobSpec `yaml:"spec"`
+}
+
+type k8sJobSpec struct {
+	Template k8sPodTemplate `yaml:"template"`
+}
+
+// defaultStorage is the size of the data volume of clusters without reserved disk.
+const defaultStorage = "1Gi"
+
+// Kubernetes returns the Kubernetes manifests running the cluster: a Secret with its credentials, a PVC for its
+// data, a StatefulSet running postgres (and the postgres_exporter as a sidecar), a Service exposing it, and a
+// CronJob taking its backups. Clusters whose data is bind mounted keep it in their host directory instead of a PVC.
+func Kubernetes(c Cluster) ([]byte, error) {
+	name := resourceName(c.Name)
+	secretName := name + "-credentials"
+	selector := map[string]string{
+		"app.kubernetes.io/name":     "postgres",
+		"app.kubernetes.io/instance": name,
+	}
+	labels := map[string]string{}
+	for k, v := range c.Labels {
+		labels[k] = v
+	}
+	for k, v := range selector {
+		labels[k] = v
+	}
+	meta := func(name string) k8sMetadata {
+		return k8sMetadata{Name: name, Labels: labels}
+	}
+
+	secretData := map[string]string{}
+	for k, v := range c.Env {
+		secretData[k] = v
+	}
+	if c.Exporter != nil {
+		secretData["DATA_SOURCE_NAME"] = c.exporterDSN("localhost")
+	}
+	secret := k8sObject{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   meta(secretName),
+		Type:       "Opaque",
+		StringData: secretData,
+	}
+
+	storage := defaultStorage
+	if c.Disk > 0 {
+		storage = fmt.Sprintf("%dM", c.Disk)
+	}
+	pvc := k8sObject{
+		APIVersion: "v1",
+		Kind:       "PersistentVolumeClaim",
+		Metadata:   meta(name + "-data"),
+		Spec: k8sPVCSpec{
+			AccessModes: []string{"ReadWriteOnce"},
+			Resources:   k8sResources{Requests: map[string]string{"storage": storage}},
+		},
+	}
+
+	pg := k8sContainer{
+		Name:  "postgres",
+		Image: c.Image,
+		// volumes often have a lost+found directory at their root, which initdb refuses to use.
+		Env:          []k8sEnvVar{{Name: "PGDATA", Value: dataDir + "/pgdata"}},
+		EnvFrom:      []k8sEnvFrom{{SecretRef: k8sNameRef{Name: secretName}}},
+		Ports:        []k8sPort{{Name: "postgres", ContainerPort: postgresPort}},
+		Resources:    resources(c.CPUShares, c.Memory),
+		VolumeMounts: []k8sVolumeMount{{Name: "data", MountPath: dataDir}},
+	}
+	dataVolume := k8sVolume{Name: "data", PersistentVolumeClaim: &k8sClaimRef{ClaimName: pvc.Metadata.Name}}
+	if c.HostPath != "" {
+		// the directory already holds the cluster's data, where PGDATA from the secret points.
+		pg.Env = nil
+		pg.VolumeMounts = []k8sVolumeMount{{Name: "data", MountPath: c.dataDir()}}
+		dataVolume = k8sVolume{Name: "data", HostPath: &k8sHostPath{Path: c.HostPath, Type: "Directory"}}
+	}
+	containers := []k8sContainer{pg}
+	servicePorts := []k8sServicePort{{Name: "postgres", Port: postgresPort, TargetPort: postgresPort}}
+	var annotations map[string]string
+	if c.Exporter != nil {
+		containers = append(containers, k8sContainer{
+			Name:  "postgres-exporter",
+			Image: c.Exporter.Image,
+			Env: []k8sEnvVar{{
+				Name:      "DATA_SOURCE_NAME",
+				ValueFrom: &k8sValueSource{SecretKeyRef: k8sKeyRef{Name: secretName, Key: "DATA_SOURCE_NAME"}},
+			}},
+			Ports: []k8sPort{{Name: "metrics", ContainerPort: exporterPort}},
+		})
+		servicePorts = append(servicePorts, k8sServicePort{Name: "metrics", Port: exporterPort, TargetPort: exporterPort})
+		annotations = map[string]string{
+			"prometheus.io/scrape": "true",
+			"prometheus.io/port":   strconv.Itoa(exporterPort),
+		}
+	}
+
+	statefulSet := k8sObject{
+		APIVersion: "apps/v1",
+		Kind:       "StatefulSet",
+		Metadata:   meta(name),
+		Spec: k8sStatefulSetSpec{
+			ServiceName: name,
+			Replicas:    1,
+			Selector:    k8sSelector{MatchLabels: selector},
+			Template: k8sPodTemplate{
+				Metadata: &k8sMetadata{Labels: labels, Annotations: annotations},
+				Spec: k8sPodSpec{
+					Containers: containers,
+					Volumes:    []k8sVolume{dataVolume},
+				},
+			},
+		},
+	}
+	service := k8sObject{
+		APIVersion: "v1",
+		Kind:       "Service",
+		Metadata:   meta(name),
+		Spec: k8sServiceSpec{
+			Selector: selector,
+			Ports:    servicePorts,
+		},
+	}
+
+	comments := []string{
+		fmt.Sprintf("Kubernetes manifests for the spinup cluster %s.", c.Name),
+	}
+	docs := []interface{}{secret, pvc, statefulSet, service}
+	if c.HostPath != "" {
+		comments = append(comments,
+			fmt.Sprintf("The data is in the directory %s of the spinup host, so the pod must run on a node holding it.", c.HostPath))
+		docs = []interface{}{secret, statefulSet, service}
+	}
+	if c.Backup != nil && c.Backup.Unsupported != "" {
+		comments = append(comments, c.Backup.unsupportedComment())
+	} else if c.Backup != nil {
+		backupSecretName := name + "-backup"
+		env := make([]k8sEnvVar, 0, len(c.Backup.Env)+4)
+		for _, key := range c.Backup.sortedEnv() {
+			env = append(env, k8sEnvVar{Name: key, Value: c.Backup.Env[key]})
+		}
+		env = append(env,
+			k8sEnvVar{Name: "PGHOST", Value: name},
+			k8sEnvVar{Name: "PGDATABASE", Value: "postgres"},
+			k8sEnvVar{Name: "PGUSER", ValueFrom: &k8sValueSource{SecretKeyRef: k8sKeyRef{Name: secretName, Key: "POSTGRES_USER"}}},
+			k8sEnvVar{Name: "PGPASSWORD", ValueFrom: &k8sValueSource{SecretKeyRef: k8sKeyRef{Name: secretName, Key: "POSTGRES_PASSWORD"}}},
+		)
+		var envFrom []k8sEnvFrom
+		if len(c.Backup.Secrets) > 0 {
+			placeholders := map[string]string{}
+			for _, key := range c.Backup.Secrets {
+				placeholders[key] = ""
+			}
+			docs = append(docs, k8sObject{
+				APIVersion: "v1",
+				Kind:       "Secret",
+				Metadata:   meta(backupSecretName),
+				Type:       "Opaque",
+				StringData: placeholders,
+			})
+			envFrom = []k8sEnvFrom{{SecretRef: k8sNameRef{Name: backupSecretName}}}
+			comments = append(comments,
+				fmt.Sprintf("Fill in %s in the %s secret.", strings.Join(c.Backup.Secrets, " and "), backupSecretName))
+		}
+		docs = append(docs,
+			k8sObject{
+				APIVersion: "batch/v1",
+				Kind:       "CronJob",
+				Metadata:   meta(name + "-backup"),
+				Spec: k8sCronJobSpec{
+					Schedule:          c.Backup.Schedule,
+					ConcurrencyPolicy: "Forbid",
+					JobTemplate: k8sJobTemplate{Spec: k8sJobSpec{Template: k8sPodTemplate{Spec: k8sPodSpec{
+						RestartPolicy: "OnFailure",
+						Containers: []k8sContainer{{
+							Name:    "backup",
+							Image:   c.Backup.Image,
+							Env:     env,
+							EnvFrom: envFrom,
+						}},
+					}}}},
+				},
+			},
+		)
+	}
+	return marshal(comments, docs...)
+}
+
+// resources returns the resources of the postgres container. CPU shares are converted to a CPU request, with 1024
+// shares being one CPU, and the memory limit is both requested and enforced.
+func resources(cpuShares, memory int64) *k8sResources {
+	if cpuShares <= 0 && memory <= 0 {
+		return nil
+	}
+	r := &k8sResources{Requests: map[string]string{}}
+	if cpuShares > 0 {
+		r.Requests["cpu"] = fmt.Sprintf("%dm", cpuShares*1000/1024)
+	}
+	if memory > 0 {
+		quantity := strconv.FormatInt(memory, 10)
+		if memory%1000000 == 0 {
+			quantity = fmt.Sprintf("%dM", memory/1000000)
+		}
+		r.Requests["memory"] = quantity
+		r.Limits = map[string]string{"memory": quantity}
+	}
+	return r
+}
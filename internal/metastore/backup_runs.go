@@ -0,0 +1,172 @@
+package metastore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Statuses of a backup run.
+const (
+	BackupRunRunning   = "running"
+	BackupRunSucceeded = "succeeded"
+	BackupRunFailed    = "failed"
+)
+
+// Triggers of a backup run.
+const (
+	BackupTriggerSchedule = "schedule"
+	BackupTriggerOnDemand = "on_demand"
+)
+
+// BackupRun is a base backup taken of a cluster, by its backup schedule or on demand.
+type BackupRun struct {
+	ID        string `json:"id"`
+	ClusterID string `json:"cluster_id"`
+	Trigger   string `json:"trigger"`
+	// OperationID is the operation of an on-demand backup.
+	OperationID string     `json:"operation_id,omitempty"`
+	Destination string     `json:"destination"` // type of the destination, e.g. "s3"
+	Bucket      string     `json:"bucket"`
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	// ExitCode is the exit code of the backup container, once it exited.
+	ExitCode int `json:"exit_code"`
+	// BackupName and BytesUploaded are the name and compressed size of the base backup written to the destination.
+	BackupName    string `json:"backup_name,omitempty"`
+	BytesUploaded int64  `json:"bytes_uploaded"`
+	// Logs are the last lines the backup container logged.
+	Logs  string `json:"logs,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// InsertBackupRun records a backup run. Runs without a start time are started at the current time.
+func InsertBackupRun(db Db, run BackupRun) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	if run.StartedAt.IsZero() {
+		run.StartedAt = time.Now()
+	}
+	query := "insert into backupRun(runId, clusterId, triggeredBy, operationId, destination, bucket, status, startedAt, finishedAt, exitCode, backupName, bytesUploaded, logs, error) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if _, err := db.Client.Exec(db.rebind(query), run.ID, run.ClusterID, run.Trigger, run.OperationID, run.Destination, run.Bucket,
+		run.Status, run.StartedAt.Unix(), toUnix(run.FinishedAt), run.ExitCode, run.BackupName, run.BytesUploaded, run.Logs, run.Error); err != nil {
+		return fmt.Errorf("unable to insert backup run of cluster %s %w", run.ClusterID, err)
+	}
+	return nil
+}
+
+// UpdateBackupRun saves the outcome of a backup run: its status, finish time, exit code, backup, logs and error.
+func UpdateBackupRun(db Db, run BackupRun) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	query := "update backupRun set status = ?, finishedAt = ?, exitCode = ?, backupName = ?, bytesUploaded = ?, logs = ?, error = ? where runId = ?"
+	if _, err := db.Client.Exec(db.rebind(query), run.Status, toUnix(run.FinishedAt), run.ExitCode, run.BackupName, run.BytesUploaded,
+		run.Logs, run.Error, run.ID); err != nil {
+		return fmt.Errorf("unable to update backup run %s %w", run.ID, err)
+	}
+	return nil
+}
+
+// FailRunningBackupRuns fails the backup runs that are still running with the given error, and returns how many there
+// were. It's used at startup, when the runs left running were interrupted by the restart.
+func FailRunningBackupRuns(db Db, reason string) (int, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return 0, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "update backupRun set status = ?, finishedAt = ?, error = ? where status = ?"
+	res, err := db.Client.Exec(db.rebind(query), BackupRunFailed, time.Now().Unix(), reason, BackupRunRunning)
+	if err != nil {
+		return 0, fmt.Errorf("unable to fail running backup runs %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// BackupRunFilter selects the backup runs returned by ListBackupRuns.
+type BackupRunFilter struct {
+	ClusterID string
+	// Finished only returns the runs that are no longer running.
+	Finished bool
+	// Status only returns the runs with the given status.
+	Status string
+	// Limit is the maximum number of runs to return. Zero returns all matching runs.
+	Limit int
+	// Logs returns the logs of the runs, which are left empty otherwise.
+	Logs bool
+}
+
+// ListBackupRuns returns the backup runs of a cluster, newest first.
+func ListBackupRuns(db Db, filter BackupRunFilter) ([]BackupRun, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return nil, fmt.Errorf("error running a migration %w", err)
+	}
+	logs := "''"
+	if filter.Logs {
+		logs = "logs"
+	}
+	query := "select runId, clusterId, triggeredBy, operationId, destination, bucket, status, startedAt, finishedAt, exitCode, backupName, bytesUploaded, " +
+		logs + ", error from backupRun where clusterId = ?"
+	args := []interface{}{filter.ClusterID}
+	if filter.Finished {
+		query += " and status <> ?"
+		args = append(args, BackupRunRunning)
+	}
+	if filter.Status != "" {
+		query += " and status = ?"
+		args = append(args, filter.Status)
+	}
+	query += " order by id desc"
+	if filter.Limit > 0 {
+		query += " limit ?"
+		args = append(args, filter.Limit)
+	}
+	rows, err := db.Client.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query backup runs of cluster %s %w", filter.ClusterID, err)
+	}
+	defer rows.Close()
+	runs := []BackupRun{}
+	for rows.Next() {
+		var run BackupRun
+		var startedAt, finishedAt int64
+		if err := rows.Scan(&run.ID, &run.ClusterID, &run.Trigger, &run.OperationID, &run.Destination, &run.Bucket, &run.Status,
+			&startedAt, &finishedAt, &run.ExitCode, &run.BackupName, &run.BytesUploaded, &run.Logs, &run.Error); err != nil {
+			return nil, fmt.Errorf("unable to read backup run row %w", err)
+		}
+		run.StartedAt = time.Unix(startedAt, 0).UTC()
+		run.FinishedAt = fromUnix(finishedAt)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// CountFailedBackupRuns returns the number of backup runs of a cluster that failed since its last successful run.
+func CountFailedBackupRuns(db Db, clusterID string) (int, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return 0, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "select count(*) from backupRun where clusterId = ? and status = ? and id > coalesce((select max(id) from backupRun where clusterId = ? and status = ?), 0)"
+	var n int
+	if err := db.Client.QueryRow(db.rebind(query), clusterID, BackupRunFailed, clusterID, BackupRunSucceeded).Scan(&n); err != nil {
+		return 0, fmt.Errorf("unable to count failed backup runs of cluster %s %w", clusterID, err)
+	}
+	return n, nil
+}
+
+// PruneBackupRuns deletes the finished backup runs of a cluster but the newest keep runs, and returns how many were
+// deleted. Runs that are still running are kept.
+func PruneBackupRuns(db Db, clusterID string, keep int) (int, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return 0, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "delete from backupRun where clusterId = ? and status <> ? and id <= coalesce((select id from backupRun where clusterId = ? order by id desc limit 1 offset ?), 0)"
+	res, err := db.Client.Exec(db.rebind(query), clusterID, BackupRunRunning, clusterID, keep)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prune backup runs of cluster %s %w", clusterID, err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
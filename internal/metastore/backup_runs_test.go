@@ -0,0 +1,88 @@
+package metastore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRuns(t *testing.T) {
+	t.Parallel()
+	db, err := NewDb(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+
+	at := time.Unix(1700000000, 0).UTC()
+	first := BackupRun{ID: "first", ClusterID: "cluster", Trigger: BackupTriggerSchedule, Destination: DestinationS3, Bucket: "bucket",
+		Status: BackupRunRunning, StartedAt: at}
+	second := BackupRun{ID: "second", ClusterID: "cluster", Trigger: BackupTriggerOnDemand, OperationID: "op", Status: BackupRunRunning,
+		StartedAt: at}
+	require.NoError(t, InsertBackupRun(db, first))
+	require.NoError(t, InsertBackupRun(db, second))
+	require.NoError(t, InsertBackupRun(db, BackupRun{ID: "other", ClusterID: "other", Status: BackupRunRunning}))
+
+	finished := at.Add(time.Minute)
+	first.Status = BackupRunSucceeded
+	first.FinishedAt = &finished
+	first.BackupName = "base_000000010000000000000002"
+	first.BytesUploaded = 4096
+	first.Logs = "INFO: Wrote backup with name base_000000010000000000000002\n"
+	require.NoError(t, UpdateBackupRun(db, first))
+
+	runs, err := ListBackupRuns(db, BackupRunFilter{ClusterID: "cluster", Logs: true})
+	require.NoError(t, err)
+	assert.Equal(t, []BackupRun{second, first}, runs, "runs started at the same time are listed newest first")
+
+	runs, err = ListBackupRuns(db, BackupRunFilter{ClusterID: "cluster", Limit: 1, Logs: true})
+	require.NoError(t, err)
+	assert.Equal(t, []BackupRun{second}, runs)
+
+	runs, err = ListBackupRuns(db, BackupRunFilter{ClusterID: "cluster", Finished: true})
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, first.ID, runs[0].ID)
+	assert.Empty(t, runs[0].Logs, "logs are only read when asked for")
+
+	runs, err = ListBackupRuns(db, BackupRunFilter{ClusterID: "missing"})
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	n, err := FailRunningBackupRuns(db, "interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	runs, err = ListBackupRuns(db, BackupRunFilter{ClusterID: "cluster", Logs: true})
+	require.NoError(t, err)
+	assert.Equal(t, BackupRunFailed, runs[0].Status)
+	assert.Equal(t, "interrupted", runs[0].Error)
+	assert.NotNil(t, runs[0].FinishedAt)
+	assert.Equal(t, BackupRunSucceeded, runs[1].Status, "finished runs are left alone")
+
+	n, err = CountFailedBackupRuns(db, "cluster")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n, "failures before the last success aren't counted")
+
+	for _, id := range []string{"third", "fourth", "fifth"} {
+		require.NoError(t, InsertBackupRun(db, BackupRun{ID: id, ClusterID: "cluster", Status: BackupRunFailed}))
+	}
+	require.NoError(t, InsertBackupRun(db, BackupRun{ID: "sixth", ClusterID: "cluster", Status: BackupRunRunning}))
+	n, err = PruneBackupRuns(db, "cluster", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	runs, err = ListBackupRuns(db, BackupRunFilter{ClusterID: "cluster"})
+	require.NoError(t, err)
+	var ids []string
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	assert.Equal(t, []string{"sixth", "fifth", "fourth"}, ids)
+
+	require.NoError(t, DeleteCluster(db, "cluster"))
+	runs, err = ListBackupRuns(db, BackupRunFilter{ClusterID: "cluster", Logs: true})
+	require.NoError(t, err)
+	assert.Empty(t, runs, "runs are deleted with their cluster")
+	runs, err = ListBackupRuns(db, BackupRunFilter{ClusterID: "other"})
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
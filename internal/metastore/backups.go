@@ -0,0 +1,139 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BackupSchedule is the backup schedule of a cluster, as it's restored when spinup starts.
+type BackupSchedule struct {
+	ID        int
+	ClusterID string
+	// Spec is the cron expression of the schedule, e.g. "30 2 * * *".
+	Spec string
+	Dest Destination
+}
+
+// SetBackupSchedule saves the backup schedule of a cluster, replacing its previous schedule and clearing its backup
+// catalog. The destination's API key secret is stored encrypted.
+func SetBackupSchedule(db Db, clusterID, spec string, dest Destination) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	secret, err := db.encrypt(dest.ApiKeySecret)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt backup secret of cluster %s %w", clusterID, err)
+	}
+	tx, err := db.Client.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin a transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	if _, err := tx.ExecContext(ctx, db.rebind("delete from backup where clusterid = ?"), clusterID); err != nil {
+		return fmt.Errorf("unable to remove backup schedule of cluster %s %w", clusterID, err)
+	}
+	// the catalog lists the backups of the previous destination.
+	if err := deleteBackupCatalog(ctx, db, tx, clusterID); err != nil {
+		return err
+	}
+	// the schedule fields of the first version of the table are kept at zero; spec holds the schedule.
+	forcePathStyle := 0
+	if dest.ForcePathStyle {
+		forcePathStyle = 1
+	}
+	query := "insert into backup(clusterid, destination, bucket, second, minute, hour, dom, month, dow, spec, apiKeyId, apiKeySecret, path, endpoint, region, forcePathStyle) " +
+		"values(?, ?, ?, 0, 0, 0, 0, 0, 0, ?, ?, ?, ?, ?, ?, ?)"
+	if _, err := tx.ExecContext(ctx, db.rebind(query), clusterID, dest.Type, dest.BucketName, spec, dest.ApiKeyID, secret, dest.Path,
+		dest.Endpoint, dest.Region, forcePathStyle); err != nil {
+		return fmt.Errorf("unable to save backup schedule of cluster %s %w", clusterID, err)
+	}
+	return tx.Commit()
+}
+
+// BackupSchedules returns the backup schedules of all clusters. Schedules saved before the cron expression and
+// credentials were stored have an empty Spec, and can't be restored.
+func BackupSchedules(db Db) ([]BackupSchedule, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return nil, fmt.Errorf("error running a migration %w", err)
+	}
+	rows, err := db.Client.Query(backupScheduleQuery + " where b.id = (select max(id) from backup where clusterid = b.clusterid) order by b.id")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query backup schedules %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []BackupSchedule
+	for rows.Next() {
+		s, err := scanBackupSchedule(db, rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// GetBackupSchedule returns the backup schedule of a cluster, and whether the cluster has one.
+func GetBackupSchedule(db Db, clusterID string) (BackupSchedule, bool, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return BackupSchedule{}, false, fmt.Errorf("error running a migration %w", err)
+	}
+	row := db.Client.QueryRow(db.rebind(backupScheduleQuery+" where b.clusterid = ? order by b.id desc limit 1"), clusterID)
+	s, err := scanBackupSchedule(db, row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BackupSchedule{}, false, nil
+	}
+	if err != nil {
+		return BackupSchedule{}, false, err
+	}
+	return s, true, nil
+}
+
+// backupScheduleQuery selects the columns read by scanBackupSchedule.
+const backupScheduleQuery = "select b.id, b.clusterid, b.spec, b.destination, b.bucket, b.apiKeyId, b.apiKeySecret, b.path, b.endpoint, b.region, b.forcePathStyle from backup b"
+
+func scanBackupSchedule(db Db, row rowScanner) (BackupSchedule, error) {
+	var s BackupSchedule
+	var destination, bucket, secret *string
+	var forcePathStyle int
+	if err := row.Scan(&s.ID, &s.ClusterID, &s.Spec, &destination, &bucket, &s.Dest.ApiKeyID, &secret, &s.Dest.Path, &s.Dest.Endpoint,
+		&s.Dest.Region, &forcePathStyle); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return s, err
+		}
+		return s, fmt.Errorf("unable to read backup row %w", err)
+	}
+	s.Dest.ForcePathStyle = forcePathStyle != 0
+	if destination != nil {
+		s.Dest.Type = destinationType(*destination)
+	}
+	if bucket != nil {
+		s.Dest.BucketName = *bucket
+	}
+	if secret != nil {
+		var err error
+		if s.Dest.ApiKeySecret, err = db.decrypt(*secret); err != nil {
+			return s, fmt.Errorf("unable to decrypt backup secret of cluster %s %w", s.ClusterID, err)
+		}
+	}
+	return s, nil
+}
+
+// specToSchedule splits a cron expression into the schedule fields of a BackupConfig.
+func specToSchedule(spec string) map[string]interface{} {
+	schedule := make(map[string]interface{})
+	for i, field := range strings.Fields(spec) {
+		if i < len(scheduleFields) {
+			schedule[scheduleFields[i]] = field
+		}
+	}
+	return schedule
+}
+
+// scheduleFields are the names of the fields of a cron expression in a BackupConfig schedule, in order.
+var scheduleFields = []string{"minute", "hour", "dom", "month", "dow"}
@@ -0,0 +1,80 @@
+package metastore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/internal/secrets"
+)
+
+func TestBackupSchedules(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	keyring, err := secrets.Load(tmpDir, "")
+	require.NoError(t, err)
+	db, err := NewDb(filepath.Join(tmpDir, "test.db"), WithKeyring(keyring))
+	require.NoError(t, err)
+
+	cluster := ClusterInfo{Name: "backups", ClusterID: generateID("backups")}
+	require.NoError(t, InsertService(db, cluster))
+	dest := Destination{Type: DestinationS3, BucketName: "bucket", Path: "spinup", ApiKeyID: "key-id", ApiKeySecret: "key-secret",
+		Endpoint: "http://minio:9000", Region: "us-east-1", ForcePathStyle: true}
+	require.NoError(t, SetBackupSchedule(db, cluster.ClusterID, "30 2 * * *", dest))
+
+	t.Run("schedules are read back with their credentials", func(t *testing.T) {
+		schedules, err := BackupSchedules(db)
+		require.NoError(t, err)
+		require.Len(t, schedules, 1)
+		assert.Equal(t, cluster.ClusterID, schedules[0].ClusterID)
+		assert.Equal(t, "30 2 * * *", schedules[0].Spec)
+		assert.Equal(t, dest, schedules[0].Dest)
+
+		var stored string
+		require.NoError(t, db.Client.QueryRow("select apiKeySecret from backup where clusterId = ?", cluster.ClusterID).Scan(&stored))
+		assert.True(t, secrets.IsEncrypted(stored))
+
+		config, ok, err := GetBackup(db, cluster.ClusterID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "30", config.Schedule["minute"])
+		assert.Equal(t, "2", config.Schedule["hour"])
+	})
+
+	t.Run("destinations of older versions are AWS destinations", func(t *testing.T) {
+		_, err := db.Client.Exec("update backup set destination = 'AWS' where clusterId = ?", cluster.ClusterID)
+		require.NoError(t, err)
+		schedule, ok, err := GetBackupSchedule(db, cluster.ClusterID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, DestinationS3, schedule.Dest.Type)
+	})
+
+	t.Run("a new schedule replaces the previous one", func(t *testing.T) {
+		require.NoError(t, SetBackupSchedule(db, cluster.ClusterID, "0 * * * *", dest))
+		schedules, err := BackupSchedules(db)
+		require.NoError(t, err)
+		require.Len(t, schedules, 1)
+		assert.Equal(t, "0 * * * *", schedules[0].Spec)
+	})
+
+	t.Run("backup secrets are re-encrypted on rotation", func(t *testing.T) {
+		require.NoError(t, keyring.Rotate())
+		n, err := EncryptSecrets(db)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		require.NoError(t, keyring.Prune())
+		schedules, err := BackupSchedules(db)
+		require.NoError(t, err)
+		assert.Equal(t, "key-secret", schedules[0].Dest.ApiKeySecret)
+	})
+
+	t.Run("schedules are deleted with their cluster", func(t *testing.T) {
+		require.NoError(t, DeleteCluster(db, cluster.ClusterID))
+		schedules, err := BackupSchedules(db)
+		require.NoError(t, err)
+		assert.Empty(t, schedules)
+	})
+}
@@ -0,0 +1,114 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CatalogBackup is a base backup of a cluster, as recorded in its backup catalog.
+type CatalogBackup struct {
+	Name       string    `json:"name"`
+	StartTime  time.Time `json:"start_time"`
+	FinishTime time.Time `json:"finish_time"`
+	// WalStart and WalEnd are the first and last WAL segments written while the backup was taken, which are needed to
+	// restore it.
+	WalStart string `json:"wal_start"`
+	WalEnd   string `json:"wal_end"`
+	// CompressedSize is the size of the backup in the destination, UncompressedSize the size of the data backed up.
+	CompressedSize   int64 `json:"compressed_size"`
+	UncompressedSize int64 `json:"uncompressed_size"`
+	// Delta is set for backups holding only the pages changed since a previous backup.
+	Delta bool `json:"delta"`
+}
+
+// BackupCatalog lists the base backups found in the backup destination of a cluster, oldest first, when the catalog
+// was last refreshed.
+type BackupCatalog struct {
+	ClusterID string `json:"cluster_id"`
+	// RefreshedAt is zero when the catalog was never refreshed.
+	RefreshedAt time.Time       `json:"refreshed_at"`
+	Backups     []CatalogBackup `json:"backups"`
+}
+
+// SaveBackupCatalog replaces the backup catalog of a cluster.
+func SaveBackupCatalog(db Db, catalog BackupCatalog) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	tx, err := db.Client.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin a transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	if err := deleteBackupCatalog(ctx, db, tx, catalog.ClusterID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, db.rebind("insert into backupCatalog(clusterId, refreshedAt) values(?, ?)"),
+		catalog.ClusterID, catalog.RefreshedAt.Unix()); err != nil {
+		return fmt.Errorf("unable to save backup catalog of cluster %s %w", catalog.ClusterID, err)
+	}
+	query := "insert into catalogBackup(clusterId, name, startTime, finishTime, walStart, walEnd, compressedSize, uncompressedSize, delta) values(?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	for _, b := range catalog.Backups {
+		delta := 0
+		if b.Delta {
+			delta = 1
+		}
+		if _, err := tx.ExecContext(ctx, db.rebind(query), catalog.ClusterID, b.Name, b.StartTime.Unix(), b.FinishTime.Unix(),
+			b.WalStart, b.WalEnd, b.CompressedSize, b.UncompressedSize, delta); err != nil {
+			return fmt.Errorf("unable to save backup %s of cluster %s %w", b.Name, catalog.ClusterID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// GetBackupCatalog returns the backup catalog of a cluster, which is empty when it was never refreshed.
+func GetBackupCatalog(db Db, clusterID string) (BackupCatalog, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return BackupCatalog{}, fmt.Errorf("error running a migration %w", err)
+	}
+	catalog := BackupCatalog{ClusterID: clusterID, Backups: []CatalogBackup{}}
+	var refreshedAt int64
+	err := db.Client.QueryRow(db.rebind("select refreshedAt from backupCatalog where clusterId = ?"), clusterID).Scan(&refreshedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return catalog, nil
+	}
+	if err != nil {
+		return catalog, fmt.Errorf("unable to read backup catalog of cluster %s %w", clusterID, err)
+	}
+	catalog.RefreshedAt = time.Unix(refreshedAt, 0).UTC()
+
+	query := "select name, startTime, finishTime, walStart, walEnd, compressedSize, uncompressedSize, delta from catalogBackup where clusterId = ? order by finishTime, name"
+	rows, err := db.Client.Query(db.rebind(query), clusterID)
+	if err != nil {
+		return catalog, fmt.Errorf("unable to query backups of cluster %s %w", clusterID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b CatalogBackup
+		var startTime, finishTime int64
+		var delta int
+		if err := rows.Scan(&b.Name, &startTime, &finishTime, &b.WalStart, &b.WalEnd, &b.CompressedSize, &b.UncompressedSize, &delta); err != nil {
+			return catalog, fmt.Errorf("unable to read backup row %w", err)
+		}
+		b.StartTime = time.Unix(startTime, 0).UTC()
+		b.FinishTime = time.Unix(finishTime, 0).UTC()
+		b.Delta = delta != 0
+		catalog.Backups = append(catalog.Backups, b)
+	}
+	return catalog, rows.Err()
+}
+
+// deleteBackupCatalog removes the backup catalog of a cluster in a transaction.
+func deleteBackupCatalog(ctx context.Context, db Db, tx *sql.Tx, clusterID string) error {
+	for _, statement := range []string{"delete from catalogBackup where clusterId = ?", "delete from backupCatalog where clusterId = ?"} {
+		if _, err := tx.ExecContext(ctx, db.rebind(statement), clusterID); err != nil {
+			return fmt.Errorf("unable to execute %s %w", statement, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package metastore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupCatalog(t *testing.T) {
+	t.Parallel()
+	db, err := NewDb(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	require.NoError(t, InsertService(db, ClusterInfo{ClusterID: "cluster", Name: "cluster"}))
+
+	catalog, err := GetBackupCatalog(db, "cluster")
+	require.NoError(t, err)
+	assert.True(t, catalog.RefreshedAt.IsZero())
+	assert.Empty(t, catalog.Backups)
+
+	at := time.Unix(1700000000, 0).UTC()
+	full := CatalogBackup{Name: "base_000000010000000000000002", StartTime: at, FinishTime: at.Add(time.Minute),
+		WalStart: "000000010000000000000002", WalEnd: "000000010000000000000003", CompressedSize: 1024, UncompressedSize: 4096}
+	delta := CatalogBackup{Name: "base_000000010000000000000005_D_000000010000000000000002", StartTime: at.Add(time.Hour),
+		FinishTime: at.Add(time.Hour + time.Minute), WalStart: "000000010000000000000005", WalEnd: "000000010000000000000005", Delta: true}
+	require.NoError(t, SaveBackupCatalog(db, BackupCatalog{ClusterID: "cluster", RefreshedAt: at, Backups: []CatalogBackup{delta, full}}))
+
+	catalog, err = GetBackupCatalog(db, "cluster")
+	require.NoError(t, err)
+	assert.Equal(t, at, catalog.RefreshedAt)
+	assert.Equal(t, []CatalogBackup{full, delta}, catalog.Backups, "backups are listed oldest first")
+
+	t.Run("refreshes replace the catalog", func(t *testing.T) {
+		require.NoError(t, SaveBackupCatalog(db, BackupCatalog{ClusterID: "cluster", RefreshedAt: at.Add(time.Hour), Backups: []CatalogBackup{full}}))
+		catalog, err := GetBackupCatalog(db, "cluster")
+		require.NoError(t, err)
+		assert.Equal(t, []CatalogBackup{full}, catalog.Backups)
+	})
+
+	t.Run("new destinations clear the catalog", func(t *testing.T) {
+		require.NoError(t, SetBackupSchedule(db, "cluster", "0 3 * * *", Destination{Type: DestinationS3, BucketName: "other"}))
+		catalog, err := GetBackupCatalog(db, "cluster")
+		require.NoError(t, err)
+		assert.True(t, catalog.RefreshedAt.IsZero())
+		assert.Empty(t, catalog.Backups)
+	})
+
+	t.Run("the catalog is deleted with the cluster", func(t *testing.T) {
+		require.NoError(t, SaveBackupCatalog(db, BackupCatalog{ClusterID: "cluster", RefreshedAt: at, Backups: []CatalogBackup{full}}))
+		require.NoError(t, DeleteCluster(db, "cluster"))
+		catalog, err := GetBackupCatalog(db, "cluster")
+		require.NoError(t, err)
+		assert.Empty(t, catalog.Backups)
+	})
+}
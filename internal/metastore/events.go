@@ -0,0 +1,154 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Types of the events recorded for a cluster.
+const (
+	EventCreated            = "created"
+	EventStarted            = "started"
+	EventStopped            = "stopped"
+	EventResized            = "resized"
+	EventBackupScheduled    = "backup_scheduled"
+	EventBackupRun          = "backup_run"
+	EventBackupRetention    = "backup_retention"
+	EventBackupHealth       = "backup_health"
+	EventRestored           = "restored"
+	EventMonitoringAttached = "monitoring_attached"
+	EventContainerDied      = "container_died"
+	EventDeleted            = "deleted"
+)
+
+// Event is a lifecycle change of a cluster.
+type Event struct {
+	ID        int       `json:"id"`
+	ClusterID string    `json:"cluster_id"`
+	Type      string    `json:"type"`
+	Actor     string    `json:"actor"` // ID of the user who caused the event, or "spinup" for spinup's own actions
+	CreatedAt time.Time `json:"created_at"`
+	// Details describes the event, e.g. the new resources of a resized cluster.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// EventFilter selects the events returned by ListEvents.
+type EventFilter struct {
+	ClusterID string
+	// Cursor continues a previous listing, as returned in EventPage.NextCursor.
+	Cursor string
+	// Limit is the maximum number of events to return. Zero returns all matching events.
+	Limit int
+}
+
+// EventPage is a page of events. NextCursor is empty on the last page.
+type EventPage struct {
+	Events     []Event
+	NextCursor string
+}
+
+// InsertEvent records an event. Events without a time are recorded at the current time.
+func InsertEvent(db Db, event Event) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	details, err := encodeDetails(event.Details)
+	if err != nil {
+		return err
+	}
+	query := "insert into clusterEvent(clusterId, type, actor, details, createdAt) values(?, ?, ?, ?, ?)"
+	if _, err := db.Client.Exec(db.rebind(query), event.ClusterID, event.Type, event.Actor, details, event.CreatedAt.Unix()); err != nil {
+		return fmt.Errorf("unable to insert %s event for cluster %s %w", event.Type, event.ClusterID, err)
+	}
+	return nil
+}
+
+// ListEvents returns the events of a cluster, oldest first.
+func ListEvents(db Db, filter EventFilter) (EventPage, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return EventPage{}, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "select id, clusterId, type, actor, details, createdAt from clusterEvent where clusterId = ?"
+	args := []interface{}{filter.ClusterID}
+	if filter.Cursor != "" {
+		after, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return EventPage{}, err
+		}
+		query += " and id > ?"
+		args = append(args, after)
+	}
+	query += " order by id"
+	if filter.Limit > 0 {
+		// fetch one more row than needed to find out whether there is a next page.
+		query += " limit ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	rows, err := db.Client.Query(db.rebind(query), args...)
+	if err != nil {
+		return EventPage{}, fmt.Errorf("unable to query events for cluster %s %w", filter.ClusterID, err)
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return EventPage{}, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return EventPage{}, err
+	}
+
+	page := EventPage{Events: events}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		page.Events = events[:filter.Limit]
+		page.NextCursor = encodeCursor(page.Events[filter.Limit-1].ID)
+	}
+	return page, nil
+}
+
+// LastEvent returns the most recent event of the given type for a cluster. ok is false when there is none.
+func LastEvent(db Db, clusterID, eventType string) (event Event, ok bool, err error) {
+	if err := migration(context.Background(), db); err != nil {
+		return Event{}, false, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "select id, clusterId, type, actor, details, createdAt from clusterEvent where clusterId = ? and type = ? order by id desc limit 1"
+	rows, err := db.Client.Query(db.rebind(query), clusterID, eventType)
+	if err != nil {
+		return Event{}, false, fmt.Errorf("unable to query %s events for cluster %s %w", eventType, clusterID, err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return Event{}, false, rows.Err()
+	}
+	event, err = scanEvent(rows)
+	if err != nil {
+		return Event{}, false, err
+	}
+	return event, true, nil
+}
+
+func scanEvent(rows *sql.Rows) (Event, error) {
+	var event Event
+	var details string
+	var createdAt int64
+	if err := rows.Scan(&event.ID, &event.ClusterID, &event.Type, &event.Actor, &details, &createdAt); err != nil {
+		return Event{}, fmt.Errorf("unable to read event row %w", err)
+	}
+	if details != "" {
+		if err := json.Unmarshal([]byte(details), &event.Details); err != nil {
+			return Event{}, fmt.Errorf("unable to decode details of event %d %w", event.ID, err)
+		}
+	}
+	event.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return event, nil
+}
@@ -0,0 +1,79 @@
+package metastore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+	db, err := NewDb(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+
+	cluster := ClusterInfo{Name: "events", ClusterID: generateID("events")}
+	other := ClusterInfo{Name: "other", ClusterID: generateID("other")}
+	require.NoError(t, InsertService(db, cluster))
+	require.NoError(t, InsertService(db, other))
+
+	at := time.Unix(1700000000, 0).UTC()
+	require.NoError(t, InsertEvent(db, Event{ClusterID: cluster.ClusterID, Type: EventCreated, Actor: "u1", CreatedAt: at,
+		Details: map[string]string{"image": "postgres:14"}}))
+	require.NoError(t, InsertEvent(db, Event{ClusterID: other.ClusterID, Type: EventCreated, Actor: "u2"}))
+	require.NoError(t, InsertEvent(db, Event{ClusterID: cluster.ClusterID, Type: EventStopped, Actor: "spinup"}))
+	require.NoError(t, InsertEvent(db, Event{ClusterID: cluster.ClusterID, Type: EventStarted, Actor: "spinup"}))
+
+	t.Run("lists the events of a cluster oldest first", func(t *testing.T) {
+		page, err := ListEvents(db, EventFilter{ClusterID: cluster.ClusterID})
+		require.NoError(t, err)
+		require.Len(t, page.Events, 3)
+		assert.Empty(t, page.NextCursor)
+		assert.Equal(t, EventCreated, page.Events[0].Type)
+		assert.Equal(t, "u1", page.Events[0].Actor)
+		assert.Equal(t, at, page.Events[0].CreatedAt)
+		assert.Equal(t, map[string]string{"image": "postgres:14"}, page.Events[0].Details)
+		assert.Nil(t, page.Events[1].Details)
+		assert.False(t, page.Events[1].CreatedAt.IsZero())
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		page, err := ListEvents(db, EventFilter{ClusterID: cluster.ClusterID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page.Events, 2)
+		require.NotEmpty(t, page.NextCursor)
+
+		page, err = ListEvents(db, EventFilter{ClusterID: cluster.ClusterID, Limit: 2, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		require.Len(t, page.Events, 1)
+		assert.Equal(t, EventStarted, page.Events[0].Type)
+		assert.Empty(t, page.NextCursor)
+
+		_, err = ListEvents(db, EventFilter{ClusterID: cluster.ClusterID, Cursor: "bogus!"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
+	})
+
+	t.Run("the last event of a type", func(t *testing.T) {
+		require.NoError(t, InsertEvent(db, Event{ClusterID: cluster.ClusterID, Type: EventStopped, Actor: "u1"}))
+		event, ok, err := LastEvent(db, cluster.ClusterID, EventStopped)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "u1", event.Actor)
+
+		_, ok, err = LastEvent(db, cluster.ClusterID, EventContainerDied)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("events outlive their cluster", func(t *testing.T) {
+		require.NoError(t, DeleteCluster(db, cluster.ClusterID))
+		page, err := ListEvents(db, EventFilter{ClusterID: cluster.ClusterID})
+		require.NoError(t, err)
+		assert.Len(t, page.Events, 4)
+		page, err = ListEvents(db, EventFilter{ClusterID: other.ClusterID})
+		require.NoError(t, err)
+		assert.Len(t, page.Events, 1)
+	})
+}
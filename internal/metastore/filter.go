@@ -0,0 +1,143 @@
+package metastore
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// LabelSelector matches clusters by label. Without HasValue, any cluster with the label Key set matches, otherwise
+// the label must be set to Value, which may be empty.
+type LabelSelector struct {
+	Key      string
+	Value    string
+	HasValue bool
+}
+
+// ParseLabelSelectors parses a comma-separated list of selectors in the form "key=value" or "key". "key=" selects
+// clusters whose label is set to an empty value.
+func ParseLabelSelectors(s string) ([]LabelSelector, error) {
+	var selectors []LabelSelector
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("label selector '%s' has no key", part)
+		}
+		selectors = append(selectors, LabelSelector{Key: key, Value: strings.TrimSpace(value), HasValue: hasValue})
+	}
+	return selectors, nil
+}
+
+// ClusterFilter selects the clusters returned by ListClusters. Zero-valued fields don't filter anything.
+type ClusterFilter struct {
+	Owner      string
+	NamePrefix string
+	Status     string
+	MajVersion int
+	MinVersion *int
+	Labels     []LabelSelector
+
+	// Cursor continues a previous listing, as returned in ClusterPage.NextCursor.
+	Cursor string
+	// Limit is the maximum number of clusters to return. Zero returns all matching clusters.
+	Limit int
+}
+
+// ClusterPage is a page of clusters. NextCursor is empty on the last page.
+type ClusterPage struct {
+	Clusters   []ClusterInfo
+	NextCursor string
+}
+
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(string(raw))
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
+
+// ListClusters returns the clusters matching the filter, sorted by creation order.
+func ListClusters(db Db, filter ClusterFilter) (ClusterPage, error) {
+	var where []string
+	var args []interface{}
+	if filter.Owner != "" {
+		where = append(where, "owner = ?")
+		args = append(args, filter.Owner)
+	}
+	if filter.NamePrefix != "" {
+		// the prefix is compared rather than matched with like, so that '%' and '_' in the prefix are matched literally.
+		// The cast lets PostgreSQL pick the text variant of length.
+		where = append(where, "substr(name, 1, length(cast(? as text))) = ?")
+		args = append(args, filter.NamePrefix, filter.NamePrefix)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.MajVersion != 0 {
+		where = append(where, "majVersion = ?")
+		args = append(args, filter.MajVersion)
+	}
+	if filter.MinVersion != nil {
+		where = append(where, "minVersion = ?")
+		args = append(args, *filter.MinVersion)
+	}
+	for _, selector := range filter.Labels {
+		if !selector.HasValue {
+			where = append(where, "exists (select 1 from clusterLabel l where l.clusterId = clusterInfo.clusterId and l.key = ?)")
+			args = append(args, selector.Key)
+		} else {
+			where = append(where, "exists (select 1 from clusterLabel l where l.clusterId = clusterInfo.clusterId and l.key = ? and l.value = ?)")
+			args = append(args, selector.Key, selector.Value)
+		}
+	}
+	if filter.Cursor != "" {
+		after, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return ClusterPage{}, err
+		}
+		where = append(where, "id > ?")
+		args = append(args, after)
+	}
+
+	query := "select " + clusterColumns + " from clusterInfo"
+	if len(where) > 0 {
+		query += " where " + strings.Join(where, " and ")
+	}
+	query += " order by id"
+	if filter.Limit > 0 {
+		// fetch one more row than needed to find out whether there is a next page.
+		query += " limit ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	clusters, err := queryClusters(db, query, args...)
+	if err != nil {
+		return ClusterPage{}, err
+	}
+	page := ClusterPage{Clusters: clusters}
+	if filter.Limit > 0 && len(clusters) > filter.Limit {
+		page.Clusters = clusters[:filter.Limit]
+		page.NextCursor = encodeCursor(page.Clusters[filter.Limit-1].ID)
+	}
+	return page, nil
+}
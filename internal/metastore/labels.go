@@ -0,0 +1,101 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// GetLabels returns the labels set on the cluster with the given ID.
+func GetLabels(db Db, clusterID string) (map[string]string, error) {
+	rows, err := db.Client.Query(db.rebind("select key, value from clusterLabel where clusterId = ?"), clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query labels for cluster %s %w", clusterID, err)
+	}
+	defer rows.Close()
+
+	var labels map[string]string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("unable to read label row %w", err)
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+	return labels, rows.Err()
+}
+
+// UpdateLabels sets and removes labels on the cluster with the given ID. Keys in set are added or overwritten, keys
+// in remove are deleted.
+func UpdateLabels(db Db, clusterID string, set map[string]string, remove []string) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	tx, err := db.Client.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin a transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	for _, key := range remove {
+		if _, err := tx.ExecContext(ctx, db.rebind("delete from clusterLabel where clusterId = ? and key = ?"), clusterID, key); err != nil {
+			return fmt.Errorf("unable to remove label %s %w", key, err)
+		}
+	}
+	if err := setLabels(ctx, db, tx, clusterID, set); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setLabels(ctx context.Context, db Db, tx *sql.Tx, clusterID string, labels map[string]string) error {
+	for key, value := range labels {
+		_, err := tx.ExecContext(ctx,
+			db.rebind("insert into clusterLabel(clusterId, key, value) values(?, ?, ?) on conflict(clusterId, key) do update set value = excluded.value"),
+			clusterID, key, value)
+		if err != nil {
+			return fmt.Errorf("unable to set label %s %w", key, err)
+		}
+	}
+	return nil
+}
+
+// loadLabels fills in the labels of the given clusters using a single query.
+func loadLabels(db Db, clusters []ClusterInfo) error {
+	if len(clusters) == 0 {
+		return nil
+	}
+	byID := make(map[string]*ClusterInfo, len(clusters))
+	args := make([]interface{}, 0, len(clusters))
+	for i := range clusters {
+		byID[clusters[i].ClusterID] = &clusters[i]
+		args = append(args, clusters[i].ClusterID)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := db.Client.Query(db.rebind("select clusterId, key, value from clusterLabel where clusterId in ("+placeholders+")"), args...)
+	if err != nil {
+		return fmt.Errorf("unable to query cluster labels %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var clusterID, key, value string
+		if err := rows.Scan(&clusterID, &key, &value); err != nil {
+			return fmt.Errorf("unable to read label row %w", err)
+		}
+		cluster, ok := byID[clusterID]
+		if !ok {
+			continue
+		}
+		if cluster.Labels == nil {
+			cluster.Labels = make(map[string]string)
+		}
+		cluster.Labels[key] = value
+	}
+	return rows.Err()
+}
@@ -6,22 +6,55 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
+
+	"github.com/spinup-host/spinup/internal/secrets"
+)
+
+// ErrClusterNotFound is returned when no cluster matches a lookup.
+var ErrClusterNotFound = errors.New("cluster not found")
+
+const (
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+	// StatusIdle is used for clusters stopped by their idle policy. They are started again on the next connection.
+	StatusIdle = "idle"
+	// StatusStopping is used for clusters whose container is being stopped by their idle policy, or restarted when
+	// their idle policy is removed.
+	StatusStopping = "stopping"
 )
 
 type Db struct {
 	Client *sql.DB
+	// Backend is the database the metastore is kept in, SQLite when nil.
+	Backend Backend
+	// Keyring encrypts the secrets stored in the metastore, such as cluster passwords. Without a keyring, secrets are
+	// stored and read as they are.
+	Keyring *secrets.Keyring
+}
+
+type DbOptions func(*Db)
+
+// WithKeyring encrypts the secrets stored in the metastore with the given keyring.
+func WithKeyring(keyring *secrets.Keyring) DbOptions {
+	return func(db *Db) {
+		db.Keyring = keyring
+	}
 }
 
 type ClusterInfo struct {
 	// one of arm64v8 or arm32v7 or amd64
 	Architecture string `json:"architecture,omitempty"`
 
-	Type       string `json:"type"` // only "postgres" is supported at the moment
+	Type       string `json:"type"` // the database engine, e.g. "postgres", "mysql", "mariadb" or "redis"
 	Host       string `json:"host"`
 	ID         int    `json:"id,omitempty"`
 	ClusterID  string `json:"cluster_id"`
+	Owner      string `json:"owner,omitempty"` // ID of the user who created the cluster
 	Name       string `json:"name"`
 	Port       int    `json:"port"`
 	Username   string `json:"username"`
@@ -30,7 +63,25 @@ type ClusterInfo struct {
 	MinVersion int    `json:"minversion"`
 	Monitoring string `json:"monitoring,omitempty"`
 	CPU        int64  `json:"cpu,omitempty"`
-	Memory     int64  `json:"memory,omitempty"`
+	Memory     int64  `json:"memory,omitempty"` // in megabytes
+	Disk       int64  `json:"disk,omitempty"`   // in megabytes, reserved for the data volume
+	Status     string `json:"status,omitempty"` // status after the last lifecycle change, e.g. "running"
+	Image      string `json:"image,omitempty"`  // image the cluster was created from, as requested (before mirroring)
+
+	// ExpiresAt is the time after which the cluster is deleted automatically. Nil for clusters that don't expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// IdleTimeout is how long (in seconds) the cluster can go without client connections before it is stopped.
+	// Zero disables the idle policy.
+	IdleTimeout int64 `json:"idle_timeout,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// DataMount is where the cluster's data directory lives on the host: the name of its volume, or the host path of
+	// a bind mount.
+	DataMount string `json:"data_mount,omitempty"`
+	// Volumes are the volumes removed along with the cluster. Volumes mounted into adopted clusters by bind mounts
+	// aren't spinup's to remove.
+	Volumes []string `json:"volumes,omitempty"`
 
 	BackupEnabled bool         `json:"backup_enabled,omitempty"`
 	Backup        BackupConfig `json:"backup,omitempty"`
@@ -42,11 +93,40 @@ type BackupConfig struct {
 	Dest     Destination `json:"Dest"`
 }
 
+// Destination is where the backups of a cluster are kept. Type is one of the Destination* types, and selects which of
+// the other fields are used.
 type Destination struct {
-	Name         string
-	BucketName   string
+	Type string
+	// BucketName is the bucket of S3 and GCS destinations, and the container of Azure destinations.
+	BucketName string
+	// Path is the directory of file destinations, and an optional prefix in the bucket of other destinations.
+	Path string
+	// ApiKeyID and ApiKeySecret are the access key of S3 destinations, and the storage account and its access key for
+	// Azure destinations. ApiKeySecret is the service account key, in JSON, of GCS destinations.
 	ApiKeyID     string
 	ApiKeySecret string
+	// Endpoint, Region and ForcePathStyle reach S3-compatible storage such as MinIO. Path-style requests put the
+	// bucket in the path of the URL rather than in the host name.
+	Endpoint       string
+	Region         string
+	ForcePathStyle bool
+}
+
+// The types of backup destinations.
+const (
+	DestinationS3    = "s3"
+	DestinationGCS   = "gcs"
+	DestinationAzure = "azure"
+	DestinationFile  = "file"
+)
+
+// destinationType returns the type of a destination as it's stored. Older versions of spinup only had AWS
+// destinations, stored as "AWS".
+func destinationType(stored string) string {
+	if stored == "AWS" {
+		return DestinationS3
+	}
+	return stored
 }
 
 // clustersInfo type has methods which provide us to filter them by name etc.
@@ -59,34 +139,132 @@ func (c clustersInfo) FilterByName(name string) (ClusterInfo, error) {
 			return clusterInfo, nil
 		}
 	}
-	return ClusterInfo{}, errors.New("cluster not found")
+	return ClusterInfo{}, ErrClusterNotFound
 }
 
-func NewDb(path string) (Db, error) {
-	db, err := sql.Open("sqlite", path)
+// sqliteParams make concurrent writers, such as the background jobs recording cluster events, wait for each other
+// instead of failing with SQLITE_BUSY. Transactions take the write lock when they begin, as a transaction upgrading
+// its read lock can't wait for another writer without deadlocking.
+const sqliteParams = "?_pragma=busy_timeout(5000)&_txlock=immediate"
+
+func NewDb(path string, opts ...DbOptions) (Db, error) {
+	client, err := sql.Open("sqlite", path+sqliteParams)
 	if err != nil {
 		return Db{}, fmt.Errorf("unable to create a new db sqlite db client %w", err)
 	}
-	return Db{Client: db}, nil
+	db := Db{Client: client}
+	for _, opt := range opts {
+		opt(&db)
+	}
+	return db, nil
 }
 
-// migration creates table
-func migration(ctx context.Context, db Db) error {
-	sqlStatements := []string{
-		"create table if not exists clusterInfo (id integer not null primary key autoincrement, clusterId text, name text, username text, password text, port integer, majVersion integer, minVersion integer);",
-		"create table if not exists backup (id integer not null primary key autoincrement, clusterid text, destination text, bucket text, second integer, minute integer, hour integer, dom integer, month integer, dow integer, foreign key(clusterid) references clusterinfo(clusterid));",
+// rebind adapts a query to the backend.
+func (db Db) rebind(query string) string {
+	if db.Backend == nil {
+		return query
+	}
+	return db.Backend.Rebind(query)
+}
+
+// migration adapts a migration statement to the backend.
+func (db Db) migration(statement string) string {
+	if db.Backend == nil {
+		return statement
 	}
+	return db.Backend.Migration(statement)
+}
+
+// afterImport returns the statement to run after rows were imported into the table with their id.
+func (db Db) afterImport(table string) string {
+	if db.Backend == nil {
+		return ""
+	}
+	return db.Backend.AfterImport(table)
+}
+
+// encrypt returns the value a secret is stored as.
+func (db Db) encrypt(secret string) (string, error) {
+	if db.Keyring == nil {
+		return secret, nil
+	}
+	return db.Keyring.Encrypt(secret)
+}
+
+// decrypt returns the secret stored as the given value.
+func (db Db) decrypt(value string) (string, error) {
+	if db.Keyring == nil {
+		return value, nil
+	}
+	return db.Keyring.Decrypt(value)
+}
+
+// migrations holds the statements that make up the metastore schema. Each statement is applied exactly once and in
+// order, so existing statements must never be edited; schema changes are made by appending new statements.
+var migrations = []string{
+	"create table if not exists clusterInfo (id integer not null primary key autoincrement, clusterId text, name text, username text, password text, port integer, majVersion integer, minVersion integer);",
+	"create table if not exists backup (id integer not null primary key autoincrement, clusterid text, destination text, bucket text, second integer, minute integer, hour integer, dom integer, month integer, dow integer, foreign key(clusterid) references clusterinfo(clusterid));",
+	"alter table clusterInfo add column owner text not null default '';",
+	"alter table clusterInfo add column cpu integer not null default 0;",
+	"alter table clusterInfo add column memory integer not null default 0;",
+	"alter table clusterInfo add column disk integer not null default 0;",
+	"alter table clusterInfo add column status text not null default 'running';",
+	"create table if not exists clusterLabel (clusterId text not null, key text not null, value text not null, primary key (clusterId, key));",
+	"alter table clusterInfo add column expiresAt integer not null default 0;",
+	"alter table clusterInfo add column idleTimeout integer not null default 0;",
+	"alter table clusterInfo add column image text not null default '';",
+	"alter table clusterInfo add column type text not null default 'postgres';",
+	"create table if not exists clusterEvent (id integer not null primary key autoincrement, clusterId text not null, type text not null, actor text not null, details text not null default '', createdAt integer not null);",
+	"alter table backup add column spec text not null default '';",
+	"alter table backup add column apiKeyId text not null default '';",
+	"alter table backup add column apiKeySecret text not null default '';",
+	"create table if not exists operation (operationId text not null primary key, type text not null, clusterId text not null default '', owner text not null, status text not null, step text not null default '', error text not null default '', details text not null default '', createdAt integer not null, updatedAt integer not null);",
+	"create table if not exists backupCatalog (clusterId text not null primary key, refreshedAt integer not null);",
+	"create table if not exists catalogBackup (clusterId text not null, name text not null, startTime integer not null, finishTime integer not null, walStart text not null default '', walEnd text not null default '', compressedSize integer not null default 0, uncompressedSize integer not null default 0, delta integer not null default 0, primary key (clusterId, name));",
+	"create table if not exists backupRetention (clusterId text not null primary key, keepLast integer not null default 0, keepDays integer not null default 0, keepWeekly integer not null default 0, keepMonthly integer not null default 0, dryRun integer not null default 0);",
+	"alter table backup add column path text not null default '';",
+	"alter table backup add column endpoint text not null default '';",
+	"alter table backup add column region text not null default '';",
+	"alter table backup add column forcePathStyle integer not null default 0;",
+	"create table if not exists backupRun (id integer not null primary key autoincrement, runId text not null unique, clusterId text not null, triggeredBy text not null, operationId text not null default '', destination text not null default '', bucket text not null default '', status text not null, startedAt integer not null, finishedAt integer not null default 0, exitCode integer not null default 0, backupName text not null default '', bytesUploaded integer not null default 0, logs text not null default '', error text not null default '');",
+	"alter table clusterInfo add column dataMount text not null default '';",
+	"alter table clusterInfo add column volumes text not null default '';",
+}
+
+// migration brings the schema up to date by applying the migrations that haven't been applied yet.
+func migration(ctx context.Context, db Db) error {
 	tx, err := db.Client.Begin()
 	if err != nil {
 		return fmt.Errorf("couldn't begin a transaction %w", err)
 
 	}
-	for _, sqlStatement := range sqlStatements {
-		_, err = tx.ExecContext(ctx, sqlStatement)
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, db.migration("create table if not exists schemaVersion (version integer not null);")); err != nil {
+		return fmt.Errorf("couldn't create schema version table %w", err)
+	}
+	var version int
+	err = tx.QueryRowContext(ctx, "select version from schemaVersion limit 1").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err = tx.ExecContext(ctx, "insert into schemaVersion(version) values(0)"); err != nil {
+			return fmt.Errorf("couldn't initialize schema version %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("couldn't read schema version %w", err)
+	}
+	if version >= len(migrations) {
+		return nil
+	}
+
+	for _, sqlStatement := range migrations[version:] {
+		_, err = tx.ExecContext(ctx, db.migration(sqlStatement))
 		if err != nil {
 			return fmt.Errorf("couldn't execute a transaction for %s %w", sqlStatement, err)
 		}
 	}
+	if _, err = tx.ExecContext(ctx, db.rebind("update schemaVersion set version = ?"), len(migrations)); err != nil {
+		return fmt.Errorf("couldn't update schema version %w", err)
+	}
 	err = tx.Commit()
 	if err != nil {
 		return fmt.Errorf("couldn't commit a transaction %w", err)
@@ -97,15 +275,28 @@ func migration(ctx context.Context, db Db) error {
 // InsertService adds a new row containing the cluster/service info to the database.
 // TODO: How to write generic functions with varying fields and types? Maybe generics
 func InsertService(db Db, cluster ClusterInfo) error {
-	query := "insert into clusterInfo(clusterId, name, username, password, port, majVersion, minVersion) values(?, ?, ?, ?, ?, ?, ?)"
+	query := "insert into clusterInfo(clusterId, name, username, password, port, majVersion, minVersion, owner, cpu, memory, disk, status, expiresAt, idleTimeout, image, type, dataMount, volumes) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if cluster.Status == "" {
+		cluster.Status = StatusRunning
+	}
+	if cluster.Type == "" {
+		cluster.Type = "postgres"
+	}
+	password, err := db.encrypt(cluster.Password)
+	if err != nil {
+		return fmt.Errorf("unable to encrypt password %w", err)
+	}
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
 	tx, err := db.Client.Begin()
 	if err != nil {
 		return fmt.Errorf("unable to begin a transaction %w", err)
 	}
-	if err = migration(context.Background(), db); err != nil {
-		return fmt.Errorf("error running a migration %w", err)
+	_, err = tx.ExecContext(context.Background(), db.rebind(query), cluster.ClusterID, cluster.Name, cluster.Username, password, cluster.Port, cluster.MajVersion, cluster.MinVersion, cluster.Owner, cluster.CPU, cluster.Memory, cluster.Disk, cluster.Status, toUnix(cluster.ExpiresAt), cluster.IdleTimeout, cluster.Image, cluster.Type, cluster.DataMount, strings.Join(cluster.Volumes, ","))
+	if err == nil {
+		err = setLabels(context.Background(), db, tx, cluster.ClusterID, cluster.Labels)
 	}
-	_, err = tx.ExecContext(context.Background(), query, cluster.ClusterID, cluster.Name, cluster.Username, cluster.Password, cluster.Port, cluster.MajVersion, cluster.MinVersion)
 	if err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			log.Println("ERROR: failed to rollback transaction: ", rollbackErr)
@@ -125,7 +316,7 @@ func InsertBackup(db Db, sql, clusterId, destination, bucket string, second, min
 	if err != nil {
 		return fmt.Errorf("unable to begin a transaction %w", err)
 	}
-	res, err := tx.ExecContext(context.Background(), sql, clusterId, destination, bucket, second, minute, hour, dom, month, dow)
+	res, err := tx.ExecContext(context.Background(), db.rebind(sql), clusterId, destination, bucket, second, minute, hour, dom, month, dow)
 	if err != nil {
 		return fmt.Errorf("unable to execute %s %v", sql, err)
 	}
@@ -138,67 +329,267 @@ func InsertBackup(db Db, sql, clusterId, destination, bucket string, second, min
 	return nil
 }
 
+// GetBackup returns the most recent backup schedule of the cluster with the given ID, or false if the cluster has no
+// backup schedule. The destination only has its name and bucket, without credentials. The schedule fields are
+// strings, as in the BackupConfig backups are created with.
+func GetBackup(db Db, clusterID string) (BackupConfig, bool, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return BackupConfig{}, false, fmt.Errorf("error running a migration %w", err)
+	}
+	var destination, bucket sql.NullString
+	var spec string
+	var minute, hour, dom, month, dow int
+	err := db.Client.QueryRow(db.rebind("select destination, bucket, spec, minute, hour, dom, month, dow from backup where clusterid = ? order by id desc limit 1"), clusterID).
+		Scan(&destination, &bucket, &spec, &minute, &hour, &dom, &month, &dow)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BackupConfig{}, false, nil
+	}
+	if err != nil {
+		return BackupConfig{}, false, fmt.Errorf("unable to read backup schedule %w", err)
+	}
+	if spec != "" {
+		return BackupConfig{
+			Schedule: specToSchedule(spec),
+			Dest:     Destination{Type: destinationType(destination.String), BucketName: bucket.String},
+		}, true, nil
+	}
+	return BackupConfig{
+		Schedule: map[string]interface{}{
+			"minute": strconv.Itoa(minute),
+			"hour":   strconv.Itoa(hour),
+			"dom":    strconv.Itoa(dom),
+			"month":  strconv.Itoa(month),
+			"dow":    strconv.Itoa(dow),
+		},
+		Dest: Destination{Type: destinationType(destination.String), BucketName: bucket.String},
+	}, true, nil
+}
+
+// clusterColumns lists the clusterInfo columns read by scanCluster, in order.
+const clusterColumns = "id, clusterId, name, username, password, port, majVersion, minVersion, owner, cpu, memory, disk, status, expiresAt, idleTimeout, image, type, dataMount, volumes"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCluster(db Db, row rowScanner) (ClusterInfo, error) {
+	var ci ClusterInfo
+	var expiresAt int64
+	var volumes string
+	err := row.Scan(
+		&ci.ID,
+		&ci.ClusterID,
+		&ci.Name,
+		&ci.Username,
+		&ci.Password,
+		&ci.Port,
+		&ci.MajVersion,
+		&ci.MinVersion,
+		&ci.Owner,
+		&ci.CPU,
+		&ci.Memory,
+		&ci.Disk,
+		&ci.Status,
+		&expiresAt,
+		&ci.IdleTimeout,
+		&ci.Image,
+		&ci.Type,
+		&ci.DataMount,
+		&volumes,
+	)
+	ci.ExpiresAt = fromUnix(expiresAt)
+	if volumes != "" {
+		ci.Volumes = strings.Split(volumes, ",")
+	}
+	ci.Host = "localhost" // filled since we don't save the host yet.
+	if err == nil {
+		if ci.Password, err = db.decrypt(ci.Password); err != nil {
+			err = fmt.Errorf("unable to decrypt password of cluster %s %w", ci.ClusterID, err)
+		}
+	}
+	return ci, err
+}
+
+// toUnix converts an optional time to unix seconds for storage, with 0 standing for no time.
+func toUnix(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	t := time.Unix(sec, 0).UTC()
+	return &t
+}
+
 // AllClusters returns all clusters from clusterinfo table
 func AllClusters(db Db) (clustersInfo, error) {
+	return queryClusters(db, "select "+clusterColumns+" from clusterInfo")
+}
+
+// ClustersByOwner returns the clusters created by the given user.
+func ClustersByOwner(db Db, owner string) (clustersInfo, error) {
+	return queryClusters(db, "select "+clusterColumns+" from clusterInfo where owner = ?", owner)
+}
+
+func queryClusters(db Db, query string, args ...interface{}) (clustersInfo, error) {
 	if err := db.Client.Ping(); err != nil {
 		return nil, fmt.Errorf("error pinging sqlite database %w", err)
 	}
 	if err := migration(context.Background(), db); err != nil {
 		return nil, fmt.Errorf("error running a migration %w", err)
 	}
-	rows, err := db.Client.Query("select id, clusterId, name, username, password, port, majversion, minversion from clusterInfo")
+	rows, err := db.Client.Query(db.rebind(query), args...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to query clusterinfo")
+		return nil, fmt.Errorf("unable to query clusterinfo %w", err)
 	}
 	defer rows.Close()
 	var csi clustersInfo
-	var cluster ClusterInfo
 	for rows.Next() {
-		err = rows.Scan(&cluster.ID, &cluster.ClusterID, &cluster.Name, &cluster.Username, &cluster.Password, &cluster.Port, &cluster.MajVersion, &cluster.MinVersion)
+		cluster, err := scanCluster(db, rows)
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("unable to read clusterinfo row %w", err)
 		}
-		cluster.Host = "localhost"
 		csi = append(csi, cluster)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadLabels(db, csi); err != nil {
+		return nil, err
+	}
 	return csi, nil
 }
 
 // GetClusterByID returns info about the cluster whose ID is provided.
 func GetClusterByID(db Db, clusterId string) (ClusterInfo, error) {
-	var ci ClusterInfo
-	query := `SELECT id, clusterId, name, username, password, port, majVersion, minVersion FROM clusterInfo WHERE clusterId = ? LIMIT 1`
-	err := db.Client.QueryRow(query, clusterId).Scan(
-		&ci.ID,
-		&ci.ClusterID,
-		&ci.Name,
-		&ci.Username,
-		&ci.Password,
-		&ci.Port,
-		&ci.MajVersion,
-		&ci.MinVersion,
-	)
-	ci.Host = "localhost" // filled since we don't save the host yet.
+	if err := migration(context.Background(), db); err != nil {
+		return ClusterInfo{}, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "SELECT " + clusterColumns + " FROM clusterInfo WHERE clusterId = ? LIMIT 1"
+	ci, err := scanCluster(db, db.Client.QueryRow(db.rebind(query), clusterId))
 	if errors.Is(err, sql.ErrNoRows) {
-		return ci, errors.New(fmt.Sprintf("no cluster with ID: '%s' was found", clusterId))
+		return ci, fmt.Errorf("no cluster with ID: '%s' was found %w", clusterId, ErrClusterNotFound)
+	}
+	if err != nil {
+		return ci, err
 	}
+	ci.Labels, err = GetLabels(db, ci.ClusterID)
 	return ci, err
 }
 
 // GetClusterByName returns info about the cluster whose name is provided.
 func GetClusterByName(db Db, clusterName string) (ClusterInfo, error) {
-	var ci ClusterInfo
-	query := `SELECT id, clusterId, name, username, password, port, majVersion, minVersion FROM clusterInfo WHERE name = ? LIMIT 1`
-	err := db.Client.QueryRow(query, clusterName).Scan(
-		&ci.ID,
-		&ci.ClusterID,
-		&ci.Name,
-		&ci.Username,
-		&ci.Password,
-		&ci.Port,
-		&ci.MajVersion,
-		&ci.MinVersion,
-	)
-	ci.Host = "localhost" // filled since we don't save the host yet.
-	return ci, err
+	if err := migration(context.Background(), db); err != nil {
+		return ClusterInfo{}, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "SELECT " + clusterColumns + " FROM clusterInfo WHERE name = ? LIMIT 1"
+	return scanCluster(db, db.Client.QueryRow(db.rebind(query), clusterName))
+}
+
+// UpdateClusterResources saves the resources allocated to the cluster with the given ID.
+func UpdateClusterResources(db Db, clusterID string, cpu, memory, disk int64) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	res, err := db.Client.Exec(db.rebind("update clusterInfo set cpu = ?, memory = ?, disk = ? where clusterId = ?"), cpu, memory, disk, clusterID)
+	if err != nil {
+		return fmt.Errorf("unable to update resources for cluster %s %w", clusterID, err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no cluster with ID: '%s' was found %w", clusterID, ErrClusterNotFound)
+	}
+	return nil
+}
+
+// UpdateClusterStatus saves the status of the cluster with the given ID.
+func UpdateClusterStatus(db Db, clusterID, status string) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	res, err := db.Client.Exec(db.rebind("update clusterInfo set status = ? where clusterId = ?"), status, clusterID)
+	if err != nil {
+		return fmt.Errorf("unable to update status for cluster %s %w", clusterID, err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no cluster with ID: '%s' was found %w", clusterID, ErrClusterNotFound)
+	}
+	return nil
+}
+
+// ClustersExpiringBefore returns the clusters with an expiry time before t, soonest first.
+func ClustersExpiringBefore(db Db, t time.Time) (clustersInfo, error) {
+	return queryClusters(db, "select "+clusterColumns+" from clusterInfo where expiresAt > 0 and expiresAt <= ? order by expiresAt", t.Unix())
+}
+
+// UpdateClusterExpiry changes the expiry time of the cluster with the given ID. A nil time means it never expires.
+func UpdateClusterExpiry(db Db, clusterID string, expiresAt *time.Time) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	res, err := db.Client.Exec(db.rebind("update clusterInfo set expiresAt = ? where clusterId = ?"), toUnix(expiresAt), clusterID)
+	if err != nil {
+		return fmt.Errorf("unable to update expiry for cluster %s %w", clusterID, err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no cluster with ID: '%s' was found %w", clusterID, ErrClusterNotFound)
+	}
+	return nil
+}
+
+// DeleteCluster removes the cluster with the given ID, along with its labels, backup schedules and backup runs. Its
+// events are kept, so that its history outlives it.
+func DeleteCluster(db Db, clusterID string) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	tx, err := db.Client.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin a transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	statements := []string{
+		"delete from clusterLabel where clusterId = ?",
+		"delete from backup where clusterid = ?",
+		"delete from catalogBackup where clusterId = ?",
+		"delete from backupCatalog where clusterId = ?",
+		"delete from backupRetention where clusterId = ?",
+		"delete from backupRun where clusterId = ?",
+		"delete from clusterInfo where clusterId = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, db.rebind(statement), clusterID); err != nil {
+			return fmt.Errorf("unable to execute %s %w", statement, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ClustersWithIdlePolicy returns the clusters that have an idle timeout set, and those that are still idle or
+// stopping after their idle timeout was removed.
+func ClustersWithIdlePolicy(db Db) (clustersInfo, error) {
+	return queryClusters(db, "select "+clusterColumns+" from clusterInfo where idleTimeout > 0 or status in (?, ?) order by id",
+		StatusIdle, StatusStopping)
+}
+
+// UpdateIdleTimeout changes the idle timeout (in seconds) of the cluster with the given ID. Zero disables it.
+func UpdateIdleTimeout(db Db, clusterID string, idleTimeout int64) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	res, err := db.Client.Exec(db.rebind("update clusterInfo set idleTimeout = ? where clusterId = ?"), idleTimeout, clusterID)
+	if err != nil {
+		return fmt.Errorf("unable to update idle timeout for cluster %s %w", clusterID, err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("no cluster with ID: '%s' was found %w", clusterID, ErrClusterNotFound)
+	}
+	return nil
 }
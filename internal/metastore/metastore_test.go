@@ -30,15 +30,19 @@ func TestServices(t *testing.T) {
 			Host:       "localhost",
 			Name:       "db1",
 			ClusterID:  generateID("db1"),
+			Owner:      "owner1",
 			Username:   "user1",
 			Password:   "password1",
 			Port:       9001,
 			MajVersion: 13,
 			MinVersion: 0,
+			DataMount:  "db1",
+			Volumes:    []string{"db1", "db1-walg"},
 		}, {
 			Host:       "localhost",
 			Name:       "db2",
 			ClusterID:  generateID("db2"),
+			Owner:      "owner1",
 			Username:   "user2",
 			Password:   "password2",
 			Port:       9001,
@@ -48,6 +52,7 @@ func TestServices(t *testing.T) {
 			Host:       "localhost",
 			Name:       "db3",
 			ClusterID:  generateID("db3"),
+			Owner:      "owner2",
 			Username:   "user3",
 			Password:   "password3",
 			Port:       9002,
@@ -96,6 +101,19 @@ func TestServices(t *testing.T) {
 		assert.Equal(t, len(clusters), len(result))
 	})
 
+	t.Run("get clusters by owner", func(t *testing.T) {
+		result, err := ClustersByOwner(db, "owner1")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(result))
+		for _, cluster := range result {
+			assert.Equal(t, "owner1", cluster.Owner)
+		}
+
+		result, err = ClustersByOwner(db, "unknown")
+		assert.NoError(t, err)
+		assert.Empty(t, result)
+	})
+
 	t.Run("get cluster by ID", func(t *testing.T) {
 		result, err := GetClusterByID(db, generateID("db1"))
 		assert.NoError(t, err)
@@ -103,7 +121,130 @@ func TestServices(t *testing.T) {
 		// we don't compare the struct directly since it may have been modified (e.g., auto-incremented ID field is added)
 		// and thus, won't be equal.
 		assert.Equal(t, clusters[0].ClusterID, result.ClusterID)
+		assert.Equal(t, clusters[0].Owner, result.Owner)
+		assert.Equal(t, clusters[0].DataMount, result.DataMount)
+		assert.Equal(t, clusters[0].Volumes, result.Volumes)
+
+		_, err = GetClusterByID(db, generateID("random_db"))
+		assert.ErrorIs(t, err, ErrClusterNotFound)
+	})
+
+	t.Run("delete cluster", func(t *testing.T) {
+		require.NoError(t, UpdateLabels(db, generateID("db4"), map[string]string{"env": "dev"}, nil))
+		require.NoError(t, DeleteCluster(db, generateID("db4")))
+
+		_, err := GetClusterByID(db, generateID("db4"))
+		assert.ErrorIs(t, err, ErrClusterNotFound)
+		labels, err := GetLabels(db, generateID("db4"))
+		assert.NoError(t, err)
+		assert.Empty(t, labels)
+	})
+
+	t.Run("migration is idempotent", func(t *testing.T) {
+		assert.NoError(t, migration(context.TODO(), db))
+		assert.NoError(t, migration(context.TODO(), db))
+
+		var version int
+		require.NoError(t, db.Client.QueryRow("select version from schemaVersion").Scan(&version))
+		assert.Equal(t, len(migrations), version)
+	})
+}
+
+func TestListClusters(t *testing.T) {
+	t.Parallel()
+	tmpDir, err := os.MkdirTemp("", "")
+	require.NoError(t, err)
+	path := filepath.Join(tmpDir, "test.db")
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(path)
+
+	db, err := NewDb(path)
+	require.NoError(t, err)
+
+	clusters := []ClusterInfo{
+		{Name: "app-db", ClusterID: generateID("app-db"), Owner: "u1", MajVersion: 13, MinVersion: 6, Labels: map[string]string{"env": "prod", "team": "a"}},
+		{Name: "app-cache", ClusterID: generateID("app-cache"), Owner: "u1", MajVersion: 14, MinVersion: 0, Labels: map[string]string{"env": "dev", "team": ""}},
+		{Name: "web_db", ClusterID: generateID("web_db"), Owner: "u2", MajVersion: 13, MinVersion: 0, Status: StatusStopped},
+		{Name: "webxdb", ClusterID: generateID("webxdb"), Owner: "u2", MajVersion: 13, MinVersion: 6, Labels: map[string]string{"env": "prod"}},
+	}
+	for _, cluster := range clusters {
+		require.NoError(t, InsertService(db, cluster))
+	}
+
+	names := func(page ClusterPage) []string {
+		var n []string
+		for _, c := range page.Clusters {
+			n = append(n, c.Name)
+		}
+		return n
+	}
+	six := 6
+	for _, tc := range []struct {
+		name     string
+		filter   ClusterFilter
+		expected []string
+	}{
+		{"no filter", ClusterFilter{}, []string{"app-db", "app-cache", "web_db", "webxdb"}},
+		{"owner", ClusterFilter{Owner: "u2"}, []string{"web_db", "webxdb"}},
+		{"name prefix", ClusterFilter{NamePrefix: "app-"}, []string{"app-db", "app-cache"}},
+		{"name prefix is literal", ClusterFilter{NamePrefix: "web_"}, []string{"web_db"}},
+		{"status", ClusterFilter{Status: StatusStopped}, []string{"web_db"}},
+		{"major version", ClusterFilter{MajVersion: 13}, []string{"app-db", "web_db", "webxdb"}},
+		{"minor version", ClusterFilter{MajVersion: 13, MinVersion: &six}, []string{"app-db", "webxdb"}},
+		{"label value", ClusterFilter{Labels: []LabelSelector{{Key: "env", Value: "prod", HasValue: true}}}, []string{"app-db", "webxdb"}},
+		{"label exists", ClusterFilter{Labels: []LabelSelector{{Key: "team"}}}, []string{"app-db", "app-cache"}},
+		{"empty label value", ClusterFilter{Labels: []LabelSelector{{Key: "team", HasValue: true}}}, []string{"app-cache"}},
+		{"combined", ClusterFilter{Owner: "u1", Labels: []LabelSelector{{Key: "env", Value: "prod", HasValue: true}}}, []string{"app-db"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := ListClusters(db, tc.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, names(page))
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+
+	t.Run("labels are returned", func(t *testing.T) {
+		page, err := ListClusters(db, ClusterFilter{NamePrefix: "app-db"})
+		require.NoError(t, err)
+		require.Len(t, page.Clusters, 1)
+		assert.Equal(t, clusters[0].Labels, page.Clusters[0].Labels)
+	})
+
+	t.Run("paginates in creation order", func(t *testing.T) {
+		var seen []string
+		filter := ClusterFilter{Limit: 3}
+		for {
+			page, err := ListClusters(db, filter)
+			require.NoError(t, err)
+			seen = append(seen, names(page)...)
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []string{"app-db", "app-cache", "web_db", "webxdb"}, seen)
+
+		_, err := ListClusters(db, ClusterFilter{Cursor: "not a cursor"})
+		assert.ErrorIs(t, err, ErrInvalidCursor)
 	})
+
+	t.Run("update labels", func(t *testing.T) {
+		require.NoError(t, UpdateLabels(db, clusters[0].ClusterID, map[string]string{"env": "staging", "tier": "1"}, []string{"team"}))
+		ci, err := GetClusterByID(db, clusters[0].ClusterID)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"env": "staging", "tier": "1"}, ci.Labels)
+	})
+}
+
+func TestParseLabelSelectors(t *testing.T) {
+	selectors, err := ParseLabelSelectors("env=prod, team ,tier=")
+	require.NoError(t, err)
+	assert.Equal(t, []LabelSelector{{Key: "env", Value: "prod", HasValue: true}, {Key: "team"}, {Key: "tier", HasValue: true}}, selectors)
+
+	_, err = ParseLabelSelectors("=prod")
+	assert.Error(t, err)
 }
 
 func generateID(name string) string {
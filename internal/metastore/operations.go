@@ -0,0 +1,129 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Statuses of an operation.
+const (
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+)
+
+// ErrOperationNotFound is returned when no operation matches the given ID.
+var ErrOperationNotFound = errors.New("operation not found")
+
+// Operation is a long-running task started through the API, such as a restore, whose progress is polled by clients.
+type Operation struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // e.g. "restore"
+	// ClusterID is the cluster the operation acts on, set once the cluster exists.
+	ClusterID string `json:"cluster_id,omitempty"`
+	Owner     string `json:"owner"`
+	Status    string `json:"status"`
+	// Step describes what the operation is doing while it runs, e.g. "fetching backup".
+	Step      string            `json:"step,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// InsertOperation records a new operation. Operations without a creation time are created at the current time.
+func InsertOperation(db Db, op Operation) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	if op.CreatedAt.IsZero() {
+		op.CreatedAt = time.Now()
+	}
+	details, err := encodeDetails(op.Details)
+	if err != nil {
+		return err
+	}
+	query := "insert into operation(operationId, type, clusterId, owner, status, step, error, details, createdAt, updatedAt) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if _, err := db.Client.Exec(db.rebind(query), op.ID, op.Type, op.ClusterID, op.Owner, op.Status, op.Step, op.Error, details,
+		op.CreatedAt.Unix(), op.CreatedAt.Unix()); err != nil {
+		return fmt.Errorf("unable to insert %s operation %w", op.Type, err)
+	}
+	return nil
+}
+
+// UpdateOperation saves the progress of an operation: its cluster, status, step, error and details.
+func UpdateOperation(db Db, op Operation) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	details, err := encodeDetails(op.Details)
+	if err != nil {
+		return err
+	}
+	query := "update operation set clusterId = ?, status = ?, step = ?, error = ?, details = ?, updatedAt = ? where operationId = ?"
+	res, err := db.Client.Exec(db.rebind(query), op.ClusterID, op.Status, op.Step, op.Error, details, time.Now().Unix(), op.ID)
+	if err != nil {
+		return fmt.Errorf("unable to update operation %s %w", op.ID, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrOperationNotFound
+	}
+	return nil
+}
+
+// FailRunningOperations fails the operations that are still running with the given error, and returns how many there
+// were. It's used at startup, when the operations left running were interrupted by the restart.
+func FailRunningOperations(db Db, reason string) (int, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return 0, fmt.Errorf("error running a migration %w", err)
+	}
+	query := "update operation set status = ?, step = '', error = ?, updatedAt = ? where status = ?"
+	res, err := db.Client.Exec(db.rebind(query), OperationFailed, reason, time.Now().Unix(), OperationRunning)
+	if err != nil {
+		return 0, fmt.Errorf("unable to fail running operations %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// GetOperation returns the operation with the given ID.
+func GetOperation(db Db, id string) (Operation, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return Operation{}, fmt.Errorf("error running a migration %w", err)
+	}
+	var op Operation
+	var details string
+	var createdAt, updatedAt int64
+	err := db.Client.QueryRow(db.rebind("select operationId, type, clusterId, owner, status, step, error, details, createdAt, updatedAt from operation where operationId = ?"), id).
+		Scan(&op.ID, &op.Type, &op.ClusterID, &op.Owner, &op.Status, &op.Step, &op.Error, &details, &createdAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Operation{}, ErrOperationNotFound
+	}
+	if err != nil {
+		return Operation{}, fmt.Errorf("unable to read operation %s %w", id, err)
+	}
+	if details != "" {
+		if err := json.Unmarshal([]byte(details), &op.Details); err != nil {
+			return Operation{}, fmt.Errorf("unable to decode details of operation %s %w", id, err)
+		}
+	}
+	op.CreatedAt = time.Unix(createdAt, 0).UTC()
+	op.UpdatedAt = time.Unix(updatedAt, 0).UTC()
+	return op, nil
+}
+
+// encodeDetails returns the details of an event or operation as they are stored.
+func encodeDetails(details map[string]string) (string, error) {
+	if len(details) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode details %w", err)
+	}
+	return string(data), nil
+}
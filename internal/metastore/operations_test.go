@@ -0,0 +1,54 @@
+package metastore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperations(t *testing.T) {
+	t.Parallel()
+	db, err := NewDb(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+
+	at := time.Unix(1700000000, 0).UTC()
+	op := Operation{ID: "op", Type: "restore", Owner: "u1", Status: OperationRunning, Step: "fetching backup", CreatedAt: at,
+		Details: map[string]string{"backup": "LATEST"}}
+	require.NoError(t, InsertOperation(db, op))
+
+	got, err := GetOperation(db, "op")
+	require.NoError(t, err)
+	assert.Equal(t, op.Details, got.Details)
+	assert.Equal(t, at, got.CreatedAt)
+	assert.Equal(t, "fetching backup", got.Step)
+
+	op.ClusterID = "cluster"
+	op.Status = OperationSucceeded
+	op.Step = ""
+	require.NoError(t, UpdateOperation(db, op))
+	got, err = GetOperation(db, "op")
+	require.NoError(t, err)
+	assert.Equal(t, "cluster", got.ClusterID)
+	assert.Equal(t, OperationSucceeded, got.Status)
+	assert.True(t, got.UpdatedAt.After(at))
+
+	_, err = GetOperation(db, "missing")
+	assert.ErrorIs(t, err, ErrOperationNotFound)
+	assert.ErrorIs(t, UpdateOperation(db, Operation{ID: "missing"}), ErrOperationNotFound)
+
+	require.NoError(t, InsertOperation(db, Operation{ID: "running", Type: "backup", Owner: "u1", Status: OperationRunning, Step: "backing up"}))
+	n, err := FailRunningOperations(db, "interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	got, err = GetOperation(db, "running")
+	require.NoError(t, err)
+	assert.Equal(t, OperationFailed, got.Status)
+	assert.Equal(t, "interrupted", got.Error)
+	assert.Empty(t, got.Step)
+	got, err = GetOperation(db, "op")
+	require.NoError(t, err)
+	assert.Equal(t, OperationSucceeded, got.Status, "finished operations are left alone")
+}
@@ -0,0 +1,80 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// RetentionPolicy is how long the base backups of a cluster are kept in its backup destination. A backup is kept when
+// any rule keeps it; rules left at zero keep nothing.
+type RetentionPolicy struct {
+	ClusterID string `json:"cluster_id"`
+	// KeepLast keeps the last full backups, with the delta backups taken against them.
+	KeepLast int `json:"keep_last"`
+	// KeepDays keeps the backups that finished in the last days.
+	KeepDays int `json:"keep_days"`
+	// KeepWeekly and KeepMonthly keep the first full backup of the last weeks and months that have one.
+	KeepWeekly  int `json:"keep_weekly"`
+	KeepMonthly int `json:"keep_monthly"`
+	// DryRun makes the policy only report the backups it would delete when it's applied after scheduled backups.
+	DryRun bool `json:"dry_run"`
+}
+
+// SetRetentionPolicy saves the retention policy of a cluster, replacing its previous policy.
+func SetRetentionPolicy(db Db, policy RetentionPolicy) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	tx, err := db.Client.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin a transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	ctx := context.Background()
+	if _, err := tx.ExecContext(ctx, db.rebind("delete from backupRetention where clusterId = ?"), policy.ClusterID); err != nil {
+		return fmt.Errorf("unable to remove retention policy of cluster %s %w", policy.ClusterID, err)
+	}
+	dryRun := 0
+	if policy.DryRun {
+		dryRun = 1
+	}
+	query := "insert into backupRetention(clusterId, keepLast, keepDays, keepWeekly, keepMonthly, dryRun) values(?, ?, ?, ?, ?, ?)"
+	if _, err := tx.ExecContext(ctx, db.rebind(query), policy.ClusterID, policy.KeepLast, policy.KeepDays, policy.KeepWeekly,
+		policy.KeepMonthly, dryRun); err != nil {
+		return fmt.Errorf("unable to save retention policy of cluster %s %w", policy.ClusterID, err)
+	}
+	return tx.Commit()
+}
+
+// GetRetentionPolicy returns the retention policy of a cluster, and whether the cluster has one.
+func GetRetentionPolicy(db Db, clusterID string) (RetentionPolicy, bool, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return RetentionPolicy{}, false, fmt.Errorf("error running a migration %w", err)
+	}
+	policy := RetentionPolicy{ClusterID: clusterID}
+	var dryRun int
+	err := db.Client.QueryRow(db.rebind("select keepLast, keepDays, keepWeekly, keepMonthly, dryRun from backupRetention where clusterId = ?"), clusterID).
+		Scan(&policy.KeepLast, &policy.KeepDays, &policy.KeepWeekly, &policy.KeepMonthly, &dryRun)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RetentionPolicy{}, false, nil
+	}
+	if err != nil {
+		return RetentionPolicy{}, false, fmt.Errorf("unable to read retention policy of cluster %s %w", clusterID, err)
+	}
+	policy.DryRun = dryRun != 0
+	return policy, true, nil
+}
+
+// DeleteRetentionPolicy removes the retention policy of a cluster, whose backups are then kept forever.
+func DeleteRetentionPolicy(db Db, clusterID string) error {
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+	if _, err := db.Client.Exec(db.rebind("delete from backupRetention where clusterId = ?"), clusterID); err != nil {
+		return fmt.Errorf("unable to remove retention policy of cluster %s %w", clusterID, err)
+	}
+	return nil
+}
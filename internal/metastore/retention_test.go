@@ -0,0 +1,44 @@
+package metastore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	t.Parallel()
+	db, err := NewDb(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	require.NoError(t, InsertService(db, ClusterInfo{ClusterID: "cluster", Name: "cluster"}))
+
+	_, ok, err := GetRetentionPolicy(db, "cluster")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	policy := RetentionPolicy{ClusterID: "cluster", KeepLast: 3, KeepDays: 7, KeepWeekly: 4, DryRun: true}
+	require.NoError(t, SetRetentionPolicy(db, policy))
+	got, ok, err := GetRetentionPolicy(db, "cluster")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, policy, got)
+
+	policy = RetentionPolicy{ClusterID: "cluster", KeepMonthly: 12}
+	require.NoError(t, SetRetentionPolicy(db, policy))
+	got, _, err = GetRetentionPolicy(db, "cluster")
+	require.NoError(t, err)
+	assert.Equal(t, policy, got, "policies are replaced")
+
+	require.NoError(t, DeleteRetentionPolicy(db, "cluster"))
+	_, ok, err = GetRetentionPolicy(db, "cluster")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, SetRetentionPolicy(db, policy))
+	require.NoError(t, DeleteCluster(db, "cluster"))
+	_, ok, err = GetRetentionPolicy(db, "cluster")
+	require.NoError(t, err)
+	assert.False(t, ok, "policies are deleted with their cluster")
+}
@@ -0,0 +1,82 @@
+package metastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// secretColumn is a column holding secrets, in a table whose rows are identified by the key column.
+type secretColumn struct {
+	table, name, key string
+}
+
+// secretColumns lists the columns of the metastore that hold secrets.
+var secretColumns = []secretColumn{
+	{table: "clusterInfo", name: "password", key: "clusterId"},
+	{table: "backup", name: "apiKeySecret", key: "id"},
+}
+
+// EncryptSecrets re-encrypts the stored secrets (cluster passwords and backup API key secrets) that aren't encrypted
+// with the current key of the keyring: secrets stored in plaintext before encryption was enabled, and secrets
+// encrypted with a key that was since rotated. It returns the number of re-encrypted secrets.
+func EncryptSecrets(db Db) (int, error) {
+	if db.Keyring == nil {
+		return 0, errors.New("metastore has no keyring")
+	}
+	if err := migration(context.Background(), db); err != nil {
+		return 0, fmt.Errorf("error running a migration %w", err)
+	}
+	tx, err := db.Client.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("unable to begin a transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	n := 0
+	for _, column := range secretColumns {
+		stale, err := staleSecrets(db, tx, column)
+		if err != nil {
+			return 0, err
+		}
+		for key, value := range stale {
+			secret, err := db.decrypt(value)
+			if err != nil {
+				return 0, fmt.Errorf("unable to decrypt %s of %s %s %w", column.name, column.key, key, err)
+			}
+			if value, err = db.encrypt(secret); err != nil {
+				return 0, fmt.Errorf("unable to encrypt %s of %s %s %w", column.name, column.key, key, err)
+			}
+			query := fmt.Sprintf("update %s set %s = ? where %s = ?", column.table, column.name, column.key)
+			if _, err := tx.Exec(db.rebind(query), value, key); err != nil {
+				return 0, fmt.Errorf("unable to update %s of %s %s %w", column.name, column.key, key, err)
+			}
+		}
+		n += len(stale)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("couldn't commit a transaction %w", err)
+	}
+	return n, nil
+}
+
+// staleSecrets returns the values of the column that aren't encrypted with the current key, by row key.
+func staleSecrets(db Db, tx *sql.Tx, column secretColumn) (map[string]string, error) {
+	rows, err := tx.Query(fmt.Sprintf("select %s, %s from %s", column.key, column.name, column.table))
+	if err != nil {
+		return nil, fmt.Errorf("unable to query %s %w", column.table, err)
+	}
+	defer rows.Close()
+	stale := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("unable to read %s row %w", column.table, err)
+		}
+		if !db.Keyring.IsCurrent(value) {
+			stale[key] = value
+		}
+	}
+	return stale, rows.Err()
+}
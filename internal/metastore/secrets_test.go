@@ -0,0 +1,84 @@
+package metastore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/internal/secrets"
+)
+
+func TestEncryptSecrets(t *testing.T) {
+	t.Parallel()
+	tmpDir, err := os.MkdirTemp("", "")
+	require.NoError(t, err)
+	path := filepath.Join(tmpDir, "test.db")
+	defer func(name string) {
+		_ = os.Remove(name)
+	}(path)
+
+	plainDb, err := NewDb(path)
+	require.NoError(t, err)
+	legacy := ClusterInfo{Name: "legacy", ClusterID: generateID("legacy"), Password: "legacy-password"}
+	require.NoError(t, InsertService(plainDb, legacy))
+
+	keyring, err := secrets.Load(tmpDir, "")
+	require.NoError(t, err)
+	db, err := NewDb(path, WithKeyring(keyring))
+	require.NoError(t, err)
+	encrypted := ClusterInfo{Name: "encrypted", ClusterID: generateID("encrypted"), Password: "new-password"}
+	require.NoError(t, InsertService(db, encrypted))
+
+	storedPassword := func(clusterID string) string {
+		var value string
+		require.NoError(t, db.Client.QueryRow("select password from clusterInfo where clusterId = ?", clusterID).Scan(&value))
+		return value
+	}
+	assert.Equal(t, "legacy-password", storedPassword(legacy.ClusterID))
+	assert.True(t, secrets.IsEncrypted(storedPassword(encrypted.ClusterID)))
+
+	t.Run("plaintext secrets are read and encrypted", func(t *testing.T) {
+		ci, err := GetClusterByID(db, legacy.ClusterID)
+		require.NoError(t, err)
+		assert.Equal(t, "legacy-password", ci.Password)
+
+		n, err := EncryptSecrets(db)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.True(t, secrets.IsEncrypted(storedPassword(legacy.ClusterID)))
+	})
+
+	t.Run("rotation re-encrypts all secrets", func(t *testing.T) {
+		before := storedPassword(encrypted.ClusterID)
+		require.NoError(t, keyring.Rotate())
+		n, err := EncryptSecrets(db)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		require.NoError(t, keyring.Prune())
+		assert.NotEqual(t, before, storedPassword(encrypted.ClusterID))
+
+		reloaded, err := secrets.Load(tmpDir, "")
+		require.NoError(t, err)
+		db, err := NewDb(path, WithKeyring(reloaded))
+		require.NoError(t, err)
+		clusters, err := AllClusters(db)
+		require.NoError(t, err)
+		passwords := map[string]string{}
+		for _, c := range clusters {
+			passwords[c.Name] = c.Password
+		}
+		assert.Equal(t, map[string]string{"legacy": "legacy-password", "encrypted": "new-password"}, passwords)
+	})
+
+	t.Run("secrets can't be read with another key", func(t *testing.T) {
+		other, err := secrets.Load(t.TempDir(), "")
+		require.NoError(t, err)
+		db, err := NewDb(path, WithKeyring(other))
+		require.NoError(t, err)
+		_, err = GetClusterByID(db, encrypted.ClusterID)
+		assert.ErrorIs(t, err, secrets.ErrUnknownKey)
+	})
+}
@@ -0,0 +1,221 @@
+package metastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StateVersion is the version of the State document format.
+const StateVersion = 1
+
+// ErrStateNotEmpty is returned when importing state into a metastore that already has state.
+var ErrStateNotEmpty = errors.New("metastore is not empty")
+
+// State is a dump of every table of the metastore, used to move spinup's state to another project directory or
+// backend. Rows are keyed by lowercase column name. Secrets are dumped as stored, so encrypted secrets can only be
+// read with the master key of the metastore they were exported from.
+type State struct {
+	Version int `json:"version"`
+	// SchemaVersion is the number of migrations applied to the exported metastore.
+	SchemaVersion int                                 `json:"schema_version"`
+	ExportedAt    time.Time                           `json:"exported_at"`
+	Tables        map[string][]map[string]interface{} `json:"tables"`
+}
+
+// stateTables lists the tables of the metastore, in the order they are imported.
+var stateTables = []string{"clusterInfo", "clusterLabel", "clusterEvent", "backup", "backupCatalog", "catalogBackup", "backupRetention", "operation", "backupRun"}
+
+// columnRe matches the column names accepted in an imported state, which are interpolated in the insert statements.
+var columnRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// ExportState dumps the metastore.
+func ExportState(db Db) (State, error) {
+	if err := migration(context.Background(), db); err != nil {
+		return State{}, fmt.Errorf("error running a migration %w", err)
+	}
+	state := State{
+		Version:       StateVersion,
+		SchemaVersion: len(migrations),
+		ExportedAt:    time.Now().UTC(),
+		Tables:        make(map[string][]map[string]interface{}, len(stateTables)),
+	}
+	for _, table := range stateTables {
+		rows, err := dumpTable(db, table)
+		if err != nil {
+			return State{}, err
+		}
+		state.Tables[strings.ToLower(table)] = rows
+	}
+	return state, nil
+}
+
+func dumpTable(db Db, table string) ([]map[string]interface{}, error) {
+	rows, err := db.Client.Query("select * from " + table)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query %s %w", table, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	dump := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("unable to read %s row %w", table, err)
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[strings.ToLower(column)] = values[i]
+		}
+		dump = append(dump, row)
+	}
+	return dump, rows.Err()
+}
+
+// ReadState decodes a state document, checking that it can be imported into this version of spinup.
+func ReadState(r io.Reader) (State, error) {
+	var state State
+	d := json.NewDecoder(r)
+	// numbers are kept as written, since float64 would lose precision and some backends reject floats for integers.
+	d.UseNumber()
+	if err := d.Decode(&state); err != nil {
+		return State{}, fmt.Errorf("unable to decode state %w", err)
+	}
+	if state.Version != StateVersion {
+		return State{}, fmt.Errorf("unsupported state version %d, expected %d", state.Version, StateVersion)
+	}
+	if state.SchemaVersion > len(migrations) {
+		return State{}, fmt.Errorf("state was exported by a newer version of spinup (schema version %d, this version supports %d)",
+			state.SchemaVersion, len(migrations))
+	}
+	return state, nil
+}
+
+// ImportState restores a dumped state into an empty metastore, in a single transaction. States exported by older
+// versions are imported into the current schema, with the defaults of the columns they didn't have. The encrypted
+// secrets of the state must be readable with the metastore's keyring.
+func ImportState(db Db, state State) error {
+	known := make(map[string]bool, len(stateTables))
+	for _, table := range stateTables {
+		known[strings.ToLower(table)] = true
+	}
+	for table := range state.Tables {
+		if !known[table] {
+			return fmt.Errorf("unknown table %s in state", table)
+		}
+	}
+	if err := migration(context.Background(), db); err != nil {
+		return fmt.Errorf("error running a migration %w", err)
+	}
+
+	ctx := context.Background()
+	tx, err := db.Client.Begin()
+	if err != nil {
+		return fmt.Errorf("unable to begin a transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range stateTables {
+		var count int
+		if err := tx.QueryRowContext(ctx, "select count(*) from "+table).Scan(&count); err != nil {
+			return fmt.Errorf("unable to count %s rows %w", table, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%s has %d rows: %w", table, count, ErrStateNotEmpty)
+		}
+	}
+
+	for _, table := range stateTables {
+		rows := state.Tables[strings.ToLower(table)]
+		hasID := false
+		for _, row := range rows {
+			columns := make([]string, 0, len(row))
+			for column := range row {
+				if !columnRe.MatchString(column) {
+					return fmt.Errorf("invalid column %s in table %s", column, table)
+				}
+				columns = append(columns, column)
+				hasID = hasID || column == "id"
+			}
+			sort.Strings(columns)
+			args := make([]interface{}, len(columns))
+			for i, column := range columns {
+				args[i] = stateValue(row[column])
+			}
+			query := fmt.Sprintf("insert into %s(%s) values(%s)", table, strings.Join(columns, ", "),
+				strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+			if _, err := tx.ExecContext(ctx, db.rebind(query), args...); err != nil {
+				return fmt.Errorf("unable to import %s row %w", table, err)
+			}
+		}
+		if statement := db.afterImport(table); hasID && statement != "" {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("unable to update the %s id sequence %w", table, err)
+			}
+		}
+	}
+
+	for _, column := range secretColumns {
+		values, err := tx.QueryContext(ctx, fmt.Sprintf("select %s, %s from %s", column.key, column.name, column.table))
+		if err != nil {
+			return fmt.Errorf("unable to query %s %w", column.table, err)
+		}
+		for values.Next() {
+			var key, value string
+			if err := values.Scan(&key, &value); err != nil {
+				values.Close()
+				return fmt.Errorf("unable to read %s row %w", column.table, err)
+			}
+			if _, err := db.decrypt(value); err != nil {
+				values.Close()
+				return fmt.Errorf("unable to decrypt %s of %s %s %w", column.name, column.key, key, err)
+			}
+		}
+		values.Close()
+		if err := values.Err(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// stateValue converts a value decoded by ReadState for the database driver.
+func stateValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// BackupFile writes a consistent copy of a SQLite metastore to the given path while it's in use. The file must not
+// exist yet.
+func BackupFile(db Db, path string) error {
+	if db.Backend != nil && db.Backend.Name() != (SQLite{}).Name() {
+		return fmt.Errorf("file backups are only supported for sqlite metastores, not %s", db.Backend.Name())
+	}
+	if _, err := db.Client.Exec("vacuum into ?", path); err != nil {
+		return fmt.Errorf("unable to back up metastore to %s %w", path, err)
+	}
+	return nil
+}
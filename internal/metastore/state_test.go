@@ -0,0 +1,116 @@
+package metastore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/internal/secrets"
+)
+
+func TestState(t *testing.T) {
+	t.Parallel()
+	srcDir := t.TempDir()
+	keyring, err := secrets.Load(srcDir, "")
+	require.NoError(t, err)
+	src, err := NewDb(filepath.Join(srcDir, "metastore.db"), WithKeyring(keyring))
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	cluster := ClusterInfo{
+		Name:       "state",
+		ClusterID:  generateID("state"),
+		Owner:      "u1",
+		Password:   "secret",
+		Port:       5432,
+		MajVersion: 14,
+		MinVersion: 5,
+		Memory:     512,
+		ExpiresAt:  &expiresAt,
+		Labels:     map[string]string{"env": "dev"},
+	}
+	require.NoError(t, InsertService(src, cluster))
+	require.NoError(t, InsertBackup(src, "insert into backup(clusterId, destination, bucket, second, minute, hour, dom, month, dow) values(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		cluster.ClusterID, "AWS", "bucket", 0, 30, 2, 0, 0, 0))
+
+	state, err := ExportState(src)
+	require.NoError(t, err)
+	assert.Equal(t, StateVersion, state.Version)
+	assert.Equal(t, len(migrations), state.SchemaVersion)
+	require.Len(t, state.Tables["clusterinfo"], 1)
+	assert.True(t, secrets.IsEncrypted(state.Tables["clusterinfo"][0]["password"].(string)))
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(state))
+	data := buf.Bytes()
+
+	t.Run("round trip into a fresh metastore", func(t *testing.T) {
+		dst, err := NewDb(filepath.Join(t.TempDir(), "metastore.db"), WithKeyring(keyring))
+		require.NoError(t, err)
+		read, err := ReadState(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.NoError(t, ImportState(dst, read))
+
+		got, err := GetClusterByID(dst, cluster.ClusterID)
+		require.NoError(t, err)
+		assert.Equal(t, cluster.Name, got.Name)
+		assert.Equal(t, "secret", got.Password)
+		assert.Equal(t, &expiresAt, got.ExpiresAt)
+		assert.Equal(t, cluster.Labels, got.Labels)
+		backup, ok, err := GetBackup(dst, cluster.ClusterID)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "30", backup.Schedule["minute"])
+
+		// new rows get ids after the imported ones.
+		require.NoError(t, InsertService(dst, ClusterInfo{Name: "after", ClusterID: generateID("after")}))
+
+		err = ImportState(dst, read)
+		assert.True(t, errors.Is(err, ErrStateNotEmpty), err)
+	})
+
+	t.Run("requires the master key of the exported metastore", func(t *testing.T) {
+		otherKeyring, err := secrets.Load(t.TempDir(), "")
+		require.NoError(t, err)
+		dst, err := NewDb(filepath.Join(t.TempDir(), "metastore.db"), WithKeyring(otherKeyring))
+		require.NoError(t, err)
+		read, err := ReadState(bytes.NewReader(data))
+		require.NoError(t, err)
+		err = ImportState(dst, read)
+		assert.True(t, errors.Is(err, secrets.ErrUnknownKey), err)
+		_, err = GetClusterByID(dst, cluster.ClusterID)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects states it can't import", func(t *testing.T) {
+		_, err := ReadState(strings.NewReader(`{"version": 2, "tables": {}}`))
+		assert.Error(t, err)
+		_, err = ReadState(strings.NewReader(`{"version": 1, "schema_version": 1000, "tables": {}}`))
+		assert.Error(t, err)
+
+		dst, err := NewDb(filepath.Join(t.TempDir(), "metastore.db"))
+		require.NoError(t, err)
+		assert.Error(t, ImportState(dst, State{Version: StateVersion, Tables: map[string][]map[string]interface{}{"users": {}}}))
+		assert.Error(t, ImportState(dst, State{Version: StateVersion, Tables: map[string][]map[string]interface{}{
+			"clusterinfo": {{"name; drop table clusterinfo": "x"}},
+		}}))
+	})
+
+	t.Run("file backup", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "backup.db")
+		require.NoError(t, BackupFile(src, path))
+		backup, err := NewDb(path, WithKeyring(keyring))
+		require.NoError(t, err)
+		got, err := GetClusterByID(backup, cluster.ClusterID)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", got.Password)
+
+		assert.Error(t, BackupFile(Db{Client: src.Client, Backend: Postgres{}}, path))
+	})
+}
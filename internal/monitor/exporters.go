@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/pkg/errors"
+
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+)
+
+const (
+	// exporterLabel is set on the exporters of services with their own exporter, to the type of the service.
+	exporterLabel = "spinup.exporter"
+	// exporterPortLabel is set on the exporters of services with their own exporter, to the port metrics are
+	// served on.
+	exporterPortLabel = "spinup.exporter.port"
+)
+
+// ExporterName returns the name of the exporter container of a service with its own exporter.
+func ExporterName(containerName string) string {
+	return containerName + "-exporter"
+}
+
+// addExporter starts the exporter of a service with its own exporter, and adds it to the prometheus targets.
+func (r *Runtime) addExporter(ctx context.Context, t *Target) error {
+	address := net.JoinHostPort(t.ContainerName, strconv.Itoa(t.ContainerPort))
+	exporter := ds.NewContainer(
+		ExporterName(t.ContainerName),
+		container.Config{
+			Image: t.Exporter.Image,
+			Env:   t.Exporter.Env(address, t.UserName, t.Password),
+			Labels: map[string]string{
+				exporterLabel:     t.Type,
+				exporterPortLabel: strconv.Itoa(t.Exporter.Port),
+			},
+		},
+		container.HostConfig{
+			RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+		},
+		network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{r.dockerClient.NetworkName: {}}},
+	)
+	if _, err := exporter.Start(ctx, r.dockerClient); err != nil {
+		return errors.Wrapf(err, "starting %s exporter", t.Type)
+	}
+	r.targets = append(r.targets, t)
+	return r.reloadPrometheus(ctx)
+}
+
+// RemoveExporter removes the exporter of the service running in the given container, for services with their own
+// exporter. It does nothing if the service has no exporter.
+func (r *Runtime) RemoveExporter(ctx context.Context, containerName string) error {
+	exporter, err := r.dockerClient.GetContainer(ctx, ExporterName(containerName))
+	if err != nil {
+		return err
+	}
+	if exporter == nil {
+		return nil
+	}
+	if exporter.State == "running" {
+		if err := exporter.Stop(ctx, r.dockerClient, types.ContainerStartOptions{}); err != nil {
+			return err
+		}
+	}
+	if err := exporter.Remove(ctx, r.dockerClient); err != nil {
+		return err
+	}
+
+	targets := r.targets[:0]
+	for _, t := range r.targets {
+		if t.ContainerName != containerName {
+			targets = append(targets, t)
+		}
+	}
+	r.targets = targets
+	return r.reloadPrometheus(ctx)
+}
+
+type exporterJob struct {
+	name    string
+	targets []string
+}
+
+// exporterJobs returns a prometheus job per type of service with its own exporter, scraping the exporters of that type
+// through the docker network.
+func (r *Runtime) exporterJobs(ctx context.Context) ([]exporterJob, error) {
+	listFilters := filters.NewArgs(filters.Arg("label", exporterLabel))
+	containers, err := r.dockerClient.Cli.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: listFilters})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing exporters")
+	}
+	targets := map[string][]string{}
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+		name := c.Names[0][1:]
+		targets[c.Labels[exporterLabel]] = append(targets[c.Labels[exporterLabel]], net.JoinHostPort(name, c.Labels[exporterPortLabel]))
+	}
+
+	jobs := make([]exporterJob, 0, len(targets))
+	for serviceType, addresses := range targets {
+		sort.Strings(addresses)
+		jobs = append(jobs, exporterJob{name: serviceType + "_exporter", targets: addresses})
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].name < jobs[j].name })
+	return jobs, nil
+}
+
+// reloadPrometheus rewrites the prometheus config and restarts prometheus, so that it scrapes the current exporters.
+// It does nothing until the monitoring services are started, which writes the config.
+func (r *Runtime) reloadPrometheus(ctx context.Context) error {
+	if r.prometheusContainer == nil {
+		return nil
+	}
+	cfgPath, err := r.getPromConfigPath()
+	if err != nil {
+		return errors.Wrap(err, "getting prometheus config")
+	}
+	if err := r.writePromConfig(ctx, cfgPath); err != nil {
+		return errors.Wrap(err, "updating prometheus config")
+	}
+	return r.prometheusContainer.Restart(ctx, r.dockerClient)
+}
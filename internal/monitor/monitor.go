@@ -19,6 +19,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/engine"
 	"github.com/spinup-host/spinup/misc"
 )
 
@@ -28,6 +29,11 @@ const (
 	prometheusImageTag = "bitnami/prometheus:2.38.0"
 )
 
+// Images returns the images used by the monitoring services.
+func Images() []string {
+	return []string{pgExporterImageTag, prometheusImageTag, grafanaImageTag}
+}
+
 var (
 	defaultDatasourceCfg string
 	defaultDashboardCfg  string
@@ -35,13 +41,23 @@ var (
 	defaultDashboardDef string
 )
 
-// Target represents a postgres service for monitoring.
+// Target represents a database service for monitoring.
 // it contains only fields that differ between different services
 type Target struct {
+	// ClusterID is the ID of the cluster the service belongs to, used to record monitoring changes in its history.
+	ClusterID     string
 	ContainerName string
 	UserName      string
 	Password      string
 	Port          int
+
+	// Exporter is the exporter of the service's engine, which is started next to the service. Services without one
+	// are postgres services, which are scraped by the shared postgres_exporter.
+	Exporter *engine.Exporter
+	// Type is the type of the service, e.g. "mysql". It names the prometheus job of services with an Exporter.
+	Type string
+	// ContainerPort is the port the service listens on in its container, which its Exporter connects to.
+	ContainerPort int
 }
 
 // BootstrapServices starts up prometheus and exporter services in docker containers
@@ -96,7 +112,7 @@ func (r *Runtime) BootstrapServices(ctx context.Context) error {
 			// we expect all containers to have the same gateway IP, but we assign it here
 			// so that we can update the prometheus config with the right IP of targets
 			r.dockerHostAddr = promContainer.NetworkConfig.EndpointsConfig[r.dockerClient.NetworkName].Gateway
-			if err = r.writePromConfig(promCfgPath); err != nil {
+			if err = r.writePromConfig(ctx, promCfgPath); err != nil {
 				return errors.Wrap(err, "failed to update prometheus config")
 			}
 		} else {
@@ -297,7 +313,7 @@ func (r *Runtime) getPromConfigPath() (string, error) {
 	return cfgPath, err
 }
 
-func (r *Runtime) writePromConfig(cfgPath string) error {
+func (r *Runtime) writePromConfig(ctx context.Context, cfgPath string) error {
 	cfg := fmt.Sprintf(`scrape_configs:
   - job_name: prometheus
     scrape_interval: 5s
@@ -310,6 +326,21 @@ func (r *Runtime) writePromConfig(cfgPath string) error {
     - targets:
       - "%s"
 `, net.JoinHostPort(r.dockerHostAddr, strconv.Itoa(r.appConfig.PromConfig.Port)), net.JoinHostPort(r.dockerHostAddr, "9187"))
+
+	jobs, err := r.exporterJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		cfg += fmt.Sprintf(`  - job_name: %s
+    scrape_interval: 5s
+    static_configs:
+    - targets:
+`, job.name)
+		for _, target := range job.targets {
+			cfg += fmt.Sprintf("      - %q\n", target)
+		}
+	}
 	if err := os.WriteFile(cfgPath, []byte(cfg), 0644); err != nil {
 		return err
 	}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
@@ -13,10 +14,13 @@ import (
 
 	"github.com/spinup-host/spinup/config"
 	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
 )
 
 const (
 	DsnKey = "DATA_SOURCE_NAME"
+	// ApplicationName is set on the exporter's database connections, so they can be told apart from client connections.
+	ApplicationName = "spinup-monitor"
 )
 
 // Runtime wraps runtime configuration and state of the monitoring service
@@ -31,6 +35,7 @@ type Runtime struct {
 	dockerHostAddr       string
 
 	appConfig config.Configuration
+	store     metastore.Db
 	logger    *zap.Logger
 }
 
@@ -48,6 +53,13 @@ func WithAppConfig(cfg config.Configuration) RuntimeOptions {
 	}
 }
 
+// WithStore records the monitoring changes of clusters in the history of the clusters kept in the given metastore.
+func WithStore(store metastore.Db) RuntimeOptions {
+	return func(runtime *Runtime) {
+		runtime.store = store
+	}
+}
+
 func NewRuntime(dockerClient ds.Docker, opts ...RuntimeOptions) *Runtime {
 	rt := &Runtime{
 		targets:              make([]*Target, 0),
@@ -57,7 +69,7 @@ func NewRuntime(dockerClient ds.Docker, opts ...RuntimeOptions) *Runtime {
 		grafanaContainerName: ds.GrafanaPrefix,
 	}
 	if dockerClient.NetworkName != "" {
-		rt.pgExporterName = ds.PgExporterPrefix + "-" + dockerClient.NetworkName
+		rt.pgExporterName = ExporterContainerName(dockerClient.NetworkName)
 		rt.prometheusName = ds.PrometheusPrefix + "-" + dockerClient.NetworkName
 		rt.grafanaContainerName = ds.GrafanaPrefix + "-" + dockerClient.NetworkName
 	}
@@ -68,13 +80,120 @@ func NewRuntime(dockerClient ds.Docker, opts ...RuntimeOptions) *Runtime {
 	return rt
 }
 
-// AddTarget adds a new service to the list of targets being monitored.
+// ExporterContainerName returns the name of the postgres_exporter container of the monitoring services running on the
+// given docker network.
+func ExporterContainerName(networkName string) string {
+	if networkName == "" {
+		return ds.PgExporterPrefix
+	}
+	return ds.PgExporterPrefix + "-" + networkName
+}
+
+// MonitorsPort reports whether the given data sources of the postgres_exporter include the service listening on the
+// given port.
+func MonitorsPort(dsn string, port int) bool {
+	for _, source := range strings.Split(dsn, ",") {
+		if strings.Contains(source, fmt.Sprintf(":%d/", port)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTarget adds a new service to the list of targets being monitored. Services with their own exporter get an
+// exporter container, postgres services are added to the data sources of the shared postgres_exporter.
 func (r *Runtime) AddTarget(ctx context.Context, t *Target) error {
+	var err error
+	if t.Exporter != nil {
+		err = r.addExporter(ctx, t)
+	} else {
+		err = r.addPostgresTarget(ctx, t)
+	}
+	if err != nil {
+		return err
+	}
+	r.recordAttached(t)
+	return nil
+}
+
+// recordAttached adds a monitoring_attached event to the history of the target's cluster, when the runtime has a store.
+func (r *Runtime) recordAttached(t *Target) {
+	if r.store.Client == nil || t.ClusterID == "" {
+		return
+	}
+	event := metastore.Event{
+		ClusterID: t.ClusterID,
+		Type:      metastore.EventMonitoringAttached,
+		Actor:     "spinup",
+		Details:   map[string]string{"exporter": r.pgExporterName},
+	}
+	if t.Exporter != nil {
+		event.Details["exporter"] = ExporterName(t.ContainerName)
+	}
+	if err := metastore.InsertEvent(r.store, event); err != nil {
+		r.logger.Error("could not record cluster event", zap.String("cluster_id", t.ClusterID), zap.Error(err))
+	}
+}
+
+func (r *Runtime) addPostgresTarget(ctx context.Context, t *Target) error {
+	oldDSN, err := r.pgExporterContainer.GetEnv(ctx, r.dockerClient, DsnKey)
+	if err != nil {
+		return errors.Wrap(err, "could not get current data sources from postgres_exporter")
+	}
+
+	var newDSN string
+	if oldDSN == "" {
+		newDSN = fmt.Sprintf("postgresql://%s:%s@%s:%s/?sslmode=disable&application_name=%s", t.UserName, t.Password, r.dockerHostAddr, strconv.Itoa(t.Port), ApplicationName)
+	} else {
+		newDSN = fmt.Sprintf("%s,postgresql://%s:%s@%s:%s/?sslmode=disable&application_name=%s", oldDSN, t.UserName, t.Password, r.dockerHostAddr, strconv.Itoa(t.Port), ApplicationName)
+	}
+	if err := r.replaceExporter(ctx, newDSN); err != nil {
+		return err
+	}
+	r.targets = append(r.targets, t)
+	return nil
+}
+
+// RemoveTarget stops monitoring the service listening on the given port. It does nothing if no such service is
+// being monitored.
+func (r *Runtime) RemoveTarget(ctx context.Context, port int) error {
+	if r.pgExporterContainer == nil {
+		return nil
+	}
 	oldDSN, err := r.pgExporterContainer.GetEnv(ctx, r.dockerClient, DsnKey)
 	if err != nil {
 		return errors.Wrap(err, "could not get current data sources from postgres_exporter")
 	}
 
+	hostPort := fmt.Sprintf("@%s:%d/", r.dockerHostAddr, port)
+	var kept []string
+	removed := false
+	for _, dsn := range strings.Split(oldDSN, ",") {
+		if strings.Contains(dsn, hostPort) {
+			removed = true
+		} else if dsn != "" {
+			kept = append(kept, dsn)
+		}
+	}
+	if !removed {
+		return nil
+	}
+	if err := r.replaceExporter(ctx, strings.Join(kept, ",")); err != nil {
+		return err
+	}
+
+	targets := r.targets[:0]
+	for _, t := range r.targets {
+		if t.Port != port {
+			targets = append(targets, t)
+		}
+	}
+	r.targets = targets
+	return nil
+}
+
+// replaceExporter replaces the postgres_exporter container with one scraping the given data sources.
+func (r *Runtime) replaceExporter(ctx context.Context, dsn string) error {
 	if err := r.pgExporterContainer.Stop(ctx, r.dockerClient, types.ContainerStartOptions{}); err != nil {
 		return err
 	}
@@ -82,13 +201,7 @@ func (r *Runtime) AddTarget(ctx context.Context, t *Target) error {
 		return err
 	}
 
-	var newDSN string
-	if oldDSN == "" {
-		newDSN = fmt.Sprintf("postgresql://%s:%s@%s:%s/?sslmode=disable", t.UserName, t.Password, r.dockerHostAddr, strconv.Itoa(t.Port))
-	} else {
-		newDSN = fmt.Sprintf("%s,postgresql://%s:%s@%s:%s/?sslmode=disable", oldDSN, t.UserName, t.Password, r.dockerHostAddr, strconv.Itoa(t.Port))
-	}
-	newContainer, err := r.newPostgresExporterContainer(newDSN)
+	newContainer, err := r.newPostgresExporterContainer(dsn)
 	if err != nil {
 		return err
 	}
@@ -100,6 +213,5 @@ func (r *Runtime) AddTarget(ctx context.Context, t *Target) error {
 	}
 
 	r.pgExporterContainer = newContainer
-	r.targets = append(r.targets, t)
 	return nil
 }
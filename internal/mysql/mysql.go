@@ -0,0 +1,78 @@
+// Package mysql runs MySQL and MariaDB clusters.
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/misc"
+)
+
+const exporterImage = "prom/mysqld-exporter:v0.14.0"
+
+// Engine runs MySQL clusters, or MariaDB clusters when MariaDB is set, with the official images. The superuser is
+// root, with the cluster's password; when the cluster's username isn't root, a user of that name is created with the
+// same password, owning a database of the same name.
+type Engine struct {
+	MariaDB bool
+}
+
+var _ engine.Engine = Engine{}
+
+func (e Engine) Type() string {
+	if e.MariaDB {
+		return "mariadb"
+	}
+	return "mysql"
+}
+
+func (Engine) Port() int {
+	return 3306
+}
+
+func (e Engine) Image(majVersion, minVersion int) string {
+	return fmt.Sprintf("%s:%d.%d", e.Type(), majVersion, minVersion)
+}
+
+func (Engine) DataDir() string {
+	return "/var/lib/mysql"
+}
+
+func (e Engine) Env(username, password string) []string {
+	// the MariaDB image also accepts the MYSQL_ variables, but warns that they are deprecated.
+	prefix := "MYSQL_"
+	if e.MariaDB {
+		prefix = "MARIADB_"
+	}
+	env := []string{misc.StringToDockerEnvVal(prefix+"ROOT_PASSWORD", password)}
+	if username != "" && username != "root" {
+		env = append(env,
+			misc.StringToDockerEnvVal(prefix+"USER", username),
+			misc.StringToDockerEnvVal(prefix+"PASSWORD", password),
+			misc.StringToDockerEnvVal(prefix+"DATABASE", username),
+		)
+	}
+	return env
+}
+
+func (Engine) Cmd(username, password string) []string {
+	return nil
+}
+
+func (e Engine) ReadyCmd(username, password string) []string {
+	admin := "mysqladmin"
+	if e.MariaDB {
+		admin = "mariadb-admin"
+	}
+	return []string{admin, "ping", "-h", "127.0.0.1", "-u", "root", "--password=" + password}
+}
+
+func (Engine) Exporter() *engine.Exporter {
+	return &engine.Exporter{
+		Image: exporterImage,
+		Port:  9104,
+		Env: func(address, username, password string) []string {
+			return []string{misc.StringToDockerEnvVal("DATA_SOURCE_NAME", fmt.Sprintf("root:%s@(%s)/", password, address))}
+		},
+	}
+}
@@ -3,16 +3,12 @@ package postgres
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"strings"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/api/types/network"
-	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/go-connections/nat"
 
 	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/engine"
 	"github.com/spinup-host/spinup/misc"
 )
 
@@ -21,87 +17,60 @@ const (
 	PGDATADIR         = "/var/lib/postgresql/data/"
 )
 
-type ContainerProps struct {
-	Image     string
-	Name      string
-	Username  string
-	Password  string
-	Port      int
-	Memory    int64
-	CPUShares int64
+// ContainerProps holds the settings of a postgres container.
+type ContainerProps = engine.ContainerProps
+
+// Engine runs postgres clusters with the official postgres image.
+type Engine struct{}
+
+var _ engine.Engine = Engine{}
+var _ engine.ConnectionCounter = Engine{}
+
+func (Engine) Type() string {
+	return "postgres"
 }
 
-func NewPostgresContainer(client dockerservice.Docker, props ContainerProps) (postgresContainer dockerservice.Container, err error) {
-	newVolume, err := dockerservice.CreateVolume(context.Background(), client, volume.VolumeCreateBody{
-		Driver: "local",
-		Labels: map[string]string{"purpose": "postgres data"},
-		Name:   props.Name,
-	})
-	if err != nil {
-		return dockerservice.Container{}, err
-	}
-	// defer for cleaning volume removal
-	defer func() {
-		if err != nil {
-			if errVolRemove := dockerservice.RemoveVolume(context.Background(), client, newVolume.Name); errVolRemove != nil {
-				err = fmt.Errorf("error removing volume during failed service creation %w", err)
-			}
-		}
-	}()
-
-	containerName := PREFIXPGCONTAINER + props.Name
-	newHostPort, err := nat.NewPort("tcp", strconv.Itoa(props.Port))
-	if err != nil {
-		return dockerservice.Container{}, err
-	}
-	newContainerport, err := nat.NewPort("tcp", "5432")
-	if err != nil {
-		return dockerservice.Container{}, err
-	}
-	mounts := []mount.Mount{
-		{
-			Type:   mount.TypeVolume,
-			Source: newVolume.Name,
-			Target: "/var/lib/postgresql/data",
-		},
-	}
-	hostConfig := container.HostConfig{
-		PortBindings: nat.PortMap{
-			newContainerport: []nat.PortBinding{
-				{
-					HostIP:   "0.0.0.0",
-					HostPort: newHostPort.Port(),
-				},
-			},
-		},
-		NetworkMode: "default",
-		AutoRemove:  false,
-		Mounts:      mounts,
-		Resources: container.Resources{
-			CPUShares: props.CPUShares,
-			Memory:    props.Memory * 1000000,
-		},
-	}
+func (Engine) Port() int {
+	return 5432
+}
+
+func (Engine) Image(majVersion, minVersion int) string {
+	return fmt.Sprintf("%s/%s:%d.%d", "amd64", "postgres", majVersion, minVersion)
+}
 
-	endpointConfig := map[string]*network.EndpointSettings{}
-	endpointConfig[client.NetworkName] = &network.EndpointSettings{}
-	nwConfig := network.NetworkingConfig{EndpointsConfig: endpointConfig}
+func (Engine) DataDir() string {
+	return strings.TrimSuffix(PGDATADIR, "/")
+}
 
-	env := []string{
-		misc.StringToDockerEnvVal("POSTGRES_USER", props.Username),
-		misc.StringToDockerEnvVal("POSTGRES_PASSWORD", props.Password),
+func (Engine) Env(username, password string) []string {
+	return []string{
+		misc.StringToDockerEnvVal("POSTGRES_USER", username),
+		misc.StringToDockerEnvVal("POSTGRES_PASSWORD", password),
 	}
+}
+
+func (Engine) Cmd(username, password string) []string {
+	return nil
+}
+
+func (Engine) ReadyCmd(username, password string) []string {
+	return []string{"pg_isready", "-h", "localhost", "-U", username}
+}
+
+// Exporter returns nil: postgres clusters are scraped by the postgres_exporter of the monitoring services, which
+// monitors every postgres cluster.
+func (Engine) Exporter() *engine.Exporter {
+	return nil
+}
+
+func (Engine) ConnectionsCmd(username, password, ignoredApplication string) []string {
+	query := fmt.Sprintf("select count(*) from pg_stat_activity where backend_type = 'client backend' "+
+		"and pid <> pg_backend_pid() and coalesce(application_name, '') <> '%s'", ignoredApplication)
+	return []string{"psql", "-U", username, "-d", "postgres", "-tAc", query}
+}
 
-	postgresContainer = dockerservice.NewContainer(
-		containerName,
-		container.Config{
-			Image: props.Image,
-			Env:   env,
-		},
-		hostConfig,
-		nwConfig,
-	)
-	return postgresContainer, nil
+func NewPostgresContainer(client dockerservice.Docker, props ContainerProps) (dockerservice.Container, error) {
+	return engine.NewContainer(client, Engine{}, props)
 }
 
 func ReloadPostgres(d dockerservice.Docker, execpath, datapath, containerName string) error {
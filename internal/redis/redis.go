@@ -0,0 +1,79 @@
+// Package redis runs Redis clusters.
+package redis
+
+import (
+	"fmt"
+
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/misc"
+)
+
+const exporterImage = "oliver006/redis_exporter:v1.45.0"
+
+// Engine runs Redis clusters with the official redis image, with append-only persistence. Redis has no superuser,
+// so the cluster's username is ignored and the password is required from every client.
+type Engine struct{}
+
+var (
+	_ engine.Engine               = Engine{}
+	_ engine.CredentialsValidator = Engine{}
+)
+
+func (Engine) Type() string {
+	return "redis"
+}
+
+func (Engine) Port() int {
+	return 6379
+}
+
+func (Engine) Image(majVersion, minVersion int) string {
+	return fmt.Sprintf("redis:%d.%d", majVersion, minVersion)
+}
+
+func (Engine) DataDir() string {
+	return "/data"
+}
+
+// Env sets the password used by redis-cli in the container.
+func (Engine) Env(username, password string) []string {
+	if password == "" {
+		return nil
+	}
+	return []string{misc.StringToDockerEnvVal("REDISCLI_AUTH", password)}
+}
+
+func (Engine) Cmd(username, password string) []string {
+	cmd := []string{"redis-server", "--appendonly", "yes"}
+	if password != "" {
+		cmd = append(cmd, "--requirepass", password)
+	}
+	return cmd
+}
+
+// ValidateCredentials requires a password: redis is published on every interface, and the official image disables
+// its protected mode, so it would accept any client without one.
+func (Engine) ValidateCredentials(username, password string) error {
+	if password == "" {
+		return engine.ErrInvalidCredentials{Type: "redis", Reason: "a password is required"}
+	}
+	return nil
+}
+
+func (Engine) ReadyCmd(username, password string) []string {
+	// redis-cli exits with zero when the server replies with an error, e.g. while loading its data.
+	return []string{"sh", "-c", `[ "$(redis-cli ping)" = PONG ]`}
+}
+
+func (Engine) Exporter() *engine.Exporter {
+	return &engine.Exporter{
+		Image: exporterImage,
+		Port:  9121,
+		Env: func(address, username, password string) []string {
+			return []string{
+				misc.StringToDockerEnvVal("REDIS_ADDR", "redis://"+address),
+				misc.StringToDockerEnvVal("REDIS_PASSWORD", password),
+			}
+		},
+	}
+}
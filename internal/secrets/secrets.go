@@ -0,0 +1,241 @@
+// Package secrets encrypts the secrets spinup keeps in its metastore, such as cluster passwords, with AES-GCM under a
+// master key.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// EnvMasterKey holds a base64 encoded master key, which is used instead of a key file.
+	EnvMasterKey = "SPINUP_MASTER_KEY"
+	// EnvMasterKeyFile holds the path of the key file, overriding the one in the project directory.
+	EnvMasterKeyFile = "SPINUP_MASTER_KEY_FILE"
+	// KeyFileName is the name of the key file in the project directory.
+	KeyFileName = "master.key"
+
+	// KeySize is the size of master keys, in bytes (AES-256).
+	KeySize = 32
+	// prefix marks encrypted values, which are stored as prefix<key ID>:<base64 nonce and ciphertext>.
+	prefix = "enc:v1:"
+)
+
+// ErrUnknownKey is returned when decrypting a value encrypted with a key that isn't in the keyring.
+var ErrUnknownKey = errors.New("value was encrypted with an unknown master key")
+
+// Keyring holds the master keys. The first key encrypts, while all of them decrypt, so that values encrypted with a
+// previous key stay readable while they are re-encrypted after a rotation.
+type Keyring struct {
+	keys []masterKey
+	// path is the key file the keys were loaded from, empty when the key came from the environment.
+	path string
+}
+
+type masterKey struct {
+	id   string
+	raw  []byte
+	aead cipher.AEAD
+}
+
+// NewKeyring returns a keyring with the given keys, the first of which encrypts.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring needs at least one key")
+	}
+	k := &Keyring{}
+	for _, raw := range keys {
+		if len(raw) != KeySize {
+			return nil, errors.Errorf("master key must be %d bytes, got %d", KeySize, len(raw))
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(raw)
+		k.keys = append(k.keys, masterKey{id: hex.EncodeToString(sum[:4]), raw: raw, aead: aead})
+	}
+	return k, nil
+}
+
+// GenerateKey returns a new random master key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, errors.Wrap(err, "generating master key")
+	}
+	return key, nil
+}
+
+// Load returns the keyring of a spinup installation. The master key is read from SPINUP_MASTER_KEY, or else from the
+// key file: keyFile when set, SPINUP_MASTER_KEY_FILE, or master.key in the project directory. A key file that doesn't
+// exist yet is created with a new key.
+func Load(projectDir, keyFile string) (*Keyring, error) {
+	if encoded := os.Getenv(EnvMasterKey); encoded != "" {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding %s", EnvMasterKey)
+		}
+		return NewKeyring(raw)
+	}
+	if keyFile == "" {
+		keyFile = os.Getenv(EnvMasterKeyFile)
+	}
+	if keyFile == "" {
+		keyFile = filepath.Join(projectDir, KeyFileName)
+	}
+
+	content, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		raw, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		k, err := NewKeyring(raw)
+		if err != nil {
+			return nil, err
+		}
+		k.path = keyFile
+		return k, k.save()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading master key file")
+	}
+	var keys [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding master key in %s", keyFile)
+		}
+		keys = append(keys, raw)
+	}
+	k, err := NewKeyring(keys...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading %s", keyFile)
+	}
+	k.path = keyFile
+	return k, nil
+}
+
+// Encrypt returns the encrypted value of a secret. Empty secrets stay empty.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	key := k.keys[0]
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrap(err, "generating nonce")
+	}
+	sealed := key.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + key.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the secret of an encrypted value. Values that aren't encrypted, which were stored before secrets
+// were encrypted, are returned as they are.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	for _, key := range k.keys {
+		if key.id != id {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", errors.Wrap(err, "decoding encrypted value")
+		}
+		if len(sealed) < key.aead.NonceSize() {
+			return "", errors.New("malformed encrypted value")
+		}
+		nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+		plaintext, err := key.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return "", errors.Wrap(err, "decrypting value")
+		}
+		return string(plaintext), nil
+	}
+	return "", ErrUnknownKey
+}
+
+// IsCurrent reports whether a value is encrypted with the keyring's current key, or is empty. Other values need to
+// be re-encrypted.
+func (k *Keyring) IsCurrent(value string) bool {
+	return value == "" || strings.HasPrefix(value, prefix+k.keys[0].id+":")
+}
+
+// IsEncrypted reports whether a value was encrypted by a keyring.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Rotate adds a new key to the keyring, which encrypts from then on, and saves it to the key file. The previous keys
+// are kept to decrypt the values encrypted with them, until they are removed with Prune.
+func (k *Keyring) Rotate() error {
+	if k.path == "" {
+		return errors.Errorf("the master key is set by %s and can only be rotated by changing it there", EnvMasterKey)
+	}
+	raw, err := GenerateKey()
+	if err != nil {
+		return err
+	}
+	rotated, err := NewKeyring(raw)
+	if err != nil {
+		return err
+	}
+	k.keys = append(rotated.keys, k.keys...)
+	return k.save()
+}
+
+// Prune removes the previous keys from the keyring and the key file, once no value is encrypted with them anymore,
+// including in copies of the metastore.
+func (k *Keyring) Prune() error {
+	k.keys = k.keys[:1]
+	if k.path == "" {
+		return nil
+	}
+	return k.save()
+}
+
+// save writes the keys to the key file, replacing it atomically so that a failed write can't lose the keys.
+func (k *Keyring) save() error {
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return errors.Wrap(err, "creating master key directory")
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# spinup master keys, the first one encrypts. Keep this file safe: the metastore secrets can't be read without it.\n")
+	for _, key := range k.keys {
+		fmt.Fprintln(&buf, base64.StdEncoding.EncodeToString(key.raw))
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return errors.Wrap(err, "writing master key file")
+	}
+	return errors.Wrap(os.Rename(tmp, k.path), "writing master key file")
+}
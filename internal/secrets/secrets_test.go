@@ -0,0 +1,85 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyring(t *testing.T) {
+	dir := t.TempDir()
+	keyring, err := Load(dir, "")
+	require.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(dir, KeyFileName))
+	require.NoError(t, err, "the key file is created")
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	t.Run("round trip", func(t *testing.T) {
+		value, err := keyring.Encrypt("s3cret")
+		require.NoError(t, err)
+		assert.True(t, IsEncrypted(value))
+		assert.NotContains(t, value, "s3cret")
+		assert.True(t, keyring.IsCurrent(value))
+
+		other, err := keyring.Encrypt("s3cret")
+		require.NoError(t, err)
+		assert.NotEqual(t, value, other, "nonces are random")
+
+		plaintext, err := keyring.Decrypt(value)
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", plaintext)
+	})
+
+	t.Run("empty and plaintext values", func(t *testing.T) {
+		value, err := keyring.Encrypt("")
+		require.NoError(t, err)
+		assert.Empty(t, value)
+		assert.True(t, keyring.IsCurrent(""))
+
+		plaintext, err := keyring.Decrypt("stored-before-encryption")
+		require.NoError(t, err)
+		assert.Equal(t, "stored-before-encryption", plaintext)
+		assert.False(t, keyring.IsCurrent("stored-before-encryption"))
+	})
+
+	t.Run("tampered values", func(t *testing.T) {
+		value, err := keyring.Encrypt("s3cret")
+		require.NoError(t, err)
+		tampered := value[:len(value)-4] + "AAA="
+		_, err = keyring.Decrypt(tampered)
+		assert.Error(t, err)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		old, err := keyring.Encrypt("s3cret")
+		require.NoError(t, err)
+		require.NoError(t, keyring.Rotate())
+		assert.False(t, keyring.IsCurrent(old))
+
+		reloaded, err := Load(dir, "")
+		require.NoError(t, err)
+		plaintext, err := reloaded.Decrypt(old)
+		require.NoError(t, err, "previous keys decrypt until pruned")
+		assert.Equal(t, "s3cret", plaintext)
+
+		require.NoError(t, keyring.Prune())
+		reloaded, err = Load(dir, "")
+		require.NoError(t, err)
+		_, err = reloaded.Decrypt(old)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("key from the environment", func(t *testing.T) {
+		raw, err := GenerateKey()
+		require.NoError(t, err)
+		t.Setenv(EnvMasterKey, base64.StdEncoding.EncodeToString(raw))
+		fromEnv, err := Load(t.TempDir(), "")
+		require.NoError(t, err)
+		assert.Error(t, fromEnv.Rotate())
+	})
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/postgres"
+)
+
+// ErrNotAdoptable is returned when a container can't be adopted as a spinup cluster.
+type ErrNotAdoptable struct {
+	Container string
+	Reason    string
+}
+
+func (e ErrNotAdoptable) Error() string {
+	return fmt.Sprintf("container '%s' cannot be adopted: %s", e.Container, e.Reason)
+}
+
+// AdoptCluster registers an existing postgres container, given by name or ID, as a cluster owned by the given user.
+// The container is renamed to spinup's naming convention and attached to spinup's network, without being restarted.
+// info holds the settings that aren't read from the container: the cluster name (defaulting to the container's
+// name), labels, monitoring, expiry and idle timeout. A username and password in info take precedence over the
+// container's POSTGRES_USER and POSTGRES_PASSWORD, which are out of date when they were changed after initdb. The
+// remaining fields are filled in from the container, including the volume or bind mount holding its data.
+func (svc Service) AdoptCluster(ctx context.Context, user User, containerRef string, info *metastore.ClusterInfo) error {
+	if user.ID == "" {
+		return errors.New("cluster owner cannot be empty")
+	}
+	data, err := svc.dockerClient.Cli.ContainerInspect(ctx, containerRef)
+	if errdefs.IsNotFound(err) {
+		return ErrNoMatch{id: containerRef}
+	}
+	if err != nil {
+		return errors.Wrap(err, "inspecting container")
+	}
+	if _, err := metastore.GetClusterByID(svc.store, data.ID); err == nil {
+		return ErrNotAdoptable{Container: containerRef, Reason: "it is already managed by spinup"}
+	} else if !errors.Is(err, metastore.ErrClusterNotFound) {
+		return errors.Wrap(err, "looking up cluster")
+	}
+
+	if err := adoptionInfo(data, info); err != nil {
+		return ErrNotAdoptable{Container: containerRef, Reason: err.Error()}
+	}
+	info.Owner = user.ID
+	info.Architecture = svc.svcConfig.Common.Architecture
+	if err := validateLabels(info.Labels); err != nil {
+		return err
+	}
+	if info.ExpiresAt != nil && !info.ExpiresAt.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+	if err := validateIdleTimeout(time.Duration(info.IdleTimeout) * time.Second); err != nil {
+		return err
+	}
+	if _, err := resolveImage(svc.svcConfig.Registry, info.Image); err != nil {
+		return err
+	}
+	if err := checkImageIDDigests(ctx, svc.dockerClient, svc.svcConfig.Registry, info.Image, data.Image); err != nil {
+		return err
+	}
+
+	containerName := postgres.PREFIXPGCONTAINER + info.Name
+	if existing, err := svc.dockerClient.GetContainer(ctx, containerName); err != nil {
+		return errors.Wrap(err, "getting container")
+	} else if existing != nil && existing.ID != data.ID {
+		return dockerservice.ErrDuplicateContainerName
+	}
+	if _, err := metastore.GetClusterByName(svc.store, info.Name); err == nil {
+		return dockerservice.ErrDuplicateContainerName
+	}
+
+	release, err := svc.quotas.reserve(svc.store, user.ID, svc.svcConfig.QuotaFor(user.ID), clusterUsage(*info))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	oldName := strings.TrimPrefix(data.Name, "/")
+	if oldName != containerName {
+		if err := svc.dockerClient.Cli.ContainerRename(ctx, data.ID, containerName); err != nil {
+			return errors.Wrap(err, "renaming container")
+		}
+	}
+	if data.NetworkSettings == nil || data.NetworkSettings.Networks[svc.dockerClient.NetworkName] == nil {
+		if err := svc.dockerClient.Cli.NetworkConnect(ctx, svc.dockerClient.NetworkName, data.ID, nil); err != nil {
+			svc.undoRename(ctx, data.ID, oldName, containerName)
+			return errors.Wrap(err, "connecting container to network")
+		}
+	}
+	if err := metastore.InsertService(svc.store, *info); err != nil {
+		svc.undoRename(ctx, data.ID, oldName, containerName)
+		return errors.Wrap(err, "saving cluster info to store")
+	}
+	svc.logger.Info("adopted cluster", zap.String("container", oldName), zap.String("cluster_id", info.ClusterID), zap.String("user", user.ID))
+	recordEvent(svc.store, svc.logger, metastore.Event{
+		ClusterID: info.ClusterID,
+		Type:      metastore.EventCreated,
+		Actor:     user.ID,
+		Details: map[string]string{
+			"type":         info.Type,
+			"image":        info.Image,
+			"version":      fmt.Sprintf("%d.%d", info.MajVersion, info.MinVersion),
+			"adopted_from": oldName,
+		},
+	})
+
+	if info.Monitoring == "enable" && info.Status == metastore.StatusRunning {
+		if err := svc.startMonitoring(ctx, info, containerName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoRename gives a container its name back after a failed adoption.
+func (svc Service) undoRename(ctx context.Context, containerID, oldName, newName string) {
+	if oldName == newName {
+		return
+	}
+	if err := svc.dockerClient.Cli.ContainerRename(ctx, containerID, oldName); err != nil {
+		svc.logger.Error("could not restore container name", zap.String("container", oldName), zap.Error(err))
+	}
+}
+
+// adoptionInfo fills in the cluster info from an inspected postgres container. It returns an error describing why
+// the container can't be adopted, if it can't.
+func adoptionInfo(data types.ContainerJSON, info *metastore.ClusterInfo) error {
+	if data.Config == nil || data.HostConfig == nil {
+		return errors.New("it has no configuration")
+	}
+	env := map[string]string{}
+	for _, kv := range data.Config.Env {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+	if _, ok := env["PG_MAJOR"]; !ok && !strings.Contains(imageRepository(data.Config.Image), "postgres") {
+		return errors.Errorf("image '%s' is not a postgres image", data.Config.Image)
+	}
+
+	info.Port = 0
+	for _, binding := range data.HostConfig.PortBindings["5432/tcp"] {
+		if port, err := strconv.Atoi(binding.HostPort); err == nil && port > 0 {
+			info.Port = port
+			break
+		}
+	}
+	if info.Port == 0 {
+		return errors.New("port 5432 is not published on the host")
+	}
+
+	if info.Name == "" {
+		info.Name = strings.TrimPrefix(strings.TrimPrefix(data.Name, "/"), postgres.PREFIXPGCONTAINER)
+	}
+	if info.Username == "" {
+		// the postgres image defaults the superuser to postgres.
+		info.Username = env["POSTGRES_USER"]
+		if info.Username == "" {
+			info.Username = "postgres"
+		}
+	}
+	if info.Password == "" {
+		info.Password = env["POSTGRES_PASSWORD"]
+	}
+	info.MajVersion, info.MinVersion = postgresVersion(env, data.Config.Image)
+
+	info.ClusterID = data.ID
+	info.Type = "postgres"
+	info.Host = "localhost"
+	info.Image = data.Config.Image
+	mounted, volumes, err := dataMount(data, env)
+	if err != nil {
+		return err
+	}
+	info.DataMount, info.Volumes = mounted, volumes
+	info.CPU = data.HostConfig.CPUShares
+	info.Memory = data.HostConfig.Memory / 1000000
+	info.Status = metastore.StatusStopped
+	if data.State != nil && data.State.Running {
+		info.Status = metastore.StatusRunning
+	}
+	return nil
+}
+
+// dataMount returns the volume name or host path mounted at the data directory of a postgres container, and the
+// volumes spinup removes along with the cluster: its data volume, but not a bind mounted host directory. The data
+// directory is PGDATA, or the postgres image's default.
+func dataMount(data types.ContainerJSON, env map[string]string) (string, []string, error) {
+	pgdata := env["PGDATA"]
+	if pgdata == "" {
+		pgdata = "/var/lib/postgresql/data"
+	}
+	for _, m := range data.Mounts {
+		target := strings.TrimSuffix(m.Destination, "/")
+		if pgdata != target && !strings.HasPrefix(pgdata, target+"/") {
+			continue
+		}
+		switch m.Type {
+		case mount.TypeVolume:
+			return m.Name, []string{m.Name}, nil
+		case mount.TypeBind:
+			return m.Source, nil, nil
+		}
+	}
+	return "", nil, errors.Errorf("its data directory %s is not on a volume or bind mount", pgdata)
+}
+
+// postgresVersion returns the major and minor postgres version of a container, from the PG_VERSION variable set by
+// the postgres image (e.g. "14.5-1.pgdg110+1"), or else from the image tag (e.g. "14.5-alpine").
+func postgresVersion(env map[string]string, image string) (int, int) {
+	version := env["PG_VERSION"]
+	if version == "" {
+		if named, err := reference.ParseNormalizedNamed(image); err == nil {
+			if tagged, ok := named.(reference.Tagged); ok {
+				version = tagged.Tag()
+			}
+		}
+	}
+	version, _, _ = strings.Cut(version, "-")
+	majStr, minStr, _ := strings.Cut(version, ".")
+	maj, _ := strconv.Atoi(majStr)
+	min, _ := strconv.Atoi(minStr)
+	return maj, min
+}
+
+// imageRepository returns the repository of an image reference without its registry, e.g. "library/postgres".
+func imageRepository(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	return reference.Path(named)
+}
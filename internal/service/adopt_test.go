@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestAdoptCluster(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	rt := ds.NewMemoryRuntime(ds.WithImages("postgres:14.5", "redis:7"))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	cfg := config.Configuration{}
+	cfg.Common.Architecture = "amd64"
+	svc := NewService(dc, store, nil, logger, cfg)
+
+	pgdata := "/var/lib/postgresql/data"
+	// run starts a container with the given mounts, or with a volume named after it at the postgres data directory.
+	run := func(name, image, port string, mounts []mount.Mount, env ...string) string {
+		if mounts == nil {
+			mounts = []mount.Mount{{Type: mount.TypeVolume, Source: name + "-data", Target: pgdata}}
+		}
+		hostConfig := &container.HostConfig{Resources: container.Resources{CPUShares: 256, Memory: 512000000}, Mounts: mounts}
+		if port != "" {
+			hostConfig.PortBindings = nat.PortMap{"5432/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: port}}}
+		}
+		created, err := rt.ContainerCreate(ctx, &container.Config{Image: image, Env: env}, hostConfig, nil, nil, name)
+		require.NoError(t, err)
+		require.NoError(t, rt.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}))
+		return created.ID
+	}
+	pgEnv := []string{"POSTGRES_USER=app", "POSTGRES_PASSWORD=secret", "PG_MAJOR=14", "PG_VERSION=14.5-1.pgdg110+1"}
+
+	t.Run("adopts postgres containers", func(t *testing.T) {
+		id := run("legacy-db", "postgres:14.5", "15433", nil, pgEnv...)
+		info := &metastore.ClusterInfo{Labels: map[string]string{"team": "web"}}
+		require.NoError(t, svc.AdoptCluster(ctx, testUser, "legacy-db", info))
+
+		stored, err := svc.GetClusterByID(ctx, testUser, id)
+		require.NoError(t, err)
+		assert.Equal(t, "legacy-db", stored.Name)
+		assert.Equal(t, "app", stored.Username)
+		assert.Equal(t, "secret", stored.Password)
+		assert.Equal(t, 15433, stored.Port)
+		assert.Equal(t, 14, stored.MajVersion)
+		assert.Equal(t, 5, stored.MinVersion)
+		assert.Equal(t, int64(256), stored.CPU)
+		assert.Equal(t, int64(512), stored.Memory)
+		assert.Equal(t, "postgres:14.5", stored.Image)
+		assert.Equal(t, metastore.StatusRunning, stored.Status)
+		assert.Equal(t, map[string]string{"team": "web"}, stored.Labels)
+		assert.Equal(t, "legacy-db-data", stored.DataMount)
+		assert.Equal(t, []string{"legacy-db-data"}, stored.Volumes)
+
+		c, err := dc.GetContainer(ctx, "spinup-postgres-legacy-db")
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		assert.Equal(t, id, c.ID)
+		assert.Contains(t, c.NetworkConfig.EndpointsConfig, testID)
+
+		err = svc.AdoptCluster(ctx, testUser, id, &metastore.ClusterInfo{})
+		assert.ErrorAs(t, err, &ErrNotAdoptable{})
+
+		// adopted clusters are managed like any other cluster.
+		_, err = svc.ResizeCluster(ctx, testUser, id, Resources{CPU: 512, Memory: 512})
+		require.NoError(t, err)
+		require.NoError(t, svc.DeleteCluster(ctx, testUser, id))
+		_, err = rt.ContainerInspect(ctx, id)
+		assert.Error(t, err)
+		assert.True(t, errdefs.IsNotFound(rt.VolumeRemove(ctx, "legacy-db-data", false)), "the data volume is removed with the cluster")
+	})
+
+	t.Run("leaves bind mounted data directories and unrelated volumes alone", func(t *testing.T) {
+		// a volume named like the cluster that isn't mounted into its container.
+		_, err := rt.VolumeCreate(ctx, volume.CreateOptions{Name: "bound", Driver: "local"})
+		require.NoError(t, err)
+		id := run("bound", "postgres:14.5", "15436", []mount.Mount{{Type: mount.TypeBind, Source: "/srv/pgdata", Target: "/pgdata"}},
+			append(pgEnv, "PGDATA=/pgdata/14")...)
+		info := &metastore.ClusterInfo{}
+		require.NoError(t, svc.AdoptCluster(ctx, testUser, id, info))
+		assert.Equal(t, "/srv/pgdata", info.DataMount)
+		assert.Empty(t, info.Volumes)
+
+		require.NoError(t, svc.DeleteCluster(ctx, testUser, id))
+		assert.NoError(t, rt.VolumeRemove(ctx, "bound", false))
+	})
+
+	t.Run("uses the given name and credentials", func(t *testing.T) {
+		id := run("old-name", "postgres:14.5", "15434", nil, "PG_MAJOR=14")
+		info := &metastore.ClusterInfo{Name: "new-name", Password: "changed"}
+		require.NoError(t, svc.AdoptCluster(ctx, testUser, id[:12], info))
+		assert.Equal(t, "postgres", info.Username)
+		assert.Equal(t, "changed", info.Password)
+		assert.Equal(t, 14, info.MajVersion)
+
+		c, err := dc.GetContainer(ctx, "spinup-postgres-new-name")
+		require.NoError(t, err)
+		require.NotNil(t, c)
+	})
+
+	t.Run("rejects containers that cannot be adopted", func(t *testing.T) {
+		run("cache", "redis:7", "16379", nil)
+		err := svc.AdoptCluster(ctx, testUser, "cache", &metastore.ClusterInfo{})
+		assert.ErrorAs(t, err, &ErrNotAdoptable{})
+
+		run("unpublished", "postgres:14.5", "", nil, pgEnv...)
+		err = svc.AdoptCluster(ctx, testUser, "unpublished", &metastore.ClusterInfo{})
+		assert.ErrorAs(t, err, &ErrNotAdoptable{})
+
+		run("ephemeral", "postgres:14.5", "15437", []mount.Mount{{Type: mount.TypeVolume, Source: "logs", Target: "/var/log"}}, pgEnv...)
+		err = svc.AdoptCluster(ctx, testUser, "ephemeral", &metastore.ClusterInfo{})
+		assert.ErrorAs(t, err, &ErrNotAdoptable{}, "the data directory must outlive the container")
+
+		err = svc.AdoptCluster(ctx, testUser, "missing", &metastore.ClusterInfo{})
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+	})
+
+	t.Run("rejects names that are taken", func(t *testing.T) {
+		run("taken", "postgres:14.5", "15435", nil, pgEnv...)
+		err := svc.AdoptCluster(ctx, testUser, "taken", &metastore.ClusterInfo{Name: "new-name"})
+		assert.ErrorIs(t, err, ds.ErrDuplicateContainerName)
+
+		c, err := dc.GetContainer(ctx, "taken")
+		require.NoError(t, err)
+		assert.NotNil(t, c)
+	})
+}
+
+func TestPostgresVersion(t *testing.T) {
+	tests := []struct {
+		env      map[string]string
+		image    string
+		maj, min int
+	}{
+		{env: map[string]string{"PG_VERSION": "14.5-1.pgdg110+1"}, image: "postgres", maj: 14, min: 5},
+		{env: map[string]string{"PG_VERSION": "15.1"}, image: "postgres:15-alpine", maj: 15, min: 1},
+		{image: "postgres:13.8-alpine", maj: 13, min: 8},
+		{image: "postgres:12", maj: 12, min: 0},
+		{image: "postgres", maj: 0, min: 0},
+	}
+	for _, tt := range tests {
+		maj, min := postgresVersion(tt.env, tt.image)
+		assert.Equal(t, tt.maj, maj, tt.image)
+		assert.Equal(t, tt.min, min, tt.image)
+	}
+}
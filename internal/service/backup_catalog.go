@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+// ListBackups returns the backup catalog of a cluster, which lists the base backups in its backup destination. The
+// catalog is kept in the metastore, and refreshed from the destination when refresh is set or when it was never
+// refreshed. The user must own the cluster.
+func (svc Service) ListBackups(ctx context.Context, user User, clusterID string, refresh bool) (metastore.BackupCatalog, error) {
+	cluster, schedule, err := svc.backupSource(ctx, user, clusterID)
+	if err != nil {
+		return metastore.BackupCatalog{}, err
+	}
+	if !refresh {
+		catalog, err := metastore.GetBackupCatalog(svc.store, clusterID)
+		if err != nil || !catalog.RefreshedAt.IsZero() {
+			return catalog, err
+		}
+	}
+
+	name := PREFIXRESTORECONTAINER + cluster.Name + "-" + uuid.New().String()[:8]
+	helper, err := startWalgHelper(ctx, svc.dockerClient, name, schedule.Dest, nil)
+	if err != nil {
+		return metastore.BackupCatalog{}, errors.Wrap(err, "starting wal-g container")
+	}
+	defer removeContainer(svc.dockerClient, svc.logger, helper)
+	backups, err := listBaseBackups(ctx, svc.dockerClient, helper)
+	if err != nil {
+		return metastore.BackupCatalog{}, err
+	}
+	return saveCatalog(svc.store, clusterID, backups)
+}
+
+// saveCatalog saves the base backups listed in the backup destination of a cluster as its backup catalog.
+func saveCatalog(store metastore.Db, clusterID string, backups []BaseBackup) (metastore.BackupCatalog, error) {
+	catalog := metastore.BackupCatalog{
+		ClusterID:   clusterID,
+		RefreshedAt: time.Now().UTC().Truncate(time.Second),
+		Backups:     make([]metastore.CatalogBackup, 0, len(backups)),
+	}
+	for _, b := range backups {
+		catalog.Backups = append(catalog.Backups, catalogBackup(b))
+	}
+	if err := metastore.SaveBackupCatalog(store, catalog); err != nil {
+		return catalog, errors.Wrap(err, "saving backup catalog")
+	}
+	return catalog, nil
+}
+
+// isDelta reports whether a base backup is a delta backup. wal-g names delta backups
+// base_<first WAL segment>_D_<first WAL segment of the backup they are taken against>.
+func isDelta(b BaseBackup) bool {
+	return strings.Contains(b.Name, "_D_")
+}
+
+// catalogBackup returns the catalog entry of a base backup.
+func catalogBackup(b BaseBackup) metastore.CatalogBackup {
+	entry := metastore.CatalogBackup{
+		Name:             b.Name,
+		StartTime:        b.StartTime,
+		FinishTime:       b.FinishTime,
+		WalStart:         b.WalFileName,
+		WalEnd:           b.WalFileName,
+		CompressedSize:   b.CompressedSize,
+		UncompressedSize: b.UncompressedSize,
+		Delta:            isDelta(b),
+	}
+	// the backup ends in the segment holding its finish LSN, on the timeline it started on.
+	if len(b.WalFileName) == 24 && b.FinishLSN != 0 {
+		if timeline, err := strconv.ParseUint(b.WalFileName[:8], 16, 32); err == nil {
+			entry.WalEnd = segmentName(uint32(timeline), b.FinishLSN)
+		}
+	}
+	return entry
+}
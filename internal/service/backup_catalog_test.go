@@ -0,0 +1,23 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestCatalogBackup(t *testing.T) {
+	at := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	full := BaseBackup{Name: "base_000000010000000000000004", WalFileName: "000000010000000000000004", StartTime: at,
+		FinishTime: at.Add(time.Minute), FinishLSN: 0x6000028, CompressedSize: 1024, UncompressedSize: 4096}
+	assert.Equal(t, metastore.CatalogBackup{Name: full.Name, StartTime: at, FinishTime: at.Add(time.Minute), WalStart: "000000010000000000000004",
+		WalEnd: "000000010000000000000006", CompressedSize: 1024, UncompressedSize: 4096}, catalogBackup(full))
+
+	delta := BaseBackup{Name: "base_000000010000000000000008_D_000000010000000000000004", WalFileName: "000000010000000000000008"}
+	entry := catalogBackup(delta)
+	assert.True(t, entry.Delta)
+	assert.Equal(t, "000000010000000000000008", entry.WalEnd, "backups without a finish LSN end where they start")
+}
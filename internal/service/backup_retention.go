@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+// ErrInvalidRetentionPolicy is returned when a retention policy is invalid, or applied to a cluster without one.
+type ErrInvalidRetentionPolicy struct {
+	Reason string
+}
+
+func (e ErrInvalidRetentionPolicy) Error() string {
+	return "invalid retention policy: " + e.Reason
+}
+
+// RetentionResult is what applying a retention policy to the backups of a cluster did, or would do in a dry run.
+type RetentionResult struct {
+	ClusterID string `json:"cluster_id"`
+	DryRun    bool   `json:"dry_run"`
+	// Deleted lists the base backups deleted from the backup destination, along with the WAL only they need.
+	Deleted []string `json:"deleted"`
+	// Marked lists the full backups made permanent to be kept as weekly or monthly snapshots, and Unmarked the
+	// backups that stopped being snapshots, which are deleted once no other rule keeps them.
+	Marked   []string `json:"marked"`
+	Unmarked []string `json:"unmarked"`
+
+	// command is the wal-g command deleting the backups, empty when there's nothing to delete.
+	command []string
+}
+
+// SetRetentionPolicy sets how long the backups of a cluster are kept in its backup destination. The policy is applied
+// after each successful scheduled backup. A policy without rules is removed, and the cluster's backups are then kept
+// forever. The user must own the cluster.
+func (bs BackupService) SetRetentionPolicy(ctx context.Context, user User, clusterID string, policy metastore.RetentionPolicy) (metastore.RetentionPolicy, error) {
+	if _, err := bs.ownedCluster(user, clusterID); err != nil {
+		return metastore.RetentionPolicy{}, err
+	}
+	for _, rule := range []int{policy.KeepLast, policy.KeepDays, policy.KeepWeekly, policy.KeepMonthly} {
+		if rule < 0 {
+			return metastore.RetentionPolicy{}, ErrInvalidRetentionPolicy{Reason: "rules can't be negative"}
+		}
+	}
+	policy.ClusterID = clusterID
+	if policy.KeepLast == 0 && policy.KeepDays == 0 && policy.KeepWeekly == 0 && policy.KeepMonthly == 0 {
+		if err := metastore.DeleteRetentionPolicy(bs.store, clusterID); err != nil {
+			return metastore.RetentionPolicy{}, err
+		}
+		return metastore.RetentionPolicy{ClusterID: clusterID}, nil
+	}
+	if err := metastore.SetRetentionPolicy(bs.store, policy); err != nil {
+		return metastore.RetentionPolicy{}, err
+	}
+	return policy, nil
+}
+
+// GetRetentionPolicy returns the retention policy of a cluster, whose rules are all zero when it has none. The user
+// must own the cluster.
+func (bs BackupService) GetRetentionPolicy(ctx context.Context, user User, clusterID string) (metastore.RetentionPolicy, error) {
+	if _, err := bs.ownedCluster(user, clusterID); err != nil {
+		return metastore.RetentionPolicy{}, err
+	}
+	policy, ok, err := metastore.GetRetentionPolicy(bs.store, clusterID)
+	if err != nil || !ok {
+		return metastore.RetentionPolicy{ClusterID: clusterID}, err
+	}
+	return policy, nil
+}
+
+// ApplyRetention applies the retention policy of a cluster to its backups now, or only reports what it would do when
+// dryRun is set. The user must own the cluster.
+func (bs BackupService) ApplyRetention(ctx context.Context, user User, clusterID string, dryRun bool) (RetentionResult, error) {
+	cluster, err := bs.ownedCluster(user, clusterID)
+	if err != nil {
+		return RetentionResult{}, err
+	}
+	policy, ok, err := metastore.GetRetentionPolicy(bs.store, clusterID)
+	if err != nil {
+		return RetentionResult{}, err
+	}
+	if !ok {
+		return RetentionResult{}, ErrInvalidRetentionPolicy{Reason: fmt.Sprintf("cluster '%s' has no retention policy", clusterID)}
+	}
+	schedule, ok, err := metastore.GetBackupSchedule(bs.store, clusterID)
+	if err != nil {
+		return RetentionResult{}, err
+	}
+	if !ok || schedule.Spec == "" {
+		return RetentionResult{}, ErrNoBackupDestination{ClusterID: clusterID}
+	}
+
+	result, err := applyRetention(ctx, bs.dockerClient, bs.logger, bs.store, cluster, schedule.Dest, policy, dryRun)
+	if !dryRun {
+		recordRetention(bs.store, bs.logger, user.ID, clusterID, result, err)
+	}
+	return result, err
+}
+
+// retain applies the retention policy of a cluster, if it has one, after a successful scheduled backup. The outcome is
+// recorded in the cluster's events; failures don't fail the backup.
+func (bs BackupService) retain(ctx context.Context, cluster metastore.ClusterInfo, dest metastore.Destination) {
+	policy, ok, err := metastore.GetRetentionPolicy(bs.store, cluster.ClusterID)
+	if err != nil {
+		bs.logger.Error("could not read retention policy", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+	if !ok {
+		return
+	}
+	result, err := applyRetention(ctx, bs.dockerClient, bs.logger, bs.store, cluster, dest, policy, policy.DryRun)
+	if err != nil {
+		bs.logger.Error("could not apply retention policy", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+	}
+	recordRetention(bs.store, bs.logger, systemUser.ID, cluster.ClusterID, result, err)
+}
+
+// applyRetention lists the backups of a cluster and applies its retention policy to them with wal-g, unless dryRun is
+// set. Snapshots are marked permanent before backups are deleted, as wal-g doesn't delete permanent backups. The
+// backup catalog is refreshed afterwards.
+func applyRetention(ctx context.Context, d dockerservice.Docker, logger *zap.Logger, store metastore.Db, cluster metastore.ClusterInfo,
+	dest metastore.Destination, policy metastore.RetentionPolicy, dryRun bool) (RetentionResult, error) {
+	name := PREFIXRESTORECONTAINER + cluster.Name + "-" + uuid.New().String()[:8]
+	helper, err := startWalgHelper(ctx, d, name, dest, nil)
+	if err != nil {
+		return RetentionResult{}, errors.Wrap(err, "starting wal-g container")
+	}
+	defer removeContainer(d, logger, helper)
+	backups, err := listBaseBackups(ctx, d, helper)
+	if err != nil {
+		return RetentionResult{}, err
+	}
+
+	result := planRetention(backups, policy, time.Now())
+	result.ClusterID = cluster.ClusterID
+	result.DryRun = dryRun
+	if dryRun {
+		return result, nil
+	}
+	for _, backup := range result.Marked {
+		if _, err := execCommand(ctx, d, helper, "wal-g", "backup-mark", backup); err != nil {
+			return result, errors.Wrapf(err, "marking backup %s permanent", backup)
+		}
+	}
+	for _, backup := range result.Unmarked {
+		if _, err := execCommand(ctx, d, helper, "wal-g", "backup-mark", "-i", backup); err != nil {
+			return result, errors.Wrapf(err, "marking backup %s impermanent", backup)
+		}
+	}
+	if len(result.command) > 0 {
+		if _, err := execCommand(ctx, d, helper, result.command...); err != nil {
+			return result, errors.Wrap(err, "deleting backups")
+		}
+	}
+
+	// the backups are deleted at this point, so a stale catalog is only logged.
+	if backups, err = listBaseBackups(ctx, d, helper); err == nil {
+		_, err = saveCatalog(store, cluster.ClusterID, backups)
+	}
+	if err != nil {
+		logger.Warn("could not refresh backup catalog", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+	}
+	return result, nil
+}
+
+// planRetention returns what a retention policy does to the given backups, oldest first, at the given time.
+//
+// keep_last and keep_days keep every backup from the oldest full backup they keep onwards, and the latest full backup
+// is always kept: wal-g deletes the backups before it with "delete retain FULL <keep_last>" when keep_last keeps the
+// oldest backup, and with "delete before FIND_FULL <backup>" otherwise. keep_weekly and keep_monthly keep the first
+// full backup of the last weeks and months that have one by marking it permanent; policies with these rules manage
+// which backups are permanent, while other policies keep the backups marked permanent by hand.
+func planRetention(backups []BaseBackup, policy metastore.RetentionPolicy, now time.Time) RetentionResult {
+	result := RetentionResult{Deleted: []string{}, Marked: []string{}, Unmarked: []string{}}
+	var fulls []int
+	for i, b := range backups {
+		if !isDelta(b) {
+			fulls = append(fulls, i)
+		}
+	}
+	if len(fulls) == 0 {
+		return result
+	}
+
+	// cutoff is the index of the oldest backup kept by keep_last and keep_days, or of the latest full backup, which is
+	// always kept. The backups before it are deleted, unless they are permanent.
+	cutoff := fulls[len(fulls)-1]
+	byKeepLast := false
+	if policy.KeepLast > 0 {
+		cutoff = 0
+		if len(fulls) > policy.KeepLast {
+			cutoff = fulls[len(fulls)-policy.KeepLast]
+			byKeepLast = true
+		}
+	}
+	if policy.KeepDays > 0 {
+		after := now.AddDate(0, 0, -policy.KeepDays)
+		// delta backups are kept with the full backup they are taken against, the last one before them.
+		days := fulls[len(fulls)-1]
+		for i, b := range backups {
+			if !finishedAt(b).Before(after) {
+				days = i
+				break
+			}
+		}
+		for j := len(fulls) - 1; j >= 0; j-- {
+			if fulls[j] <= days {
+				days = fulls[j]
+				break
+			}
+		}
+		if days < cutoff {
+			cutoff = days
+			byKeepLast = false
+		}
+	}
+
+	managed := policy.KeepWeekly > 0 || policy.KeepMonthly > 0
+	snapshots := make(map[int]bool)
+	for _, rule := range []struct {
+		keep   int
+		period func(time.Time) string
+	}{
+		{keep: policy.KeepWeekly, period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%d", year, week)
+		}},
+		{keep: policy.KeepMonthly, period: func(t time.Time) string {
+			return t.Format("2006-01")
+		}},
+	} {
+		// fulls are walked newest first, so the first full backup of each period is the last one seen.
+		var periods []string
+		first := make(map[string]int)
+		for j := len(fulls) - 1; j >= 0; j-- {
+			period := rule.period(finishedAt(backups[fulls[j]]).UTC())
+			if _, ok := first[period]; !ok {
+				periods = append(periods, period)
+			}
+			first[period] = fulls[j]
+		}
+		for k := 0; k < rule.keep && k < len(periods); k++ {
+			snapshots[first[periods[k]]] = true
+		}
+	}
+
+	for i, b := range backups {
+		permanent := b.IsPermanent
+		if managed {
+			permanent = snapshots[i]
+			switch {
+			case permanent && !b.IsPermanent:
+				result.Marked = append(result.Marked, b.Name)
+			case !permanent && b.IsPermanent:
+				result.Unmarked = append(result.Unmarked, b.Name)
+			}
+		}
+		if i < cutoff && !permanent {
+			result.Deleted = append(result.Deleted, b.Name)
+		}
+	}
+	if len(result.Deleted) > 0 {
+		if byKeepLast {
+			result.command = []string{"wal-g", "delete", "retain", "FULL", strconv.Itoa(policy.KeepLast), "--confirm"}
+		} else {
+			result.command = []string{"wal-g", "delete", "before", "FIND_FULL", backups[cutoff].Name, "--confirm"}
+		}
+	}
+	return result
+}
+
+// finishedAt returns when a backup finished, or when it was last modified for backups listed without details.
+func finishedAt(b BaseBackup) time.Time {
+	if b.FinishTime.IsZero() {
+		return b.Time
+	}
+	return b.FinishTime
+}
+
+// recordRetention records the outcome of applying a retention policy in the cluster's events.
+func recordRetention(store metastore.Db, logger *zap.Logger, actor, clusterID string, result RetentionResult, err error) {
+	details := map[string]string{
+		"status":  "succeeded",
+		"dry_run": strconv.FormatBool(result.DryRun),
+		"deleted": strings.Join(result.Deleted, ","),
+	}
+	if len(result.Marked) > 0 {
+		details["marked"] = strings.Join(result.Marked, ",")
+	}
+	if len(result.Unmarked) > 0 {
+		details["unmarked"] = strings.Join(result.Unmarked, ",")
+	}
+	if err != nil {
+		details["status"] = "failed"
+		details["error"] = err.Error()
+	}
+	recordEvent(store, logger, metastore.Event{
+		ClusterID: clusterID,
+		Type:      metastore.EventBackupRetention,
+		Actor:     actor,
+		Details:   details,
+	})
+}
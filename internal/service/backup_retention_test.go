@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/postgres"
+)
+
+func TestPlanRetention(t *testing.T) {
+	day := func(month time.Month, d int) time.Time {
+		return time.Date(2024, month, d, 3, 0, 0, 0, time.UTC)
+	}
+	// two full backups in January and two in February, in different ISO weeks, the first two with a delta backup.
+	backups := []BaseBackup{
+		{Name: "base_000000010000000000000001", FinishTime: day(time.January, 1)},
+		{Name: "base_000000010000000000000003_D_000000010000000000000001", FinishTime: day(time.January, 2)},
+		{Name: "base_000000010000000000000005", FinishTime: day(time.January, 8)},
+		{Name: "base_000000010000000000000007", FinishTime: day(time.February, 5)},
+		{Name: "base_000000010000000000000009_D_000000010000000000000007", FinishTime: day(time.February, 6)},
+		{Name: "base_00000001000000000000000B", FinishTime: day(time.February, 28)},
+	}
+	names := func(indexes ...int) []string {
+		names := []string{}
+		for _, i := range indexes {
+			names = append(names, backups[i].Name)
+		}
+		return names
+	}
+	withPermanent := func(i int) []BaseBackup {
+		marked := append([]BaseBackup(nil), backups...)
+		marked[i].IsPermanent = true
+		return marked
+	}
+	now := day(time.March, 1)
+
+	tests := []struct {
+		name     string
+		backups  []BaseBackup
+		policy   metastore.RetentionPolicy
+		deleted  []string
+		marked   []string
+		unmarked []string
+		command  []string
+	}{
+		{
+			name:    "keep last full backups",
+			backups: backups,
+			policy:  metastore.RetentionPolicy{KeepLast: 2},
+			deleted: names(0, 1, 2),
+			command: []string{"wal-g", "delete", "retain", "FULL", "2", "--confirm"},
+		},
+		{
+			name:    "fewer full backups than kept",
+			backups: backups,
+			policy:  metastore.RetentionPolicy{KeepLast: 10},
+			deleted: names(),
+		},
+		{
+			name:    "keep days",
+			backups: backups,
+			policy:  metastore.RetentionPolicy{KeepDays: 30},
+			deleted: names(0, 1, 2),
+			command: []string{"wal-g", "delete", "before", "FIND_FULL", backups[3].Name, "--confirm"},
+		},
+		{
+			name:    "delta backups are kept with their full backup",
+			backups: backups,
+			policy:  metastore.RetentionPolicy{KeepDays: 24},
+			deleted: names(0, 1, 2),
+			command: []string{"wal-g", "delete", "before", "FIND_FULL", backups[3].Name, "--confirm"},
+		},
+		{
+			name:    "the rule keeping the most backups wins",
+			backups: backups,
+			policy:  metastore.RetentionPolicy{KeepLast: 1, KeepDays: 30},
+			deleted: names(0, 1, 2),
+			command: []string{"wal-g", "delete", "before", "FIND_FULL", backups[3].Name, "--confirm"},
+		},
+		{
+			name:    "monthly snapshots are marked permanent",
+			backups: backups,
+			policy:  metastore.RetentionPolicy{KeepMonthly: 2},
+			deleted: names(1, 2, 4),
+			marked:  names(0, 3),
+			command: []string{"wal-g", "delete", "before", "FIND_FULL", backups[5].Name, "--confirm"},
+		},
+		{
+			name:    "backups marked permanent by hand are kept",
+			backups: withPermanent(0),
+			policy:  metastore.RetentionPolicy{KeepLast: 1},
+			deleted: names(1, 2, 3, 4),
+			command: []string{"wal-g", "delete", "retain", "FULL", "1", "--confirm"},
+		},
+		{
+			name:     "snapshots that are no longer kept are unmarked",
+			backups:  withPermanent(0),
+			policy:   metastore.RetentionPolicy{KeepWeekly: 1},
+			deleted:  names(0, 1, 2, 3, 4),
+			marked:   names(5),
+			unmarked: names(0),
+			command:  []string{"wal-g", "delete", "before", "FIND_FULL", backups[5].Name, "--confirm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := planRetention(tt.backups, tt.policy, now)
+			assert.Equal(t, tt.deleted, result.Deleted)
+			if tt.marked == nil {
+				tt.marked = []string{}
+			}
+			if tt.unmarked == nil {
+				tt.unmarked = []string{}
+			}
+			assert.Equal(t, tt.marked, result.Marked)
+			assert.Equal(t, tt.unmarked, result.Unmarked)
+			assert.Equal(t, tt.command, result.command)
+		})
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var commands [][]string
+	f := newBackupFixture(t, testID, func(container string, cmd []string) ds.ExecResult {
+		if !strings.HasPrefix(container, PREFIXRESTORECONTAINER) {
+			return ds.ExecResult{}
+		}
+		mu.Lock()
+		commands = append(commands, cmd)
+		mu.Unlock()
+		if cmd[0] == "wal-g" && cmd[1] == "backup-list" {
+			return ds.ExecResult{Stdout: `[{"backup_name":"base_000000010000000000000002","time":"2024-01-01T03:00:00Z","finish_time":"2024-01-01T03:05:00Z"},` +
+				`{"backup_name":"base_000000010000000000000004","time":"2024-01-02T03:00:00Z","finish_time":"2024-01-02T03:05:00Z"}]`}
+		}
+		return ds.ExecResult{}
+	})
+	rt, dc, store, bs, cluster, dest := f.rt, f.dc, f.store, f.bs, f.cluster, f.dest
+
+	deletions := func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		var deletions [][]string
+		for _, cmd := range commands {
+			if cmd[0] == "wal-g" && cmd[1] == "delete" {
+				deletions = append(deletions, cmd)
+			}
+		}
+		return deletions
+	}
+	retentionEvents := func() []metastore.Event {
+		page, err := metastore.ListEvents(store, metastore.EventFilter{ClusterID: cluster.ClusterID})
+		require.NoError(t, err)
+		var events []metastore.Event
+		for _, event := range page.Events {
+			if event.Type == metastore.EventBackupRetention {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	t.Run("policies are validated", func(t *testing.T) {
+		_, err := bs.SetRetentionPolicy(ctx, testUser, cluster.ClusterID, metastore.RetentionPolicy{KeepLast: -1})
+		assert.ErrorAs(t, err, &ErrInvalidRetentionPolicy{})
+		_, err = bs.SetRetentionPolicy(ctx, User{ID: "someone-else"}, cluster.ClusterID, metastore.RetentionPolicy{KeepLast: 1})
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+		_, err = bs.ApplyRetention(ctx, testUser, cluster.ClusterID, true)
+		assert.ErrorAs(t, err, &ErrInvalidRetentionPolicy{}, "the cluster has no policy")
+	})
+
+	policy, err := bs.SetRetentionPolicy(ctx, testUser, cluster.ClusterID, metastore.RetentionPolicy{KeepLast: 1})
+	require.NoError(t, err)
+	assert.Equal(t, cluster.ClusterID, policy.ClusterID)
+
+	t.Run("backups need a destination", func(t *testing.T) {
+		_, err := bs.ApplyRetention(ctx, testUser, cluster.ClusterID, true)
+		assert.ErrorAs(t, err, &ErrNoBackupDestination{})
+	})
+	require.NoError(t, metastore.SetBackupSchedule(store, cluster.ClusterID, "0 3 * * *", dest))
+
+	t.Run("dry runs only report what would be deleted", func(t *testing.T) {
+		result, err := bs.ApplyRetention(ctx, testUser, cluster.ClusterID, true)
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.Equal(t, []string{"base_000000010000000000000002"}, result.Deleted)
+		assert.Empty(t, deletions())
+		assert.Empty(t, retentionEvents())
+	})
+
+	t.Run("backups are deleted with wal-g", func(t *testing.T) {
+		result, err := bs.ApplyRetention(ctx, testUser, cluster.ClusterID, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"base_000000010000000000000002"}, result.Deleted)
+		assert.Equal(t, [][]string{{"wal-g", "delete", "retain", "FULL", "1", "--confirm"}}, deletions())
+		events := retentionEvents()
+		require.Len(t, events, 1)
+		assert.Equal(t, "succeeded", events[0].Details["status"])
+		assert.Equal(t, testUser.ID, events[0].Actor)
+
+		catalog, err := metastore.GetBackupCatalog(store, cluster.ClusterID)
+		require.NoError(t, err)
+		assert.False(t, catalog.RefreshedAt.IsZero(), "the catalog is refreshed")
+	})
+
+	t.Run("policies are applied after successful scheduled backups", func(t *testing.T) {
+		go func() {
+			var c *ds.Container
+			for c == nil {
+				time.Sleep(10 * time.Millisecond)
+				c, _ = dc.GetContainer(ctx, PREFIXBACKUPCONTAINER+postgres.PREFIXPGCONTAINER+cluster.Name)
+			}
+			_ = rt.Exit(c.ID, 0)
+		}()
+		schedule, ok, err := metastore.GetBackupSchedule(store, cluster.ClusterID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.NoError(t, bs.runBackup(ctx, schedule))
+		assert.Len(t, deletions(), 2)
+		events := retentionEvents()
+		require.Len(t, events, 2)
+		assert.Equal(t, systemUser.ID, events[1].Actor)
+	})
+
+	t.Run("policies without rules are removed", func(t *testing.T) {
+		_, err := bs.SetRetentionPolicy(ctx, testUser, cluster.ClusterID, metastore.RetentionPolicy{})
+		require.NoError(t, err)
+		_, ok, err := metastore.GetRetentionPolicy(store, cluster.ClusterID)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+// Backup health of a cluster, see BackupHealth.
+const (
+	BackupHealthy       = "healthy"
+	BackupFailing       = "failing"
+	BackupHealthUnknown = "unknown"
+)
+
+// backupFailureThreshold is the number of consecutive failed backup runs after which a cluster's backups are failing.
+const backupFailureThreshold = 3
+
+// backupLogLines is the number of lines of the backup container's logs kept with each backup run.
+const backupLogLines = 200
+
+// backupRunsKept is the number of finished backup runs kept for each cluster. Older runs are deleted as runs finish.
+const backupRunsKept = 100
+
+// backupNameRe matches the line wal-g backup-push logs once the base backup is written, e.g.
+// "INFO: 2024/01/01 03:00:05.123456 Wrote backup with name base_000000010000000000000002".
+var backupNameRe = regexp.MustCompile(`Wrote backup with name (base_\w+)`)
+
+// BackupHealth tells whether the backups of a cluster are succeeding. Backups are failing once the last
+// backupFailureThreshold runs failed, and their health is unknown until a run succeeds.
+type BackupHealth struct {
+	Status string `json:"status"`
+	// ConsecutiveFailures is the number of runs that failed since the last successful run.
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// BackupHistory is the backup runs of a cluster, newest first, with the health of its backups.
+type BackupHistory struct {
+	ClusterID string                `json:"cluster_id"`
+	Health    BackupHealth          `json:"health"`
+	Runs      []metastore.BackupRun `json:"runs"`
+}
+
+// BackupHistory returns the backup runs of a cluster, newest first, and the health of its backups. A positive limit
+// returns only the latest runs, and the logs of the runs are only returned with logs. The user must own the cluster.
+func (bs BackupService) BackupHistory(ctx context.Context, user User, clusterID string, limit int, logs bool) (BackupHistory, error) {
+	if _, err := bs.ownedCluster(user, clusterID); err != nil {
+		return BackupHistory{}, err
+	}
+	runs, err := metastore.ListBackupRuns(bs.store, metastore.BackupRunFilter{ClusterID: clusterID, Limit: limit, Logs: logs})
+	if err != nil {
+		return BackupHistory{}, err
+	}
+	health, err := bs.backupHealth(clusterID)
+	if err != nil {
+		return BackupHistory{}, err
+	}
+	return BackupHistory{ClusterID: clusterID, Health: health, Runs: runs}, nil
+}
+
+// backupHealth returns the health of a cluster's backups. Only the latest finished runs are read, unless the backups
+// are failing and the failures since the last successful run are counted.
+func (bs BackupService) backupHealth(clusterID string) (BackupHealth, error) {
+	runs, err := metastore.ListBackupRuns(bs.store, metastore.BackupRunFilter{ClusterID: clusterID, Finished: true, Limit: backupFailureThreshold})
+	if err != nil {
+		return BackupHealth{}, err
+	}
+	health := backupHealth(runs)
+	if health.Status != BackupFailing {
+		return health, nil
+	}
+	if health.ConsecutiveFailures, err = metastore.CountFailedBackupRuns(bs.store, clusterID); err != nil {
+		return BackupHealth{}, err
+	}
+	succeeded, err := metastore.ListBackupRuns(bs.store, metastore.BackupRunFilter{ClusterID: clusterID, Status: metastore.BackupRunSucceeded, Limit: 1})
+	if err != nil {
+		return BackupHealth{}, err
+	}
+	if len(succeeded) > 0 {
+		health.LastSuccess = succeeded[0].FinishedAt
+	}
+	return health, nil
+}
+
+// backupHealth returns the health of backups from their runs, newest first. Runs that are still running are ignored.
+func backupHealth(runs []metastore.BackupRun) BackupHealth {
+	health := BackupHealth{Status: BackupHealthUnknown}
+	for _, run := range runs {
+		if run.Status == metastore.BackupRunRunning {
+			continue
+		}
+		if run.Status == metastore.BackupRunSucceeded {
+			health.LastSuccess = run.FinishedAt
+			health.Status = BackupHealthy
+			break
+		}
+		if health.ConsecutiveFailures == 0 {
+			health.LastError = run.Error
+		}
+		health.ConsecutiveFailures++
+	}
+	if health.ConsecutiveFailures >= backupFailureThreshold {
+		health.Status = BackupFailing
+	}
+	return health
+}
+
+// newBackupRun returns a backup run of a cluster to the given destination.
+func newBackupRun(clusterID string, dest metastore.Destination, trigger, operationID string) metastore.BackupRun {
+	return metastore.BackupRun{
+		ID:          uuid.New().String(),
+		ClusterID:   clusterID,
+		Trigger:     trigger,
+		OperationID: operationID,
+		Destination: dest.Type,
+		Bucket:      dest.BucketName,
+		Status:      metastore.BackupRunRunning,
+	}
+}
+
+// describeBackup sets the name and size of the base backup written by a successful run. The name is logged by wal-g;
+// the size is read from the destination, along with the name when it wasn't logged. The backup catalog is refreshed
+// with the listed backups when the destination is the cluster's.
+func (bs BackupService) describeBackup(ctx context.Context, cluster metastore.ClusterInfo, dest metastore.Destination,
+	run *metastore.BackupRun, refreshCatalog bool) {
+	if m := backupNameRe.FindStringSubmatch(run.Logs); m != nil {
+		run.BackupName = m[1]
+	}
+	name := PREFIXRESTORECONTAINER + cluster.Name + "-" + uuid.New().String()[:8]
+	helper, err := startWalgHelper(ctx, bs.dockerClient, name, dest, nil)
+	if err != nil {
+		bs.logger.Warn("could not start wal-g container to describe backup", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+	defer removeContainer(bs.dockerClient, bs.logger, helper)
+	backups, err := listBaseBackups(ctx, bs.dockerClient, helper)
+	if err != nil {
+		bs.logger.Warn("could not list backups to describe backup", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+	if refreshCatalog {
+		if _, err := saveCatalog(bs.store, cluster.ClusterID, backups); err != nil {
+			bs.logger.Warn("could not refresh backup catalog", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		}
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		// without a logged name, the backup is the latest one finished since the run started.
+		if b.Name == run.BackupName || (run.BackupName == "" && !b.FinishTime.Before(run.StartedAt.Truncate(time.Second))) {
+			run.BackupName = b.Name
+			run.BytesUploaded = b.CompressedSize
+			return
+		}
+	}
+}
+
+// endRun saves the outcome of a backup run, records a backup_health event when the cluster's backups start failing or
+// recover, and deletes the oldest runs of the cluster.
+func (bs BackupService) endRun(run metastore.BackupRun, runErr error) {
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+	run.Status = metastore.BackupRunSucceeded
+	if runErr != nil {
+		run.Status = metastore.BackupRunFailed
+		run.Error = runErr.Error()
+	}
+	if err := metastore.UpdateBackupRun(bs.store, run); err != nil {
+		bs.logger.Error("could not save backup run", zap.String("cluster_id", run.ClusterID), zap.String("run_id", run.ID), zap.Error(err))
+		return
+	}
+
+	if _, err := metastore.PruneBackupRuns(bs.store, run.ClusterID, backupRunsKept); err != nil {
+		bs.logger.Warn("could not delete old backup runs", zap.String("cluster_id", run.ClusterID), zap.Error(err))
+	}
+
+	// the health only changes when this run is one of the last backupFailureThreshold runs.
+	runs, err := metastore.ListBackupRuns(bs.store, metastore.BackupRunFilter{ClusterID: run.ClusterID, Finished: true,
+		Limit: backupFailureThreshold + 1})
+	if err != nil {
+		bs.logger.Error("could not read backup runs", zap.String("cluster_id", run.ClusterID), zap.Error(err))
+		return
+	}
+	var previous []metastore.BackupRun
+	for i, r := range runs {
+		if r.ID == run.ID {
+			previous = runs[i+1:]
+			break
+		}
+	}
+	health, before := backupHealth(runs), backupHealth(previous)
+	if health.Status == before.Status || (health.Status != BackupFailing && before.Status != BackupFailing) {
+		return
+	}
+	if health.Status == BackupFailing {
+		bs.logger.Error("backups are failing", zap.String("cluster_id", run.ClusterID), zap.Int("consecutive_failures", health.ConsecutiveFailures))
+	}
+	recordEvent(bs.store, bs.logger, metastore.Event{
+		ClusterID: run.ClusterID,
+		Type:      metastore.EventBackupHealth,
+		Actor:     systemUser.ID,
+		Details: map[string]string{
+			"status":               health.Status,
+			"consecutive_failures": strconv.Itoa(health.ConsecutiveFailures),
+			"run_id":               run.ID,
+		},
+	})
+}
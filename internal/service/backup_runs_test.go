@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/postgres"
+)
+
+func TestBackupHealth(t *testing.T) {
+	at := time.Date(2024, time.January, 1, 3, 0, 0, 0, time.UTC)
+	succeeded := metastore.BackupRun{Status: metastore.BackupRunSucceeded, FinishedAt: &at}
+	failed := metastore.BackupRun{Status: metastore.BackupRunFailed, Error: "backup exited with code 1"}
+	running := metastore.BackupRun{Status: metastore.BackupRunRunning}
+
+	tests := []struct {
+		name string
+		runs []metastore.BackupRun
+		want BackupHealth
+	}{
+		{
+			name: "no runs",
+			want: BackupHealth{Status: BackupHealthUnknown},
+		},
+		{
+			name: "failures before the first success",
+			runs: []metastore.BackupRun{failed, failed},
+			want: BackupHealth{Status: BackupHealthUnknown, ConsecutiveFailures: 2, LastError: failed.Error},
+		},
+		{
+			name: "a failure after a success",
+			runs: []metastore.BackupRun{running, failed, succeeded, failed, failed, failed},
+			want: BackupHealth{Status: BackupHealthy, ConsecutiveFailures: 1, LastSuccess: &at, LastError: failed.Error},
+		},
+		{
+			name: "consecutive failures",
+			runs: []metastore.BackupRun{failed, failed, running, failed, succeeded},
+			want: BackupHealth{Status: BackupFailing, ConsecutiveFailures: 3, LastSuccess: &at, LastError: failed.Error},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, backupHealth(tt.runs))
+		})
+	}
+}
+
+func TestBackupHistory(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+
+	f := newBackupFixture(t, testID, func(container string, cmd []string) ds.ExecResult {
+		if strings.HasPrefix(container, PREFIXRESTORECONTAINER) && cmd[0] == "wal-g" && cmd[1] == "backup-list" {
+			// the latest backup finishes as it's listed, after the run started.
+			finished := time.Now().UTC().Format(time.RFC3339)
+			return ds.ExecResult{Stdout: `[{"backup_name":"base_000000010000000000000002","time":"2024-01-01T03:00:00Z","finish_time":"2024-01-01T03:05:00Z","compressed_size":1024},` +
+				`{"backup_name":"base_000000010000000000000004","time":"` + finished + `","finish_time":"` + finished + `","compressed_size":2048}]`}
+		}
+		return ds.ExecResult{}
+	})
+	rt, dc, store, bs, cluster, dest := f.rt, f.dc, f.store, f.bs, f.cluster, f.dest
+	require.NoError(t, metastore.SetBackupSchedule(store, cluster.ClusterID, "0 3 * * *", dest))
+
+	// backup runs a backup that exits with the given code after logging the given lines.
+	backup := func(code int, logs string) {
+		op, err := bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		require.NoError(t, err)
+		c, err := dc.GetContainer(ctx, PREFIXBACKUPCONTAINER+postgres.PREFIXPGCONTAINER+cluster.Name)
+		require.NoError(t, err)
+		require.NoError(t, rt.Log(c.ID, "", logs))
+		require.NoError(t, rt.Exit(c.ID, code))
+		require.Eventually(t, func() bool {
+			op, err = metastore.GetOperation(store, op.ID)
+			require.NoError(t, err)
+			return op.Status != metastore.OperationRunning
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	healthEvents := func() []metastore.Event {
+		page, err := metastore.ListEvents(store, metastore.EventFilter{ClusterID: cluster.ClusterID})
+		require.NoError(t, err)
+		var events []metastore.Event
+		for _, event := range page.Events {
+			if event.Type == metastore.EventBackupHealth {
+				events = append(events, event)
+			}
+		}
+		return events
+	}
+
+	t.Run("runs are recorded with the backup they wrote", func(t *testing.T) {
+		backup(0, "INFO: 2024/01/01 03:05:00.000000 Wrote backup with name base_000000010000000000000002\n")
+		history, err := bs.BackupHistory(ctx, testUser, cluster.ClusterID, 0, true)
+		require.NoError(t, err)
+		require.Len(t, history.Runs, 1)
+		run := history.Runs[0]
+		assert.Equal(t, metastore.BackupRunSucceeded, run.Status)
+		assert.Equal(t, metastore.BackupTriggerOnDemand, run.Trigger)
+		assert.NotEmpty(t, run.OperationID)
+		assert.Equal(t, 0, run.ExitCode)
+		assert.Equal(t, "base_000000010000000000000002", run.BackupName)
+		assert.Equal(t, int64(1024), run.BytesUploaded)
+		assert.Contains(t, run.Logs, "Wrote backup with name")
+		require.NotNil(t, run.FinishedAt)
+		assert.False(t, run.FinishedAt.Before(run.StartedAt))
+		assert.Equal(t, BackupHealthy, history.Health.Status)
+
+		catalog, err := metastore.GetBackupCatalog(store, cluster.ClusterID)
+		require.NoError(t, err)
+		assert.Len(t, catalog.Backups, 2, "the backup catalog is refreshed")
+
+		_, err = bs.BackupHistory(ctx, User{ID: "someone-else"}, cluster.ClusterID, 0, false)
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+	})
+
+	t.Run("backups are failing after consecutive failures", func(t *testing.T) {
+		for i := 0; i < backupFailureThreshold; i++ {
+			backup(1, "ERROR: connect: connection refused\n")
+		}
+		history, err := bs.BackupHistory(ctx, testUser, cluster.ClusterID, 2, true)
+		require.NoError(t, err)
+		require.Len(t, history.Runs, 2)
+		assert.Equal(t, metastore.BackupRunFailed, history.Runs[0].Status)
+		assert.Equal(t, 1, history.Runs[0].ExitCode)
+		assert.Equal(t, "ERROR: connect: connection refused\n", history.Runs[0].Logs)
+		assert.Equal(t, BackupFailing, history.Health.Status)
+		assert.Equal(t, backupFailureThreshold, history.Health.ConsecutiveFailures)
+		assert.Equal(t, "backup exited with code 1", history.Health.LastError)
+		require.NotNil(t, history.Health.LastSuccess)
+
+		events := healthEvents()
+		require.Len(t, events, 1)
+		assert.Equal(t, BackupFailing, events[0].Details["status"])
+	})
+
+	t.Run("backups recover after a success", func(t *testing.T) {
+		backup(0, "")
+		history, err := bs.BackupHistory(ctx, testUser, cluster.ClusterID, 0, false)
+		require.NoError(t, err)
+		assert.Equal(t, BackupHealthy, history.Health.Status)
+		assert.Empty(t, history.Runs[0].Logs, "logs are only returned when asked for")
+		assert.Equal(t, "base_000000010000000000000004", history.Runs[0].BackupName, "the latest backup when none was logged")
+		events := healthEvents()
+		require.Len(t, events, 2)
+		assert.Equal(t, BackupHealthy, events[1].Details["status"])
+	})
+}
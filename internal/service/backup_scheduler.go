@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/postgres"
+)
+
+// backupScheduler runs the backup schedules kept in the metastore. It has a single cron scheduler for all clusters,
+// with a job per cluster that is kept in sync with the cluster's schedule in the metastore.
+type backupScheduler struct {
+	store  metastore.Db
+	logger *zap.Logger
+	cron   *cron.Cron
+	// run takes a backup of the cluster of the schedule.
+	run func(ctx context.Context, schedule metastore.BackupSchedule) error
+
+	mu sync.Mutex
+	// ctx is the context backups are run with, cancelled when the scheduler stops.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// jobs holds the cron entry and schedule ID of each cluster with a schedule.
+	jobs map[string]backupJob
+	// running holds the clusters whose backup job is running, so that runs of one cluster don't overlap.
+	running map[string]bool
+}
+
+type backupJob struct {
+	entry      cron.EntryID
+	scheduleID int
+}
+
+func newBackupScheduler(store metastore.Db, logger *zap.Logger, run func(ctx context.Context, schedule metastore.BackupSchedule) error) *backupScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backupScheduler{
+		store:   store,
+		logger:  logger,
+		cron:    cron.New(),
+		run:     run,
+		ctx:     ctx,
+		cancel:  cancel,
+		jobs:    make(map[string]backupJob),
+		running: make(map[string]bool),
+	}
+}
+
+// StartScheduler schedules the backups of every cluster with a backup schedule in the metastore, and starts running
+// them. Schedules created afterwards with CreateBackup are added as they are created. Backup runs and operations left
+// running by a previous spinup process are failed first.
+func (bs BackupService) StartScheduler() error {
+	bs.failInterrupted()
+	if err := bs.scheduler.sync(); err != nil {
+		return err
+	}
+	bs.scheduler.cron.Start()
+	return nil
+}
+
+// errInterrupted is the error of the backup runs and operations that were running when spinup stopped.
+const errInterrupted = "interrupted by restart"
+
+// failInterrupted fails the backup runs and operations left running by the previous spinup process, as nothing waits
+// for them anymore. Backup containers that were still running finish on their own, without being recorded.
+func (bs BackupService) failInterrupted() {
+	if n, err := metastore.FailRunningBackupRuns(bs.store, errInterrupted); err != nil {
+		bs.logger.Error("could not fail interrupted backup runs", zap.Error(err))
+	} else if n > 0 {
+		bs.logger.Warn("failed backup runs interrupted by restart", zap.Int("count", n))
+	}
+	if n, err := metastore.FailRunningOperations(bs.store, errInterrupted); err != nil {
+		bs.logger.Error("could not fail interrupted operations", zap.Error(err))
+	} else if n > 0 {
+		bs.logger.Warn("failed operations interrupted by restart", zap.Int("count", n))
+	}
+}
+
+// StopScheduler stops scheduling backups, stops waiting for the running backups to finish, and waits for their
+// outcome to be recorded or for the context to be done. The backup containers keep running.
+func (bs BackupService) StopScheduler(ctx context.Context) {
+	bs.scheduler.cancel()
+	stopped := bs.scheduler.cron.Stop()
+	select {
+	case <-stopped.Done():
+	case <-ctx.Done():
+		bs.logger.Warn("stopped waiting for scheduled backups", zap.Error(ctx.Err()))
+	}
+}
+
+// sync makes the scheduled jobs match the schedules in the metastore: jobs are added for new schedules, replaced for
+// changed schedules, and removed for clusters that no longer have a schedule.
+func (s *backupScheduler) sync() error {
+	schedules, err := metastore.BackupSchedules(s.store)
+	if err != nil {
+		return errors.Wrap(err, "loading backup schedules")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scheduled := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		if schedule.Spec == "" {
+			s.logger.Warn("backup schedule was saved by an older version of spinup and can't be restored, schedule the backups again",
+				zap.String("cluster_id", schedule.ClusterID))
+			continue
+		}
+		scheduled[schedule.ClusterID] = true
+		if job, ok := s.jobs[schedule.ClusterID]; ok {
+			if job.scheduleID == schedule.ID {
+				continue
+			}
+			s.cron.Remove(job.entry)
+			delete(s.jobs, schedule.ClusterID)
+		}
+		schedule := schedule
+		entry, err := s.cron.AddFunc(schedule.Spec, func() {
+			s.fire(schedule)
+		})
+		if err != nil {
+			s.logger.Error("could not schedule backups", zap.String("cluster_id", schedule.ClusterID),
+				zap.String("spec", schedule.Spec), zap.Error(err))
+			continue
+		}
+		s.jobs[schedule.ClusterID] = backupJob{entry: entry, scheduleID: schedule.ID}
+	}
+	for clusterID, job := range s.jobs {
+		if !scheduled[clusterID] {
+			s.cron.Remove(job.entry)
+			delete(s.jobs, clusterID)
+		}
+	}
+	return nil
+}
+
+// fire runs a scheduled backup, unless the previous backup of the cluster is still running, and records its outcome in
+// the cluster's history.
+func (s *backupScheduler) fire(schedule metastore.BackupSchedule) {
+	if !s.claim(schedule.ClusterID) {
+		s.logger.Warn("skipping backup, the previous backup is still running", zap.String("cluster_id", schedule.ClusterID))
+		return
+	}
+	defer s.release(schedule.ClusterID)
+
+	// schedules are removed along with their cluster.
+	if _, err := metastore.GetClusterByID(s.store, schedule.ClusterID); errors.Is(err, metastore.ErrClusterNotFound) {
+		if err := s.sync(); err != nil {
+			s.logger.Error("could not update backup schedules", zap.Error(err))
+		}
+		return
+	}
+
+	event := metastore.Event{
+		ClusterID: schedule.ClusterID,
+		Type:      metastore.EventBackupRun,
+		Actor:     systemUser.ID,
+		Details: map[string]string{
+			"destination": schedule.Dest.Type,
+			"bucket":      schedule.Dest.BucketName,
+			"trigger":     metastore.BackupTriggerSchedule,
+			"status":      "started",
+		},
+	}
+	err := s.run(s.ctx, schedule)
+	switch {
+	case err == nil:
+		event.Details["status"] = "succeeded"
+	case s.ctx.Err() != nil:
+		// the scheduler stopped while the backup was running, the backup container keeps running.
+		s.logger.Warn("stopped waiting for backup", zap.String("cluster_id", schedule.ClusterID), zap.Error(err))
+	case errors.Is(err, ErrBackupRunning):
+		s.logger.Warn("skipping backup, the previous backup is still running", zap.String("cluster_id", schedule.ClusterID))
+		event.Details["status"] = "skipped"
+		event.Details["error"] = err.Error()
+	case err != nil:
+		s.logger.Error("backup failed", zap.String("cluster_id", schedule.ClusterID), zap.Error(err))
+		event.Details["status"] = "failed"
+		event.Details["error"] = err.Error()
+	}
+	recordEvent(s.store, s.logger, event)
+}
+
+// claim marks a backup of the cluster as running, unless one already is, and reports whether it did. Scheduled and
+// on-demand backups both claim the cluster, so that they don't overlap.
+func (s *backupScheduler) claim(clusterID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[clusterID] {
+		return false
+	}
+	s.running[clusterID] = true
+	return true
+}
+
+// release marks the backup of the cluster as finished.
+func (s *backupScheduler) release(clusterID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, clusterID)
+}
+
+// runBackup takes a backup of the cluster of the given schedule, with the cluster's current credentials, and waits for
+// it to finish. The cluster's retention policy is applied after successful backups.
+func (bs BackupService) runBackup(ctx context.Context, schedule metastore.BackupSchedule) error {
+	cluster, err := metastore.GetClusterByID(bs.store, schedule.ClusterID)
+	if err != nil {
+		return err
+	}
+	run := newBackupRun(cluster.ClusterID, schedule.Dest, metastore.BackupTriggerSchedule, "")
+	backupContainer, run, err := bs.startBackup(ctx, cluster, schedule.Dest, run)
+	if err != nil {
+		return err
+	}
+	return bs.finishBackup(ctx, cluster, backupContainer, schedule.Dest, run, true)
+}
+
+// startBackup starts the container taking a backup of a cluster to the given destination, and records the backup run.
+// Backups that fail to start are recorded as failed runs, unless another backup of the cluster is running.
+func (bs BackupService) startBackup(ctx context.Context, cluster metastore.ClusterInfo, dest metastore.Destination,
+	run metastore.BackupRun) (*dockerservice.Container, metastore.BackupRun, error) {
+	run.StartedAt = time.Now().UTC()
+	backupContainer, err := startBackupContainer(ctx, bs.dockerClient, bs.logger, BackupData{
+		Dest:       dest,
+		PgHost:     postgres.PREFIXPGCONTAINER + cluster.Name,
+		PgDatabase: "postgres",
+		PgUsername: cluster.Username,
+		PgPassword: cluster.Password,
+	})
+	if errors.Is(err, ErrBackupRunning) {
+		return nil, run, err
+	}
+	if insertErr := metastore.InsertBackupRun(bs.store, run); insertErr != nil {
+		bs.logger.Error("could not record backup run", zap.String("cluster_id", cluster.ClusterID), zap.Error(insertErr))
+	}
+	if err != nil {
+		bs.endRun(run, err)
+		return nil, run, err
+	}
+	return backupContainer, run, nil
+}
+
+// finishBackup waits for a backup container to exit, and records the outcome of the backup run along with the
+// container's logs. The backup written by a successful run is described, and the cluster's retention policy is applied
+// to the destination when retain is set. Runs are left running when ctx is cancelled, as the container keeps running.
+func (bs BackupService) finishBackup(ctx context.Context, cluster metastore.ClusterInfo, backupContainer *dockerservice.Container,
+	dest metastore.Destination, run metastore.BackupRun, retain bool) error {
+	code, err := waitExit(ctx, bs.dockerClient, backupContainer)
+	if err != nil {
+		if ctx.Err() == nil {
+			bs.endRun(run, err)
+		}
+		return err
+	}
+	run.ExitCode = code
+	if run.Logs, err = backupContainer.Logs(ctx, bs.dockerClient, backupLogLines); err != nil {
+		bs.logger.Warn("could not read backup logs", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+	}
+	if code != 0 {
+		err := errors.Errorf("backup exited with code %d", code)
+		bs.endRun(run, err)
+		return err
+	}
+	bs.describeBackup(ctx, cluster, dest, &run, retain)
+	bs.endRun(run, nil)
+	if retain {
+		bs.retain(ctx, cluster, dest)
+	}
+	return nil
+}
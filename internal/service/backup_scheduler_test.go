@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestBackupScheduler(t *testing.T) {
+	testID := uuid.New().String()
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+
+	for _, name := range []string{"nightly", "hourly", "legacy"} {
+		require.NoError(t, metastore.InsertService(store, metastore.ClusterInfo{ClusterID: name, Name: name, Owner: testUser.ID}))
+	}
+	dest := metastore.Destination{Type: metastore.DestinationS3, BucketName: "bucket", ApiKeyID: "id", ApiKeySecret: "secret"}
+	require.NoError(t, metastore.SetBackupSchedule(store, "nightly", "30 2 * * *", dest))
+	require.NoError(t, metastore.SetBackupSchedule(store, "hourly", "0 * * * *", dest))
+	// schedules saved before the cron expression was stored can't be restored.
+	require.NoError(t, metastore.InsertBackup(store, "insert into backup(clusterId, destination, bucket, second, minute, hour, dom, month, dow) values(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		"legacy", "AWS", "bucket", 0, 0, 0, 0, 0, 0))
+
+	var mu sync.Mutex
+	var runs []metastore.BackupSchedule
+	newService := func() BackupService {
+		bs := NewBackupService(store, ds.Docker{}, logger)
+		bs.scheduler.run = func(ctx context.Context, schedule metastore.BackupSchedule) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs = append(runs, schedule)
+			if schedule.ClusterID == "hourly" {
+				return ErrBackupRunning
+			}
+			return nil
+		}
+		return bs
+	}
+	scheduledClusters := func(bs BackupService) []string {
+		bs.scheduler.mu.Lock()
+		defer bs.scheduler.mu.Unlock()
+		var clusters []string
+		for clusterID := range bs.scheduler.jobs {
+			clusters = append(clusters, clusterID)
+		}
+		return clusters
+	}
+
+	bs := newService()
+	require.NoError(t, bs.StartScheduler())
+	t.Cleanup(func() {
+		bs.StopScheduler(context.Background())
+	})
+
+	t.Run("schedules are restored from the metastore", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"nightly", "hourly"}, scheduledClusters(bs))
+		restarted := newService()
+		require.NoError(t, restarted.StartScheduler())
+		restarted.StopScheduler(context.Background())
+		assert.ElementsMatch(t, []string{"nightly", "hourly"}, scheduledClusters(restarted))
+	})
+
+	t.Run("interrupted runs and operations are failed at start", func(t *testing.T) {
+		run := newBackupRun("nightly", dest, metastore.BackupTriggerOnDemand, "interrupted-op")
+		require.NoError(t, metastore.InsertBackupRun(store, run))
+		require.NoError(t, metastore.InsertOperation(store, metastore.Operation{ID: "interrupted-op", Type: OperationBackup,
+			ClusterID: "nightly", Owner: testUser.ID, Status: metastore.OperationRunning}))
+
+		restarted := newService()
+		require.NoError(t, restarted.StartScheduler())
+		restarted.StopScheduler(context.Background())
+
+		runs, err := metastore.ListBackupRuns(store, metastore.BackupRunFilter{ClusterID: "nightly", Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, metastore.BackupRunFailed, runs[0].Status)
+		assert.Equal(t, errInterrupted, runs[0].Error)
+		op, err := metastore.GetOperation(store, "interrupted-op")
+		require.NoError(t, err)
+		assert.Equal(t, metastore.OperationFailed, op.Status)
+		assert.Equal(t, errInterrupted, op.Error)
+	})
+
+	t.Run("changed schedules replace the cluster's job", func(t *testing.T) {
+		before := bs.scheduler.jobs["nightly"]
+		require.NoError(t, metastore.SetBackupSchedule(store, "nightly", "0 3 * * *", dest))
+		require.NoError(t, bs.scheduler.sync())
+		after := bs.scheduler.jobs["nightly"]
+		assert.NotEqual(t, before.entry, after.entry)
+		midnight := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+		assert.Equal(t, midnight.Add(3*time.Hour), bs.scheduler.cron.Entry(after.entry).Schedule.Next(midnight))
+		assert.Len(t, bs.scheduler.cron.Entries(), 2)
+	})
+
+	t.Run("runs are recorded and don't overlap", func(t *testing.T) {
+		schedules, err := metastore.BackupSchedules(store)
+		require.NoError(t, err)
+		bySchedule := map[string]metastore.BackupSchedule{}
+		for _, s := range schedules {
+			bySchedule[s.ClusterID] = s
+		}
+
+		bs.scheduler.fire(bySchedule["nightly"])
+		require.Len(t, runs, 1)
+		assert.Equal(t, "secret", runs[0].Dest.ApiKeySecret)
+
+		bs.scheduler.running["nightly"] = true
+		bs.scheduler.fire(bySchedule["nightly"])
+		delete(bs.scheduler.running, "nightly")
+		assert.Len(t, runs, 1)
+
+		bs.scheduler.fire(bySchedule["hourly"])
+		assert.Len(t, runs, 2)
+
+		statuses := func(clusterID string) []string {
+			page, err := metastore.ListEvents(store, metastore.EventFilter{ClusterID: clusterID})
+			require.NoError(t, err)
+			var statuses []string
+			for _, event := range page.Events {
+				if event.Type == metastore.EventBackupRun {
+					statuses = append(statuses, event.Details["status"])
+				}
+			}
+			return statuses
+		}
+		assert.Equal(t, []string{"succeeded"}, statuses("nightly"))
+		assert.Equal(t, []string{"skipped"}, statuses("hourly"))
+	})
+
+	t.Run("jobs of deleted clusters are removed", func(t *testing.T) {
+		schedules, err := metastore.BackupSchedules(store)
+		require.NoError(t, err)
+		require.NoError(t, metastore.DeleteCluster(store, "hourly"))
+		for _, s := range schedules {
+			if s.ClusterID == "hourly" {
+				bs.scheduler.fire(s)
+			}
+		}
+		assert.Equal(t, []string{"nightly"}, scheduledClusters(bs))
+		assert.Len(t, runs, 2)
+	})
+}
+
+func TestStartBackupContainer(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	rt := ds.NewMemoryRuntime(ds.WithImages(WalgImage))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	data := BackupData{PgHost: "spinup-postgres-db", PgUsername: "postgres", PgPassword: "secret", PgDatabase: "postgres"}
+	started, err := startBackupContainer(ctx, dc, zap.NewNop(), data)
+	require.NoError(t, err)
+	c, err := dc.GetContainer(ctx, PREFIXBACKUPCONTAINER+data.PgHost)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, c.ID, started.ID)
+	assert.Contains(t, c.Config.Env, "PGPASSWORD=secret")
+
+	// the backup container of the previous run is still running.
+	_, err = startBackupContainer(ctx, dc, zap.NewNop(), data)
+	assert.ErrorIs(t, err, ErrBackupRunning)
+
+	t.Run("waits for the backup to exit", func(t *testing.T) {
+		setBackupPollInterval(t, 10*time.Millisecond)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = rt.Exit(c.ID, 1)
+		}()
+		code, err := waitExit(ctx, dc, started)
+		require.NoError(t, err)
+		assert.Equal(t, 1, code)
+	})
+
+	t.Run("containers of previous backups are replaced", func(t *testing.T) {
+		data := data
+		data.Dest = metastore.Destination{Type: metastore.DestinationGCS, BucketName: "bucket", ApiKeySecret: `{"type": "service_account"}`}
+		var c *ds.Container
+		require.Eventually(t, func() bool {
+			var err error
+			c, err = startBackupContainer(ctx, dc, zap.NewNop(), data)
+			return err == nil
+		}, time.Second, 10*time.Millisecond)
+		assert.NotEqual(t, started.ID, c.ID)
+		assert.Contains(t, c.Config.Env, "WALG_GS_PREFIX=gs://bucket")
+		key, ok := rt.ReadFile(c.ID, gcsKeyPath(data.Dest))
+		require.True(t, ok, "the service account key is copied before the backup starts")
+		assert.Equal(t, data.Dest.ApiKeySecret, string(key))
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -18,12 +20,10 @@ import (
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
 
-	"github.com/spinup-host/spinup/config"
 	"github.com/spinup-host/spinup/internal/dockerservice"
 	"github.com/spinup-host/spinup/internal/metastore"
 	"github.com/spinup-host/spinup/internal/postgres"
 	"github.com/spinup-host/spinup/misc"
-	"github.com/spinup-host/spinup/utils"
 )
 
 // Ideally I would like to keep the modify-pghba.sh script to scripts directory.
@@ -35,37 +35,57 @@ var f embed.FS
 const (
 	tarPath               = "modify-pghba.tar"
 	PREFIXBACKUPCONTAINER = "spinup-pg-backup-"
+	// WalgImage is the image of the containers running backups.
+	WalgImage = "spinuphost/walg:latest"
 )
 
 type BackupService struct {
 	store        metastore.Db
 	logger       *zap.Logger
 	dockerClient dockerservice.Docker
+	// scheduler runs the scheduled backups of every cluster. It's shared by the copies of the service.
+	scheduler *backupScheduler
 }
 
 func NewBackupService(store metastore.Db, client dockerservice.Docker, logger *zap.Logger) BackupService {
-	return BackupService{
+	bs := BackupService{
 		store:        store,
 		logger:       logger,
 		dockerClient: client,
 	}
+	bs.scheduler = newBackupScheduler(store, logger, bs.runBackup)
+	return bs
+}
+
+// ErrInvalidSchedule is returned when backups are scheduled with an invalid cron expression.
+type ErrInvalidSchedule struct {
+	Spec string
+	Err  error
+}
+
+func (e ErrInvalidSchedule) Error() string {
+	return fmt.Sprintf("invalid backup schedule '%s': %v", e.Spec, e.Err)
 }
 
 type BackupData struct {
-	AwsAccessKeySecret string
-	AwsAccessKeyId     string
-	WalgS3Prefix       string
-	PgHost             string
-	PgUsername         string
-	PgPassword         string
-	PgDatabase         string
+	Dest       metastore.Destination
+	PgHost     string
+	PgUsername string
+	PgPassword string
+	PgDatabase string
 }
 
-func (bs BackupService) CreateBackup(ctx context.Context, clusterID string, backupConfig metastore.BackupConfig) error {
-	cluster, err := metastore.GetClusterByID(bs.store, clusterID)
+// CreateBackup schedules backups for the cluster with the given ID, and makes the cluster archive its WAL to the
+// backup destination for point-in-time recovery. The destination is checked with wal-g first. The user must own the
+// cluster.
+func (bs BackupService) CreateBackup(ctx context.Context, user User, clusterID string, backupConfig metastore.BackupConfig) error {
+	cluster, err := bs.ownedCluster(user, clusterID)
 	if err != nil {
 		return err
 	}
+	if err := validateDestination(backupConfig.Dest); err != nil {
+		return err
+	}
 
 	pgHost := postgres.PREFIXPGCONTAINER + cluster.Name
 	var pgContainer *dockerservice.Container
@@ -77,41 +97,17 @@ func (bs BackupService) CreateBackup(ctx context.Context, clusterID string, back
 		return errors.New("no container matched the provided ID")
 	}
 
-	minute, _ := backupConfig.Schedule["minute"].(string)
-	min, _ := strconv.Atoi(minute)
-
-	hour, _ := backupConfig.Schedule["hour"].(string)
-	h, _ := strconv.Atoi(hour)
-
-	dom, _ := backupConfig.Schedule["dom"].(string)
-	domInt, _ := strconv.Atoi(dom)
-
-	month, _ := backupConfig.Schedule["month"].(string)
-	mon, _ := strconv.Atoi(month)
-
-	dow, _ := backupConfig.Schedule["dow"].(string)
-	dowInt, _ := strconv.Atoi(dow)
-
-	insertSql := "insert into backup(clusterId, destination, bucket, second, minute, hour, dom, month, dow) values(?, ?, ?, ?, ?, ?, ?, ?, ?)"
-	if err := metastore.InsertBackup(
-		bs.store,
-		insertSql,
-		clusterID,
-		backupConfig.Dest.Name,
-		backupConfig.Dest.BucketName,
-		0,
-		min,
-		h,
-		domInt,
-		mon,
-		dowInt,
-	); err != nil {
+	spec := strings.TrimSpace(scheduleToCronExpr(backupConfig.Schedule))
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return ErrInvalidSchedule{Spec: spec, Err: err}
+	}
+	if err := checkDestination(ctx, bs.dockerClient, bs.logger, cluster.Name, backupConfig.Dest); err != nil {
 		return err
 	}
 
 	scriptContent, err := f.ReadFile("modify-pghba.sh")
 	if err != nil {
-		utils.Logger.Error("reading modify-pghba.sh file ", zap.Error(err))
+		bs.logger.Error("reading modify-pghba.sh file ", zap.Error(err))
 	}
 	if err = updatePghba(pgContainer, bs.dockerClient, scriptContent); err != nil {
 		return errors.Wrap(err, "failed to update pghba")
@@ -121,28 +117,49 @@ func (bs BackupService) CreateBackup(ctx context.Context, clusterID string, back
 	if err = postgres.ReloadPostgres(bs.dockerClient, execPath, postgres.PGDATADIR, pgHost); err != nil {
 		return errors.Wrap(err, "failed to relaod postgres")
 	}
-	scheduler := cron.New()
-	spec := scheduleToCronExpr(backupConfig.Schedule)
-	utils.Logger.Info("Scheduling backup at ", zap.String("spec", spec))
+	if err := enableArchiving(ctx, bs.dockerClient, bs.logger, pgContainer, cluster, backupConfig.Dest); err != nil {
+		return errors.Wrap(err, "failed to enable WAL archiving")
+	}
 
-	backupData := BackupData{
-		AwsAccessKeySecret: backupConfig.Dest.ApiKeySecret,
-		AwsAccessKeyId:     backupConfig.Dest.ApiKeyID,
-		WalgS3Prefix:       fmt.Sprintf("s3://%s", backupConfig.Dest.BucketName),
-		PgHost:             pgHost,
-		PgDatabase:         "postgres",
-		PgUsername:         cluster.Username,
-		PgPassword:         cluster.Password,
-	}
-	_, err = scheduler.AddFunc(spec, TriggerBackup(config.DefaultNetworkName, backupData))
-	if err != nil {
-		utils.Logger.Error("scheduling database backup", zap.Error(err))
+	bs.logger.Info("Scheduling backup at ", zap.String("spec", spec))
+	if err := metastore.SetBackupSchedule(bs.store, clusterID, spec, backupConfig.Dest); err != nil {
+		return errors.Wrap(err, "saving backup schedule")
+	}
+	if err := bs.scheduler.sync(); err != nil {
+		bs.logger.Error("scheduling database backup", zap.Error(err))
 		return err
 	}
-	scheduler.Start()
+	recordEvent(bs.store, bs.logger, metastore.Event{
+		ClusterID: clusterID,
+		Type:      metastore.EventBackupScheduled,
+		Actor:     user.ID,
+		Details: map[string]string{
+			"destination": backupConfig.Dest.Type,
+			"bucket":      backupConfig.Dest.BucketName,
+			"schedule":    spec,
+		},
+	})
 	return nil
 }
 
+// ownedCluster returns the cluster with the given ID, as long as the user owns it and its engine supports backups.
+func (bs BackupService) ownedCluster(user User, clusterID string) (metastore.ClusterInfo, error) {
+	cluster, err := metastore.GetClusterByID(bs.store, clusterID)
+	if errors.Is(err, metastore.ErrClusterNotFound) {
+		return metastore.ClusterInfo{}, ErrNoMatch{id: clusterID}
+	}
+	if err != nil {
+		return metastore.ClusterInfo{}, err
+	}
+	if !user.owns(cluster) {
+		return metastore.ClusterInfo{}, ErrNoMatch{id: clusterID}
+	}
+	if err := requirePostgres(cluster, "backups"); err != nil {
+		return metastore.ClusterInfo{}, err
+	}
+	return cluster, nil
+}
+
 func scheduleToCronExpr(schedule map[string]interface{}) string {
 	spec := ""
 	if minute, ok := schedule["minute"].(string); ok {
@@ -231,66 +248,81 @@ func contentToTar(content []byte) (io.Writer, func(), error) {
 	return tw, rmFunc, nil
 }
 
-// TriggerBackup returns a closure which is being invoked by the cron
-func TriggerBackup(networkName string, backupData BackupData) func() {
-	var err error
-	dockerClient, err := dockerservice.NewDocker(config.DefaultNetworkName)
-	if err != nil {
-		utils.Logger.Error("Error creating client", zap.Error(err))
+// ErrBackupRunning is returned when a backup is started while another backup of the cluster is still running.
+var ErrBackupRunning = errors.New("another backup of the cluster is still running")
+
+// startBackupContainer starts the container taking a backup with the given settings, and returns it. The cluster's
+// backup container from the previous backup is replaced, so that each backup runs with the current settings.
+func startBackupContainer(ctx context.Context, dockerClient dockerservice.Docker, logger *zap.Logger, backupData BackupData) (*dockerservice.Container, error) {
+	logger.Info("starting backup")
+
+	containerName := PREFIXBACKUPCONTAINER + backupData.PgHost
+	backupContainer, err := dockerClient.GetContainer(ctx, containerName)
+	if backupContainer != nil {
+		if backupContainer.State == "running" {
+			return nil, ErrBackupRunning
+		}
+		if err := backupContainer.Remove(ctx, dockerClient); err != nil {
+			return nil, errors.Wrap(err, "removing previous backup container")
+		}
+	} else if err != nil {
+		logger.Warn("could not get info for backup container, spinup will attempt to recreate it", zap.Error(err))
 	}
-	var op container.ContainerCreateCreatedBody
-	env := []string{
-		misc.StringToDockerEnvVal("AWS_SECRET_ACCESS_KEY", backupData.AwsAccessKeySecret),
-		misc.StringToDockerEnvVal("AWS_ACCESS_KEY_ID", backupData.AwsAccessKeyId),
-		misc.StringToDockerEnvVal("WALG_S3_PREFIX", backupData.WalgS3Prefix),
+
+	env := append(walgEnv(backupData.Dest),
 		misc.StringToDockerEnvVal("PGHOST", backupData.PgHost),
 		misc.StringToDockerEnvVal("PGPASSWORD", backupData.PgPassword),
 		misc.StringToDockerEnvVal("PGDATABASE", backupData.PgDatabase),
 		misc.StringToDockerEnvVal("PGUSER", backupData.PgUsername),
-	}
-
+	)
 	// Ref: https://gist.github.com/viggy28/5b524baf005d029e4bad2ec16cb09dca
 	// On dealing with container networking and environment variables
-	// initialized a map
-	endpointConfig := map[string]*network.EndpointSettings{}
-	// setting key and value for the map. networkName=$dbname_default (eg: viggy_default)
-	endpointConfig[networkName] = &network.EndpointSettings{}
-	nwConfig := network.NetworkingConfig{EndpointsConfig: endpointConfig}
+	nwConfig := network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+		dockerClient.NetworkName: {},
+	}}
+	walgContainer := dockerservice.NewContainer(
+		containerName,
+		container.Config{
+			Image:        WalgImage,
+			Env:          env,
+			ExposedPorts: map[nat.Port]struct{}{"5432": {}},
+		},
+		container.HostConfig{NetworkMode: "default", Mounts: walgMounts(backupData.Dest)},
+		nwConfig,
+	)
+	if files := walgFiles(backupData.Dest); len(files) > 0 {
+		archive, err := tarFiles(files...)
+		if err != nil {
+			return nil, err
+		}
+		walgContainer.Files = archive
+	}
+	op, err := walgContainer.Start(ctx, dockerClient)
+	if err != nil {
+		logger.Error("failed to start backup container", zap.Error(err))
+		return nil, errors.Wrap(err, "starting backup container")
+	}
+	logger.Info("started backup container:", zap.String("containerId", op.ID))
+	return &walgContainer, nil
+}
 
-	return func() {
-		utils.Logger.Info("starting backup")
+// backupPollInterval is how often a running backup container is checked for having exited.
+var backupPollInterval = 5 * time.Second
 
-		containerName := PREFIXBACKUPCONTAINER + backupData.PgHost
-		backupContainer, err := dockerClient.GetContainer(context.TODO(), containerName)
-		if backupContainer != nil {
-			err = backupContainer.StartExisting(context.TODO(), dockerClient)
-			if err != nil {
-				utils.Logger.Error("failed to start existing walg container", zap.Error(err))
-			} else {
-				utils.Logger.Info(fmt.Sprintf("reusing existing walg container: '%s'", containerName))
-			}
-		} else {
-			if err != nil {
-				utils.Logger.Warn("could not get info for backup container, spinup will attempt to recreate it", zap.Error(err))
-			}
-			walgContainer := dockerservice.NewContainer(
-				containerName,
-				container.Config{
-					Image:        "spinuphost/walg:latest",
-					Env:          env,
-					ExposedPorts: map[nat.Port]struct{}{"5432": {}},
-				},
-				container.HostConfig{NetworkMode: "default"},
-				nwConfig,
-			)
-			op, err = walgContainer.Start(context.Background(), dockerClient)
-			if err != nil {
-				utils.Logger.Error("failed to start backup container", zap.Error(err))
-			} else {
-				utils.Logger.Info("started backup container:", zap.String("containerId", op.ID))
-			}
+// waitExit waits for a container to exit, and returns its exit code.
+func waitExit(ctx context.Context, d dockerservice.Docker, c *dockerservice.Container) (int, error) {
+	for {
+		data, err := d.Cli.ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return 0, errors.Wrap(err, "inspecting backup container")
+		}
+		if data.State != nil && !data.State.Running {
+			return data.State.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, errors.Wrap(ctx.Err(), "waiting for backup to finish")
+		case <-time.After(backupPollInterval):
 		}
-
-		utils.Logger.Info("Ending backup")
 	}
 }
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestCreateBackup(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	rt := ds.NewMemoryRuntime(ds.WithImages("postgres:14.5", WalgImage), ds.WithExecHandler(func(container string, cmd []string) ds.ExecResult {
+		if strings.HasPrefix(container, PREFIXWALGCONTAINER) {
+			if cmd[0] == "wal-g" {
+				return ds.ExecResult{Stdout: "[]"}
+			}
+			return ds.ExecResult{Stdout: "wal-g binary"}
+		}
+		return ds.SimulatePostgres(container, cmd)
+	}))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	cfg := config.Configuration{}
+	cfg.Backups.FileRoot = "/srv/backups/"
+	svc := NewService(dc, store, nil, logger, cfg)
+	bs := NewBackupService(store, dc, logger)
+
+	info := &metastore.ClusterInfo{Type: "postgres", Name: "files-" + testID[:8], Port: 15440, Username: "admin", Password: "secret",
+		MajVersion: 14, MinVersion: 5}
+	require.NoError(t, svc.CreateService(ctx, testUser, info))
+	schedule := map[string]interface{}{"minute": "0", "hour": "3"}
+
+	t.Run("file destinations in the file root", func(t *testing.T) {
+		dest := metastore.Destination{Type: metastore.DestinationFile, Path: "/srv/backups/" + info.Name}
+		require.NoError(t, bs.CreateBackup(ctx, testUser, info.ClusterID, metastore.BackupConfig{Schedule: schedule, Dest: dest}))
+
+		saved, ok, err := metastore.GetBackupSchedule(store, info.ClusterID)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, dest, saved.Dest)
+		_, ok = rt.ReadFile(info.ClusterID, "/spinup/walg/walg.json")
+		assert.True(t, ok, "postgres archives WAL to the destination")
+	})
+
+	t.Run("file destinations outside of the file root", func(t *testing.T) {
+		dest := metastore.Destination{Type: metastore.DestinationFile, Path: "/mnt/backups"}
+		err := bs.CreateBackup(ctx, testUser, info.ClusterID, metastore.BackupConfig{Schedule: schedule, Dest: dest})
+		assert.ErrorAs(t, err, &ErrInvalidDestination{})
+	})
+}
+
+// backupFixture is a postgres cluster with an S3 backup destination, whose backups are managed by a backup service
+// running on a memory runtime.
+type backupFixture struct {
+	rt      *ds.MemoryRuntime
+	dc      ds.Docker
+	store   metastore.Db
+	bs      BackupService
+	cluster metastore.ClusterInfo
+	dest    metastore.Destination
+}
+
+// newBackupFixture returns a backup fixture whose commands executed in containers are answered by exec. Backup
+// containers are polled every 10ms for the duration of the test.
+func newBackupFixture(t *testing.T, testID string, exec ds.ExecHandler) backupFixture {
+	setBackupPollInterval(t, 10*time.Millisecond)
+	rt := ds.NewMemoryRuntime(ds.WithImages(WalgImage), ds.WithExecHandler(exec))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(context.Background())
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	cluster := metastore.ClusterInfo{ClusterID: "cluster-" + testID, Name: "cluster-" + testID, Owner: testUser.ID, Type: "postgres",
+		Username: "admin", Password: "secret"}
+	require.NoError(t, metastore.InsertService(store, cluster))
+	return backupFixture{
+		rt:      rt,
+		dc:      dc,
+		store:   store,
+		bs:      NewBackupService(store, dc, logger),
+		cluster: cluster,
+		dest:    metastore.Destination{Type: metastore.DestinationS3, BucketName: "bucket", ApiKeyID: "id", ApiKeySecret: "key"},
+	}
+}
+
+// setBackupPollInterval changes how often backup containers are polled for the duration of the test.
+func setBackupPollInterval(t *testing.T, d time.Duration) {
+	previous := backupPollInterval
+	backupPollInterval = d
+	t.Cleanup(func() {
+		backupPollInterval = previous
+	})
+}
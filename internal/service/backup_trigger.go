@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+// OperationBackup is the type of the operations taking an on-demand backup of a cluster.
+const OperationBackup = "backup"
+
+// TriggerBackup takes a backup of a cluster now, rather than at its next scheduled backup. The backup goes to the
+// cluster's backup destination, or to dest when it's set, which is then checked with wal-g first and only used for
+// this backup. The backup runs in the background: the returned operation succeeds once the backup container exits
+// successfully. Backups are refused with ErrBackupRunning while another backup of the cluster is running. The user
+// must own the cluster.
+func (bs BackupService) TriggerBackup(ctx context.Context, user User, clusterID string, dest *metastore.Destination) (metastore.Operation, error) {
+	cluster, err := bs.ownedCluster(user, clusterID)
+	if err != nil {
+		return metastore.Operation{}, err
+	}
+	oneOff := dest != nil
+	if oneOff {
+		if err := validateDestination(*dest); err != nil {
+			return metastore.Operation{}, err
+		}
+		if err := checkDestination(ctx, bs.dockerClient, bs.logger, cluster.Name, *dest); err != nil {
+			return metastore.Operation{}, err
+		}
+	} else {
+		schedule, ok, err := metastore.GetBackupSchedule(bs.store, clusterID)
+		if err != nil {
+			return metastore.Operation{}, err
+		}
+		if !ok || schedule.Spec == "" {
+			return metastore.Operation{}, ErrNoBackupDestination{ClusterID: clusterID}
+		}
+		dest = &schedule.Dest
+	}
+
+	if !bs.scheduler.claim(clusterID) {
+		return metastore.Operation{}, ErrBackupRunning
+	}
+	opID := uuid.New().String()
+	// the container is started before returning, so that a backup started by another spinup process is refused too.
+	run := newBackupRun(clusterID, *dest, metastore.BackupTriggerOnDemand, opID)
+	backupContainer, run, err := bs.startBackup(ctx, cluster, *dest, run)
+	if err != nil {
+		bs.scheduler.release(clusterID)
+		return metastore.Operation{}, err
+	}
+	op := metastore.Operation{
+		ID:        opID,
+		Type:      OperationBackup,
+		ClusterID: clusterID,
+		Owner:     user.ID,
+		Status:    metastore.OperationRunning,
+		Step:      "backing up",
+		Details: map[string]string{
+			"destination": dest.Type,
+			"bucket":      dest.BucketName,
+			"one_off":     strconv.FormatBool(oneOff),
+			"run_id":      run.ID,
+		},
+	}
+	if err := metastore.InsertOperation(bs.store, op); err != nil {
+		err = errors.Wrap(err, "saving backup operation")
+		// nothing would wait for the backup, so it's stopped rather than left running unrecorded.
+		removeContainer(bs.dockerClient, bs.logger, backupContainer)
+		bs.endRun(run, err)
+		bs.scheduler.release(clusterID)
+		return metastore.Operation{}, err
+	}
+
+	// the backup outlives the request, so it's waited for with the scheduler's context, like scheduled backups. When
+	// the scheduler stops, the backup container keeps running and the run and operation are failed on the next start.
+	// Retention policies only apply to the cluster's backup destination.
+	go func(op metastore.Operation, dest metastore.Destination) {
+		defer bs.scheduler.release(clusterID)
+		err := bs.finishBackup(bs.scheduler.ctx, cluster, backupContainer, dest, run, !oneOff)
+		if bs.scheduler.ctx.Err() != nil {
+			bs.logger.Warn("stopped waiting for backup", zap.String("cluster_id", clusterID), zap.Error(err))
+			return
+		}
+		event := metastore.Event{
+			ClusterID: clusterID,
+			Type:      metastore.EventBackupRun,
+			Actor:     user.ID,
+			Details: map[string]string{
+				"destination":  dest.Type,
+				"bucket":       dest.BucketName,
+				"trigger":      metastore.BackupTriggerOnDemand,
+				"operation_id": op.ID,
+				"run_id":       run.ID,
+				"status":       "succeeded",
+			},
+		}
+		op.Step = ""
+		op.Status = metastore.OperationSucceeded
+		if err != nil {
+			bs.logger.Error("backup failed", zap.String("cluster_id", clusterID), zap.Error(err))
+			op.Status = metastore.OperationFailed
+			op.Error = err.Error()
+			event.Details["status"] = "failed"
+			event.Details["error"] = err.Error()
+		}
+		saveOperation(bs.store, bs.logger, op)
+		recordEvent(bs.store, bs.logger, event)
+	}(op, *dest)
+	return op, nil
+}
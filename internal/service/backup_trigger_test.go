@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/postgres"
+)
+
+func TestTriggerBackup(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	deletions := 0
+	f := newBackupFixture(t, testID, func(container string, cmd []string) ds.ExecResult {
+		if !strings.HasPrefix(container, PREFIXRESTORECONTAINER) || cmd[0] != "wal-g" {
+			return ds.ExecResult{}
+		}
+		switch cmd[1] {
+		case "backup-list":
+			return ds.ExecResult{Stdout: `[{"backup_name":"base_000000010000000000000002","time":"2024-01-01T03:00:00Z","finish_time":"2024-01-01T03:05:00Z"},` +
+				`{"backup_name":"base_000000010000000000000004","time":"2024-01-02T03:00:00Z","finish_time":"2024-01-02T03:05:00Z"}]`}
+		case "delete":
+			mu.Lock()
+			deletions++
+			mu.Unlock()
+		}
+		return ds.ExecResult{}
+	})
+	rt, dc, store, bs, cluster, dest := f.rt, f.dc, f.store, f.bs, f.cluster, f.dest
+
+	backupContainer := func() *ds.Container {
+		c, err := dc.GetContainer(ctx, PREFIXBACKUPCONTAINER+postgres.PREFIXPGCONTAINER+cluster.Name)
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		return c
+	}
+	finished := func(id string) metastore.Operation {
+		var op metastore.Operation
+		require.Eventually(t, func() bool {
+			var err error
+			op, err = metastore.GetOperation(store, id)
+			require.NoError(t, err)
+			return op.Status != metastore.OperationRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		return op
+	}
+	deleted := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return deletions
+	}
+
+	t.Run("backups need a destination", func(t *testing.T) {
+		_, err := bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		assert.ErrorAs(t, err, &ErrNoBackupDestination{})
+		_, err = bs.TriggerBackup(ctx, User{ID: "someone-else"}, cluster.ClusterID, &dest)
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+		_, err = bs.TriggerBackup(ctx, testUser, cluster.ClusterID, &metastore.Destination{Type: metastore.DestinationS3})
+		assert.ErrorAs(t, err, &ErrInvalidDestination{})
+	})
+	require.NoError(t, metastore.SetBackupSchedule(store, cluster.ClusterID, "0 3 * * *", dest))
+	_, err := bs.SetRetentionPolicy(ctx, testUser, cluster.ClusterID, metastore.RetentionPolicy{KeepLast: 1})
+	require.NoError(t, err)
+
+	t.Run("backups go to the cluster's destination", func(t *testing.T) {
+		op, err := bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		require.NoError(t, err)
+		assert.Equal(t, OperationBackup, op.Type)
+		assert.Equal(t, metastore.OperationRunning, op.Status)
+		assert.Equal(t, "false", op.Details["one_off"])
+
+		_, err = bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		assert.ErrorIs(t, err, ErrBackupRunning, "only one backup of a cluster runs at a time")
+
+		require.NoError(t, rt.Exit(backupContainer().ID, 0))
+		op = finished(op.ID)
+		assert.Equal(t, metastore.OperationSucceeded, op.Status)
+		assert.Equal(t, 1, deleted(), "the retention policy is applied")
+
+		page, err := metastore.ListEvents(store, metastore.EventFilter{ClusterID: cluster.ClusterID})
+		require.NoError(t, err)
+		var runs []metastore.Event
+		for _, event := range page.Events {
+			if event.Type == metastore.EventBackupRun {
+				runs = append(runs, event)
+			}
+		}
+		require.Len(t, runs, 1)
+		assert.Equal(t, "on_demand", runs[0].Details["trigger"])
+		assert.Equal(t, op.ID, runs[0].Details["operation_id"])
+		assert.Equal(t, testUser.ID, runs[0].Actor)
+	})
+
+	t.Run("one-off destinations skip the retention policy", func(t *testing.T) {
+		other := metastore.Destination{Type: metastore.DestinationS3, BucketName: "other", ApiKeyID: "id", ApiKeySecret: "key"}
+		op, err := bs.TriggerBackup(ctx, testUser, cluster.ClusterID, &other)
+		require.NoError(t, err)
+		assert.Equal(t, "true", op.Details["one_off"])
+		assert.Equal(t, "other", op.Details["bucket"])
+
+		require.NoError(t, rt.Exit(backupContainer().ID, 0))
+		op = finished(op.ID)
+		assert.Equal(t, metastore.OperationSucceeded, op.Status)
+		assert.Equal(t, 1, deleted())
+	})
+
+	t.Run("failed backups fail their operation", func(t *testing.T) {
+		op, err := bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		require.NoError(t, err)
+		require.NoError(t, rt.Exit(backupContainer().ID, 1))
+		op = finished(op.ID)
+		assert.Equal(t, metastore.OperationFailed, op.Status)
+		assert.Contains(t, op.Error, "exited with code 1")
+		assert.Equal(t, 1, deleted())
+	})
+
+	t.Run("backups are stopped when their operation can't be saved", func(t *testing.T) {
+		_, err := store.Client.Exec("CREATE TRIGGER fail_operations BEFORE INSERT ON operation BEGIN SELECT RAISE(ABORT, 'disk full'); END")
+		require.NoError(t, err)
+		_, err = bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		_, dropErr := store.Client.Exec("DROP TRIGGER fail_operations")
+		require.NoError(t, dropErr)
+		assert.ErrorContains(t, err, "disk full")
+
+		c, err := dc.GetContainer(ctx, PREFIXBACKUPCONTAINER+postgres.PREFIXPGCONTAINER+cluster.Name)
+		require.NoError(t, err)
+		assert.Nil(t, c, "the backup container is removed")
+		runs, err := metastore.ListBackupRuns(store, metastore.BackupRunFilter{ClusterID: cluster.ClusterID, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, metastore.BackupRunFailed, runs[0].Status)
+		assert.Contains(t, runs[0].Error, "saving backup operation")
+
+		op, err := bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		require.NoError(t, err, "the cluster is released")
+		require.NoError(t, rt.Exit(backupContainer().ID, 0))
+		assert.Equal(t, metastore.OperationSucceeded, finished(op.ID).Status)
+	})
+
+	t.Run("backups outlive a stopped scheduler", func(t *testing.T) {
+		op, err := bs.TriggerBackup(ctx, testUser, cluster.ClusterID, nil)
+		require.NoError(t, err)
+		bs.StopScheduler(ctx)
+		time.Sleep(10 * backupPollInterval)
+
+		op, err = metastore.GetOperation(store, op.ID)
+		require.NoError(t, err)
+		assert.Equal(t, metastore.OperationRunning, op.Status, "the operation is failed on the next start")
+		assert.Equal(t, "running", backupContainer().State)
+	})
+}
@@ -3,26 +3,54 @@ package service
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/spinup-host/spinup/config"
 	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/engine"
 	"github.com/spinup-host/spinup/internal/metastore"
 	"github.com/spinup-host/spinup/internal/monitor"
-	"github.com/spinup-host/spinup/internal/postgres"
 )
 
 type Service struct {
 	store          metastore.Db
 	dockerClient   dockerservice.Docker
 	monitorRuntime *monitor.Runtime
+	quotas         *quotaTracker
 
 	logger    *zap.Logger
 	svcConfig config.Configuration
 }
 
+// User identifies the caller on whose behalf a service operation is performed.
+// Regular users can only see and manage the clusters they own, admins can manage every cluster.
+type User struct {
+	ID    string
+	Admin bool
+}
+
+// systemUser is used for operations spinup performs on its own, such as deleting expired clusters.
+var systemUser = User{ID: "spinup", Admin: true}
+
+// owns reports whether the user is allowed to see and manage the given cluster.
+func (u User) owns(cluster metastore.ClusterInfo) bool {
+	return u.Admin || (u.ID != "" && cluster.Owner == u.ID)
+}
+
+// ErrInvalidExpiry is returned when a cluster is given an expiry time that has already passed.
+var ErrInvalidExpiry = errors.New("expiry time must be in the future")
+
+// MinIdleTimeout is the shortest idle timeout a cluster can have, so that clusters aren't stopped between two queries.
+const MinIdleTimeout = time.Minute
+
+// ErrInvalidIdleTimeout is returned when a cluster is given an idle timeout shorter than MinIdleTimeout.
+var ErrInvalidIdleTimeout = errors.Errorf("idle timeout must be zero or at least %s", MinIdleTimeout)
+
 type ErrNoMatch struct {
 	id string
 }
@@ -36,6 +64,7 @@ func NewService(client dockerservice.Docker, store metastore.Db, mr *monitor.Run
 		store:          store,
 		dockerClient:   client,
 		monitorRuntime: mr,
+		quotas:         newQuotaTracker(),
 
 		logger:    logger,
 		svcConfig: cfg,
@@ -68,11 +97,54 @@ type Destination struct {
 	ApiKeySecret string
 }
 
-// CreateService creates a new database service alongside the needed containers.
-func (svc Service) CreateService(ctx context.Context, info *metastore.ClusterInfo) error {
-	image := fmt.Sprintf("%s/%s:%d.%d", "amd64", "postgres", info.MajVersion, info.MinVersion)
+// CreateService creates a new database service alongside the needed containers. The cluster is owned by the given user.
+func (svc Service) CreateService(ctx context.Context, user User, info *metastore.ClusterInfo) error {
+	if user.ID == "" {
+		return errors.New("cluster owner cannot be empty")
+	}
+	info.Owner = user.ID
+	e, err := engineFor(info.Type)
+	if err != nil {
+		return err
+	}
+	info.Type = e.Type()
+	if err := validateLabels(info.Labels); err != nil {
+		return err
+	}
+	if info.ExpiresAt != nil && !info.ExpiresAt.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+	if err := validateIdleTimeout(time.Duration(info.IdleTimeout) * time.Second); err != nil {
+		return err
+	}
+	if err := validateIdleEngine(e, time.Duration(info.IdleTimeout)*time.Second); err != nil {
+		return err
+	}
+	if err := validateCredentials(e, info.Username, info.Password); err != nil {
+		return err
+	}
+	// container names include the engine, so clusters of different engines wouldn't clash on them.
+	if _, err := metastore.GetClusterByName(svc.store, info.Name); err == nil {
+		return dockerservice.ErrDuplicateContainerName
+	}
+	if info.Image == "" {
+		info.Image = e.Image(info.MajVersion, info.MinVersion)
+	}
+	image, err := resolveImage(svc.svcConfig.Registry, info.Image)
+	if err != nil {
+		return err
+	}
+	if err := checkImageDigests(ctx, svc.dockerClient, svc.svcConfig.Registry, image); err != nil {
+		return err
+	}
+
+	release, err := svc.quotas.reserve(svc.store, user.ID, svc.svcConfig.QuotaFor(user.ID), clusterUsage(*info))
+	if err != nil {
+		return err
+	}
+	defer release()
 
-	postgresContainerProp := postgres.ContainerProps{
+	containerProps := engine.ContainerProps{
 		Name:      info.Name,
 		Username:  info.Username,
 		Password:  info.Password,
@@ -82,48 +154,78 @@ func (svc Service) CreateService(ctx context.Context, info *metastore.ClusterInf
 		Image:     image,
 	}
 
-	pgContainer, err := postgres.NewPostgresContainer(svc.dockerClient, postgresContainerProp)
+	dbContainer, err := engine.NewContainer(svc.dockerClient, e, containerProps)
 	if err != nil {
-		return errors.Wrap(err, "creating new postgres container")
+		return errors.Wrapf(err, "creating new %s container", info.Type)
 	}
+	dbContainer.HostConfig.Mounts = append(dbContainer.HostConfig.Mounts, fileRootMounts(svc.svcConfig, info.Type)...)
 
-	body, err := pgContainer.Start(ctx, svc.dockerClient)
+	body, err := dbContainer.Start(ctx, svc.dockerClient)
 	if err != nil {
-		return errors.Wrap(err, "starting postgres container")
+		return errors.Wrapf(err, "starting %s container", info.Type)
 	}
 	if len(body.Warnings) != 0 {
 		svc.logger.Warn("container may be unhealthy", zap.Strings("warnings", body.Warnings))
 	}
 	info.ClusterID = body.ID
+	info.Status = metastore.StatusRunning
+	info.DataMount = info.Name
+	info.Volumes = []string{info.Name}
 
 	if err := metastore.InsertService(svc.store, *info); err != nil {
 		return errors.Wrap(err, "saving cluster info to store")
 	}
+	recordEvent(svc.store, svc.logger, metastore.Event{
+		ClusterID: info.ClusterID,
+		Type:      metastore.EventCreated,
+		Actor:     user.ID,
+		Details: map[string]string{
+			"type":    info.Type,
+			"image":   image,
+			"version": fmt.Sprintf("%d.%d", info.MajVersion, info.MinVersion),
+		},
+	})
 
 	if info.Monitoring == "enable" {
-		if svc.monitorRuntime == nil {
-			svc.monitorRuntime = monitor.NewRuntime(svc.dockerClient, monitor.WithLogger(svc.logger), monitor.WithAppConfig(svc.svcConfig))
-			if err := svc.monitorRuntime.BootstrapServices(ctx); err != nil {
-				return errors.Wrap(err, "failed to start monitoring services")
-			}
-		}
+		return svc.startMonitoring(ctx, info, dbContainer.Name)
+	}
+
+	return nil
+}
 
-		target := &monitor.Target{
-			ContainerName: pgContainer.Name,
-			UserName:      info.Username,
-			Password:      info.Password,
-			Port:          info.Port,
+// startMonitoring adds the cluster running in the given container to the monitoring targets, starting the monitoring
+// services if needed. The target is added in the background.
+func (svc *Service) startMonitoring(ctx context.Context, info *metastore.ClusterInfo, containerName string) error {
+	e, err := engineFor(info.Type)
+	if err != nil {
+		return err
+	}
+	if svc.monitorRuntime == nil {
+		svc.monitorRuntime = monitor.NewRuntime(svc.dockerClient, monitor.WithLogger(svc.logger), monitor.WithAppConfig(svc.svcConfig),
+			monitor.WithStore(svc.store))
+		if err := svc.monitorRuntime.BootstrapServices(ctx); err != nil {
+			return errors.Wrap(err, "failed to start monitoring services")
 		}
-		go func(target *monitor.Target) {
-			// we use a background context since this is a goroutine and the orignal request
-			// might have been terminated.
-			if err := svc.addMonitorTarget(context.Background(), target); err != nil {
-				svc.logger.Error("could not monitor target", zap.Error(err))
-			}
-			return
-		}(target)
 	}
 
+	target := &monitor.Target{
+		ClusterID:     info.ClusterID,
+		ContainerName: containerName,
+		UserName:      info.Username,
+		Password:      info.Password,
+		Port:          info.Port,
+		Exporter:      e.Exporter(),
+		Type:          e.Type(),
+		ContainerPort: e.Port(),
+	}
+	go func(target *monitor.Target) {
+		// we use a background context since this is a goroutine and the orignal request
+		// might have been terminated.
+		if err := svc.addMonitorTarget(context.Background(), target); err != nil {
+			svc.logger.Error("could not monitor target", zap.Error(err))
+		}
+		return
+	}(target)
 	return nil
 }
 
@@ -135,29 +237,239 @@ func (svc *Service) addMonitorTarget(ctx context.Context, target *monitor.Target
 	return nil
 }
 
-// ListClusters list all clusters currently available
-func (svc Service) ListClusters(ctx context.Context) ([]metastore.ClusterInfo, error) {
-	clusters, err := metastore.AllClusters(svc.store)
+// ListClusters lists the clusters visible to the given user that match the filter. Admins see every cluster,
+// other users only their own.
+func (svc Service) ListClusters(ctx context.Context, user User, filter metastore.ClusterFilter) (metastore.ClusterPage, error) {
+	if !user.Admin {
+		if filter.Owner != "" && filter.Owner != user.ID {
+			return metastore.ClusterPage{Clusters: []metastore.ClusterInfo{}}, nil
+		}
+		filter.Owner = user.ID
+	}
+	page, err := metastore.ListClusters(svc.store, filter)
 	if err != nil {
-		return nil, err
+		return page, err
 	}
-	if len(clusters) < 1 {
-		clusters = []metastore.ClusterInfo{}
+	if len(page.Clusters) < 1 {
+		page.Clusters = []metastore.ClusterInfo{}
 	}
-	return clusters, nil
+	return page, nil
 }
 
-// GetClusterByID returns the specific cluster with the given ID, returns ErrNoMatch if no cluster was found.
-func (svc Service) GetClusterByID(ctx context.Context, clusterID string) (metastore.ClusterInfo, error) {
+// GetClusterByID returns the specific cluster with the given ID, returns ErrNoMatch if no cluster was found or
+// if the cluster isn't visible to the given user.
+func (svc Service) GetClusterByID(ctx context.Context, user User, clusterID string) (metastore.ClusterInfo, error) {
 	ci, err := metastore.GetClusterByID(svc.store, clusterID)
+	if errors.Is(err, metastore.ErrClusterNotFound) {
+		return ci, ErrNoMatch{
+			id: clusterID,
+		}
+	}
 	if err != nil {
 		return ci, err
 	}
-	if ci.ClusterID == "" && ci.Name == "" {
-		return ci, ErrNoMatch{
+	// clusters owned by other users are reported as missing so their existence isn't leaked.
+	if !user.owns(ci) {
+		return metastore.ClusterInfo{}, ErrNoMatch{
 			id: clusterID,
 		}
 	}
 
 	return ci, nil
 }
+
+// Resources holds the resources allocated to a cluster. CPU is in CPU shares, Memory and Disk are in megabytes.
+type Resources struct {
+	CPU    int64
+	Memory int64
+	Disk   int64
+}
+
+// ResizeCluster changes the resources allocated to a cluster. CPU and memory limits are applied to the running
+// container, disk is reserved for quota accounting. The user must own the cluster.
+func (svc Service) ResizeCluster(ctx context.Context, user User, clusterID string, resources Resources) (metastore.ClusterInfo, error) {
+	cluster, err := svc.GetClusterByID(ctx, user, clusterID)
+	if err != nil {
+		return cluster, err
+	}
+
+	resized := cluster
+	resized.CPU = resources.CPU
+	resized.Memory = resources.Memory
+	resized.Disk = resources.Disk
+	// resources are charged to the cluster owner, who may not be the user resizing it (e.g. an admin).
+	delta := clusterUsage(resized).sub(clusterUsage(cluster))
+	release, err := svc.quotas.reserve(svc.store, cluster.Owner, svc.svcConfig.QuotaFor(cluster.Owner), delta)
+	if err != nil {
+		return cluster, err
+	}
+	defer release()
+
+	name, err := containerName(cluster)
+	if err != nil {
+		return cluster, err
+	}
+	dbContainer, err := svc.dockerClient.GetContainer(ctx, name)
+	if err != nil {
+		return cluster, errors.Wrap(err, "getting cluster container")
+	}
+	if dbContainer == nil {
+		return cluster, errors.Errorf("no container found for cluster %s", clusterID)
+	}
+	if err := dbContainer.Update(ctx, svc.dockerClient, engine.Resources(resized.CPU, resized.Memory)); err != nil {
+		return cluster, errors.Wrap(err, "updating container resources")
+	}
+
+	if err := metastore.UpdateClusterResources(svc.store, clusterID, resized.CPU, resized.Memory, resized.Disk); err != nil {
+		return cluster, errors.Wrap(err, "saving cluster resources")
+	}
+	recordEvent(svc.store, svc.logger, metastore.Event{
+		ClusterID: clusterID,
+		Type:      metastore.EventResized,
+		Actor:     user.ID,
+		Details: map[string]string{
+			"cpu":    strconv.FormatInt(resized.CPU, 10),
+			"memory": strconv.FormatInt(resized.Memory, 10),
+			"disk":   strconv.FormatInt(resized.Disk, 10),
+		},
+	})
+	return resized, nil
+}
+
+// QuotaUsage returns the resources currently used by the user with the given ID, alongside their quota.
+func (svc Service) QuotaUsage(ctx context.Context, userID string) (QuotaReport, error) {
+	usage, err := storedUsage(svc.store, userID)
+	if err != nil {
+		return QuotaReport{}, err
+	}
+	return QuotaReport{
+		UserID: userID,
+		Usage:  usage,
+		Quota:  svc.svcConfig.QuotaFor(userID),
+	}, nil
+}
+
+// DeleteCluster removes a cluster's containers and data volume, stops monitoring it, and removes it from the
+// metastore. The user must own the cluster.
+func (svc Service) DeleteCluster(ctx context.Context, user User, clusterID string) error {
+	return svc.deleteCluster(ctx, user, clusterID, "")
+}
+
+// deleteCluster deletes a cluster, and records a deleted event giving the reason for the deletion, if any.
+func (svc Service) deleteCluster(ctx context.Context, user User, clusterID, reason string) error {
+	cluster, err := svc.GetClusterByID(ctx, user, clusterID)
+	if err != nil {
+		return err
+	}
+
+	e, err := engineFor(cluster.Type)
+	if err != nil {
+		return err
+	}
+	dbName := engine.ContainerName(e, cluster.Name)
+	for _, name := range []string{PREFIXBACKUPCONTAINER + dbName, dbName} {
+		c, err := svc.dockerClient.GetContainer(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "getting container %s", name)
+		}
+		if c == nil {
+			continue
+		}
+		if c.State == "running" {
+			if err := c.Stop(ctx, svc.dockerClient, types.ContainerStartOptions{}); err != nil {
+				return errors.Wrapf(err, "stopping container %s", name)
+			}
+		}
+		if err := c.Remove(ctx, svc.dockerClient); err != nil {
+			return errors.Wrapf(err, "removing container %s", name)
+		}
+	}
+	for _, volume := range clusterVolumes(cluster) {
+		if err := dockerservice.RemoveVolume(ctx, svc.dockerClient, volume); err != nil {
+			svc.logger.Warn("could not remove cluster volume", zap.String("volume", volume), zap.Error(err))
+		}
+	}
+
+	if svc.monitorRuntime != nil {
+		if e.Exporter() != nil {
+			err = svc.monitorRuntime.RemoveExporter(ctx, dbName)
+		} else {
+			err = svc.monitorRuntime.RemoveTarget(ctx, cluster.Port)
+		}
+		if err != nil {
+			svc.logger.Error("could not stop monitoring cluster", zap.String("cluster_id", clusterID), zap.Error(err))
+		}
+	}
+
+	if err := metastore.DeleteCluster(svc.store, clusterID); err != nil {
+		return errors.Wrap(err, "removing cluster from store")
+	}
+	// the owner is kept with the event, as it's needed to list the history of the deleted cluster.
+	event := metastore.Event{
+		ClusterID: clusterID,
+		Type:      metastore.EventDeleted,
+		Actor:     user.ID,
+		Details:   map[string]string{"name": cluster.Name, "owner": cluster.Owner},
+	}
+	if reason != "" {
+		event.Details["reason"] = reason
+	}
+	recordEvent(svc.store, svc.logger, event)
+	svc.logger.Info("deleted cluster", zap.String("cluster_id", clusterID), zap.String("user", user.ID))
+	return nil
+}
+
+// clusterVolumes returns the volumes to remove along with a cluster. Clusters saved before their volumes were recorded
+// were all created or restored by spinup, and have a volume named after them, plus one holding wal-g when restored.
+func clusterVolumes(cluster metastore.ClusterInfo) []string {
+	if cluster.DataMount == "" {
+		return []string{cluster.Name, walgVolume(cluster.Name)}
+	}
+	return cluster.Volumes
+}
+
+// ExtendCluster changes the time at which a cluster expires. A nil expiry makes the cluster permanent.
+// The user must own the cluster.
+func (svc Service) ExtendCluster(ctx context.Context, user User, clusterID string, expiresAt *time.Time) (metastore.ClusterInfo, error) {
+	cluster, err := svc.GetClusterByID(ctx, user, clusterID)
+	if err != nil {
+		return cluster, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return cluster, ErrInvalidExpiry
+	}
+	if err := metastore.UpdateClusterExpiry(svc.store, clusterID, expiresAt); err != nil {
+		return cluster, errors.Wrap(err, "saving cluster expiry")
+	}
+	return svc.GetClusterByID(ctx, user, clusterID)
+}
+
+func validateIdleTimeout(timeout time.Duration) error {
+	if timeout != 0 && timeout < MinIdleTimeout {
+		return ErrInvalidIdleTimeout
+	}
+	return nil
+}
+
+// SetIdlePolicy changes how long a cluster can go without client connections before it is stopped. A zero timeout
+// disables the policy; a cluster that is idle at that point is still started on the next connection.
+func (svc Service) SetIdlePolicy(ctx context.Context, user User, clusterID string, timeout time.Duration) (metastore.ClusterInfo, error) {
+	cluster, err := svc.GetClusterByID(ctx, user, clusterID)
+	if err != nil {
+		return cluster, err
+	}
+	if err := validateIdleTimeout(timeout); err != nil {
+		return cluster, err
+	}
+	e, err := engineFor(cluster.Type)
+	if err != nil {
+		return cluster, err
+	}
+	if err := validateIdleEngine(e, timeout); err != nil {
+		return cluster, err
+	}
+	if err := metastore.UpdateIdleTimeout(svc.store, clusterID, int64(timeout/time.Second)); err != nil {
+		return cluster, errors.Wrap(err, "saving cluster idle timeout")
+	}
+	return svc.GetClusterByID(ctx, user, clusterID)
+}
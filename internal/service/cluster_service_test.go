@@ -24,12 +24,14 @@ import (
 var (
 	maxPort = 60000
 	minPort = 10000
+
+	testUser = User{ID: "testuser"}
 )
 
 func TestCreateService(t *testing.T) {
 	testID := uuid.New().String()
 	ctx := context.Background()
-	dc, err := tests.NewDockerTest(ctx, testID)
+	dc, err := tests.NewMemoryDockerTest(ctx, testID)
 	require.NoError(t, err)
 
 	store, path, err := newTestStore(testID)
@@ -44,29 +46,8 @@ func TestCreateService(t *testing.T) {
 	})
 
 	rand.Seed(time.Now().UnixNano())
-	cfg := config.Configuration{
-		Common: struct {
-			Architecture string `yaml:"architecture"`
-			ProjectDir   string `yaml:"projectDir"`
-			Ports        []int  `yaml:"ports"`
-			ClientID     string `yaml:"client_id"`
-			ClientSecret string `yaml:"client_secret"`
-			ApiKey       string `yaml:"api_key"`
-			LogDir       string `yaml:"log_dir"`
-			LogFile      string `yaml:"log_file"`
-			Monitoring   bool   `yaml:"monitoring"`
-		}(struct {
-			Architecture string
-			ProjectDir   string
-			Ports        []int
-			ClientID     string
-			ClientSecret string
-			ApiKey       string
-			LogDir       string
-			LogFile      string
-			Monitoring   bool
-		}{ProjectDir: os.TempDir()}),
-	}
+	cfg := config.Configuration{}
+	cfg.Common.ProjectDir = os.TempDir()
 	rt := monitor.NewRuntime(dc.Docker, monitor.WithLogger(logger), monitor.WithAppConfig(cfg))
 	svc := NewService(dc.Docker, store, rt, logger, cfg)
 
@@ -84,7 +65,7 @@ func TestCreateService(t *testing.T) {
 			MajVersion:   13,
 			MinVersion:   6,
 		}
-		err = svc.CreateService(ctx, info)
+		err = svc.CreateService(ctx, testUser, info)
 		assert.NoError(t, err)
 
 		pg, err := svc.dockerClient.GetContainer(ctx, "spinup-postgres-"+containerName)
@@ -115,7 +96,7 @@ func TestCreateService(t *testing.T) {
 		currentExporter, err := svc.dockerClient.GetContainer(ctx, exporterName)
 		assert.NoError(t, err)
 
-		err = svc.CreateService(ctx, info)
+		err = svc.CreateService(ctx, testUser, info)
 		assert.NoError(t, err)
 
 		pgC, err := svc.dockerClient.GetContainer(ctx, "spinup-postgres-"+containerName)
@@ -143,6 +124,57 @@ func TestCreateService(t *testing.T) {
 	})
 }
 
+func TestClusterOwnership(t *testing.T) {
+	testID := uuid.New().String()
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	svc := NewService(ds.Docker{}, store, nil, logger, config.Configuration{})
+
+	owned := metastore.ClusterInfo{ClusterID: "owned-" + testID, Name: "owned", Owner: testUser.ID}
+	foreign := metastore.ClusterInfo{ClusterID: "foreign-" + testID, Name: "foreign", Owner: "otheruser"}
+	require.NoError(t, metastore.InsertService(store, owned))
+	require.NoError(t, metastore.InsertService(store, foreign))
+
+	ctx := context.Background()
+	t.Run("users only see their clusters", func(t *testing.T) {
+		page, err := svc.ListClusters(ctx, testUser, metastore.ClusterFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Clusters, 1)
+		assert.Equal(t, owned.ClusterID, page.Clusters[0].ClusterID)
+
+		page, err = svc.ListClusters(ctx, testUser, metastore.ClusterFilter{Owner: "otheruser"})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Clusters)
+
+		_, err = svc.GetClusterByID(ctx, testUser, owned.ClusterID)
+		assert.NoError(t, err)
+
+		_, err = svc.GetClusterByID(ctx, testUser, foreign.ClusterID)
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+	})
+
+	t.Run("admins see all clusters", func(t *testing.T) {
+		admin := User{ID: "admin", Admin: true}
+		page, err := svc.ListClusters(ctx, admin, metastore.ClusterFilter{})
+		assert.NoError(t, err)
+		assert.Len(t, page.Clusters, 2)
+
+		page, err = svc.ListClusters(ctx, admin, metastore.ClusterFilter{Owner: "otheruser"})
+		assert.NoError(t, err)
+		assert.Len(t, page.Clusters, 1)
+
+		ci, err := svc.GetClusterByID(ctx, admin, foreign.ClusterID)
+		assert.NoError(t, err)
+		assert.Equal(t, "otheruser", ci.Owner)
+	})
+}
+
 func newTestStore(name string) (metastore.Db, string, error) {
 	db := metastore.Db{}
 	tmpDir, err := os.MkdirTemp("", "")
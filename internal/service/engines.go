@@ -0,0 +1,95 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/mysql"
+	"github.com/spinup-host/spinup/internal/postgres"
+	"github.com/spinup-host/spinup/internal/redis"
+)
+
+// engines holds the supported database engines, keyed by cluster type.
+var engines = map[string]engine.Engine{
+	"postgres": postgres.Engine{},
+	"mysql":    mysql.Engine{},
+	"mariadb":  mysql.Engine{MariaDB: true},
+	"redis":    redis.Engine{},
+}
+
+// ErrUnsupportedEngine is returned for clusters of a type spinup has no engine for, and for operations that the
+// engine of a cluster doesn't support.
+type ErrUnsupportedEngine struct {
+	Type string
+	// Operation is set when the type is supported, but not for the operation, e.g. "backups".
+	Operation string
+}
+
+func (e ErrUnsupportedEngine) Error() string {
+	if e.Operation != "" {
+		return fmt.Sprintf("%s are not supported for %s clusters", e.Operation, e.Type)
+	}
+	return fmt.Sprintf("unsupported database type '%s', expected one of %s", e.Type, strings.Join(EngineTypes(), ", "))
+}
+
+// EngineTypes returns the supported cluster types.
+func EngineTypes() []string {
+	types := make([]string, 0, len(engines))
+	for t := range engines {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// engineFor returns the engine of the given cluster type. Clusters saved before the type was recorded are postgres
+// clusters.
+func engineFor(clusterType string) (engine.Engine, error) {
+	if clusterType == "" {
+		clusterType = "postgres"
+	}
+	e, ok := engines[clusterType]
+	if !ok {
+		return nil, ErrUnsupportedEngine{Type: clusterType}
+	}
+	return e, nil
+}
+
+// containerName returns the name of the container running the cluster.
+func containerName(cluster metastore.ClusterInfo) (string, error) {
+	e, err := engineFor(cluster.Type)
+	if err != nil {
+		return "", err
+	}
+	return engine.ContainerName(e, cluster.Name), nil
+}
+
+// requirePostgres returns an error unless the cluster is a postgres cluster, for the operations only postgres
+// clusters support.
+func requirePostgres(cluster metastore.ClusterInfo, operation string) error {
+	if cluster.Type != "" && cluster.Type != "postgres" {
+		return ErrUnsupportedEngine{Type: cluster.Type, Operation: operation}
+	}
+	return nil
+}
+
+// validateIdleEngine returns an error when a cluster of the given type is given an idle timeout but its engine can't
+// count client connections.
+// validateCredentials checks the credentials of a new cluster against the requirements of its engine.
+func validateCredentials(e engine.Engine, username, password string) error {
+	if v, ok := e.(engine.CredentialsValidator); ok {
+		return v.ValidateCredentials(username, password)
+	}
+	return nil
+}
+
+func validateIdleEngine(e engine.Engine, timeout time.Duration) error {
+	if _, ok := e.(engine.ConnectionCounter); !ok && timeout > 0 {
+		return ErrUnsupportedEngine{Type: e.Type(), Operation: "idle policies"}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/monitor"
+	"github.com/spinup-host/spinup/tests"
+)
+
+func TestEngines(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	dc, err := tests.NewMemoryDockerTest(ctx, testID)
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+		assert.NoError(t, dc.Cleanup())
+	})
+
+	cfg := config.Configuration{}
+	cfg.Common.ProjectDir = t.TempDir()
+	rt := monitor.NewRuntime(dc.Docker, monitor.WithLogger(logger), monitor.WithAppConfig(cfg))
+	require.NoError(t, rt.BootstrapServices(ctx))
+	svc := NewService(dc.Docker, store, rt, logger, cfg)
+
+	newInfo := func(clusterType string) *metastore.ClusterInfo {
+		return &metastore.ClusterInfo{
+			Type:       clusterType,
+			Host:       "localhost",
+			Name:       "test-db-" + uuid.New().String(),
+			Port:       rand.Intn(maxPort-minPort) + minPort,
+			Username:   "test",
+			Password:   "test",
+			MajVersion: 7,
+			MinVersion: 0,
+		}
+	}
+
+	for _, clusterType := range []string{"mysql", "mariadb", "redis"} {
+		clusterType := clusterType
+		t.Run(clusterType, func(t *testing.T) {
+			info := newInfo(clusterType)
+			info.Monitoring = "enable"
+			require.NoError(t, svc.CreateService(ctx, testUser, info))
+
+			e := engines[clusterType]
+			assert.Equal(t, e.Image(7, 0), info.Image)
+			db, err := svc.dockerClient.GetContainer(ctx, "spinup-"+clusterType+"-"+info.Name)
+			require.NoError(t, err)
+			require.NotNil(t, db)
+			assert.Equal(t, "running", db.State)
+			assert.Equal(t, e.Env("test", "test"), db.Config.Env)
+
+			// monitoring is set up in the background.
+			exporterName := monitor.ExporterName(db.Name)
+			assert.Eventually(t, func() bool {
+				exporter, err := svc.dockerClient.GetContainer(ctx, exporterName)
+				return err == nil && exporter != nil && exporter.State == "running"
+			}, 5*time.Second, 50*time.Millisecond)
+
+			_, err = svc.SetIdlePolicy(ctx, testUser, info.ClusterID, time.Hour)
+			assert.True(t, errors.As(err, &ErrUnsupportedEngine{}), "got %v", err)
+			_, err = svc.ExportCluster(ctx, testUser, info.ClusterID, "compose")
+			assert.True(t, errors.As(err, &ErrUnsupportedEngine{}), "got %v", err)
+
+			require.NoError(t, svc.DeleteCluster(ctx, testUser, info.ClusterID))
+			for _, name := range []string{db.Name, exporterName} {
+				c, err := svc.dockerClient.GetContainer(ctx, name)
+				assert.NoError(t, err)
+				assert.Nil(t, c, name)
+			}
+		})
+	}
+
+	t.Run("cluster names are unique across engines", func(t *testing.T) {
+		info := newInfo("mysql")
+		require.NoError(t, svc.CreateService(ctx, testUser, info))
+		t.Cleanup(func() {
+			assert.NoError(t, svc.DeleteCluster(ctx, testUser, info.ClusterID))
+		})
+
+		other := newInfo("redis")
+		other.Name = info.Name
+		err := svc.CreateService(ctx, testUser, other)
+		assert.ErrorIs(t, err, ds.ErrDuplicateContainerName)
+		c, err := svc.dockerClient.GetContainer(ctx, "spinup-redis-"+info.Name)
+		require.NoError(t, err)
+		assert.Nil(t, c)
+
+		// the volume of a cluster isn't handed over to another engine.
+		_, err = engine.NewContainer(svc.dockerClient, engines["redis"], engine.ContainerProps{Name: info.Name, Port: other.Port})
+		assert.ErrorAs(t, err, &engine.ErrVolumeInUse{})
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		err := svc.CreateService(ctx, testUser, newInfo("oracle"))
+		assert.EqualError(t, err, "unsupported database type 'oracle', expected one of mariadb, mysql, postgres, redis")
+	})
+
+	t.Run("redis needs a password", func(t *testing.T) {
+		info := newInfo("redis")
+		info.Password = ""
+		err := svc.CreateService(ctx, testUser, info)
+		assert.ErrorAs(t, err, &engine.ErrInvalidCredentials{})
+		c, err := svc.dockerClient.GetContainer(ctx, "spinup-redis-"+info.Name)
+		require.NoError(t, err)
+		assert.Nil(t, c)
+	})
+
+	t.Run("idle timeout needs connection counting", func(t *testing.T) {
+		info := newInfo("redis")
+		info.IdleTimeout = int64(time.Hour / time.Second)
+		err := svc.CreateService(ctx, testUser, info)
+		assert.EqualError(t, err, "idle policies are not supported for redis clusters")
+	})
+}
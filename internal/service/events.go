@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+// recordEvent adds an event to the history of a cluster. The history is informational, so an event that can't be
+// recorded is logged rather than failing the change it describes.
+func recordEvent(store metastore.Db, logger *zap.Logger, event metastore.Event) {
+	if err := metastore.InsertEvent(store, event); err != nil {
+		logger.Error("could not record cluster event",
+			zap.String("cluster_id", event.ClusterID),
+			zap.String("type", event.Type),
+			zap.Error(err),
+		)
+	}
+}
+
+// ListEvents returns the history of the cluster with the given ID, oldest first. The user must own the cluster, and
+// still can list its history once it's deleted.
+func (svc Service) ListEvents(ctx context.Context, user User, clusterID string, filter metastore.EventFilter) (metastore.EventPage, error) {
+	if _, err := svc.GetClusterByID(ctx, user, clusterID); err != nil {
+		deleted, ok, lastErr := metastore.LastEvent(svc.store, clusterID, metastore.EventDeleted)
+		if lastErr != nil || !ok || !user.owns(metastore.ClusterInfo{Owner: deleted.Details["owner"]}) {
+			return metastore.EventPage{}, err
+		}
+	}
+	filter.ClusterID = clusterID
+	return metastore.ListEvents(svc.store, filter)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/monitor"
+)
+
+func TestClusterEvents(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	rt := ds.NewMemoryRuntime()
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	cfg := config.Configuration{}
+	cfg.Common.ProjectDir = t.TempDir()
+	mr := monitor.NewRuntime(dc, monitor.WithLogger(logger), monitor.WithAppConfig(cfg), monitor.WithStore(store))
+	require.NoError(t, mr.BootstrapServices(ctx))
+	svc := NewService(dc, store, mr, logger, cfg)
+
+	info := &metastore.ClusterInfo{
+		Type:       "redis",
+		Name:       "events-" + testID,
+		Port:       rand.Intn(maxPort-minPort) + minPort,
+		Username:   "test",
+		Password:   "test",
+		MajVersion: 7,
+		Monitoring: "enable",
+	}
+	require.NoError(t, svc.CreateService(ctx, testUser, info))
+	_, err = svc.ResizeCluster(ctx, testUser, info.ClusterID, Resources{CPU: 512, Memory: 256})
+	require.NoError(t, err)
+
+	eventTypes := func() []string {
+		page, err := svc.ListEvents(ctx, testUser, info.ClusterID, metastore.EventFilter{})
+		require.NoError(t, err)
+		var types []string
+		for _, event := range page.Events {
+			types = append(types, event.Type)
+		}
+		return types
+	}
+
+	t.Run("lifecycle changes are recorded", func(t *testing.T) {
+		// monitoring is set up in the background.
+		assert.Eventually(t, func() bool {
+			return len(eventTypes()) == 3
+		}, 5*time.Second, 50*time.Millisecond)
+		assert.ElementsMatch(t, []string{metastore.EventCreated, metastore.EventResized, metastore.EventMonitoringAttached}, eventTypes())
+
+		page, err := svc.ListEvents(ctx, testUser, info.ClusterID, metastore.EventFilter{Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, page.Events, 1)
+		assert.Equal(t, metastore.EventCreated, page.Events[0].Type)
+		assert.Equal(t, testUser.ID, page.Events[0].Actor)
+		assert.Equal(t, "redis", page.Events[0].Details["type"])
+		assert.NotEmpty(t, page.NextCursor)
+	})
+
+	t.Run("container deaths are recorded once", func(t *testing.T) {
+		c, err := dc.GetContainer(ctx, "spinup-redis-"+info.Name)
+		require.NoError(t, err)
+		require.NoError(t, rt.Exit(c.ID, 137))
+
+		w := NewContainerWatcher(svc)
+		w.check(ctx)
+		w.check(ctx)
+		// spinup was restarted.
+		NewContainerWatcher(svc).check(ctx)
+		page, err := svc.ListEvents(ctx, testUser, info.ClusterID, metastore.EventFilter{})
+		require.NoError(t, err)
+		last := page.Events[len(page.Events)-1]
+		assert.Equal(t, metastore.EventContainerDied, last.Type)
+		assert.Equal(t, "137", last.Details["exit_code"])
+		assert.Len(t, page.Events, 4)
+	})
+
+	t.Run("containers stopped by spinup aren't recorded as dead", func(t *testing.T) {
+		c, err := dc.GetContainer(ctx, "spinup-redis-"+info.Name)
+		require.NoError(t, err)
+		require.NoError(t, c.StartExisting(ctx, dc))
+		require.NoError(t, metastore.UpdateClusterStatus(store, info.ClusterID, metastore.StatusStopping))
+		require.NoError(t, rt.Exit(c.ID, 0))
+
+		NewContainerWatcher(svc).check(ctx)
+		page, err := svc.ListEvents(ctx, testUser, info.ClusterID, metastore.EventFilter{})
+		require.NoError(t, err)
+		assert.Len(t, page.Events, 4)
+	})
+
+	t.Run("events of clusters owned by other users are not found", func(t *testing.T) {
+		_, err := svc.ListEvents(ctx, User{ID: "someone-else"}, info.ClusterID, metastore.EventFilter{})
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+	})
+
+	t.Run("deleted clusters keep their history", func(t *testing.T) {
+		require.NoError(t, svc.DeleteCluster(ctx, testUser, info.ClusterID))
+		page, err := svc.ListEvents(ctx, testUser, info.ClusterID, metastore.EventFilter{})
+		require.NoError(t, err)
+		require.Len(t, page.Events, 5)
+		last := page.Events[len(page.Events)-1]
+		assert.Equal(t, metastore.EventDeleted, last.Type)
+		assert.Equal(t, testUser.ID, last.Actor)
+		assert.Equal(t, info.Name, last.Details["name"])
+		assert.NotContains(t, last.Details, "reason")
+
+		_, err = svc.ListEvents(ctx, User{ID: "someone-else"}, info.ClusterID, metastore.EventFilter{})
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+	})
+
+	t.Run("expired clusters are deleted by spinup", func(t *testing.T) {
+		expiring := &metastore.ClusterInfo{
+			Type:       "redis",
+			Name:       "expiring-" + testID,
+			Port:       rand.Intn(maxPort-minPort) + minPort,
+			Username:   "test",
+			Password:   "test",
+			MajVersion: 7,
+		}
+		require.NoError(t, svc.CreateService(ctx, testUser, expiring))
+		require.NoError(t, NewReaper(svc).deleteCluster(ctx, expiring.ClusterID))
+
+		event, ok, err := metastore.LastEvent(store, expiring.ClusterID, metastore.EventDeleted)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, systemUser.ID, event.Actor)
+		assert.Equal(t, "expired", event.Details["reason"])
+	})
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/pkg/errors"
+
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/internal/export"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/monitor"
+	"github.com/spinup-host/spinup/internal/postgres"
+)
+
+// ExportCluster renders the cluster with the given ID in the given export format (export.FormatCompose or
+// export.FormatKubernetes). The user must own the cluster.
+func (svc Service) ExportCluster(ctx context.Context, user User, clusterID, format string) ([]byte, error) {
+	cluster, err := svc.GetClusterByID(ctx, user, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requirePostgres(cluster, "exports"); err != nil {
+		return nil, err
+	}
+	spec, err := svc.exportSpec(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return export.Render(format, spec)
+}
+
+// exportSpec describes the cluster for export. The metastore has the cluster's settings, which are refined with
+// what its containers actually run when they exist.
+func (svc Service) exportSpec(ctx context.Context, cluster metastore.ClusterInfo) (export.Cluster, error) {
+	spec := export.Cluster{
+		Name:  cluster.Name,
+		Image: cluster.Image,
+		Port:  cluster.Port,
+		Env: map[string]string{
+			"POSTGRES_USER":     cluster.Username,
+			"POSTGRES_PASSWORD": cluster.Password,
+		},
+		Volume:    cluster.Name,
+		CPUShares: cluster.CPU,
+		Memory:    engine.Resources(cluster.CPU, cluster.Memory).Memory,
+		Disk:      cluster.Disk,
+		Labels:    cluster.Labels,
+	}
+
+	pgContainer, err := svc.dockerClient.GetContainer(ctx, postgres.PREFIXPGCONTAINER+cluster.Name)
+	if err != nil {
+		return spec, errors.Wrap(err, "getting cluster container")
+	}
+	if pgContainer != nil {
+		data, err := svc.dockerClient.Cli.ContainerInspect(ctx, pgContainer.ID)
+		if err != nil {
+			return spec, errors.Wrap(err, "inspecting cluster container")
+		}
+		// the image is exported as requested rather than through the registry mirror, which the platform the cluster
+		// is exported to may not use. Clusters created before the image was recorded use the container's image.
+		if spec.Image == "" {
+			spec.Image = data.Config.Image
+		}
+		for _, env := range data.Config.Env {
+			// other variables come from the image.
+			if key, value, ok := strings.Cut(env, "="); ok && (strings.HasPrefix(key, "POSTGRES_") || key == "PGDATA") {
+				spec.Env[key] = value
+			}
+		}
+		for _, binding := range data.HostConfig.PortBindings["5432/tcp"] {
+			// clusters stopped by their idle policy are published on the loopback interface and reached through spinup.
+			if binding.HostIP == "127.0.0.1" {
+				continue
+			}
+			fmt.Sscanf(binding.HostPort, "%d", &spec.Port)
+		}
+		spec.CPUShares = data.HostConfig.CPUShares
+		spec.Memory = data.HostConfig.Memory
+		for _, m := range data.Mounts {
+			switch {
+			case cluster.DataMount == "":
+				// clusters saved before their data mount was recorded have their data on a volume mounted at the
+				// usual place.
+				if m.Type == mount.TypeVolume && strings.TrimSuffix(m.Destination, "/") == strings.TrimSuffix(postgres.PGDATADIR, "/") {
+					spec.Volume = m.Name
+				}
+			case m.Type == mount.TypeVolume && m.Name == cluster.DataMount, m.Type == mount.TypeBind && m.Source == cluster.DataMount:
+				spec.DataDir = m.Destination
+			}
+		}
+	}
+	// the data mount is a volume name, or the absolute host path of a bind mount for some adopted clusters.
+	if path.IsAbs(cluster.DataMount) {
+		spec.Volume, spec.HostPath = "", cluster.DataMount
+	} else if cluster.DataMount != "" {
+		spec.Volume = cluster.DataMount
+	}
+
+	if spec.Image == "" {
+		e, err := engineFor(cluster.Type)
+		if err != nil {
+			return spec, err
+		}
+		spec.Image = e.Image(cluster.MajVersion, cluster.MinVersion)
+	}
+
+	exporter, err := svc.dockerClient.GetContainer(ctx, monitor.ExporterContainerName(svc.dockerClient.NetworkName))
+	if err != nil {
+		return spec, errors.Wrap(err, "getting exporter container")
+	}
+	if exporter != nil {
+		dsn, err := exporter.GetEnv(ctx, svc.dockerClient, monitor.DsnKey)
+		if err == nil && monitor.MonitorsPort(dsn, cluster.Port) {
+			spec.Exporter = &export.Exporter{Image: exporter.Config.Image}
+		}
+	}
+
+	schedule, ok, err := metastore.GetBackupSchedule(svc.store, cluster.ClusterID)
+	if err != nil {
+		return spec, errors.Wrap(err, "getting backup schedule")
+	}
+	if ok {
+		if schedule.Spec == "" {
+			// schedules saved by older versions of spinup only have the schedule fields.
+			legacy, _, err := metastore.GetBackup(svc.store, cluster.ClusterID)
+			if err != nil {
+				return spec, errors.Wrap(err, "getting backup schedule")
+			}
+			schedule.Spec = storedScheduleToCron(legacy.Schedule)
+		}
+		spec.Backup = exportBackup(schedule)
+	}
+	return spec, nil
+}
+
+// exportBackup describes a backup schedule for export, with the wal-g settings of its destination. Credentials are
+// left out, to be filled in where the cluster is exported to. Destinations that wal-g only reaches through files on
+// the spinup host can't be exported.
+func exportBackup(schedule metastore.BackupSchedule) *export.Backup {
+	backup := &export.Backup{Image: WalgImage, Schedule: schedule.Spec}
+	switch schedule.Dest.Type {
+	case metastore.DestinationS3:
+		backup.Secrets = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"}
+	case metastore.DestinationAzure:
+		backup.Secrets = []string{"AZURE_STORAGE_ACCESS_KEY"}
+	case metastore.DestinationGCS:
+		backup.Unsupported = fmt.Sprintf("wal-g reads the service account key of the gcs destination gs://%s from a file",
+			path.Join(schedule.Dest.BucketName, schedule.Dest.Path))
+		return backup
+	case metastore.DestinationFile:
+		backup.Unsupported = fmt.Sprintf("the file destination %s is a directory of the spinup host", schedule.Dest.Path)
+		return backup
+	default:
+		backup.Unsupported = fmt.Sprintf("the destination type '%s' is unknown", schedule.Dest.Type)
+		return backup
+	}
+	backup.Env = walgConfig(schedule.Dest)
+	for _, key := range backup.Secrets {
+		delete(backup.Env, key)
+	}
+	return backup
+}
+
+// storedScheduleToCron returns the cron expression of a backup schedule read from the metastore. The metastore stores
+// a zero for fields that were unset, which for the day of month and month can only mean every day and every month.
+// For the day of week it could also mean Sunday, but every day is the most common schedule.
+func storedScheduleToCron(schedule map[string]interface{}) string {
+	for _, field := range []string{"dom", "month", "dow"} {
+		if schedule[field] == "0" {
+			schedule[field] = "*"
+		}
+	}
+	return strings.TrimSpace(scheduleToCronExpr(schedule))
+}
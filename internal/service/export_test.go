@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/export"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/monitor"
+	"github.com/spinup-host/spinup/tests"
+)
+
+func TestExportCluster(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	dc, err := tests.NewMemoryDockerTest(ctx, testID)
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+		assert.NoError(t, dc.Cleanup())
+	})
+
+	cfg := config.Configuration{}
+	cfg.Common.ProjectDir = os.TempDir()
+	rt := monitor.NewRuntime(dc.Docker, monitor.WithLogger(logger), monitor.WithAppConfig(cfg))
+	require.NoError(t, rt.BootstrapServices(ctx))
+	svc := NewService(dc.Docker, store, rt, logger, cfg)
+
+	info := &metastore.ClusterInfo{
+		Architecture: "amd64",
+		Type:         "postgres",
+		Host:         "localhost",
+		Name:         "export-" + testID,
+		Port:         15432,
+		Username:     "test",
+		Password:     "secret",
+		MajVersion:   14,
+		MinVersion:   5,
+		CPU:          512,
+		Memory:       256,
+		Labels:       map[string]string{"env": "staging"},
+	}
+	require.NoError(t, svc.CreateService(ctx, testUser, info))
+	require.NoError(t, rt.AddTarget(ctx, &monitor.Target{UserName: "test", Password: "secret", Port: info.Port}))
+	dest := metastore.Destination{Type: metastore.DestinationS3, BucketName: "backups", Path: "spinup", Endpoint: "http://minio:9000",
+		ApiKeyID: "key-id", ApiKeySecret: "key-secret"}
+	require.NoError(t, metastore.SetBackupSchedule(store, info.ClusterID, "30 2 * * *", dest))
+
+	t.Run("docker compose", func(t *testing.T) {
+		data, err := svc.ExportCluster(ctx, testUser, info.ClusterID, export.FormatCompose)
+		require.NoError(t, err)
+
+		var file struct {
+			Services map[string]struct {
+				Image       string            `yaml:"image"`
+				Environment map[string]string `yaml:"environment"`
+				Ports       []string          `yaml:"ports"`
+				CPUShares   int64             `yaml:"cpu_shares"`
+				MemLimit    int64             `yaml:"mem_limit"`
+			} `yaml:"services"`
+			Volumes map[string]struct {
+				Name string `yaml:"name"`
+			} `yaml:"volumes"`
+		}
+		require.NoError(t, yaml.Unmarshal(data, &file))
+		pg := file.Services["postgres"]
+		assert.Equal(t, info.Image, pg.Image)
+		assert.Equal(t, "test", pg.Environment["POSTGRES_USER"])
+		assert.Equal(t, "secret", pg.Environment["POSTGRES_PASSWORD"])
+		assert.Equal(t, []string{"15432:5432"}, pg.Ports)
+		assert.Equal(t, int64(512), pg.CPUShares)
+		assert.NotZero(t, pg.MemLimit)
+		assert.NotEmpty(t, file.Volumes["data"].Name)
+		assert.Contains(t, file.Services, "postgres-exporter")
+		backup := file.Services["backup"].Environment
+		assert.Equal(t, "s3://backups/spinup", backup["WALG_S3_PREFIX"])
+		assert.Equal(t, "http://minio:9000", backup["AWS_ENDPOINT"])
+		assert.Equal(t, "${AWS_SECRET_ACCESS_KEY}", backup["AWS_SECRET_ACCESS_KEY"])
+		assert.NotContains(t, string(data), "key-secret", "credentials are placeholders")
+		assert.Contains(t, string(data), "schedule '30 2 * * *'")
+	})
+
+	t.Run("kubernetes", func(t *testing.T) {
+		data, err := svc.ExportCluster(ctx, testUser, info.ClusterID, export.FormatKubernetes)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "kind: StatefulSet")
+		assert.Contains(t, string(data), "kind: CronJob")
+		assert.Contains(t, string(data), "s3://backups/spinup")
+		assert.NotContains(t, string(data), "key-secret")
+	})
+
+	t.Run("schedules of older versions", func(t *testing.T) {
+		require.NoError(t, metastore.InsertBackup(store,
+			"insert into backup(clusterId, destination, bucket, second, minute, hour, dom, month, dow) values(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			info.ClusterID, "AWS", "legacy", 0, 15, 4, 0, 0, 0))
+		data, err := svc.ExportCluster(ctx, testUser, info.ClusterID, export.FormatCompose)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "schedule '15 4 * * *'")
+		assert.Contains(t, string(data), "WALG_S3_PREFIX: s3://legacy")
+	})
+
+	t.Run("destinations that can't be exported", func(t *testing.T) {
+		file := metastore.Destination{Type: metastore.DestinationFile, Path: "/srv/backups"}
+		require.NoError(t, metastore.SetBackupSchedule(store, info.ClusterID, "30 2 * * *", file))
+		data, err := svc.ExportCluster(ctx, testUser, info.ClusterID, export.FormatKubernetes)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "kind: CronJob")
+		assert.Contains(t, string(data), "the file destination /srv/backups is a directory of the spinup host")
+	})
+
+	t.Run("clusters owned by other users are not found", func(t *testing.T) {
+		_, err := svc.ExportCluster(ctx, User{ID: "otheruser"}, info.ClusterID, export.FormatCompose)
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+	})
+
+	t.Run("adopted clusters keep their bind mounted data", func(t *testing.T) {
+		require.NoError(t, dc.PullImage(ctx, "postgres:14.5"))
+		created, err := dc.Cli.ContainerCreate(ctx,
+			&container.Config{Image: "postgres:14.5", Env: []string{"POSTGRES_PASSWORD=secret", "PG_VERSION=14.5", "PGDATA=/pgdata/14"}},
+			&container.HostConfig{
+				PortBindings: nat.PortMap{"5432/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "15437"}}},
+				Mounts:       []mount.Mount{{Type: mount.TypeBind, Source: "/srv/pgdata", Target: "/pgdata"}},
+			}, nil, nil, "adopted-"+testID)
+		require.NoError(t, err)
+		require.NoError(t, dc.Cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}))
+		require.NoError(t, svc.AdoptCluster(ctx, testUser, created.ID, &metastore.ClusterInfo{}))
+
+		data, err := svc.ExportCluster(ctx, testUser, created.ID, export.FormatCompose)
+		require.NoError(t, err)
+		var file struct {
+			Services map[string]struct {
+				Environment map[string]string `yaml:"environment"`
+				Volumes     []string          `yaml:"volumes"`
+			} `yaml:"services"`
+			Volumes map[string]interface{} `yaml:"volumes"`
+		}
+		require.NoError(t, yaml.Unmarshal(data, &file))
+		pg := file.Services["postgres"]
+		assert.Equal(t, []string{"/srv/pgdata:/pgdata"}, pg.Volumes)
+		assert.Equal(t, "/pgdata/14", pg.Environment["PGDATA"])
+		assert.Empty(t, file.Volumes)
+
+		data, err = svc.ExportCluster(ctx, testUser, created.ID, export.FormatKubernetes)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "path: /srv/pgdata")
+		assert.NotContains(t, string(data), "kind: PersistentVolumeClaim")
+	})
+
+	t.Run("unknown formats are rejected", func(t *testing.T) {
+		_, err := svc.ExportCluster(ctx, testUser, info.ClusterID, "helm")
+		assert.ErrorIs(t, err, export.ErrUnknownFormat)
+	})
+}
@@ -0,0 +1,657 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/monitor"
+)
+
+const (
+	defaultIdleCheckInterval = time.Minute
+	defaultWakeTimeout       = time.Minute
+)
+
+// IdleManager stops clusters that have had no client connections for longer than their idle timeout, and starts
+// them again when a client connects. A cluster stopped by its idle policy is fronted by spinup: its container is
+// recreated with its port published on the loopback interface only, and spinup listens on the cluster's port instead.
+// The first connection starts the cluster; connections are held until the database accepts connections, and every
+// connection is then proxied to the container. Clusters stay fronted while they have an idle policy. Once the policy
+// is removed, their port is published again, which restarts them if they are running.
+type IdleManager struct {
+	store        metastore.Db
+	dockerClient dockerservice.Docker
+	interval     time.Duration
+	wakeTimeout  time.Duration
+	logger       *zap.Logger
+
+	// connections returns the number of client connections to a running cluster.
+	connections func(ctx context.Context, cluster metastore.ClusterInfo) (int, error)
+	// scaleDown stops an idle cluster and fronts it.
+	scaleDown func(ctx context.Context, cluster metastore.ClusterInfo) error
+	// wake starts a fronted cluster, waits until it accepts connections, and returns the address it's reachable at.
+	wake func(ctx context.Context, cluster metastore.ClusterInfo) (string, error)
+	// backend returns the address a fronted cluster is reachable at, or an empty address if it isn't fronted.
+	backend func(ctx context.Context, cluster metastore.ClusterInfo) (string, error)
+	// publish publishes the port of a fronted cluster again, restarting the cluster if it's running.
+	publish func(ctx context.Context, cluster metastore.ClusterInfo) error
+
+	mu         sync.Mutex
+	lastActive map[string]time.Time
+	frontends  map[string]*frontend
+	// resumed holds the running clusters checked for a frontend left by a previous run of spinup.
+	resumed map[string]bool
+}
+
+// frontend listens on the port of a fronted cluster.
+type frontend struct {
+	clusterID string
+	ln        net.Listener
+
+	// mu is held while the cluster is stopped or started, so that connections wait for the cluster to be started.
+	mu sync.Mutex
+	// addr is the address of the running cluster, empty while the cluster is stopped.
+	addr string
+	// failedAt is when the cluster last failed to start, with the error it failed with.
+	failedAt time.Time
+	err      error
+}
+
+type IdleManagerOptions func(m *IdleManager)
+
+// WithIdleCheckInterval sets how often the connection activity of clusters is checked.
+func WithIdleCheckInterval(interval time.Duration) IdleManagerOptions {
+	return func(m *IdleManager) {
+		m.interval = interval
+	}
+}
+
+func NewIdleManager(svc Service, opts ...IdleManagerOptions) *IdleManager {
+	m := &IdleManager{
+		store:        svc.store,
+		dockerClient: svc.dockerClient,
+		interval:     defaultIdleCheckInterval,
+		wakeTimeout:  defaultWakeTimeout,
+		logger:       svc.logger,
+		lastActive:   make(map[string]time.Time),
+		frontends:    make(map[string]*frontend),
+		resumed:      make(map[string]bool),
+	}
+	m.connections = m.countConnections
+	m.scaleDown = m.stopCluster
+	m.wake = m.startCluster
+	m.backend = m.frontedAddr
+	m.publish = m.publishPort
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Run checks the activity of clusters every interval until the context is cancelled. Fronted clusters get a listener
+// on their port again, and clusters whose idle policy was removed while spinup wasn't running get their port back.
+func (m *IdleManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	defer m.closeListeners()
+	m.publishUnmanaged(ctx)
+	for {
+		m.check(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check stops the clusters that have been idle for too long at the given time, and makes sure every fronted cluster
+// has a listener on its port.
+func (m *IdleManager) check(ctx context.Context, now time.Time) {
+	clusters, err := metastore.ClustersWithIdlePolicy(m.store)
+	if err != nil {
+		m.logger.Error("could not list clusters with an idle policy", zap.Error(err))
+		return
+	}
+
+	known := make(map[string]bool, len(clusters))
+	for _, cluster := range clusters {
+		known[cluster.ClusterID] = true
+		switch cluster.Status {
+		case metastore.StatusIdle:
+			m.listen(ctx, cluster, "")
+		case metastore.StatusRunning:
+			m.resume(ctx, cluster)
+			m.checkActivity(ctx, cluster, now)
+		case metastore.StatusStopping:
+			// spinup was interrupted while stopping the cluster.
+			m.stop(ctx, cluster, map[string]string{"reason": "idle"})
+		}
+	}
+
+	// clusters that were deleted or had their idle policy removed are no longer fronted.
+	m.mu.Lock()
+	var unmanaged []string
+	for clusterID, f := range m.frontends {
+		if !known[clusterID] {
+			f.ln.Close()
+			delete(m.frontends, clusterID)
+			unmanaged = append(unmanaged, clusterID)
+		}
+	}
+	for clusterID := range m.lastActive {
+		if !known[clusterID] {
+			delete(m.lastActive, clusterID)
+			delete(m.resumed, clusterID)
+		}
+	}
+	m.mu.Unlock()
+	for _, clusterID := range unmanaged {
+		cluster, err := metastore.GetClusterByID(m.store, clusterID)
+		if errors.Is(err, metastore.ErrClusterNotFound) {
+			continue
+		}
+		if err == nil {
+			err = m.unfront(ctx, cluster)
+		}
+		if err != nil {
+			m.logger.Error("could not publish the port of cluster", zap.String("cluster_id", clusterID), zap.Error(err))
+		}
+	}
+}
+
+// publishUnmanaged publishes the port of the fronted clusters that no longer have an idle policy.
+func (m *IdleManager) publishUnmanaged(ctx context.Context) {
+	clusters, err := metastore.AllClusters(m.store)
+	if err != nil {
+		m.logger.Error("could not list clusters", zap.Error(err))
+		return
+	}
+	for _, cluster := range clusters {
+		if cluster.IdleTimeout > 0 || cluster.Status == metastore.StatusIdle {
+			continue
+		}
+		if _, err := engineFor(cluster.Type); err != nil {
+			continue
+		}
+		addr, err := m.backend(ctx, cluster)
+		if err == nil && addr != "" {
+			err = m.unfront(ctx, cluster)
+		}
+		if err != nil {
+			m.logger.Error("could not publish the port of cluster", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		}
+	}
+}
+
+// unfront publishes the port of a cluster that no longer has an idle policy. A running cluster is restarted, and is
+// stopping meanwhile so that its restart isn't taken for a crash.
+func (m *IdleManager) unfront(ctx context.Context, cluster metastore.ClusterInfo) error {
+	if cluster.Status == metastore.StatusRunning {
+		if err := metastore.UpdateClusterStatus(m.store, cluster.ClusterID, metastore.StatusStopping); err != nil {
+			return err
+		}
+		defer func() {
+			if err := metastore.UpdateClusterStatus(m.store, cluster.ClusterID, metastore.StatusRunning); err != nil {
+				m.logger.Error("could not save cluster status", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+			}
+		}()
+	}
+	return m.publish(ctx, cluster)
+}
+
+// resume listens on the port of a running cluster that was fronted by a previous run of spinup.
+func (m *IdleManager) resume(ctx context.Context, cluster metastore.ClusterInfo) {
+	m.mu.Lock()
+	_, listening := m.frontends[cluster.ClusterID]
+	resumed := m.resumed[cluster.ClusterID]
+	m.resumed[cluster.ClusterID] = true
+	m.mu.Unlock()
+	if listening || resumed {
+		return
+	}
+	addr, err := m.backend(ctx, cluster)
+	if err != nil {
+		m.logger.Warn("could not check whether cluster is fronted", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+	if addr != "" {
+		m.listen(ctx, cluster, addr)
+	}
+}
+
+// checkActivity stops the cluster if it has had no client connections for longer than its idle timeout.
+func (m *IdleManager) checkActivity(ctx context.Context, cluster metastore.ClusterInfo, now time.Time) {
+	count, err := m.connections(ctx, cluster)
+	if err != nil {
+		m.logger.Warn("could not check cluster activity", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+
+	m.mu.Lock()
+	lastActive, seen := m.lastActive[cluster.ClusterID]
+	if count > 0 || !seen {
+		// clusters are considered active when first seen so that they get a full idle period after spinup starts.
+		m.lastActive[cluster.ClusterID] = now
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+
+	idleTimeout := time.Duration(cluster.IdleTimeout) * time.Second
+	if idleTimeout <= 0 || now.Sub(lastActive) < idleTimeout {
+		return
+	}
+	m.logger.Info("stopping idle cluster",
+		zap.String("cluster_id", cluster.ClusterID),
+		zap.String("name", cluster.Name),
+		zap.Duration("idle_for", now.Sub(lastActive)),
+	)
+	m.stop(ctx, cluster, map[string]string{
+		"reason":   "idle",
+		"idle_for": now.Sub(lastActive).Round(time.Second).String(),
+	})
+}
+
+// stop stops a cluster and fronts it, recording a stopped event with the given details. The cluster is stopping
+// while its container stops, so that the container watcher doesn't take it for a crash.
+func (m *IdleManager) stop(ctx context.Context, cluster metastore.ClusterInfo, details map[string]string) {
+	m.mu.Lock()
+	f := m.frontends[cluster.ClusterID]
+	m.mu.Unlock()
+	if f != nil {
+		// connections arriving while the cluster stops wait to start it again.
+		f.mu.Lock()
+		defer f.mu.Unlock()
+	}
+	if err := metastore.UpdateClusterStatus(m.store, cluster.ClusterID, metastore.StatusStopping); err != nil {
+		m.logger.Error("could not save cluster status", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+	if err := m.scaleDown(ctx, cluster); err != nil {
+		m.logger.Error("could not stop idle cluster", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		if err := metastore.UpdateClusterStatus(m.store, cluster.ClusterID, metastore.StatusRunning); err != nil {
+			m.logger.Error("could not save cluster status", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		}
+		return
+	}
+	if f != nil {
+		f.addr = ""
+	}
+	if err := metastore.UpdateClusterStatus(m.store, cluster.ClusterID, metastore.StatusIdle); err != nil {
+		m.logger.Error("could not save cluster status", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+	recordEvent(m.store, m.logger, metastore.Event{
+		ClusterID: cluster.ClusterID,
+		Type:      metastore.EventStopped,
+		Actor:     systemUser.ID,
+		Details:   details,
+	})
+	if f == nil {
+		m.listen(ctx, cluster, "")
+	}
+}
+
+// listen starts listening on the port of a fronted cluster, unless a listener already exists. addr is the address of
+// the cluster when it's running.
+func (m *IdleManager) listen(ctx context.Context, cluster metastore.ClusterInfo, addr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.frontends[cluster.ClusterID]; ok {
+		return
+	}
+	ln, err := net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(cluster.Port))
+	if err != nil {
+		m.logger.Error("could not listen on fronted cluster port", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		return
+	}
+	f := &frontend{clusterID: cluster.ClusterID, ln: ln, addr: addr}
+	m.frontends[cluster.ClusterID] = f
+	go m.serve(ctx, f)
+}
+
+// serve accepts the connections to a fronted cluster until its listener is closed, and proxies them to the cluster.
+func (m *IdleManager) serve(ctx context.Context, f *frontend) {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			// the listener was closed.
+			return
+		}
+		go func() {
+			addr, err := m.clusterAddr(ctx, f, time.Now())
+			if err != nil {
+				conn.Close()
+				return
+			}
+			proxy(conn, addr, m.logger)
+		}()
+	}
+}
+
+// clusterAddr returns the address of a fronted cluster, starting the cluster if it's stopped. Connections that
+// arrived before a failed start fail with it rather than starting the cluster again, while later ones retry.
+func (m *IdleManager) clusterAddr(ctx context.Context, f *frontend, arrived time.Time) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.addr != "" {
+		return f.addr, nil
+	}
+	if f.err != nil && f.failedAt.After(arrived) {
+		return "", f.err
+	}
+	addr, err := m.wakeUp(ctx, f.clusterID)
+	if err != nil {
+		m.logger.Error("could not wake up idle cluster", zap.String("cluster_id", f.clusterID), zap.Error(err))
+		f.failedAt, f.err = time.Now(), err
+		return "", err
+	}
+	f.addr = addr
+	return addr, nil
+}
+
+// wakeUp starts an idle cluster, and returns the address it's reachable at once it accepts connections.
+func (m *IdleManager) wakeUp(ctx context.Context, clusterID string) (string, error) {
+	cluster, err := metastore.GetClusterByID(m.store, clusterID)
+	if err != nil {
+		return "", errors.Wrap(err, "getting cluster")
+	}
+	m.logger.Info("waking up idle cluster", zap.String("cluster_id", cluster.ClusterID), zap.String("name", cluster.Name))
+	wakeCtx, cancel := context.WithTimeout(ctx, m.wakeTimeout)
+	defer cancel()
+	addr, err := m.wake(wakeCtx, cluster)
+	if err != nil {
+		return "", err
+	}
+	if err := metastore.UpdateClusterStatus(m.store, cluster.ClusterID, metastore.StatusRunning); err != nil {
+		m.logger.Error("could not save cluster status", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+	}
+	recordEvent(m.store, m.logger, metastore.Event{
+		ClusterID: cluster.ClusterID,
+		Type:      metastore.EventStarted,
+		Actor:     systemUser.ID,
+		Details:   map[string]string{"reason": "connection"},
+	})
+	m.mu.Lock()
+	m.lastActive[cluster.ClusterID] = time.Now()
+	m.mu.Unlock()
+	return addr, nil
+}
+
+// proxy copies data between a client connection and the given address until either side closes the connection.
+func proxy(client net.Conn, addr string, logger *zap.Logger) {
+	defer client.Close()
+	server, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		logger.Error("could not connect to woken up cluster", zap.String("addr", addr), zap.Error(err))
+		return
+	}
+	defer server.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(server, client)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, server)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (m *IdleManager) closeListeners() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for clusterID, f := range m.frontends {
+		f.ln.Close()
+		delete(m.frontends, clusterID)
+	}
+}
+
+func (m *IdleManager) clusterContainer(ctx context.Context, cluster metastore.ClusterInfo) (*dockerservice.Container, error) {
+	name, err := containerName(cluster)
+	if err != nil {
+		return nil, err
+	}
+	c, err := m.dockerClient.GetContainer(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting cluster container")
+	}
+	if c == nil {
+		return nil, errors.Errorf("no container found for cluster %s", cluster.ClusterID)
+	}
+	return c, nil
+}
+
+// countConnections returns the number of client connections to the cluster, ignoring those made by spinup itself.
+func (m *IdleManager) countConnections(ctx context.Context, cluster metastore.ClusterInfo) (int, error) {
+	e, err := engineFor(cluster.Type)
+	if err != nil {
+		return 0, err
+	}
+	counter, ok := e.(engine.ConnectionCounter)
+	if !ok {
+		return 0, ErrUnsupportedEngine{Type: e.Type(), Operation: "idle policies"}
+	}
+	c, err := m.clusterContainer(ctx, cluster)
+	if err != nil {
+		return 0, err
+	}
+	cmd := counter.ConnectionsCmd(cluster.Username, cluster.Password, monitor.ApplicationName)
+	res, err := c.Exec(ctx, m.dockerClient, types.ExecConfig{
+		User: "postgres",
+		Cmd:  cmd,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if res.ExitCode != 0 {
+		return 0, errors.Errorf("%s exited with code %d: %s", cmd[0], res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	return strconv.Atoi(strings.TrimSpace(res.Stdout))
+}
+
+// stopCluster stops the cluster's container and fronts it, by recreating it with its port published on a free port of
+// the loopback interface.
+func (m *IdleManager) stopCluster(ctx context.Context, cluster metastore.ClusterInfo) error {
+	c, err := m.clusterContainer(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if err := c.Stop(ctx, m.dockerClient, types.ContainerStartOptions{}); err != nil {
+		return err
+	}
+	_, err = m.front(ctx, cluster)
+	return err
+}
+
+// front publishes the port of a stopped cluster on a free port of the loopback interface, unless it already is, and
+// returns the address the cluster is reachable at.
+func (m *IdleManager) front(ctx context.Context, cluster metastore.ClusterInfo) (string, error) {
+	addr, err := m.frontedAddr(ctx, cluster)
+	if err != nil || addr != "" {
+		return addr, err
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", errors.Wrap(err, "finding a free port")
+	}
+	addr = ln.Addr().String()
+	ln.Close()
+	_, port, _ := net.SplitHostPort(addr)
+	if err := m.rebind(ctx, cluster, nat.PortBinding{HostIP: "127.0.0.1", HostPort: port}); err != nil {
+		return "", err
+	}
+	return addr, nil
+}
+
+// startCluster starts the cluster's container, waits until the database accepts connections and returns the address
+// the cluster is reachable at.
+func (m *IdleManager) startCluster(ctx context.Context, cluster metastore.ClusterInfo) (string, error) {
+	e, err := engineFor(cluster.Type)
+	if err != nil {
+		return "", err
+	}
+	// clusters stopped by earlier versions of spinup still have their port published publicly.
+	addr, err := m.front(ctx, cluster)
+	if err != nil {
+		return "", err
+	}
+	c, err := m.clusterContainer(ctx, cluster)
+	if err != nil {
+		return "", err
+	}
+	if err := c.StartExisting(ctx, m.dockerClient); err != nil {
+		return "", err
+	}
+	for {
+		res, err := c.Exec(ctx, m.dockerClient, types.ExecConfig{
+			Cmd: e.ReadyCmd(cluster.Username, cluster.Password),
+		})
+		if err == nil && res.ExitCode == 0 {
+			return addr, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", errors.Wrapf(ctx.Err(), "waiting for %s to accept connections", e.Type())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// frontedAddr returns the loopback address the cluster's port is published on, or an empty address if it's published
+// publicly.
+func (m *IdleManager) frontedAddr(ctx context.Context, cluster metastore.ClusterInfo) (string, error) {
+	e, err := engineFor(cluster.Type)
+	if err != nil {
+		return "", err
+	}
+	c, err := m.clusterContainer(ctx, cluster)
+	if err != nil {
+		return "", err
+	}
+	data, err := m.dockerClient.Cli.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return "", errors.Wrap(err, "inspecting cluster container")
+	}
+	for _, binding := range data.HostConfig.PortBindings[enginePort(e)] {
+		if binding.HostIP == "127.0.0.1" {
+			return net.JoinHostPort(binding.HostIP, binding.HostPort), nil
+		}
+	}
+	return "", nil
+}
+
+// publishPort publishes the port of a fronted cluster on the cluster's port again.
+func (m *IdleManager) publishPort(ctx context.Context, cluster metastore.ClusterInfo) error {
+	return m.rebind(ctx, cluster, nat.PortBinding{HostIP: "0.0.0.0", HostPort: strconv.Itoa(cluster.Port)})
+}
+
+// rebind recreates the cluster's container with its port published on the given binding, since the port bindings of
+// a container can't be changed. The container keeps its name, configuration, networks and volumes, and is started
+// again if it was running.
+func (m *IdleManager) rebind(ctx context.Context, cluster metastore.ClusterInfo, binding nat.PortBinding) error {
+	e, err := engineFor(cluster.Type)
+	if err != nil {
+		return err
+	}
+	c, err := m.clusterContainer(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	data, err := m.dockerClient.Cli.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return errors.Wrap(err, "inspecting cluster container")
+	}
+
+	hostConfig := *data.HostConfig
+	hostConfig.PortBindings = nat.PortMap{}
+	for port, bindings := range data.HostConfig.PortBindings {
+		hostConfig.PortBindings[port] = bindings
+	}
+	hostConfig.PortBindings[enginePort(e)] = []nat.PortBinding{binding}
+	// anonymous volumes would be replaced by new, empty ones.
+	hostConfig.Mounts = addMounts(hostConfig.Mounts, anonymousVolumes(data)...)
+
+	var networks []string
+	for name := range data.NetworkSettings.Networks {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+	endpoint := func(name string) *network.EndpointSettings {
+		return &network.EndpointSettings{Aliases: data.NetworkSettings.Networks[name].Aliases}
+	}
+	var networkConfig network.NetworkingConfig
+	if len(networks) > 0 {
+		hostConfig.NetworkMode = container.NetworkMode(networks[0])
+		networkConfig.EndpointsConfig = map[string]*network.EndpointSettings{networks[0]: endpoint(networks[0])}
+	}
+
+	running := data.State != nil && data.State.Running
+	if running {
+		if err := c.Stop(ctx, m.dockerClient, types.ContainerStartOptions{}); err != nil {
+			return err
+		}
+	}
+	if err := c.Remove(ctx, m.dockerClient); err != nil {
+		return errors.Wrap(err, "removing cluster container")
+	}
+	name := strings.TrimPrefix(data.Name, "/")
+	created, err := m.dockerClient.Cli.ContainerCreate(ctx, data.Config, &hostConfig, &networkConfig, nil, name)
+	if err != nil {
+		return errors.Wrap(err, "recreating cluster container")
+	}
+	for _, name := range networks[1:] {
+		if err := m.dockerClient.Cli.NetworkConnect(ctx, name, created.ID, endpoint(name)); err != nil {
+			return errors.Wrapf(err, "connecting cluster container to network %s", name)
+		}
+	}
+	if running {
+		if err := m.dockerClient.Cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+			return errors.Wrap(err, "starting cluster container")
+		}
+	}
+	return nil
+}
+
+// anonymousVolumes returns mounts for the volumes of a container that aren't part of its host configuration, such as
+// the volumes declared by its image.
+func anonymousVolumes(data types.ContainerJSON) []mount.Mount {
+	configured := map[string]bool{}
+	for _, bind := range data.HostConfig.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) > 1 {
+			configured[parts[1]] = true
+		}
+	}
+	var mounts []mount.Mount
+	for _, point := range data.Mounts {
+		if point.Type != mount.TypeVolume || point.Name == "" || configured[point.Destination] {
+			continue
+		}
+		mounts = append(mounts, mount.Mount{Type: mount.TypeVolume, Source: point.Name, Target: point.Destination, ReadOnly: !point.RW})
+	}
+	return mounts
+}
+
+func enginePort(e engine.Engine) nat.Port {
+	return nat.Port(strconv.Itoa(e.Port()) + "/tcp")
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+// freePort returns a port that nothing is listening on.
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestIdleManager(t *testing.T) {
+	testID := uuid.New().String()
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	quietPort := freePort(t)
+	clusters := []metastore.ClusterInfo{
+		{ClusterID: "busy", Name: "busy", Port: freePort(t), IdleTimeout: 600},
+		{ClusterID: "quiet", Name: "quiet", Port: quietPort, IdleTimeout: 600},
+		{ClusterID: "no-policy", Name: "no-policy", Port: freePort(t)},
+	}
+	for _, cluster := range clusters {
+		cluster.Owner = testUser.ID
+		require.NoError(t, metastore.InsertService(store, cluster))
+	}
+
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	svc := NewService(ds.Docker{}, store, nil, logger, config.Configuration{})
+	m := NewIdleManager(svc)
+	t.Cleanup(m.closeListeners)
+	connections := map[string]int{"busy": 2}
+	var checked, stopped []string
+	m.connections = func(ctx context.Context, cluster metastore.ClusterInfo) (int, error) {
+		checked = append(checked, cluster.ClusterID)
+		return connections[cluster.ClusterID], nil
+	}
+	m.scaleDown = func(ctx context.Context, cluster metastore.ClusterInfo) error {
+		stopped = append(stopped, cluster.ClusterID)
+		return nil
+	}
+	// the stubbed cluster is an echo server started on an internal port once the wake is released.
+	waking, release := make(chan struct{}), make(chan struct{})
+	m.wake = func(ctx context.Context, cluster metastore.ClusterInfo) (string, error) {
+		close(waking)
+		<-release
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return "", err
+		}
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					_, _ = io.Copy(conn, conn)
+				}()
+			}
+		}()
+		return ln.Addr().String(), nil
+	}
+	m.backend = func(ctx context.Context, cluster metastore.ClusterInfo) (string, error) {
+		return "", nil
+	}
+	var published []string
+	m.publish = func(ctx context.Context, cluster metastore.ClusterInfo) error {
+		published = append(published, cluster.ClusterID)
+		return nil
+	}
+	echo := func(t *testing.T, conn net.Conn) {
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+		_, err := conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		reply := make([]byte, 4)
+		_, err = io.ReadFull(conn, reply)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(reply))
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+
+	t.Run("clusters get a full idle period when first seen", func(t *testing.T) {
+		m.check(ctx, now)
+		assert.ElementsMatch(t, []string{"busy", "quiet"}, checked)
+		assert.Empty(t, stopped)
+	})
+
+	t.Run("clusters without connections are stopped after their idle timeout", func(t *testing.T) {
+		m.check(ctx, now.Add(5*time.Minute))
+		assert.Empty(t, stopped)
+
+		m.check(ctx, now.Add(11*time.Minute))
+		assert.Equal(t, []string{"quiet"}, stopped)
+		quiet, err := metastore.GetClusterByID(store, "quiet")
+		require.NoError(t, err)
+		assert.Equal(t, metastore.StatusIdle, quiet.Status)
+		busy, err := metastore.GetClusterByID(store, "busy")
+		require.NoError(t, err)
+		assert.Equal(t, metastore.StatusRunning, busy.Status)
+	})
+
+	t.Run("a connection to an idle cluster wakes it up", func(t *testing.T) {
+		quietAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(quietPort))
+		conn, err := net.DialTimeout("tcp", quietAddr, time.Second)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+
+		// connections made while the cluster wakes up are held until it accepts connections.
+		<-waking
+		held, err := net.DialTimeout("tcp", quietAddr, time.Second)
+		require.NoError(t, err)
+		defer held.Close()
+		close(release)
+		echo(t, held)
+		reply := make([]byte, 4)
+		_, err = io.ReadFull(conn, reply)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(reply))
+
+		quiet, err := metastore.GetClusterByID(store, "quiet")
+		require.NoError(t, err)
+		assert.Equal(t, metastore.StatusRunning, quiet.Status)
+
+		// connections to the running cluster are still proxied.
+		later, err := net.DialTimeout("tcp", quietAddr, time.Second)
+		require.NoError(t, err)
+		defer later.Close()
+		echo(t, later)
+	})
+
+	t.Run("clusters whose idle policy is removed are published again", func(t *testing.T) {
+		require.NoError(t, metastore.UpdateIdleTimeout(store, "quiet", 0))
+		m.check(ctx, now.Add(12*time.Minute))
+		assert.Equal(t, []string{"quiet"}, published)
+		m.mu.Lock()
+		assert.Empty(t, m.frontends)
+		m.mu.Unlock()
+	})
+}
+
+func TestSetIdlePolicy(t *testing.T) {
+	testID := uuid.New().String()
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+	require.NoError(t, metastore.InsertService(store, metastore.ClusterInfo{
+		ClusterID: testID,
+		Name:      testID,
+		Owner:     testUser.ID,
+	}))
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	svc := NewService(ds.Docker{}, store, nil, logger, config.Configuration{})
+	ctx := context.Background()
+
+	cluster, err := svc.SetIdlePolicy(ctx, testUser, testID, 30*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1800), cluster.IdleTimeout)
+
+	_, err = svc.SetIdlePolicy(ctx, testUser, testID, 10*time.Second)
+	assert.ErrorIs(t, err, ErrInvalidIdleTimeout)
+
+	_, err = svc.SetIdlePolicy(ctx, User{ID: "someone-else"}, testID, 0)
+	assert.ErrorAs(t, err, &ErrNoMatch{})
+
+	cluster, err = svc.SetIdlePolicy(ctx, testUser, testID, 0)
+	require.NoError(t, err)
+	assert.Zero(t, cluster.IdleTimeout)
+}
+
+func TestFrontCluster(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	rt := ds.NewMemoryRuntime(ds.WithImages("postgres:14.5"), ds.WithExecHandler(ds.SimulatePostgres))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+	svc := NewService(dc, store, nil, logger, config.Configuration{})
+	m := NewIdleManager(svc)
+
+	info := &metastore.ClusterInfo{Type: "postgres", Name: "fronted-" + testID[:8], Port: 15441, Username: "admin", Password: "secret",
+		MajVersion: 14, MinVersion: 5}
+	require.NoError(t, svc.CreateService(ctx, testUser, info))
+	cluster, err := metastore.GetClusterByID(store, info.ClusterID)
+	require.NoError(t, err)
+	inspect := func() types.ContainerJSON {
+		c, err := m.clusterContainer(ctx, cluster)
+		require.NoError(t, err)
+		data, err := rt.ContainerInspect(ctx, c.ID)
+		require.NoError(t, err)
+		return data
+	}
+
+	require.NoError(t, m.stopCluster(ctx, cluster))
+	data := inspect()
+	assert.False(t, data.State.Running)
+	binding := data.HostConfig.PortBindings["5432/tcp"]
+	require.Len(t, binding, 1)
+	assert.Equal(t, "127.0.0.1", binding[0].HostIP)
+	assert.Contains(t, data.NetworkSettings.Networks, testID, "the container stays on the spinup network")
+	require.Len(t, data.Mounts, 1)
+	assert.Equal(t, info.Name, data.Mounts[0].Name, "the container keeps its data")
+
+	addr, err := m.startCluster(ctx, cluster)
+	require.NoError(t, err)
+	assert.Equal(t, net.JoinHostPort("127.0.0.1", binding[0].HostPort), addr)
+	assert.True(t, inspect().State.Running)
+
+	require.NoError(t, m.publishPort(ctx, cluster))
+	data = inspect()
+	assert.True(t, data.State.Running, "running clusters are restarted")
+	assert.Equal(t, []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: "15441"}}, []nat.PortBinding(data.HostConfig.PortBindings["5432/tcp"]))
+	addr, err = m.frontedAddr(ctx, cluster)
+	require.NoError(t, err)
+	assert.Empty(t, addr)
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/monitor"
+)
+
+// Cluster images are of the kind of the cluster's type, e.g. "postgres" or "redis", while the images of the
+// containers spinup runs alongside clusters are "tooling" images.
+const (
+	ImageKindPostgres = "postgres"
+	ImageKindTooling  = "tooling"
+)
+
+// versionRe matches the postgres versions accepted in the pre-pull list, e.g. "14.5".
+var versionRe = regexp.MustCompile(`^(\d+)\.(\d+)$`)
+
+// ImageInfo describes an image spinup uses, and whether it's present on the docker host.
+type ImageInfo struct {
+	Image    string   `json:"image"` // reference the image is pulled from
+	Kind     string   `json:"kind"`  // a cluster type, or "tooling"
+	ID       string   `json:"id,omitempty"`
+	Size     int64    `json:"size"` // in bytes, zero if the image isn't pulled
+	Pulled   bool     `json:"pulled"`
+	PrePull  bool     `json:"prepull,omitempty"`
+	Clusters []string `json:"clusters,omitempty"` // IDs of the clusters created from the image
+}
+
+// ImageService manages the images stored on the docker host.
+type ImageService struct {
+	store        metastore.Db
+	dockerClient dockerservice.Docker
+	logger       *zap.Logger
+	svcConfig    config.Configuration
+}
+
+func NewImageService(client dockerservice.Docker, store metastore.Db, logger *zap.Logger, cfg config.Configuration) ImageService {
+	return ImageService{
+		store:        store,
+		dockerClient: client,
+		logger:       logger,
+		svcConfig:    cfg,
+	}
+}
+
+// ListImages returns the postgres images used by clusters or pre-pulled, the tooling images, and any other image of the
+// same postgres repositories found on the docker host.
+func (svc ImageService) ListImages(ctx context.Context) ([]ImageInfo, error) {
+	known, err := svc.knownImages()
+	if err != nil {
+		return nil, err
+	}
+	local, err := svc.dockerClient.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaultRef, err := pullReference(svc.svcConfig.Registry, engines["postgres"].Image(0, 0))
+	if err != nil {
+		return nil, err
+	}
+	return imageCatalog(known, local, defaultRef), nil
+}
+
+// PruneImages removes the cluster images that no cluster was created from and that aren't in the pre-pull list.
+// It returns the removed images.
+func (svc ImageService) PruneImages(ctx context.Context) ([]ImageInfo, error) {
+	images, err := svc.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []ImageInfo
+	var pruneErr error
+	for _, image := range images {
+		if image.Kind == ImageKindTooling || !image.Pulled || image.PrePull || len(image.Clusters) > 0 {
+			continue
+		}
+		if err := svc.dockerClient.RemoveImage(ctx, image.Image); err != nil {
+			pruneErr = multierr.Append(pruneErr, err)
+			continue
+		}
+		svc.logger.Info("removed unused image", zap.String("image", image.Image), zap.Int64("size", image.Size))
+		removed = append(removed, image)
+	}
+	return removed, pruneErr
+}
+
+// PrePull pulls the images of the pre-pull list that aren't on the docker host yet. Failures are logged, so that one
+// unavailable image doesn't prevent the others from being pulled.
+func (svc ImageService) PrePull(ctx context.Context) {
+	for _, entry := range svc.svcConfig.Images.PrePull {
+		image, err := pullReference(svc.svcConfig.Registry, prePullImage(entry))
+		if err != nil {
+			svc.logger.Error("invalid image in pre-pull list", zap.String("image", entry), zap.Error(err))
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		svc.logger.Info("pre-pulling image", zap.String("image", image))
+		if err := svc.dockerClient.PullImage(ctx, image); err != nil {
+			svc.logger.Error("could not pre-pull image", zap.String("image", image), zap.Error(err))
+		}
+	}
+}
+
+// prePullImage returns the image for an entry of the pre-pull list, which is either a postgres version or an image.
+func prePullImage(entry string) string {
+	if m := versionRe.FindStringSubmatch(entry); m != nil {
+		maj, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		return engines["postgres"].Image(maj, minor)
+	}
+	return entry
+}
+
+// toolingImages returns the images of the containers spinup runs alongside clusters.
+func toolingImages() []string {
+	images := append(monitor.Images(), WalgImage)
+	for _, t := range EngineTypes() {
+		if exporter := engines[t].Exporter(); exporter != nil {
+			images = append(images, exporter.Image)
+		}
+	}
+	return images
+}
+
+// knownImages returns the images spinup uses, keyed by the reference they are pulled from.
+func (svc ImageService) knownImages() (map[string]*ImageInfo, error) {
+	clusters, err := metastore.AllClusters(svc.store)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading clusters")
+	}
+
+	known := make(map[string]*ImageInfo)
+	add := func(image, kind string) *ImageInfo {
+		ref, err := pullReference(svc.svcConfig.Registry, image)
+		if err != nil {
+			svc.logger.Warn("ignoring invalid image reference", zap.String("image", image), zap.Error(err))
+			return nil
+		}
+		if _, ok := known[ref]; !ok {
+			known[ref] = &ImageInfo{Image: ref, Kind: kind}
+		}
+		return known[ref]
+	}
+	for _, image := range toolingImages() {
+		add(image, ImageKindTooling)
+	}
+	for _, entry := range svc.svcConfig.Images.PrePull {
+		if info := add(prePullImage(entry), ImageKindPostgres); info != nil {
+			info.PrePull = true
+		}
+	}
+	for _, cluster := range clusters {
+		e, err := engineFor(cluster.Type)
+		if err != nil {
+			svc.logger.Warn("ignoring cluster of unknown type", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+			continue
+		}
+		image := cluster.Image
+		if image == "" {
+			// clusters created before the image was saved use the default image.
+			image = e.Image(cluster.MajVersion, cluster.MinVersion)
+		}
+		if info := add(image, e.Type()); info != nil {
+			info.Clusters = append(info.Clusters, cluster.ClusterID)
+		}
+	}
+	return known, nil
+}
+
+// imageCatalog matches the known images against the images on the docker host. Local images that aren't known, but
+// belong to the repository of a known cluster image or of the default image (e.g. an older version), are included as
+// unused cluster images of the same kind.
+func imageCatalog(known map[string]*ImageInfo, local []dockerservice.Image, defaultRef string) []ImageInfo {
+	clusterRepos := make(map[string]string)
+	for ref, info := range known {
+		if info.Kind != ImageKindTooling {
+			clusterRepos[repositoryOf(ref)] = info.Kind
+		}
+	}
+	clusterRepos[repositoryOf(defaultRef)] = ImageKindPostgres
+
+	catalog := make(map[string]*ImageInfo, len(known))
+	for ref, info := range known {
+		catalog[ref] = info
+	}
+	for _, image := range local {
+		for _, tag := range image.Tags {
+			info, ok := catalog[tag]
+			if !ok {
+				kind, ok := clusterRepos[repositoryOf(tag)]
+				if !ok {
+					continue
+				}
+				info = &ImageInfo{Image: tag, Kind: kind}
+				catalog[tag] = info
+			}
+			info.ID = image.ID
+			info.Size = image.Size
+			info.Pulled = true
+		}
+	}
+
+	images := make([]ImageInfo, 0, len(catalog))
+	for _, info := range catalog {
+		sort.Strings(info.Clusters)
+		images = append(images, *info)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Kind != images[j].Kind {
+			return images[i].Kind < images[j].Kind
+		}
+		return images[i].Image < images[j].Image
+	})
+	return images
+}
+
+// repositoryOf returns the repository of an image reference, i.e. the reference without its tag or digest.
+func repositoryOf(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return strings.SplitN(image, ":", 2)[0]
+	}
+	return reference.FamiliarName(named)
+}
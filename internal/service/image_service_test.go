@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+)
+
+func TestImageCatalog(t *testing.T) {
+	known := map[string]*ImageInfo{
+		"amd64/postgres:14.5":       {Image: "amd64/postgres:14.5", Kind: ImageKindPostgres, Clusters: []string{"b", "a"}},
+		"amd64/postgres:15.1":       {Image: "amd64/postgres:15.1", Kind: ImageKindPostgres, PrePull: true},
+		"spinuphost/walg:latest":    {Image: "spinuphost/walg:latest", Kind: ImageKindTooling},
+		"grafana/grafana-oss:9.0.5": {Image: "grafana/grafana-oss:9.0.5", Kind: ImageKindTooling},
+	}
+	local := []dockerservice.Image{
+		{ID: "sha256:1", Tags: []string{"amd64/postgres:14.5"}, Size: 100},
+		{ID: "sha256:2", Tags: []string{"amd64/postgres:13.3"}, Size: 90},
+		{ID: "sha256:3", Tags: []string{"spinuphost/walg:latest"}, Size: 50},
+		{ID: "sha256:4", Tags: []string{"redis:7"}, Size: 30},
+	}
+
+	got := imageCatalog(known, local, "amd64/postgres:0.0")
+	assert.Equal(t, []ImageInfo{
+		{Image: "amd64/postgres:13.3", Kind: ImageKindPostgres, ID: "sha256:2", Size: 90, Pulled: true},
+		{Image: "amd64/postgres:14.5", Kind: ImageKindPostgres, ID: "sha256:1", Size: 100, Pulled: true, Clusters: []string{"a", "b"}},
+		{Image: "amd64/postgres:15.1", Kind: ImageKindPostgres, PrePull: true},
+		{Image: "grafana/grafana-oss:9.0.5", Kind: ImageKindTooling},
+		{Image: "spinuphost/walg:latest", Kind: ImageKindTooling, ID: "sha256:3", Size: 50, Pulled: true},
+	}, got)
+}
+
+func TestPrePullImage(t *testing.T) {
+	assert.Equal(t, "amd64/postgres:14.5", prePullImage("14.5"))
+	assert.Equal(t, "registry.internal/postgres:14", prePullImage("registry.internal/postgres:14"))
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/dockerservice"
+)
+
+// ErrImageNotAllowed is returned when a cluster is created with an image that the registry configuration doesn't allow.
+type ErrImageNotAllowed struct {
+	Image  string
+	Reason string
+}
+
+func (e ErrImageNotAllowed) Error() string {
+	return fmt.Sprintf("image '%s' is not allowed: %s", e.Image, e.Reason)
+}
+
+// resolveImage checks the image against the allow and deny lists and returns the reference to pull it from, which
+// goes through the mirror for Docker Hub images when one is configured.
+func resolveImage(cfg config.RegistryConfig, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", ErrImageNotAllowed{Image: image, Reason: "invalid image reference"}
+	}
+	named = reference.TagNameOnly(named)
+
+	for _, pattern := range cfg.Deny {
+		if imageMatches(pattern, named) {
+			return "", ErrImageNotAllowed{Image: image, Reason: fmt.Sprintf("matches denied image '%s'", pattern)}
+		}
+	}
+	if len(cfg.Allow) > 0 {
+		allowed := false
+		for _, pattern := range cfg.Allow {
+			if imageMatches(pattern, named) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", ErrImageNotAllowed{Image: image, Reason: "not in the list of allowed images"}
+		}
+	}
+
+	return mirrorReference(cfg, named)
+}
+
+// checkImageDigests pulls the image, unless it already exists on the docker host, and checks it against the digests
+// in the deny list. resolveImage only matches them against images pinned with "@sha256:...", while an image referenced
+// by tag is denied here once its digest is known.
+func checkImageDigests(ctx context.Context, d dockerservice.Docker, cfg config.RegistryConfig, image string) error {
+	if !hasDigests(cfg.Deny) {
+		return nil
+	}
+	if err := d.PullImage(ctx, image); err != nil {
+		return errors.Wrapf(err, "pulling image %s", image)
+	}
+	return checkImageIDDigests(ctx, d, cfg, image, image)
+}
+
+// checkImageIDDigests checks the image, which must exist on the docker host, against the digests in the deny list.
+func checkImageIDDigests(ctx context.Context, d dockerservice.Docker, cfg config.RegistryConfig, image, id string) error {
+	if !hasDigests(cfg.Deny) {
+		return nil
+	}
+	data, _, err := d.Cli.ImageInspectWithRaw(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "inspecting image %s", image)
+	}
+	for _, pattern := range cfg.Deny {
+		if digestMatches(pattern, data) {
+			return ErrImageNotAllowed{Image: image, Reason: fmt.Sprintf("matches denied image '%s'", pattern)}
+		}
+	}
+	return nil
+}
+
+// hasDigests reports whether any of the list entries is a digest.
+func hasDigests(patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "sha256:") {
+			return true
+		}
+	}
+	return false
+}
+
+// digestMatches reports whether the digest entry is the image's ID or the digest of one of its repositories.
+func digestMatches(pattern string, data types.ImageInspect) bool {
+	if !strings.HasPrefix(pattern, "sha256:") {
+		return false
+	}
+	if data.ID == pattern {
+		return true
+	}
+	for _, repoDigest := range data.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// pullReference returns the reference to pull the image from, without checking the allow and deny lists.
+func pullReference(cfg config.RegistryConfig, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", ErrImageNotAllowed{Image: image, Reason: "invalid image reference"}
+	}
+	return mirrorReference(cfg, reference.TagNameOnly(named))
+}
+
+// mirrorReference rewrites Docker Hub images to go through the mirror, if one is configured.
+func mirrorReference(cfg config.RegistryConfig, named reference.Named) (string, error) {
+	if cfg.Mirror == "" || reference.Domain(named) != "docker.io" {
+		return reference.FamiliarString(named), nil
+	}
+	mirrored := strings.TrimSuffix(cfg.Mirror, "/") + "/" + reference.Path(named)
+	if tagged, ok := named.(reference.Tagged); ok {
+		mirrored += ":" + tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		mirrored += "@" + digested.Digest().String()
+	}
+	if _, err := reference.ParseNormalizedNamed(mirrored); err != nil {
+		return "", fmt.Errorf("invalid registry mirror '%s' %w", cfg.Mirror, err)
+	}
+	return mirrored, nil
+}
+
+// imageMatches reports whether the image matches an allow or deny list entry. Entries are digests ("sha256:..."),
+// repositories ("postgres", "registry.internal/team/postgres"), or repository prefixes ending in "/*".
+func imageMatches(pattern string, named reference.Named) bool {
+	if strings.HasPrefix(pattern, "sha256:") {
+		digested, ok := named.(reference.Digested)
+		return ok && digested.Digest().String() == pattern
+	}
+	if prefix := strings.TrimSuffix(pattern, "/*"); prefix != pattern {
+		prefix += "/"
+		return strings.HasPrefix(named.Name(), prefix) || strings.HasPrefix(reference.FamiliarName(named), prefix)
+	}
+	repo, err := reference.ParseNormalizedNamed(pattern)
+	if err != nil {
+		return false
+	}
+	return repo.Name() == named.Name()
+}
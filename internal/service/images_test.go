@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+)
+
+func TestResolveImage(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name    string
+		cfg     config.RegistryConfig
+		image   string
+		want    string
+		allowed bool
+	}{
+		{
+			name:    "no restrictions",
+			image:   "amd64/postgres:14.5",
+			want:    "amd64/postgres:14.5",
+			allowed: true,
+		},
+		{
+			name:    "missing tag defaults to latest",
+			image:   "postgres",
+			want:    "postgres:latest",
+			allowed: true,
+		},
+		{
+			name:    "docker hub images go through the mirror",
+			cfg:     config.RegistryConfig{Mirror: "mirror.internal:5000/dockerhub/"},
+			image:   "postgres:14",
+			want:    "mirror.internal:5000/dockerhub/library/postgres:14",
+			allowed: true,
+		},
+		{
+			name:    "other registries don't go through the mirror",
+			cfg:     config.RegistryConfig{Mirror: "mirror.internal:5000"},
+			image:   "registry.internal/hardened/postgres:14",
+			want:    "registry.internal/hardened/postgres:14",
+			allowed: true,
+		},
+		{
+			name:    "allowed repository",
+			cfg:     config.RegistryConfig{Allow: []string{"postgres"}},
+			image:   "docker.io/library/postgres:14",
+			want:    "postgres:14",
+			allowed: true,
+		},
+		{
+			name:  "repository not in allow list",
+			cfg:   config.RegistryConfig{Allow: []string{"postgres"}},
+			image: "amd64/postgres:14",
+		},
+		{
+			name:    "allowed registry prefix",
+			cfg:     config.RegistryConfig{Allow: []string{"registry.internal/*"}},
+			image:   "registry.internal/hardened/postgres:14",
+			want:    "registry.internal/hardened/postgres:14",
+			allowed: true,
+		},
+		{
+			name:  "deny takes precedence over allow",
+			cfg:   config.RegistryConfig{Allow: []string{"registry.internal/*"}, Deny: []string{"registry.internal/hardened/postgres"}},
+			image: "registry.internal/hardened/postgres:14",
+		},
+		{
+			name:    "allowed digest",
+			cfg:     config.RegistryConfig{Allow: []string{digest}},
+			image:   "postgres@" + digest,
+			want:    "postgres@" + digest,
+			allowed: true,
+		},
+		{
+			name:  "denied digest",
+			cfg:   config.RegistryConfig{Deny: []string{digest}},
+			image: "postgres@" + digest,
+		},
+		{
+			name:  "invalid reference",
+			image: "Not An Image",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveImage(tt.cfg, tt.image)
+			if !tt.allowed {
+				assert.ErrorAs(t, err, &ErrImageNotAllowed{})
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckImageDigests(t *testing.T) {
+	const other = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	ctx := context.Background()
+	rt := ds.NewMemoryRuntime(ds.WithImages("postgres:14"))
+	d := ds.NewDockerWithRuntime("test", rt)
+	data, _, err := rt.ImageInspectWithRaw(ctx, "postgres:14")
+	require.NoError(t, err)
+	_, digest, _ := strings.Cut(data.RepoDigests[0], "@")
+
+	t.Run("denies images referenced by tag with a denied digest", func(t *testing.T) {
+		err := checkImageDigests(ctx, d, config.RegistryConfig{Deny: []string{other, digest}}, "postgres:14")
+		assert.ErrorAs(t, err, &ErrImageNotAllowed{})
+	})
+
+	t.Run("denies images by ID", func(t *testing.T) {
+		err := checkImageDigests(ctx, d, config.RegistryConfig{Deny: []string{data.ID}}, "postgres:14")
+		assert.ErrorAs(t, err, &ErrImageNotAllowed{})
+		err = checkImageIDDigests(ctx, d, config.RegistryConfig{Deny: []string{data.ID}}, "postgres:14", data.ID)
+		assert.ErrorAs(t, err, &ErrImageNotAllowed{})
+	})
+
+	t.Run("pulls missing images before checking them", func(t *testing.T) {
+		err := checkImageDigests(ctx, d, config.RegistryConfig{Deny: []string{digest}}, "postgres:15")
+		require.NoError(t, err)
+		_, _, err = rt.ImageInspectWithRaw(ctx, "postgres:15")
+		assert.NoError(t, err)
+	})
+
+	t.Run("doesn't pull without denied digests", func(t *testing.T) {
+		err := checkImageDigests(ctx, d, config.RegistryConfig{Deny: []string{"amd64/postgres"}}, "postgres:16")
+		require.NoError(t, err)
+		_, _, err = rt.ImageInspectWithRaw(ctx, "postgres:16")
+		assert.Error(t, err)
+	})
+}
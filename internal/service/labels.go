@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/pkg/errors"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+const (
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 255
+)
+
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]*[a-zA-Z0-9])?$`)
+
+// ErrInvalidLabel is returned when a label key or value is malformed.
+type ErrInvalidLabel struct {
+	Key    string
+	Reason string
+}
+
+func (e ErrInvalidLabel) Error() string {
+	return "invalid label '" + e.Key + "': " + e.Reason
+}
+
+func validateLabelKey(key string) error {
+	if len(key) > maxLabelKeyLength {
+		return ErrInvalidLabel{Key: key, Reason: "key is too long"}
+	}
+	if !labelKeyPattern.MatchString(key) {
+		return ErrInvalidLabel{Key: key, Reason: "key must be alphanumeric and may contain '.', '_', '/' and '-'"}
+	}
+	return nil
+}
+
+func validateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if err := validateLabelKey(key); err != nil {
+			return err
+		}
+		if len(value) > maxLabelValueLength {
+			return ErrInvalidLabel{Key: key, Reason: "value is too long"}
+		}
+	}
+	return nil
+}
+
+// UpdateLabels adds, overwrites and removes labels on a cluster. The user must own the cluster.
+func (svc Service) UpdateLabels(ctx context.Context, user User, clusterID string, set map[string]string, remove []string) (metastore.ClusterInfo, error) {
+	if err := validateLabels(set); err != nil {
+		return metastore.ClusterInfo{}, err
+	}
+	for _, key := range remove {
+		if err := validateLabelKey(key); err != nil {
+			return metastore.ClusterInfo{}, err
+		}
+	}
+	if _, err := svc.GetClusterByID(ctx, user, clusterID); err != nil {
+		return metastore.ClusterInfo{}, err
+	}
+	if err := metastore.UpdateLabels(svc.store, clusterID, set, remove); err != nil {
+		return metastore.ClusterInfo{}, errors.Wrap(err, "updating labels")
+	}
+	return svc.GetClusterByID(ctx, user, clusterID)
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, validateLabels(map[string]string{"env": "prod", "team.io/owner": "db-team", "a": ""}))
+
+	for _, labels := range []map[string]string{
+		{"": "value"},
+		{"-env": "prod"},
+		{"env ": "prod"},
+		{strings.Repeat("k", maxLabelKeyLength+1): "v"},
+		{"env": strings.Repeat("v", maxLabelValueLength+1)},
+	} {
+		assert.ErrorAs(t, validateLabels(labels), &ErrInvalidLabel{}, "%v", labels)
+	}
+}
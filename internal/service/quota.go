@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+// Usage holds the resources allocated by a user across all their clusters.
+type Usage struct {
+	Clusters int   `json:"clusters"`
+	Memory   int64 `json:"memory"`
+	CPU      int64 `json:"cpu"`
+	Disk     int64 `json:"disk"`
+}
+
+func (u Usage) add(o Usage) Usage {
+	return Usage{
+		Clusters: u.Clusters + o.Clusters,
+		Memory:   u.Memory + o.Memory,
+		CPU:      u.CPU + o.CPU,
+		Disk:     u.Disk + o.Disk,
+	}
+}
+
+func (u Usage) sub(o Usage) Usage {
+	return Usage{
+		Clusters: u.Clusters - o.Clusters,
+		Memory:   u.Memory - o.Memory,
+		CPU:      u.CPU - o.CPU,
+		Disk:     u.Disk - o.Disk,
+	}
+}
+
+// clusterUsage returns the resources allocated to a single cluster.
+func clusterUsage(cluster metastore.ClusterInfo) Usage {
+	return Usage{
+		Clusters: 1,
+		Memory:   cluster.Memory,
+		CPU:      cluster.CPU,
+		Disk:     cluster.Disk,
+	}
+}
+
+// QuotaReport compares the resources used by a user against their quota.
+type QuotaReport struct {
+	UserID string       `json:"user_id"`
+	Usage  Usage        `json:"usage"`
+	Quota  config.Quota `json:"quota"`
+}
+
+// ErrQuotaExceeded is returned when an operation would take a user over their quota.
+type ErrQuotaExceeded struct {
+	Resource string
+	Limit    int64
+	Wanted   int64
+}
+
+func (e ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: limit is %d, operation requires %d", e.Resource, e.Limit, e.Wanted)
+}
+
+// checkQuota returns ErrQuotaExceeded if the given usage doesn't fit in the quota.
+func checkQuota(quota config.Quota, usage Usage) error {
+	switch {
+	case quota.MaxClusters > 0 && usage.Clusters > quota.MaxClusters:
+		return ErrQuotaExceeded{Resource: "clusters", Limit: int64(quota.MaxClusters), Wanted: int64(usage.Clusters)}
+	case quota.Memory > 0 && usage.Memory > quota.Memory:
+		return ErrQuotaExceeded{Resource: "memory", Limit: quota.Memory, Wanted: usage.Memory}
+	case quota.CPU > 0 && usage.CPU > quota.CPU:
+		return ErrQuotaExceeded{Resource: "cpu", Limit: quota.CPU, Wanted: usage.CPU}
+	case quota.Disk > 0 && usage.Disk > quota.Disk:
+		return ErrQuotaExceeded{Resource: "disk", Limit: quota.Disk, Wanted: usage.Disk}
+	}
+	return nil
+}
+
+// quotaTracker enforces quotas atomically. Creating or resizing a cluster takes a while, so instead of holding a
+// lock for the whole operation, resources are reserved up front and the reservation is released once the change
+// has been saved to the metastore (or has failed).
+type quotaTracker struct {
+	mu       sync.Mutex
+	reserved map[string]Usage
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{
+		reserved: make(map[string]Usage),
+	}
+}
+
+// reserve checks that the user's stored usage, plus any in-flight reservations, plus the requested resources fit
+// in the quota and reserves the requested resources if they do. The returned release func must be called once the
+// operation has completed.
+func (q *quotaTracker) reserve(store metastore.Db, userID string, quota config.Quota, requested Usage) (func(), error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	used, err := storedUsage(store, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkQuota(quota, used.add(q.reserved[userID]).add(requested)); err != nil {
+		return nil, err
+	}
+
+	q.reserved[userID] = q.reserved[userID].add(requested)
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.reserved[userID] = q.reserved[userID].sub(requested)
+		})
+	}
+	return release, nil
+}
+
+// storedUsage sums up the resources of all clusters owned by the user.
+func storedUsage(store metastore.Db, userID string) (Usage, error) {
+	clusters, err := metastore.ClustersByOwner(store, userID)
+	if err != nil {
+		return Usage{}, errors.Wrap(err, "reading clusters for quota")
+	}
+	var usage Usage
+	for _, cluster := range clusters {
+		usage = usage.add(clusterUsage(cluster))
+	}
+	return usage, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestQuota(t *testing.T) {
+	testID := uuid.New().String()
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	require.NoError(t, metastore.InsertService(store, metastore.ClusterInfo{
+		ClusterID: "c1-" + testID,
+		Name:      "c1",
+		Owner:     testUser.ID,
+		Memory:    512,
+		CPU:       256,
+		Disk:      1024,
+	}))
+	quota := config.Quota{MaxClusters: 2, Memory: 1024, CPU: 1024, Disk: 2048}
+
+	t.Run("reservations count against the quota until released", func(t *testing.T) {
+		q := newQuotaTracker()
+		release, err := q.reserve(store, testUser.ID, quota, Usage{Clusters: 1, Memory: 512})
+		require.NoError(t, err)
+
+		_, err = q.reserve(store, testUser.ID, quota, Usage{Clusters: 1})
+		quotaErr := ErrQuotaExceeded{}
+		require.ErrorAs(t, err, &quotaErr)
+		assert.Equal(t, "clusters", quotaErr.Resource)
+
+		release()
+		release() // releasing twice must not free more than was reserved
+		_, err = q.reserve(store, testUser.ID, quota, Usage{Clusters: 1, Memory: 512})
+		assert.NoError(t, err)
+	})
+
+	t.Run("each resource is checked", func(t *testing.T) {
+		q := newQuotaTracker()
+		for _, tc := range []struct {
+			resource string
+			usage    Usage
+		}{
+			{"memory", Usage{Memory: 513}},
+			{"cpu", Usage{CPU: 769}},
+			{"disk", Usage{Disk: 1025}},
+		} {
+			_, err := q.reserve(store, testUser.ID, quota, tc.usage)
+			quotaErr := ErrQuotaExceeded{}
+			if assert.ErrorAs(t, err, &quotaErr) {
+				assert.Equal(t, tc.resource, quotaErr.Resource)
+			}
+		}
+	})
+
+	t.Run("zero quota means unlimited", func(t *testing.T) {
+		q := newQuotaTracker()
+		_, err := q.reserve(store, testUser.ID, config.Quota{}, Usage{Clusters: 100, Memory: 1 << 20})
+		assert.NoError(t, err)
+	})
+
+	t.Run("usage report", func(t *testing.T) {
+		cfg := config.Configuration{}
+		cfg.Quotas.Default = quota
+		svc := NewService(ds.Docker{}, store, nil, nil, cfg)
+		report, err := svc.QuotaUsage(context.Background(), testUser.ID)
+		require.NoError(t, err)
+		assert.Equal(t, Usage{Clusters: 1, Memory: 512, CPU: 256, Disk: 1024}, report.Usage)
+		assert.Equal(t, quota, report.Quota)
+	})
+}
+
+func TestQuotaFor(t *testing.T) {
+	cfg := config.Configuration{}
+	cfg.Common.Admins = []string{"admin"}
+	cfg.Quotas.Default = config.Quota{MaxClusters: 1}
+	cfg.Quotas.Admin = config.Quota{MaxClusters: 10}
+	cfg.Quotas.Users = map[string]config.Quota{"special": {MaxClusters: 5}}
+
+	assert.Equal(t, 1, cfg.QuotaFor("someone").MaxClusters)
+	assert.Equal(t, 10, cfg.QuotaFor("admin").MaxClusters)
+	assert.Equal(t, 5, cfg.QuotaFor("special").MaxClusters)
+}
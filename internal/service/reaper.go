@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+const (
+	defaultReaperInterval = time.Minute
+	defaultWarningWindow  = time.Hour
+)
+
+// Reaper periodically deletes clusters whose expiry time has passed, and warns about clusters that are about to expire.
+type Reaper struct {
+	store         metastore.Db
+	interval      time.Duration
+	warningWindow time.Duration
+	logger        *zap.Logger
+
+	// deleteCluster deletes an expired cluster. It goes through the normal delete path of the cluster service.
+	deleteCluster func(ctx context.Context, clusterID string) error
+	// warned holds the expiry time each cluster was last warned about, so that each warning is only emitted once.
+	warned map[string]time.Time
+}
+
+type ReaperOptions func(reaper *Reaper)
+
+// WithReaperInterval sets how often the reaper checks for expired clusters.
+func WithReaperInterval(interval time.Duration) ReaperOptions {
+	return func(reaper *Reaper) {
+		reaper.interval = interval
+	}
+}
+
+// WithWarningWindow sets how long before a cluster expires a warning is emitted.
+func WithWarningWindow(window time.Duration) ReaperOptions {
+	return func(reaper *Reaper) {
+		reaper.warningWindow = window
+	}
+}
+
+func NewReaper(svc Service, opts ...ReaperOptions) *Reaper {
+	r := &Reaper{
+		store:         svc.store,
+		interval:      defaultReaperInterval,
+		warningWindow: defaultWarningWindow,
+		logger:        svc.logger,
+		deleteCluster: func(ctx context.Context, clusterID string) error {
+			return svc.deleteCluster(ctx, systemUser, clusterID, "expired")
+		},
+		warned: make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run checks for expired clusters every interval until the context is cancelled.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.reap(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap deletes the clusters that have expired at the given time and warns about those expiring soon.
+func (r *Reaper) reap(ctx context.Context, now time.Time) {
+	clusters, err := metastore.ClustersExpiringBefore(r.store, now.Add(r.warningWindow))
+	if err != nil {
+		r.logger.Error("could not list expiring clusters", zap.Error(err))
+		return
+	}
+
+	for _, cluster := range clusters {
+		if cluster.ExpiresAt.After(now) {
+			if warnedAt, ok := r.warned[cluster.ClusterID]; ok && warnedAt.Equal(*cluster.ExpiresAt) {
+				continue
+			}
+			r.logger.Warn("cluster is about to expire",
+				zap.String("cluster_id", cluster.ClusterID),
+				zap.String("name", cluster.Name),
+				zap.String("owner", cluster.Owner),
+				zap.Time("expires_at", *cluster.ExpiresAt),
+			)
+			r.warned[cluster.ClusterID] = *cluster.ExpiresAt
+			continue
+		}
+
+		r.logger.Info("deleting expired cluster",
+			zap.String("cluster_id", cluster.ClusterID),
+			zap.String("name", cluster.Name),
+			zap.Time("expires_at", *cluster.ExpiresAt),
+		)
+		if err := r.deleteCluster(ctx, cluster.ClusterID); err != nil {
+			r.logger.Error("could not delete expired cluster", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+			continue
+		}
+		delete(r.warned, cluster.ClusterID)
+	}
+}
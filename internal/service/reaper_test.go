@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestReaper(t *testing.T) {
+	testID := uuid.New().String()
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	expired := now.Add(-time.Minute)
+	expiringSoon := now.Add(10 * time.Minute)
+	expiringLater := now.Add(24 * time.Hour)
+	for name, expiresAt := range map[string]*time.Time{
+		"expired":        &expired,
+		"expiring-soon":  &expiringSoon,
+		"expiring-later": &expiringLater,
+		"permanent":      nil,
+	} {
+		require.NoError(t, metastore.InsertService(store, metastore.ClusterInfo{
+			ClusterID: name,
+			Name:      name,
+			Owner:     testUser.ID,
+			ExpiresAt: expiresAt,
+		}))
+	}
+
+	core, logs := observer.New(zap.InfoLevel)
+	svc := NewService(ds.Docker{}, store, nil, zap.New(core), config.Configuration{})
+	r := NewReaper(svc, WithWarningWindow(time.Hour))
+	var deleted []string
+	r.deleteCluster = func(ctx context.Context, clusterID string) error {
+		deleted = append(deleted, clusterID)
+		return metastore.DeleteCluster(store, clusterID)
+	}
+
+	r.reap(context.Background(), now)
+	assert.Equal(t, []string{"expired"}, deleted)
+	warnings := logs.FilterMessage("cluster is about to expire").All()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "expiring-soon", warnings[0].ContextMap()["cluster_id"])
+
+	t.Run("warnings are only emitted once per expiry time", func(t *testing.T) {
+		r.reap(context.Background(), now)
+		assert.Len(t, logs.FilterMessage("cluster is about to expire").All(), 1)
+
+		extended := expiringSoon.Add(5 * time.Minute)
+		require.NoError(t, metastore.UpdateClusterExpiry(store, "expiring-soon", &extended))
+		r.reap(context.Background(), now)
+		assert.Len(t, logs.FilterMessage("cluster is about to expire").All(), 2)
+	})
+
+	t.Run("clusters are deleted once they expire", func(t *testing.T) {
+		r.reap(context.Background(), now.Add(25*time.Hour))
+		assert.Equal(t, []string{"expired", "expiring-soon", "expiring-later"}, deleted)
+
+		clusters, err := metastore.AllClusters(store)
+		require.NoError(t, err)
+		require.Len(t, clusters, 1)
+		assert.Equal(t, "permanent", clusters[0].ClusterID)
+	})
+}
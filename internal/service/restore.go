@@ -0,0 +1,629 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/engine"
+	"github.com/spinup-host/spinup/internal/metastore"
+	"github.com/spinup-host/spinup/internal/postgres"
+)
+
+const (
+	// PREFIXRESTORECONTAINER is the prefix of the helper containers running wal-g to list, fetch and delete backups.
+	PREFIXRESTORECONTAINER = "spinup-pg-restore-"
+	// OperationRestore is the type of the operations restoring a backup into a new cluster.
+	OperationRestore = "restore"
+	// LatestBackup restores the most recent base backup.
+	LatestBackup = "LATEST"
+
+	// restoreReadyTimeout bounds how long a restored cluster can take to replay WAL and accept connections.
+	restoreReadyTimeout = time.Hour
+)
+
+// ErrNoBackupDestination is returned when the backups of a cluster are listed or restored, but the cluster has no
+// backup destination whose credentials spinup knows.
+type ErrNoBackupDestination struct {
+	ClusterID string
+}
+
+func (e ErrNoBackupDestination) Error() string {
+	return fmt.Sprintf("cluster '%s' has no backup destination, schedule its backups first", e.ClusterID)
+}
+
+// ErrInvalidRecoveryTarget is returned when a backup is restored to a recovery target that is malformed, or that the
+// WAL archived after the backup doesn't reach.
+type ErrInvalidRecoveryTarget struct {
+	Reason string
+}
+
+func (e ErrInvalidRecoveryTarget) Error() string {
+	return "invalid recovery target: " + e.Reason
+}
+
+// BaseBackup is a base backup of a cluster, as listed by wal-g.
+type BaseBackup struct {
+	Name             string    `json:"backup_name"`
+	Time             time.Time `json:"time"`
+	WalFileName      string    `json:"wal_file_name"`
+	StartTime        time.Time `json:"start_time"`
+	FinishTime       time.Time `json:"finish_time"`
+	StartLSN         uint64    `json:"start_lsn"`
+	FinishLSN        uint64    `json:"finish_lsn"`
+	CompressedSize   int64     `json:"compressed_size"`
+	UncompressedSize int64     `json:"uncompressed_size"`
+	// IsPermanent is set for backups that wal-g doesn't delete, see BackupService.ApplyRetention.
+	IsPermanent bool `json:"is_permanent"`
+}
+
+// RecoveryTarget is the point of the WAL archived after a base backup that a restored cluster recovers to: a time, an
+// LSN such as 0/3000060, or the name of a restore point created with pg_create_restore_point. At most one of them is
+// set; the zero target recovers all the archived WAL.
+type RecoveryTarget struct {
+	Time *time.Time
+	LSN  string
+	Name string
+}
+
+func (t RecoveryTarget) isZero() bool {
+	return t.Time == nil && t.LSN == "" && t.Name == ""
+}
+
+// validate checks that at most one target is set, and that it's well-formed.
+func (t RecoveryTarget) validate() error {
+	set := 0
+	for _, ok := range []bool{t.Time != nil, t.LSN != "", t.Name != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return ErrInvalidRecoveryTarget{Reason: "set only one of a time, an LSN or a restore point name"}
+	}
+	if t.LSN != "" {
+		if _, err := parseLSN(t.LSN); err != nil {
+			return ErrInvalidRecoveryTarget{Reason: err.Error()}
+		}
+	}
+	// restore point names are truncated to 63 bytes by postgres.
+	if len(t.Name) > 63 {
+		return ErrInvalidRecoveryTarget{Reason: "restore point names are at most 63 bytes long"}
+	}
+	return nil
+}
+
+// details returns the target as operation and event details.
+func (t RecoveryTarget) details() map[string]string {
+	switch {
+	case t.Time != nil:
+		return map[string]string{"target_time": t.Time.UTC().Format(time.RFC3339Nano)}
+	case t.LSN != "":
+		return map[string]string{"target_lsn": t.LSN}
+	case t.Name != "":
+		return map[string]string{"target_name": t.Name}
+	}
+	return nil
+}
+
+// walTimeline is a timeline of the WAL archived in a backup destination, as shown by wal-g wal-show.
+type walTimeline struct {
+	ID              uint32   `json:"id"`
+	StartSegment    string   `json:"start_segment"`
+	EndSegment      string   `json:"end_segment"`
+	MissingSegments []string `json:"missing_segments"`
+}
+
+// RestoreBackup restores a base backup of a cluster into a new cluster, and returns the operation to follow the
+// restore with. backup is the name of a base backup as listed by ListBaseBackups, or LatestBackup. The new cluster
+// replays the WAL archived after the backup up to the recovery target, or all of it when the target is zero; when
+// restoring the latest backup to a target, the latest backup taken before the target is restored. info holds the
+// settings of the new cluster (name, port, resources, labels and monitoring); its version, image and credentials are
+// those of the restored cluster, as the credentials are kept in the restored data. Restoring into an existing cluster,
+// replacing its data, isn't supported. The user must own the cluster.
+func (svc Service) RestoreBackup(ctx context.Context, user User, clusterID, backup string, target RecoveryTarget,
+	info *metastore.ClusterInfo) (metastore.Operation, error) {
+	source, schedule, err := svc.backupSource(ctx, user, clusterID)
+	if err != nil {
+		return metastore.Operation{}, err
+	}
+	if backup == "" {
+		backup = LatestBackup
+	}
+	if err := target.validate(); err != nil {
+		return metastore.Operation{}, err
+	}
+	info.Owner = user.ID
+	info.Type = "postgres"
+	info.Username = source.Username
+	info.Password = source.Password
+	info.MajVersion = source.MajVersion
+	info.MinVersion = source.MinVersion
+	info.Image = source.Image
+	if info.CPU == 0 && info.Memory == 0 {
+		info.CPU, info.Memory = source.CPU, source.Memory
+	}
+	info.Status = metastore.StatusRunning
+	if err := validateLabels(info.Labels); err != nil {
+		return metastore.Operation{}, err
+	}
+	if _, err := metastore.GetClusterByName(svc.store, info.Name); err == nil {
+		return metastore.Operation{}, dockerservice.ErrDuplicateContainerName
+	}
+	if existing, err := svc.dockerClient.GetContainer(ctx, postgres.PREFIXPGCONTAINER+info.Name); err != nil {
+		return metastore.Operation{}, errors.Wrap(err, "getting container")
+	} else if existing != nil {
+		return metastore.Operation{}, dockerservice.ErrDuplicateContainerName
+	}
+	if info.Image == "" {
+		info.Image = postgres.Engine{}.Image(info.MajVersion, info.MinVersion)
+	}
+	image, err := resolveImage(svc.svcConfig.Registry, info.Image)
+	if err != nil {
+		return metastore.Operation{}, err
+	}
+
+	if !target.isZero() {
+		if backup, err = svc.resolveTarget(ctx, source, schedule.Dest, backup, target); err != nil {
+			return metastore.Operation{}, err
+		}
+	}
+
+	release, err := svc.quotas.reserve(svc.store, user.ID, svc.svcConfig.QuotaFor(user.ID), clusterUsage(*info))
+	if err != nil {
+		return metastore.Operation{}, err
+	}
+	op := metastore.Operation{
+		ID:     uuid.New().String(),
+		Type:   OperationRestore,
+		Owner:  user.ID,
+		Status: metastore.OperationRunning,
+		Step:   "fetching backup",
+		Details: map[string]string{
+			"source_cluster_id": clusterID,
+			"backup":            backup,
+			"name":              info.Name,
+		},
+	}
+	for key, value := range target.details() {
+		op.Details[key] = value
+	}
+	if err := metastore.InsertOperation(svc.store, op); err != nil {
+		release()
+		return metastore.Operation{}, errors.Wrap(err, "saving restore operation")
+	}
+
+	// the restore outlives the request, so it runs with a background context.
+	go func(op metastore.Operation, info metastore.ClusterInfo) {
+		defer release()
+		err := svc.restore(context.Background(), &op, schedule.Dest, backup, target, image, &info)
+		if err != nil {
+			svc.logger.Error("could not restore backup", zap.String("cluster_id", clusterID), zap.String("backup", backup), zap.Error(err))
+			op.Status = metastore.OperationFailed
+			op.Error = err.Error()
+		} else {
+			svc.logger.Info("restored backup", zap.String("cluster_id", info.ClusterID), zap.String("source_cluster_id", clusterID),
+				zap.String("backup", backup))
+			op.Status = metastore.OperationSucceeded
+			op.Step = ""
+		}
+		svc.saveOperation(op)
+	}(op, *info)
+	return op, nil
+}
+
+// GetOperation returns the operation with the given ID. Operations started by other users are reported as missing,
+// unless the user is an admin.
+func (svc Service) GetOperation(ctx context.Context, user User, id string) (metastore.Operation, error) {
+	op, err := metastore.GetOperation(svc.store, id)
+	if errors.Is(err, metastore.ErrOperationNotFound) {
+		return op, ErrNoMatch{id: id}
+	}
+	if err != nil {
+		return op, err
+	}
+	if !user.Admin && op.Owner != user.ID {
+		return metastore.Operation{}, ErrNoMatch{id: id}
+	}
+	return op, nil
+}
+
+// backupSource returns a cluster whose backups are listed or restored, along with its backup schedule.
+func (svc Service) backupSource(ctx context.Context, user User, clusterID string) (metastore.ClusterInfo, metastore.BackupSchedule, error) {
+	cluster, err := svc.GetClusterByID(ctx, user, clusterID)
+	if err != nil {
+		return cluster, metastore.BackupSchedule{}, err
+	}
+	if err := requirePostgres(cluster, "restores"); err != nil {
+		return cluster, metastore.BackupSchedule{}, err
+	}
+	schedule, ok, err := metastore.GetBackupSchedule(svc.store, clusterID)
+	if err != nil {
+		return cluster, schedule, err
+	}
+	// schedules saved by older versions of spinup have no credentials.
+	if !ok || schedule.Spec == "" {
+		return cluster, schedule, ErrNoBackupDestination{ClusterID: clusterID}
+	}
+	return cluster, schedule, nil
+}
+
+// resolveTarget checks that a recovery target lies within the WAL archived after the base backup restored, and returns
+// the name of that backup.
+func (svc Service) resolveTarget(ctx context.Context, source metastore.ClusterInfo, dest metastore.Destination, backup string,
+	target RecoveryTarget) (string, error) {
+	name := PREFIXRESTORECONTAINER + source.Name + "-" + uuid.New().String()[:8]
+	helper, err := startWalgHelper(ctx, svc.dockerClient, name, dest, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "starting wal-g container")
+	}
+	defer removeContainer(svc.dockerClient, svc.logger, helper)
+
+	backups, err := listBaseBackups(ctx, svc.dockerClient, helper)
+	if err != nil {
+		return "", err
+	}
+	out, err := execCommand(ctx, svc.dockerClient, helper, "wal-g", "wal-show", "--detailed-json")
+	if err != nil {
+		return "", errors.Wrap(err, "showing archived WAL")
+	}
+	timelines, err := parseWalTimelines(out)
+	if err != nil {
+		return "", err
+	}
+	base, err := checkTarget(backups, timelines, backup, target, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return base.Name, nil
+}
+
+// restore fetches the backup into the volume of the new cluster and starts the cluster, which recovers from the
+// backup. The cluster is saved once it accepts connections; its containers and volumes are removed if the restore
+// fails.
+func (svc Service) restore(ctx context.Context, op *metastore.Operation, dest metastore.Destination, backup string,
+	target RecoveryTarget, image string, info *metastore.ClusterInfo) error {
+	if err := checkImageDigests(ctx, svc.dockerClient, svc.svcConfig.Registry, image); err != nil {
+		return err
+	}
+	e := postgres.Engine{}
+	walgMount := mount.Mount{Type: mount.TypeVolume, Source: walgVolume(info.Name), Target: walgDir}
+	mounts := []mount.Mount{{Type: mount.TypeVolume, Source: info.Name, Target: e.DataDir()}, walgMount}
+	helper, err := startWalgHelper(ctx, svc.dockerClient, PREFIXRESTORECONTAINER+info.Name, dest, mounts)
+	if err != nil {
+		svc.removeVolumes(info.Name)
+		return errors.Wrap(err, "starting wal-g container")
+	}
+	err = fetchBackup(ctx, svc.dockerClient, helper, dest, backup, info.MajVersion, recoverySettings(target))
+	removeContainer(svc.dockerClient, svc.logger, helper)
+	if err != nil {
+		svc.removeVolumes(info.Name)
+		return err
+	}
+
+	op.Step = "starting cluster"
+	svc.saveOperation(*op)
+	dbContainer, err := engine.NewContainer(svc.dockerClient, e, engine.ContainerProps{
+		Name:      info.Name,
+		Username:  info.Username,
+		Password:  info.Password,
+		Port:      info.Port,
+		Memory:    info.Memory,
+		CPUShares: info.CPU,
+		Image:     image,
+	})
+	if err != nil {
+		svc.removeVolumes(info.Name)
+		return errors.Wrap(err, "creating postgres container")
+	}
+	// postgres fetches WAL from the destination while it recovers, and the file root lets backups be scheduled to
+	// file destinations later.
+	dbMounts := append([]mount.Mount{walgMount}, walgMounts(dest)...)
+	dbContainer.HostConfig.Mounts = addMounts(dbContainer.HostConfig.Mounts, append(dbMounts, fileRootMounts(svc.svcConfig, info.Type)...)...)
+	body, err := dbContainer.Start(ctx, svc.dockerClient)
+	if err != nil {
+		svc.removeVolumes(info.Name)
+		return errors.Wrap(err, "starting postgres container")
+	}
+
+	op.Step = "recovering"
+	svc.saveOperation(*op)
+	readyCtx, cancel := context.WithTimeout(ctx, restoreReadyTimeout)
+	defer cancel()
+	if err := waitReady(readyCtx, svc.dockerClient, dbContainer, e.ReadyCmd(info.Username, info.Password)); err != nil {
+		removeContainer(svc.dockerClient, svc.logger, &dbContainer)
+		svc.removeVolumes(info.Name)
+		return err
+	}
+
+	info.ClusterID = body.ID
+	info.DataMount = info.Name
+	info.Volumes = []string{info.Name, walgVolume(info.Name)}
+	if err := metastore.InsertService(svc.store, *info); err != nil {
+		removeContainer(svc.dockerClient, svc.logger, &dbContainer)
+		svc.removeVolumes(info.Name)
+		return errors.Wrap(err, "saving cluster info to store")
+	}
+	op.ClusterID = info.ClusterID
+	details := map[string]string{
+		"source_cluster_id": op.Details["source_cluster_id"],
+		"backup":            backup,
+		"image":             image,
+		"version":           fmt.Sprintf("%d.%d", info.MajVersion, info.MinVersion),
+	}
+	for key, value := range target.details() {
+		details[key] = value
+	}
+	recordEvent(svc.store, svc.logger, metastore.Event{
+		ClusterID: info.ClusterID,
+		Type:      metastore.EventRestored,
+		Actor:     op.Owner,
+		Details:   details,
+	})
+	if info.Monitoring == "enable" {
+		// the cluster is restored, so failing to monitor it doesn't fail the restore.
+		if err := svc.startMonitoring(ctx, info, dbContainer.Name); err != nil {
+			svc.logger.Error("could not monitor restored cluster", zap.String("cluster_id", info.ClusterID), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// fetchBackup fetches a base backup into the data directory mounted in the helper container, and configures postgres
+// to recover from it with the given settings, fetching WAL with wal-g, which is copied to walgDir along with its
+// configuration.
+func fetchBackup(ctx context.Context, d dockerservice.Docker, helper *dockerservice.Container, dest metastore.Destination, backup string,
+	majVersion int, settings string) error {
+	config, err := json.Marshal(walgConfig(dest))
+	if err != nil {
+		return errors.Wrap(err, "encoding wal-g configuration")
+	}
+	archive, err := tarFiles(tarEntry{name: "walg.json", content: config, mode: 0600, uid: postgresUID})
+	if err != nil {
+		return err
+	}
+	if err := d.Cli.CopyToContainer(ctx, helper.ID, walgDir, archive, types.CopyToContainerOptions{}); err != nil {
+		return errors.Wrap(err, "copying wal-g configuration")
+	}
+	if _, err := execCommand(ctx, d, helper, "sh", "-c", `cp "$(command -v wal-g)" "$1"`, "sh", path.Join(walgDir, "wal-g")); err != nil {
+		return errors.Wrap(err, "copying wal-g")
+	}
+
+	dataDir := postgres.Engine{}.DataDir()
+	if _, err := execCommand(ctx, d, helper, "wal-g", "backup-fetch", dataDir, backup); err != nil {
+		return errors.Wrapf(err, "fetching backup %s", backup)
+	}
+	for _, file := range recoveryFiles(majVersion, settings) {
+		if _, err := execCommand(ctx, d, helper, "sh", "-c", `printf '%s' "$1" >> "$2"`, "sh", file.content, path.Join(dataDir, file.name)); err != nil {
+			return errors.Wrapf(err, "writing %s", file.name)
+		}
+	}
+	return nil
+}
+
+// recoverySettings returns the postgres settings recovering a cluster from its backup destination up to the given
+// target. The cluster is promoted once it reaches the target.
+func recoverySettings(target RecoveryTarget) string {
+	settings := fmt.Sprintf("restore_command = '%s wal-fetch \"%%f\" \"%%p\"'\n", walgCommand())
+	switch {
+	case target.Time != nil:
+		settings += fmt.Sprintf("recovery_target_time = '%s'\n", target.Time.UTC().Format("2006-01-02 15:04:05.999999+00"))
+	case target.LSN != "":
+		settings += fmt.Sprintf("recovery_target_lsn = '%s'\n", target.LSN)
+	case target.Name != "":
+		settings += fmt.Sprintf("recovery_target_name = '%s'\n", strings.ReplaceAll(target.Name, "'", "''"))
+	default:
+		return settings
+	}
+	return settings + "recovery_target_action = 'promote'\n"
+}
+
+type recoveryFile struct {
+	name    string
+	content string
+}
+
+// disableArchiving turns WAL archiving off in restored clusters. The restored data holds the archiving settings of the
+// restored cluster, which would archive the WAL of the new cluster to the destination of the restored one.
+const disableArchiving = "archive_mode = off\n"
+
+// recoveryFiles returns the files of the data directory that make postgres of the given major version start in
+// recovery with the given settings, and the content appended to them. Postgres 12 and later read the settings from
+// postgresql.auto.conf and recover when recovery.signal exists; older versions read them from recovery.conf.
+func recoveryFiles(majVersion int, settings string) []recoveryFile {
+	if majVersion < 12 {
+		return []recoveryFile{
+			{name: "postgresql.auto.conf", content: disableArchiving},
+			{name: "recovery.conf", content: settings},
+		}
+	}
+	return []recoveryFile{
+		{name: "postgresql.auto.conf", content: settings + disableArchiving},
+		{name: "recovery.signal"},
+	}
+}
+
+// walgVolume returns the name of the volume holding wal-g and its configuration for a restored cluster.
+func walgVolume(clusterName string) string {
+	return clusterName + "-walg"
+}
+
+// removeVolumes removes the volumes of a cluster that couldn't be restored.
+func (svc Service) removeVolumes(clusterName string) {
+	for _, name := range []string{clusterName, walgVolume(clusterName)} {
+		if err := dockerservice.RemoveVolume(context.Background(), svc.dockerClient, name); err != nil {
+			svc.logger.Warn("could not remove volume", zap.String("volume", name), zap.Error(err))
+		}
+	}
+}
+
+// saveOperation saves the progress of an operation. Failures are only logged, so that they don't fail the operation.
+func (svc Service) saveOperation(op metastore.Operation) {
+	saveOperation(svc.store, svc.logger, op)
+}
+
+func saveOperation(store metastore.Db, logger *zap.Logger, op metastore.Operation) {
+	if err := metastore.UpdateOperation(store, op); err != nil {
+		logger.Error("could not save operation", zap.String("operation_id", op.ID), zap.Error(err))
+	}
+}
+
+// waitReady waits until the ready command succeeds in the container, or the container stops, e.g. when postgres
+// can't reach its recovery target.
+func waitReady(ctx context.Context, d dockerservice.Docker, c dockerservice.Container, readyCmd []string) error {
+	for {
+		res, err := c.Exec(ctx, d, types.ExecConfig{Cmd: readyCmd})
+		if err == nil && res.ExitCode == 0 {
+			return nil
+		}
+		if data, err := d.Cli.ContainerInspect(ctx, c.ID); err == nil && data.State != nil && !data.State.Running {
+			return errors.Errorf("postgres exited with code %d", data.State.ExitCode)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "waiting for postgres to accept connections")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// listBaseBackups lists the base backups in the destination of a wal-g helper container, oldest first.
+func listBaseBackups(ctx context.Context, d dockerservice.Docker, helper *dockerservice.Container) ([]BaseBackup, error) {
+	out, err := execCommand(ctx, d, helper, "wal-g", "backup-list", "--detail", "--json")
+	if err != nil {
+		return nil, errors.Wrap(err, "listing backups")
+	}
+	return parseBaseBackups(out)
+}
+
+// parseBaseBackups parses the output of wal-g backup-list --json, which is empty when there are no backups.
+func parseBaseBackups(out string) ([]BaseBackup, error) {
+	backups := []BaseBackup{}
+	if strings.TrimSpace(out) == "" {
+		return backups, nil
+	}
+	if err := json.Unmarshal([]byte(out), &backups); err != nil {
+		return nil, errors.Wrap(err, "parsing backup list")
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Time.Before(backups[j].Time)
+	})
+	return backups, nil
+}
+
+// parseWalTimelines parses the output of wal-g wal-show --detailed-json, which is empty when no WAL is archived.
+func parseWalTimelines(out string) ([]walTimeline, error) {
+	timelines := []walTimeline{}
+	if strings.TrimSpace(out) == "" {
+		return timelines, nil
+	}
+	if err := json.Unmarshal([]byte(out), &timelines); err != nil {
+		return nil, errors.Wrap(err, "parsing archived WAL")
+	}
+	return timelines, nil
+}
+
+// checkTarget returns the base backup restored to a recovery target: the given backup, or when restoring the latest
+// backup, the latest one that ended before the target. The WAL from the start of the backup to the target must be
+// archived without gaps on the timeline of the backup. Time targets and restore points can't be located in the WAL,
+// so the whole archive after the backup must be free of gaps for them.
+func checkTarget(backups []BaseBackup, timelines []walTimeline, backup string, target RecoveryTarget, now time.Time) (BaseBackup, error) {
+	if target.Time != nil && target.Time.After(now) {
+		return BaseBackup{}, ErrInvalidRecoveryTarget{Reason: "the recovery target time is in the future"}
+	}
+	var lsn uint64
+	if target.LSN != "" {
+		var err error
+		if lsn, err = parseLSN(target.LSN); err != nil {
+			return BaseBackup{}, ErrInvalidRecoveryTarget{Reason: err.Error()}
+		}
+	}
+	precedes := func(b BaseBackup) bool {
+		switch {
+		case target.Time != nil:
+			return !b.FinishTime.After(*target.Time)
+		case target.LSN != "":
+			return b.FinishLSN <= lsn
+		}
+		return true
+	}
+
+	var base BaseBackup
+	found := false
+	// backups are sorted oldest first.
+	for _, b := range backups {
+		if (backup == LatestBackup && precedes(b)) || b.Name == backup {
+			base, found = b, true
+		}
+	}
+	switch {
+	case !found && backup == LatestBackup:
+		return base, ErrInvalidRecoveryTarget{Reason: "no base backup ended before the recovery target"}
+	case !found:
+		return base, ErrInvalidRecoveryTarget{Reason: fmt.Sprintf("backup '%s' does not exist", backup)}
+	case !precedes(base):
+		return base, ErrInvalidRecoveryTarget{Reason: fmt.Sprintf("the recovery target precedes the end of backup '%s'", backup)}
+	}
+
+	var timeline *walTimeline
+	for i := range timelines {
+		if len(base.WalFileName) == 24 && fmt.Sprintf("%08X", timelines[i].ID) == base.WalFileName[:8] {
+			timeline = &timelines[i]
+		}
+	}
+	if timeline == nil || timeline.EndSegment < base.WalFileName {
+		return base, ErrInvalidRecoveryTarget{Reason: fmt.Sprintf("no WAL is archived after backup '%s'", base.Name)}
+	}
+	end := timeline.EndSegment
+	if target.LSN != "" {
+		end = segmentName(timeline.ID, lsn)
+		if end > timeline.EndSegment {
+			return base, ErrInvalidRecoveryTarget{Reason: fmt.Sprintf("the archived WAL ends in segment %s, before the recovery target", timeline.EndSegment)}
+		}
+	}
+	for _, segment := range timeline.MissingSegments {
+		if segment >= base.WalFileName && segment <= end {
+			return base, ErrInvalidRecoveryTarget{Reason: fmt.Sprintf("WAL segment %s is missing from the archive", segment)}
+		}
+	}
+	return base, nil
+}
+
+// parseLSN parses an LSN in the X/Y format of postgres, where X and Y are the high and low 32 bits in hexadecimal.
+func parseLSN(s string) (uint64, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, errors.Errorf("invalid LSN '%s'", s)
+	}
+	hi, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, errors.Errorf("invalid LSN '%s'", s)
+	}
+	lo, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, errors.Errorf("invalid LSN '%s'", s)
+	}
+	return hi<<32 | lo, nil
+}
+
+// walSegmentSize is the default size of WAL segments, which spinup clusters use.
+const walSegmentSize = 16 * 1024 * 1024
+
+// segmentName returns the name of the WAL segment of a timeline holding an LSN.
+func segmentName(timeline uint32, lsn uint64) string {
+	segment := lsn / walSegmentSize
+	perID := uint64(1<<32) / walSegmentSize
+	return fmt.Sprintf("%08X%08X%08X", timeline, segment/perID, segment%perID)
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spinup-host/spinup/config"
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestRestoreBackup(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var commands [][]string
+	rt := ds.NewMemoryRuntime(ds.WithExecHandler(func(container string, cmd []string) ds.ExecResult {
+		if !strings.HasPrefix(container, PREFIXRESTORECONTAINER) {
+			return ds.SimulatePostgres(container, cmd)
+		}
+		mu.Lock()
+		commands = append(commands, cmd)
+		mu.Unlock()
+		switch {
+		case cmd[0] == "wal-g" && cmd[1] == "backup-list":
+			return ds.ExecResult{Stdout: `[{"backup_name":"base_000000010000000000000004","time":"2024-01-02T03:00:00Z","wal_file_name":"000000010000000000000004",` +
+				`"finish_time":"2024-01-02T03:05:00Z","finish_lsn":67109120},` +
+				`{"backup_name":"base_000000010000000000000002","time":"2024-01-01T03:00:00Z","wal_file_name":"000000010000000000000002",` +
+				`"finish_time":"2024-01-01T03:05:00Z","finish_lsn":33554688}]`}
+		case cmd[0] == "wal-g" && cmd[1] == "wal-show":
+			return ds.ExecResult{Stdout: `[{"id":1,"start_segment":"000000010000000000000001","end_segment":"000000010000000000000009"}]`}
+		case cmd[0] == "wal-g" && cmd[1] == "backup-fetch" && cmd[3] == "missing":
+			return ds.ExecResult{Stderr: "backup 'missing' does not exist\n", ExitCode: 1}
+		}
+		return ds.ExecResult{}
+	}))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	logger, err := newTestLogger()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+	svc := NewService(dc, store, nil, logger, config.Configuration{})
+
+	source := metastore.ClusterInfo{ClusterID: "source-" + testID, Name: "source-" + testID, Owner: testUser.ID, Type: "postgres",
+		Username: "admin", Password: "secret", MajVersion: 14, MinVersion: 5, Port: 15432}
+	require.NoError(t, metastore.InsertService(store, source))
+	unscheduled := metastore.ClusterInfo{ClusterID: "unscheduled-" + testID, Name: "unscheduled-" + testID, Owner: testUser.ID}
+	require.NoError(t, metastore.InsertService(store, unscheduled))
+	dest := metastore.Destination{Type: metastore.DestinationS3, BucketName: "bucket", ApiKeyID: "id", ApiKeySecret: "key"}
+	require.NoError(t, metastore.SetBackupSchedule(store, source.ClusterID, "0 3 * * *", dest))
+
+	waitForOperation := func(t *testing.T, id string) metastore.Operation {
+		var op metastore.Operation
+		require.Eventually(t, func() bool {
+			var err error
+			op, err = svc.GetOperation(ctx, testUser, id)
+			require.NoError(t, err)
+			return op.Status != metastore.OperationRunning
+		}, 5*time.Second, 20*time.Millisecond)
+		return op
+	}
+
+	t.Run("lists the base backups of a cluster", func(t *testing.T) {
+		listings := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			n := 0
+			for _, cmd := range commands {
+				if cmd[0] == "wal-g" && cmd[1] == "backup-list" {
+					n++
+				}
+			}
+			return n
+		}
+		catalog, err := svc.ListBackups(ctx, testUser, source.ClusterID, false)
+		require.NoError(t, err)
+		require.Len(t, catalog.Backups, 2)
+		assert.False(t, catalog.RefreshedAt.IsZero())
+		assert.Equal(t, metastore.CatalogBackup{Name: "base_000000010000000000000002", FinishTime: time.Date(2024, 1, 1, 3, 5, 0, 0, time.UTC),
+			WalStart: "000000010000000000000002", WalEnd: "000000010000000000000002"}, catalog.Backups[0])
+		assert.Equal(t, 1, listings())
+
+		_, err = svc.ListBackups(ctx, testUser, source.ClusterID, false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, listings(), "the catalog is cached")
+		_, err = svc.ListBackups(ctx, testUser, source.ClusterID, true)
+		require.NoError(t, err)
+		assert.Equal(t, 2, listings())
+
+		_, err = svc.ListBackups(ctx, testUser, unscheduled.ClusterID, false)
+		assert.ErrorAs(t, err, &ErrNoBackupDestination{})
+		_, err = svc.ListBackups(ctx, User{ID: "someone-else"}, source.ClusterID, false)
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+	})
+
+	t.Run("restores a backup into a new cluster", func(t *testing.T) {
+		info := &metastore.ClusterInfo{Name: "restored-" + testID, Port: 15433}
+		op, err := svc.RestoreBackup(ctx, testUser, source.ClusterID, "", RecoveryTarget{}, info)
+		require.NoError(t, err)
+		assert.Equal(t, OperationRestore, op.Type)
+		assert.Equal(t, LatestBackup, op.Details["backup"])
+
+		op = waitForOperation(t, op.ID)
+		require.Equal(t, metastore.OperationSucceeded, op.Status, op.Error)
+		restored, err := metastore.GetClusterByID(store, op.ClusterID)
+		require.NoError(t, err)
+		assert.Equal(t, info.Name, restored.Name)
+		assert.Equal(t, "admin", restored.Username)
+		assert.Equal(t, "secret", restored.Password)
+		assert.Equal(t, 14, restored.MajVersion)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Contains(t, commands, []string{"wal-g", "backup-fetch", "/var/lib/postgresql/data", LatestBackup})
+		var recovery []string
+		for _, cmd := range commands {
+			if cmd[0] == "sh" && strings.HasPrefix(cmd[2], "printf") {
+				recovery = append(recovery, cmd[len(cmd)-1])
+			}
+		}
+		assert.Equal(t, []string{"/var/lib/postgresql/data/postgresql.auto.conf", "/var/lib/postgresql/data/recovery.signal"}, recovery)
+
+		c, err := dc.GetContainer(ctx, PREFIXRESTORECONTAINER+info.Name)
+		require.NoError(t, err)
+		assert.Nil(t, c, "the helper container is removed")
+		data, err := rt.ContainerInspect(ctx, op.ClusterID)
+		require.NoError(t, err)
+		var targets []string
+		for _, m := range data.Mounts {
+			targets = append(targets, m.Destination)
+		}
+		assert.ElementsMatch(t, []string{"/var/lib/postgresql/data", walgDir}, targets)
+
+		page, err := metastore.ListEvents(store, metastore.EventFilter{ClusterID: op.ClusterID})
+		require.NoError(t, err)
+		require.Len(t, page.Events, 1)
+		assert.Equal(t, metastore.EventRestored, page.Events[0].Type)
+		assert.Equal(t, source.ClusterID, page.Events[0].Details["source_cluster_id"])
+	})
+
+	t.Run("restores to a point in time", func(t *testing.T) {
+		mu.Lock()
+		commands = nil
+		mu.Unlock()
+		at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		info := &metastore.ClusterInfo{Name: "pitr-" + testID, Port: 15436}
+		op, err := svc.RestoreBackup(ctx, testUser, source.ClusterID, "", RecoveryTarget{Time: &at}, info)
+		require.NoError(t, err)
+		assert.Equal(t, "base_000000010000000000000002", op.Details["backup"], "the latest backup before the target is restored")
+		assert.Equal(t, "2024-01-01T12:00:00Z", op.Details["target_time"])
+
+		op = waitForOperation(t, op.ID)
+		require.Equal(t, metastore.OperationSucceeded, op.Status, op.Error)
+		mu.Lock()
+		defer mu.Unlock()
+		var settings string
+		for _, cmd := range commands {
+			if cmd[0] == "sh" && strings.HasSuffix(cmd[len(cmd)-1], "postgresql.auto.conf") {
+				settings = cmd[len(cmd)-2]
+			}
+		}
+		assert.Contains(t, settings, "recovery_target_time = '2024-01-01 12:00:00+00'\n")
+	})
+
+	t.Run("targets outside the archived WAL are refused", func(t *testing.T) {
+		future := time.Now().Add(time.Hour)
+		for _, target := range []RecoveryTarget{{Time: &future}, {LSN: "0/A000000"}, {LSN: "0/1000000"}, {LSN: "0/1000000", Name: "both"}} {
+			_, err := svc.RestoreBackup(ctx, testUser, source.ClusterID, "", target, &metastore.ClusterInfo{Name: "refused-" + testID, Port: 15437})
+			assert.ErrorAs(t, err, &ErrInvalidRecoveryTarget{}, target)
+		}
+	})
+
+	t.Run("failed restores are cleaned up", func(t *testing.T) {
+		info := &metastore.ClusterInfo{Name: "failed-" + testID, Port: 15434}
+		op, err := svc.RestoreBackup(ctx, testUser, source.ClusterID, "missing", RecoveryTarget{}, info)
+		require.NoError(t, err)
+		op = waitForOperation(t, op.ID)
+		assert.Equal(t, metastore.OperationFailed, op.Status)
+		assert.Contains(t, op.Error, "does not exist")
+
+		_, err = metastore.GetClusterByName(store, info.Name)
+		assert.Error(t, err)
+		for _, volume := range []string{info.Name, walgVolume(info.Name)} {
+			assert.True(t, errdefs.IsNotFound(rt.VolumeRemove(ctx, volume, false)), volume)
+		}
+	})
+
+	t.Run("restores into an existing name are refused", func(t *testing.T) {
+		_, err := svc.RestoreBackup(ctx, testUser, source.ClusterID, "", RecoveryTarget{}, &metastore.ClusterInfo{Name: source.Name, Port: 15435})
+		assert.ErrorIs(t, err, ds.ErrDuplicateContainerName)
+	})
+
+	t.Run("operations of other users are not found", func(t *testing.T) {
+		op := metastore.Operation{ID: uuid.New().String(), Type: OperationRestore, Owner: testUser.ID, Status: metastore.OperationRunning}
+		require.NoError(t, metastore.InsertOperation(store, op))
+		_, err := svc.GetOperation(ctx, User{ID: "someone-else"}, op.ID)
+		assert.ErrorAs(t, err, &ErrNoMatch{})
+		_, err = svc.GetOperation(ctx, User{ID: "admin", Admin: true}, op.ID)
+		assert.NoError(t, err)
+	})
+}
+
+func TestRecoveryFiles(t *testing.T) {
+	restore := "restore_command = '/spinup/walg/wal-g --config /spinup/walg/walg.json wal-fetch \"%f\" \"%p\"'\n"
+	assert.Equal(t, restore, recoverySettings(RecoveryTarget{}))
+	assert.Equal(t, restore+"recovery_target_lsn = '0/3000060'\nrecovery_target_action = 'promote'\n", recoverySettings(RecoveryTarget{LSN: "0/3000060"}))
+	assert.Equal(t, restore+"recovery_target_name = 'before ''drop'''\nrecovery_target_action = 'promote'\n",
+		recoverySettings(RecoveryTarget{Name: "before 'drop'"}))
+
+	assert.Equal(t, []recoveryFile{{name: "postgresql.auto.conf", content: "archive_mode = off\n"}, {name: "recovery.conf", content: restore}},
+		recoveryFiles(11, restore))
+	assert.Equal(t, []recoveryFile{{name: "postgresql.auto.conf", content: restore + "archive_mode = off\n"}, {name: "recovery.signal"}},
+		recoveryFiles(12, restore))
+}
+
+func TestCheckTarget(t *testing.T) {
+	now := time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+	at := func(day, hour int) *time.Time {
+		t := time.Date(2024, 1, day, hour, 0, 0, 0, time.UTC)
+		return &t
+	}
+	backups := []BaseBackup{
+		{Name: "base_000000010000000000000002", WalFileName: "000000010000000000000002", FinishTime: *at(1, 3), FinishLSN: 0x2000100},
+		{Name: "base_000000010000000000000004", WalFileName: "000000010000000000000004", FinishTime: *at(2, 3), FinishLSN: 0x4000100},
+	}
+	timelines := []walTimeline{{ID: 1, StartSegment: "000000010000000000000001", EndSegment: "000000010000000100000009",
+		MissingSegments: []string{"000000010000000000000003"}}}
+
+	tests := []struct {
+		name   string
+		backup string
+		target RecoveryTarget
+		want   string
+		err    bool
+	}{
+		{name: "latest backup before a time", backup: LatestBackup, target: RecoveryTarget{Time: at(2, 12)}, want: "base_000000010000000000000004"},
+		{name: "latest backup before an LSN", backup: LatestBackup, target: RecoveryTarget{LSN: "1/9000000"}, want: "base_000000010000000000000004"},
+		{name: "named backup", backup: "base_000000010000000000000004", target: RecoveryTarget{Name: "before_drop"}, want: "base_000000010000000000000004"},
+		{name: "time in the future", backup: LatestBackup, target: RecoveryTarget{Time: at(4, 0)}, err: true},
+		{name: "time before every backup", backup: LatestBackup, target: RecoveryTarget{Time: at(1, 0)}, err: true},
+		{name: "time before the named backup", backup: "base_000000010000000000000004", target: RecoveryTarget{Time: at(1, 12)}, err: true},
+		{name: "LSN past the archive", backup: LatestBackup, target: RecoveryTarget{LSN: "1/A000000"}, err: true},
+		{name: "missing segment", backup: "base_000000010000000000000002", target: RecoveryTarget{LSN: "0/3000100"}, err: true},
+		{name: "missing backup", backup: "base_000000010000000000000006", target: RecoveryTarget{Name: "before_drop"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkTarget(backups, timelines, tt.backup, tt.target, now)
+			if tt.err {
+				assert.ErrorAs(t, err, &ErrInvalidRecoveryTarget{})
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Name)
+		})
+	}
+
+	assert.Equal(t, "000000010000000100000009", segmentName(1, 0x1090000FF))
+	_, err := parseLSN("3000060")
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+const (
+	defaultStateBackupKeep = 7
+	stateBackupPrefix      = "metastore-"
+	stateBackupSuffix      = ".db"
+	// stateBackupTimeFormat sorts lexically in time order, so the oldest backups are found by name.
+	stateBackupTimeFormat = "20060102T150405Z"
+)
+
+// StateBackup periodically copies a SQLite metastore to a backup directory, keeping the most recent copies.
+type StateBackup struct {
+	store    metastore.Db
+	dir      string
+	interval time.Duration
+	keep     int
+	logger   *zap.Logger
+}
+
+type StateBackupOptions func(backup *StateBackup)
+
+// WithStateBackupKeep sets how many backups are kept. Values below 1 keep the default.
+func WithStateBackupKeep(keep int) StateBackupOptions {
+	return func(backup *StateBackup) {
+		if keep > 0 {
+			backup.keep = keep
+		}
+	}
+}
+
+func NewStateBackup(store metastore.Db, dir string, interval time.Duration, logger *zap.Logger, opts ...StateBackupOptions) *StateBackup {
+	b := &StateBackup{
+		store:    store,
+		dir:      dir,
+		interval: interval,
+		keep:     defaultStateBackupKeep,
+		logger:   logger,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Run backs up the metastore every interval until the context is cancelled. The first backup is taken after one
+// interval, so that restarting spinup doesn't push older backups out.
+func (b *StateBackup) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		path, err := b.backup(time.Now())
+		if err != nil {
+			b.logger.Error("could not back up metastore", zap.Error(err))
+			continue
+		}
+		b.logger.Info("backed up metastore", zap.String("path", path))
+	}
+}
+
+// backup writes a backup of the metastore named after the given time and removes the backups beyond keep.
+func (b *StateBackup) backup(now time.Time) (string, error) {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return "", errors.Wrap(err, "creating metastore backup directory")
+	}
+	path := filepath.Join(b.dir, stateBackupPrefix+now.UTC().Format(stateBackupTimeFormat)+stateBackupSuffix)
+	if err := metastore.BackupFile(b.store, path); err != nil {
+		return "", err
+	}
+	return path, b.prune()
+}
+
+func (b *StateBackup) prune() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return errors.Wrap(err, "listing metastore backups")
+	}
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, stateBackupPrefix) && strings.HasSuffix(name, stateBackupSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > b.keep {
+		if err := os.Remove(filepath.Join(b.dir, backups[0])); err != nil {
+			return errors.Wrap(err, "removing metastore backup")
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestStateBackup(t *testing.T) {
+	testID := uuid.New().String()
+	store, path, err := newTestStore(testID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.Remove(path)
+	})
+	require.NoError(t, metastore.InsertService(store, metastore.ClusterInfo{
+		ClusterID: "backed-up",
+		Name:      "backed-up",
+		Owner:     testUser.ID,
+	}))
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	b := NewStateBackup(store, dir, time.Hour, zap.NewNop(), WithStateBackupKeep(2))
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 3; i++ {
+		p, err := b.backup(start.Add(time.Duration(i) * time.Hour))
+		require.NoError(t, err)
+		paths = append(paths, p)
+	}
+	assert.Equal(t, filepath.Join(dir, "metastore-20240101T000000Z.db"), paths[0])
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"metastore-20240101T010000Z.db", "metastore-20240101T020000Z.db"}, names)
+
+	backup, err := metastore.NewDb(paths[2])
+	require.NoError(t, err)
+	cluster, err := metastore.GetClusterByID(backup, "backed-up")
+	require.NoError(t, err)
+	assert.Equal(t, "backed-up", cluster.Name)
+}
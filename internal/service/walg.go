@@ -0,0 +1,375 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/config"
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+const (
+	// PREFIXWALGCONTAINER is the prefix of the helper containers wal-g is copied from into postgres containers.
+	PREFIXWALGCONTAINER = "spinup-pg-walg-"
+
+	// walgDir is where the wal-g binary and its configuration are kept in postgres containers, for postgres to archive
+	// WAL with, and to fetch archived WAL with while it recovers.
+	walgDir = "/spinup/walg"
+	// postgresUID is the ID of the postgres user and group of the postgres image, which must be able to read the wal-g
+	// configuration.
+	postgresUID = 999
+)
+
+// ErrInvalidDestination is returned when backups are scheduled to a destination that is incomplete, or that wal-g
+// can't reach.
+type ErrInvalidDestination struct {
+	Reason string
+}
+
+func (e ErrInvalidDestination) Error() string {
+	return "invalid backup destination: " + e.Reason
+}
+
+// validateDestination checks that a backup destination has the settings its type needs.
+func validateDestination(dest metastore.Destination) error {
+	switch dest.Type {
+	case metastore.DestinationS3:
+		if dest.ApiKeyID == "" || dest.ApiKeySecret == "" {
+			return ErrInvalidDestination{Reason: "api key id and api key secret are mandatory"}
+		}
+	case metastore.DestinationGCS:
+		if !json.Valid([]byte(dest.ApiKeySecret)) {
+			return ErrInvalidDestination{Reason: "api key secret must be a service account key, in JSON"}
+		}
+	case metastore.DestinationAzure:
+		if dest.ApiKeyID == "" || dest.ApiKeySecret == "" {
+			return ErrInvalidDestination{Reason: "api key id (the storage account) and api key secret are mandatory"}
+		}
+	case metastore.DestinationFile:
+		if !path.IsAbs(dest.Path) {
+			return ErrInvalidDestination{Reason: "path must be an absolute path"}
+		}
+		return nil
+	default:
+		return ErrInvalidDestination{Reason: fmt.Sprintf("unknown type '%s', expected one of %s, %s, %s or %s", dest.Type,
+			metastore.DestinationS3, metastore.DestinationGCS, metastore.DestinationAzure, metastore.DestinationFile)}
+	}
+	if dest.BucketName == "" {
+		return ErrInvalidDestination{Reason: "bucket name is mandatory"}
+	}
+	if dest.Type != metastore.DestinationS3 && (dest.Endpoint != "" || dest.Region != "" || dest.ForcePathStyle) {
+		return ErrInvalidDestination{Reason: "endpoint, region and path style are only supported by s3 destinations"}
+	}
+	return nil
+}
+
+// checkDestination checks that wal-g reaches a backup destination, by listing its backups from a helper container.
+func checkDestination(ctx context.Context, d dockerservice.Docker, logger *zap.Logger, clusterName string, dest metastore.Destination) error {
+	helper, err := startWalgHelper(ctx, d, PREFIXWALGCONTAINER+clusterName+"-"+uuid.New().String()[:8], dest, nil)
+	if err != nil {
+		if dest.Type == metastore.DestinationFile {
+			// docker refuses to mount directories that don't exist.
+			return ErrInvalidDestination{Reason: fmt.Sprintf("could not mount %s: %v", dest.Path, err)}
+		}
+		return errors.Wrap(err, "starting wal-g container")
+	}
+	defer removeContainer(d, logger, helper)
+	if _, err := execCommand(ctx, d, helper, "wal-g", "backup-list", "--json"); err != nil {
+		return ErrInvalidDestination{Reason: fmt.Sprintf("could not reach the destination: %v", err)}
+	}
+	return nil
+}
+
+// walgConfig returns the wal-g settings of a backup destination.
+func walgConfig(dest metastore.Destination) map[string]string {
+	prefix := path.Join(dest.BucketName, dest.Path)
+	switch dest.Type {
+	case metastore.DestinationGCS:
+		return map[string]string{
+			"WALG_GS_PREFIX":                 "gs://" + prefix,
+			"GOOGLE_APPLICATION_CREDENTIALS": gcsKeyPath(dest),
+		}
+	case metastore.DestinationAzure:
+		return map[string]string{
+			"WALG_AZ_PREFIX":           "azure://" + prefix,
+			"AZURE_STORAGE_ACCOUNT":    dest.ApiKeyID,
+			"AZURE_STORAGE_ACCESS_KEY": dest.ApiKeySecret,
+		}
+	case metastore.DestinationFile:
+		return map[string]string{"WALG_FILE_PREFIX": dest.Path}
+	}
+	config := map[string]string{
+		"AWS_ACCESS_KEY_ID":     dest.ApiKeyID,
+		"AWS_SECRET_ACCESS_KEY": dest.ApiKeySecret,
+		"WALG_S3_PREFIX":        "s3://" + prefix,
+	}
+	if dest.Endpoint != "" {
+		config["AWS_ENDPOINT"] = dest.Endpoint
+	}
+	if dest.Region != "" {
+		config["AWS_REGION"] = dest.Region
+	}
+	if dest.ForcePathStyle {
+		config["AWS_S3_FORCE_PATH_STYLE"] = "true"
+	}
+	return config
+}
+
+// walgEnv returns the wal-g settings of a backup destination as container environment variables.
+func walgEnv(dest metastore.Destination) []string {
+	var env []string
+	for key, value := range walgConfig(dest) {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// walgFiles returns the files the wal-g settings of a backup destination refer to, relative to the root of the
+// container: the service account key of GCS destinations, which wal-g only reads from a file.
+func walgFiles(dest metastore.Destination) []tarEntry {
+	if dest.Type != metastore.DestinationGCS {
+		return nil
+	}
+	return []tarEntry{{name: strings.TrimPrefix(gcsKeyPath(dest), "/"), content: []byte(dest.ApiKeySecret), mode: 0600, uid: postgresUID}}
+}
+
+// walgMounts returns the mounts wal-g needs to reach a backup destination: the directory of file destinations, at the
+// same path.
+func walgMounts(dest metastore.Destination) []mount.Mount {
+	if dest.Type != metastore.DestinationFile {
+		return nil
+	}
+	return []mount.Mount{{Type: mount.TypeBind, Source: dest.Path, Target: dest.Path}}
+}
+
+// fileRootMounts returns the mount of the file root of backups (see config.BackupsConfig) in the containers of
+// clusters of the given type, when the engine supports backups and a file root is configured.
+func fileRootMounts(cfg config.Configuration, clusterType string) []mount.Mount {
+	if cfg.Backups.FileRoot == "" || clusterType != "postgres" {
+		return nil
+	}
+	root := path.Clean(cfg.Backups.FileRoot)
+	return []mount.Mount{{Type: mount.TypeBind, Source: root, Target: root}}
+}
+
+// addMounts adds mounts to those of a container, skipping the ones whose target is already mounted.
+func addMounts(mounts []mount.Mount, more ...mount.Mount) []mount.Mount {
+	targets := map[string]bool{}
+	for _, m := range mounts {
+		targets[m.Target] = true
+	}
+	for _, m := range more {
+		if !targets[m.Target] {
+			mounts = append(mounts, m)
+			targets[m.Target] = true
+		}
+	}
+	return mounts
+}
+
+// gcsKeyPath is where the service account key of a GCS destination is kept in containers. The file is named after
+// its content, so that the environment of containers tells which key they use.
+func gcsKeyPath(dest metastore.Destination) string {
+	sum := sha256.Sum256([]byte(dest.ApiKeySecret))
+	return path.Join(walgDir, fmt.Sprintf("gcs-%x.json", sum[:6]))
+}
+
+// hasMount reports whether a directory is mounted in a container, or is in a directory mounted in it.
+func hasMount(ctx context.Context, d dockerservice.Docker, c *dockerservice.Container, dir string) (bool, error) {
+	data, err := d.Cli.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return false, errors.Wrap(err, "inspecting container")
+	}
+	dir = path.Clean(dir)
+	for _, m := range data.Mounts {
+		target := path.Clean(m.Destination)
+		if dir == target || strings.HasPrefix(dir, strings.TrimSuffix(target, "/")+"/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// walgCommand is the wal-g command run by postgres, reading its configuration from walgDir.
+func walgCommand() string {
+	return path.Join(walgDir, "wal-g") + " --config " + path.Join(walgDir, "walg.json")
+}
+
+// archiveCommand is the archive_command of clusters with backups, pushing each WAL segment to the backup
+// destination.
+func archiveCommand() string {
+	return walgCommand() + ` wal-push "%p"`
+}
+
+// installWalg copies wal-g and the configuration of the backup destination to walgDir in a postgres container. The
+// binary is read from a helper container of the walg image. The directory of file destinations must be mounted in the
+// container: spinup mounts the file root of backups in the clusters it creates and restores, but can't add mounts to
+// existing containers.
+func installWalg(ctx context.Context, d dockerservice.Docker, logger *zap.Logger, pg *dockerservice.Container, clusterName string,
+	dest metastore.Destination) error {
+	if dest.Type == metastore.DestinationFile {
+		mounted, err := hasMount(ctx, d, pg, dest.Path)
+		if err != nil {
+			return err
+		}
+		if !mounted {
+			return ErrInvalidDestination{Reason: fmt.Sprintf("%s must be mounted in the cluster's container for postgres to archive WAL to it, "+
+				"e.g. by being in the backups.file_root directory when the cluster is created", dest.Path)}
+		}
+	}
+	helper, err := startWalgHelper(ctx, d, PREFIXWALGCONTAINER+clusterName+"-"+uuid.New().String()[:8], dest, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting wal-g container")
+	}
+	defer removeContainer(d, logger, helper)
+	binary, err := execCommand(ctx, d, helper, "sh", "-c", `cat "$(command -v wal-g)"`)
+	if err != nil {
+		return errors.Wrap(err, "reading wal-g")
+	}
+	config, err := json.Marshal(walgConfig(dest))
+	if err != nil {
+		return errors.Wrap(err, "encoding wal-g configuration")
+	}
+
+	// the archive is extracted at the root, which creates walgDir.
+	dir := strings.TrimPrefix(walgDir, "/")
+	archive, err := tarFiles(append([]tarEntry{
+		{name: path.Join(dir, "wal-g"), content: []byte(binary), mode: 0755},
+		{name: path.Join(dir, "walg.json"), content: config, mode: 0600, uid: postgresUID},
+	}, walgFiles(dest)...)...)
+	if err != nil {
+		return err
+	}
+	if err := d.Cli.CopyToContainer(ctx, pg.ID, "/", archive, types.CopyToContainerOptions{}); err != nil {
+		return errors.Wrap(err, "copying wal-g")
+	}
+	return nil
+}
+
+// enableArchiving makes a postgres cluster archive its WAL to the backup destination with wal-g, for point-in-time
+// recovery. Turning archive_mode on restarts the cluster; later calls only update the wal-g configuration.
+func enableArchiving(ctx context.Context, d dockerservice.Docker, logger *zap.Logger, pg *dockerservice.Container,
+	cluster metastore.ClusterInfo, dest metastore.Destination) error {
+	if err := installWalg(ctx, d, logger, pg, cluster.Name, dest); err != nil {
+		return err
+	}
+	psql := func(args ...string) (string, error) {
+		return execCommand(ctx, d, pg, append([]string{"psql", "-U", cluster.Username, "-d", "postgres", "-tA"}, args...)...)
+	}
+	mode, err := psql("-c", "show archive_mode")
+	if err != nil {
+		return errors.Wrap(err, "reading archive_mode")
+	}
+	// each -c runs in its own transaction, as alter system can't run in a transaction block.
+	if _, err := psql(
+		"-c", "alter system set archive_mode = 'on'",
+		"-c", fmt.Sprintf("alter system set archive_command = '%s'", archiveCommand()),
+		"-c", "select pg_reload_conf()",
+	); err != nil {
+		return errors.Wrap(err, "configuring WAL archiving")
+	}
+	if strings.TrimSpace(mode) == "on" {
+		return nil
+	}
+
+	logger.Info("restarting cluster to turn WAL archiving on", zap.String("cluster_id", cluster.ClusterID))
+	if err := pg.Restart(ctx, d); err != nil {
+		return errors.Wrap(err, "restarting postgres")
+	}
+	return waitReady(ctx, d, *pg, []string{"pg_isready", "-h", "localhost", "-U", cluster.Username})
+}
+
+// startWalgHelper starts a container of the walg image that idles, for wal-g commands to be executed in, with the
+// settings of the given backup destination.
+func startWalgHelper(ctx context.Context, d dockerservice.Docker, name string, dest metastore.Destination, mounts []mount.Mount) (*dockerservice.Container, error) {
+	helper := dockerservice.NewContainer(
+		name,
+		container.Config{
+			Image:      WalgImage,
+			Env:        walgEnv(dest),
+			Entrypoint: []string{"sleep"},
+			Cmd:        []string{"infinity"},
+		},
+		container.HostConfig{NetworkMode: "default", Mounts: append(walgMounts(dest), mounts...)},
+		network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+			d.NetworkName: {},
+		}},
+	)
+	if files := walgFiles(dest); len(files) > 0 {
+		archive, err := tarFiles(files...)
+		if err != nil {
+			return nil, err
+		}
+		helper.Files = archive
+	}
+	if _, err := helper.Start(ctx, d); err != nil {
+		return nil, err
+	}
+	return &helper, nil
+}
+
+// removeContainer stops and removes a container. Failures are only logged, as the container is no longer needed.
+func removeContainer(d dockerservice.Docker, logger *zap.Logger, c *dockerservice.Container) {
+	ctx := context.Background()
+	if err := c.Stop(ctx, d, types.ContainerStartOptions{}); err != nil {
+		logger.Warn("could not stop container", zap.String("container", c.Name), zap.Error(err))
+	}
+	if err := c.Remove(ctx, d); err != nil {
+		logger.Warn("could not remove container", zap.String("container", c.Name), zap.Error(err))
+	}
+}
+
+// execCommand executes a command in a container and returns its output, or an error if it exits with a non-zero code.
+func execCommand(ctx context.Context, d dockerservice.Docker, c *dockerservice.Container, cmd ...string) (string, error) {
+	res, err := c.Exec(ctx, d, types.ExecConfig{Cmd: cmd})
+	if err != nil {
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return "", errors.Errorf("%s exited with code %d: %s", cmd[0], res.ExitCode, strings.TrimSpace(res.Stderr))
+	}
+	return res.Stdout, nil
+}
+
+type tarEntry struct {
+	name    string
+	content []byte
+	mode    int64
+	uid     int // owner and group of the file
+}
+
+// tarFiles returns a tar archive holding the given files, for CopyToContainer.
+func tarFiles(files ...tarEntry) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: f.mode, Size: int64(len(f.content)), Uid: f.uid, Gid: f.uid}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
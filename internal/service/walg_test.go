@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	ds "github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+func TestEnableArchiving(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var statements []string
+	archiveMode := "off"
+	rt := ds.NewMemoryRuntime(ds.WithExecHandler(func(container string, cmd []string) ds.ExecResult {
+		if strings.HasPrefix(container, PREFIXWALGCONTAINER) {
+			return ds.ExecResult{Stdout: "wal-g binary"}
+		}
+		if cmd[0] != "psql" {
+			return ds.SimulatePostgres(container, cmd)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if cmd[len(cmd)-1] == "show archive_mode" {
+			return ds.ExecResult{Stdout: archiveMode + "\n"}
+		}
+		for i, arg := range cmd {
+			if arg == "-c" {
+				statements = append(statements, cmd[i+1])
+			}
+		}
+		return ds.ExecResult{}
+	}))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+	pg := ds.NewContainer("spinup-postgres-"+testID, container.Config{Image: "postgres:14"}, container.HostConfig{}, network.NetworkingConfig{})
+	_, err = pg.Start(ctx, dc)
+	require.NoError(t, err)
+
+	cluster := metastore.ClusterInfo{ClusterID: pg.ID, Name: testID, Username: "admin"}
+	dest := metastore.Destination{Type: metastore.DestinationS3, BucketName: "bucket", ApiKeyID: "id", ApiKeySecret: "key"}
+	require.NoError(t, enableArchiving(ctx, dc, zap.NewNop(), &pg, cluster, dest))
+
+	binary, ok := rt.ReadFile(pg.ID, "/spinup/walg/wal-g")
+	require.True(t, ok)
+	assert.Equal(t, "wal-g binary", string(binary))
+	config, ok := rt.ReadFile(pg.ID, "/spinup/walg/walg.json")
+	require.True(t, ok)
+	var settings map[string]string
+	require.NoError(t, json.Unmarshal(config, &settings))
+	assert.Equal(t, "s3://bucket", settings["WALG_S3_PREFIX"])
+	assert.Contains(t, statements, `alter system set archive_command = '/spinup/walg/wal-g --config /spinup/walg/walg.json wal-push "%p"'`)
+
+	data, err := rt.ContainerInspect(ctx, pg.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, data.RestartCount, "turning archive_mode on restarts the cluster")
+
+	t.Run("clusters archiving already aren't restarted", func(t *testing.T) {
+		mu.Lock()
+		archiveMode = "on"
+		mu.Unlock()
+		require.NoError(t, enableArchiving(ctx, dc, zap.NewNop(), &pg, cluster, dest))
+		data, err := rt.ContainerInspect(ctx, pg.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, data.RestartCount)
+	})
+
+	t.Run("service account keys of GCS destinations are copied", func(t *testing.T) {
+		gcs := metastore.Destination{Type: metastore.DestinationGCS, BucketName: "bucket", ApiKeySecret: `{"type": "service_account"}`}
+		require.NoError(t, enableArchiving(ctx, dc, zap.NewNop(), &pg, cluster, gcs))
+		key, ok := rt.ReadFile(pg.ID, gcsKeyPath(gcs))
+		require.True(t, ok)
+		assert.Equal(t, gcs.ApiKeySecret, string(key))
+	})
+
+	t.Run("file destinations must be mounted in the cluster's container", func(t *testing.T) {
+		file := metastore.Destination{Type: metastore.DestinationFile, Path: "/mnt/backups"}
+		err := enableArchiving(ctx, dc, zap.NewNop(), &pg, cluster, file)
+		assert.ErrorAs(t, err, &ErrInvalidDestination{})
+	})
+}
+
+func TestWalgConfig(t *testing.T) {
+	gcs := metastore.Destination{Type: metastore.DestinationGCS, BucketName: "bucket", Path: "spinup", ApiKeySecret: `{"type": "service_account"}`}
+	tests := []struct {
+		name string
+		dest metastore.Destination
+		want map[string]string
+	}{
+		{
+			name: "s3",
+			dest: metastore.Destination{Type: metastore.DestinationS3, BucketName: "bucket", ApiKeyID: "id", ApiKeySecret: "key"},
+			want: map[string]string{"WALG_S3_PREFIX": "s3://bucket", "AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "key"},
+		},
+		{
+			name: "s3-compatible",
+			dest: metastore.Destination{Type: metastore.DestinationS3, BucketName: "bucket", Path: "spinup/", ApiKeyID: "id", ApiKeySecret: "key",
+				Endpoint: "http://minio:9000", Region: "us-east-1", ForcePathStyle: true},
+			want: map[string]string{"WALG_S3_PREFIX": "s3://bucket/spinup", "AWS_ACCESS_KEY_ID": "id", "AWS_SECRET_ACCESS_KEY": "key",
+				"AWS_ENDPOINT": "http://minio:9000", "AWS_REGION": "us-east-1", "AWS_S3_FORCE_PATH_STYLE": "true"},
+		},
+		{
+			name: "gcs",
+			dest: gcs,
+			want: map[string]string{"WALG_GS_PREFIX": "gs://bucket/spinup", "GOOGLE_APPLICATION_CREDENTIALS": gcsKeyPath(gcs)},
+		},
+		{
+			name: "azure",
+			dest: metastore.Destination{Type: metastore.DestinationAzure, BucketName: "container", ApiKeyID: "account", ApiKeySecret: "key"},
+			want: map[string]string{"WALG_AZ_PREFIX": "azure://container", "AZURE_STORAGE_ACCOUNT": "account", "AZURE_STORAGE_ACCESS_KEY": "key"},
+		},
+		{
+			name: "file",
+			dest: metastore.Destination{Type: metastore.DestinationFile, Path: "/mnt/backups"},
+			want: map[string]string{"WALG_FILE_PREFIX": "/mnt/backups"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, walgConfig(tt.dest))
+			assert.NoError(t, validateDestination(tt.dest))
+		})
+	}
+
+	assert.NotEqual(t, gcsKeyPath(gcs), gcsKeyPath(metastore.Destination{ApiKeySecret: "{}"}), "keys are named after their content")
+	assert.Len(t, walgFiles(gcs), 1)
+	assert.Equal(t, "/mnt/backups", walgMounts(metastore.Destination{Type: metastore.DestinationFile, Path: "/mnt/backups"})[0].Source)
+}
+
+func TestValidateDestination(t *testing.T) {
+	for _, dest := range []metastore.Destination{
+		{Type: "ftp", BucketName: "bucket"},
+		{Type: metastore.DestinationS3, BucketName: "bucket"},
+		{Type: metastore.DestinationS3, ApiKeyID: "id", ApiKeySecret: "key"},
+		{Type: metastore.DestinationGCS, BucketName: "bucket", ApiKeySecret: "not json"},
+		{Type: metastore.DestinationAzure, BucketName: "container", ApiKeySecret: "key"},
+		{Type: metastore.DestinationAzure, BucketName: "container", ApiKeyID: "account", ApiKeySecret: "key", Endpoint: "http://azurite"},
+		{Type: metastore.DestinationFile, Path: "backups"},
+	} {
+		assert.ErrorAs(t, validateDestination(dest), &ErrInvalidDestination{}, "%+v", dest)
+	}
+}
+
+func TestCheckDestination(t *testing.T) {
+	testID := uuid.New().String()
+	ctx := context.Background()
+	var mu sync.Mutex
+	reachable := true
+	rt := ds.NewMemoryRuntime(ds.WithExecHandler(func(container string, cmd []string) ds.ExecResult {
+		mu.Lock()
+		defer mu.Unlock()
+		if !reachable {
+			return ds.ExecResult{Stderr: "AccessDenied: Access Denied\n", ExitCode: 1}
+		}
+		return ds.ExecResult{}
+	}))
+	dc := ds.NewDockerWithRuntime(testID, rt)
+	_, err := dc.CreateNetwork(ctx)
+	require.NoError(t, err)
+
+	dest := metastore.Destination{Type: metastore.DestinationS3, BucketName: "bucket", ApiKeyID: "id", ApiKeySecret: "key"}
+	require.NoError(t, checkDestination(ctx, dc, zap.NewNop(), testID, dest))
+
+	mu.Lock()
+	reachable = false
+	mu.Unlock()
+	err = checkDestination(ctx, dc, zap.NewNop(), testID, dest)
+	assert.ErrorAs(t, err, &ErrInvalidDestination{})
+	assert.Contains(t, err.Error(), "Access Denied")
+
+	containers, err := rt.ContainerList(ctx, types.ContainerListOptions{All: true})
+	require.NoError(t, err)
+	assert.Empty(t, containers, "helper containers are removed")
+}
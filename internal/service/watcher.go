@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/spinup-host/spinup/internal/dockerservice"
+	"github.com/spinup-host/spinup/internal/metastore"
+)
+
+const defaultWatchInterval = 30 * time.Second
+
+// ContainerWatcher periodically checks that the containers of running clusters are still running, and records a
+// container_died event in the history of clusters whose container exited without spinup stopping it.
+type ContainerWatcher struct {
+	store        metastore.Db
+	dockerClient dockerservice.Docker
+	interval     time.Duration
+	logger       *zap.Logger
+}
+
+type ContainerWatcherOptions func(w *ContainerWatcher)
+
+// WithWatchInterval sets how often the containers of running clusters are checked.
+func WithWatchInterval(interval time.Duration) ContainerWatcherOptions {
+	return func(w *ContainerWatcher) {
+		w.interval = interval
+	}
+}
+
+func NewContainerWatcher(svc Service, opts ...ContainerWatcherOptions) *ContainerWatcher {
+	w := &ContainerWatcher{
+		store:        svc.store,
+		dockerClient: svc.dockerClient,
+		interval:     defaultWatchInterval,
+		logger:       svc.logger,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Run checks the containers of running clusters every interval until the context is cancelled.
+func (w *ContainerWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check records an event for each running cluster whose container has exited since the last check.
+func (w *ContainerWatcher) check(ctx context.Context) {
+	page, err := metastore.ListClusters(w.store, metastore.ClusterFilter{Status: metastore.StatusRunning})
+	if err != nil {
+		w.logger.Error("could not list running clusters", zap.Error(err))
+		return
+	}
+
+	for _, cluster := range page.Clusters {
+		if err := w.checkCluster(ctx, cluster); err != nil {
+			w.logger.Warn("could not check cluster container", zap.String("cluster_id", cluster.ClusterID), zap.Error(err))
+		}
+	}
+}
+
+func (w *ContainerWatcher) checkCluster(ctx context.Context, cluster metastore.ClusterInfo) error {
+	name, err := containerName(cluster)
+	if err != nil {
+		return err
+	}
+	c, err := w.dockerClient.GetContainer(ctx, name)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		// the container is removed before the cluster when a cluster is deleted.
+		return nil
+	}
+	data, err := w.dockerClient.Cli.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return errors.Wrap(err, "inspecting container")
+	}
+	if data.State == nil || data.State.Running || data.State.Status == "created" {
+		return nil
+	}
+	// each exit is only recorded once, including across restarts of spinup.
+	last, ok, err := metastore.LastEvent(w.store, cluster.ClusterID, metastore.EventContainerDied)
+	if err != nil {
+		return err
+	}
+	if ok && last.Details["finished_at"] == data.State.FinishedAt {
+		return nil
+	}
+
+	// the cluster may have been stopped or deleted by spinup after it was listed.
+	current, err := metastore.GetClusterByID(w.store, cluster.ClusterID)
+	if errors.Is(err, metastore.ErrClusterNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.Status != metastore.StatusRunning {
+		return nil
+	}
+
+	w.logger.Warn("cluster container died",
+		zap.String("cluster_id", cluster.ClusterID),
+		zap.String("name", cluster.Name),
+		zap.Int("exit_code", data.State.ExitCode),
+	)
+	details := map[string]string{
+		"container":   name,
+		"exit_code":   strconv.Itoa(data.State.ExitCode),
+		"finished_at": data.State.FinishedAt,
+	}
+	if data.State.OOMKilled {
+		details["oom_killed"] = "true"
+	}
+	if data.State.Error != "" {
+		details["error"] = data.State.Error
+	}
+	recordEvent(w.store, w.logger, metastore.Event{
+		ClusterID: cluster.ClusterID,
+		Type:      metastore.EventContainerDied,
+		Actor:     systemUser.ID,
+		Details:   details,
+	})
+	return nil
+}
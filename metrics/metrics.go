@@ -3,7 +3,6 @@ package metrics
 import (
 	"fmt"
 	"net/http"
-	"path/filepath"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,8 +19,7 @@ type MetricsHandler struct {
 }
 
 func NewMetricsHandler(cfg config.Configuration) (MetricsHandler, error) {
-	path := filepath.Join(cfg.Common.ProjectDir, "metastore.db")
-	db, err := metastore.NewDb(path)
+	db, err := metastore.Open(cfg.MetastoreDSN())
 	if err != nil {
 		return MetricsHandler{}, err
 	}
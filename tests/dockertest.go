@@ -33,6 +33,17 @@ func NewDockerTest(ctx context.Context, networkName string) (DockerTest, error)
 	}, nil
 }
 
+// NewMemoryDockerTest returns a DockerTest backed by an in-memory runtime, for tests that don't need a docker daemon.
+func NewMemoryDockerTest(ctx context.Context, networkName string) (DockerTest, error) {
+	dc := ds.NewDockerWithRuntime(networkName, ds.NewMemoryRuntime())
+	if _, err := dc.CreateNetwork(ctx); err != nil {
+		return DockerTest{}, errors.Wrap(err, "create network")
+	}
+	return DockerTest{
+		Docker: dc,
+	}, nil
+}
+
 // Cleanup removes all containers and volumes in the docker network, and removes the network itself.
 func (dt DockerTest) Cleanup() error {
 	ctx := context.Background()